@@ -135,3 +135,122 @@ func getAttributes(rawInput string) []Attribute {
 
 	return list
 }
+
+// AttributeSpan describes an attribute together with its location inside of
+// the raw text of an element token.
+type AttributeSpan struct {
+	Attribute
+	// Start and End are the offsets of the complete attribute, from the
+	// start of the name to the end of the value including a closing quote.
+	Start int
+	End   int
+	// ValueStart and ValueEnd are the offsets of the value without quotes.
+	ValueStart int
+	ValueEnd   int
+	// Quote is the quote character used for the value or 0, if the value is
+	// unquoted.
+	Quote byte
+}
+
+func getAttributeSpans(raw string) []AttributeSpan {
+	list := []AttributeSpan{}
+
+	end := len(raw)
+	if end > 0 && raw[end-1] == '>' {
+		end--
+		if end > 0 && raw[end-1] == '/' {
+			end--
+		}
+	}
+
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+	}
+
+	// skip the opening bracket and element name
+	pos := 1
+	for pos < end && !isSpace(raw[pos]) {
+		pos++
+	}
+
+	for {
+		for pos < end && isSpace(raw[pos]) {
+			pos++
+		}
+		if pos >= end {
+			break
+		}
+
+		a := AttributeSpan{Start: pos}
+		for pos < end && !isSpace(raw[pos]) && raw[pos] != '=' {
+			pos++
+		}
+		a.Name = raw[a.Start:pos]
+		a.ValueStart, a.ValueEnd, a.End = pos, pos, pos
+
+		eq := pos
+		for eq < end && isSpace(raw[eq]) {
+			eq++
+		}
+		if eq >= end || raw[eq] != '=' {
+			list = append(list, a)
+			continue
+		}
+
+		pos = eq + 1
+		for pos < end && isSpace(raw[pos]) {
+			pos++
+		}
+
+		if pos < end && (raw[pos] == '"' || raw[pos] == '\'') {
+			a.Quote = raw[pos]
+			pos++
+			a.ValueStart = pos
+			for pos < end && raw[pos] != a.Quote {
+				pos++
+			}
+			a.ValueEnd = pos
+			if pos < end {
+				pos++
+			}
+		} else {
+			a.ValueStart = pos
+			for pos < end && !isSpace(raw[pos]) {
+				pos++
+			}
+			a.ValueEnd = pos
+		}
+
+		a.Content = raw[a.ValueStart:a.ValueEnd]
+		a.End = pos
+		list = append(list, a)
+	}
+
+	return list
+}
+
+func setAttribute(raw, name, value string) string {
+	for _, a := range getAttributeSpans(raw) {
+		if a.Name != name {
+			continue
+		}
+
+		if a.Quote == 0 {
+			return raw[:a.Start] + a.Name + `="` + EscapeAttribute(value, '"') + `"` + raw[a.End:]
+		}
+
+		return raw[:a.ValueStart] + EscapeAttribute(value, a.Quote) + raw[a.ValueEnd:]
+	}
+
+	end := len(raw)
+	if end > 0 && raw[end-1] == '>' {
+		end--
+		if end > 0 && raw[end-1] == '/' {
+			end--
+		}
+	}
+	// keep whitespace in front of the closing bracket where it is
+	trimmed := strings.TrimRight(raw[:end], spaceChars)
+
+	return trimmed + " " + name + `="` + EscapeAttribute(value, '"') + `"` + raw[len(trimmed):]
+}
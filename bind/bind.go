@@ -0,0 +1,419 @@
+// Package bind loads XML documents into Go structs and writes changed values
+// back into the original document without touching anything else.
+//
+// Struct fields are mapped using the same `xml` struct tags as encoding/xml:
+//
+//	type Config struct {
+//		Version string `xml:"version,attr"`
+//		Name    string `xml:"name"`
+//		Hosts   []Host `xml:"host"`
+//	}
+//
+// Supported field types are strings, booleans, integers and floats, structs,
+// pointers to these, and slices thereof. Nested paths (`a>b`) are not
+// supported.
+package bind
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+var ErrInvalidValue = errors.New("bind: value must be a non-nil pointer to a struct")
+
+type locationKind uint8
+
+const (
+	elementLocation locationKind = iota
+	attributeLocation
+	textLocation
+)
+
+type location struct {
+	kind    locationKind
+	node    *node
+	name    string
+	value   string
+	missing bool
+}
+
+// Document remembers the original input and the locations every bound value
+// was read from.
+type Document struct {
+	input     string
+	locations map[string]*location
+	lengths   map[string]int
+}
+
+// Unmarshal parses the XML document input and stores the values of the root
+// element in the struct pointed to by v.
+func Unmarshal(input string, v interface{}) (*Document, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return nil, ErrInvalidValue
+	}
+
+	root, err := parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Document{
+		input:     input,
+		locations: map[string]*location{},
+		lengths:   map[string]int{},
+	}
+
+	if err := d.unmarshalStruct(root, rv.Elem(), ""); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Input returns the original document.
+func (d *Document) Input() string {
+	return d.input
+}
+
+// Marshal compares the values of v with the values originally unmarshalled
+// and returns the original document with only the changed values patched in.
+// v needs to be of the same type as the value passed to Unmarshal. Elements
+// cannot be added or removed, but missing attributes are appended to their
+// element.
+func (d *Document) Marshal(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return "", ErrInvalidValue
+	}
+
+	changes := map[*node]*change{}
+	if err := d.marshalStruct(rv.Elem(), "", changes); err != nil {
+		return "", err
+	}
+
+	edits := []edit{}
+	for n, c := range changes {
+		e, err := c.edits(d.input, n)
+		if err != nil {
+			return "", err
+		}
+		edits = append(edits, e...)
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end < edits[j].end
+	})
+
+	buf := strings.Builder{}
+	pos := 0
+	for _, e := range edits {
+		buf.WriteString(d.input[pos:e.start])
+		buf.WriteString(e.text)
+		pos = e.end
+	}
+	buf.WriteString(d.input[pos:])
+
+	return buf.String(), nil
+}
+
+type fieldMode uint8
+
+const (
+	skipField fieldMode = iota
+	elementField
+	attributeField
+	chardataField
+)
+
+func fieldInfo(f reflect.StructField) (string, fieldMode, error) {
+	if f.PkgPath != "" || f.Name == "XMLName" {
+		return "", skipField, nil
+	}
+
+	tag := f.Tag.Get("xml")
+	if tag == "-" {
+		return "", skipField, nil
+	}
+
+	parts := strings.Split(tag, ",")
+	name := parts[0]
+	if strings.Contains(name, ">") || strings.Contains(name, " ") {
+		return "", skipField, fmt.Errorf("bind: unsupported tag for field %s: %s", f.Name, tag)
+	}
+
+	mode := elementField
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "attr":
+			mode = attributeField
+		case "chardata":
+			mode = chardataField
+		case "omitempty":
+		default:
+			return "", skipField, fmt.Errorf("bind: unsupported tag option for field %s: %s", f.Name, opt)
+		}
+	}
+
+	if name == "" {
+		name = f.Name
+	}
+
+	return name, mode, nil
+}
+
+func (d *Document) unmarshalStruct(n *node, v reflect.Value, path string) error {
+	d.locations[path] = &location{kind: elementLocation, node: n}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, mode, err := fieldInfo(t.Field(i))
+		if err != nil {
+			return err
+		}
+
+		fv := v.Field(i)
+		fpath := path + "." + strconv.Itoa(i)
+
+		switch mode {
+		case attributeField:
+			if value, ok := n.attribute(d.input, name); ok {
+				if err := setScalar(fv, gockl.Unescape(value)); err != nil {
+					return err
+				}
+			}
+			value, err := formatScalar(fv)
+			if err != nil {
+				return err
+			}
+			d.locations[fpath] = &location{kind: attributeLocation, node: n, name: name, value: value}
+		case chardataField:
+			if err := setScalar(fv, n.chardata(d.input)); err != nil {
+				return err
+			}
+			value, err := formatScalar(fv)
+			if err != nil {
+				return err
+			}
+			d.locations[fpath] = &location{kind: textLocation, node: n, value: value}
+		case elementField:
+			if err := d.unmarshalElements(n.childrenNamed(name), fv, fpath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) unmarshalElements(children []*node, v reflect.Value, path string) error {
+	if v.Kind() == reflect.Slice {
+		d.lengths[path] = len(children)
+		v.Set(reflect.MakeSlice(v.Type(), len(children), len(children)))
+		for i, c := range children {
+			if err := d.unmarshalValue(c, v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(children) == 0 {
+		d.locations[path] = &location{missing: true}
+		return nil
+	}
+
+	return d.unmarshalValue(children[0], v, path)
+}
+
+func (d *Document) unmarshalValue(n *node, v reflect.Value, path string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		return d.unmarshalStruct(n, v, path)
+	}
+
+	if err := setScalar(v, n.chardata(d.input)); err != nil {
+		return err
+	}
+	value, err := formatScalar(v)
+	if err != nil {
+		return err
+	}
+	d.locations[path] = &location{kind: textLocation, node: n, value: value}
+
+	return nil
+}
+
+func (d *Document) marshalStruct(v reflect.Value, path string, changes map[*node]*change) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		_, mode, err := fieldInfo(t.Field(i))
+		if err != nil {
+			return err
+		}
+
+		fv := v.Field(i)
+		fpath := path + "." + strconv.Itoa(i)
+
+		switch mode {
+		case attributeField, chardataField:
+			if err := d.marshalScalar(fv, fpath, changes); err != nil {
+				return err
+			}
+		case elementField:
+			if err := d.marshalElements(fv, fpath, changes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (d *Document) marshalElements(v reflect.Value, path string, changes map[*node]*change) error {
+	if v.Kind() == reflect.Slice {
+		if v.Len() != d.lengths[path] {
+			return fmt.Errorf("bind: cannot add or remove elements (%s)", path)
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := d.marshalValue(v.Index(i), path+"["+strconv.Itoa(i)+"]", changes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if loc := d.locations[path]; loc == nil || loc.missing {
+		if !reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface()) {
+			return fmt.Errorf("bind: cannot add elements (%s)", path)
+		}
+		return nil
+	}
+
+	return d.marshalValue(v, path, changes)
+}
+
+func (d *Document) marshalValue(v reflect.Value, path string, changes map[*node]*change) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return fmt.Errorf("bind: cannot remove elements (%s)", path)
+		}
+		v = v.Elem()
+	}
+
+	if v.Kind() == reflect.Struct {
+		return d.marshalStruct(v, path, changes)
+	}
+
+	return d.marshalScalar(v, path, changes)
+}
+
+func (d *Document) marshalScalar(v reflect.Value, path string, changes map[*node]*change) error {
+	loc := d.locations[path]
+	if loc == nil {
+		return fmt.Errorf("bind: value does not match unmarshalled document (%s)", path)
+	}
+
+	value, err := formatScalar(v)
+	if err != nil {
+		return err
+	}
+	if value == loc.value {
+		return nil
+	}
+
+	c := changes[loc.node]
+	if c == nil {
+		c = &change{}
+		changes[loc.node] = c
+	}
+
+	if loc.kind == attributeLocation {
+		c.attributes = append(c.attributes, gockl.Attribute{Name: loc.name, Content: value})
+	} else {
+		c.text = &value
+	}
+
+	return nil
+}
+
+func setScalar(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(s), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("bind: unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+func formatScalar(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+
+	return "", fmt.Errorf("bind: unsupported type %s", v.Type())
+}
@@ -0,0 +1,187 @@
+package bind
+
+import (
+	"testing"
+)
+
+type Host struct {
+	Name    string `xml:"name,attr"`
+	Port    int    `xml:"port,attr"`
+	Enabled bool   `xml:"enabled,attr"`
+	Comment string `xml:",chardata"`
+}
+
+type Config struct {
+	Version string  `xml:"version,attr"`
+	Name    string  `xml:"name"`
+	Timeout float64 `xml:"timeout"`
+	Script  string  `xml:"script"`
+	Hosts   []Host  `xml:"host"`
+	Owner   *struct {
+		Email string `xml:"email,attr"`
+	} `xml:"owner"`
+	Missing string `xml:"missing"`
+	Ignored string `xml:"-"`
+}
+
+const config = `<?xml version="1.0"?>
+<!-- the configuration -->
+<config  version = '1'>
+	<name>My &amp; Service</name>
+	<timeout>  007.5 </timeout>
+	<script><![CDATA[if a < b]]></script>
+	<host name="a" port="80"/>
+	<host
+		name="b"
+		port="8080"   enabled="true">backup</host>
+	<owner email=x@example.com />
+</config>
+`
+
+func TestUnmarshal(t *testing.T) {
+	c := Config{}
+	if _, err := Unmarshal(config, &c); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Version != "1" || c.Name != "My & Service" || c.Timeout != 7.5 || c.Script != "if a < b" {
+		t.Errorf("Wrong values: %+v", c)
+	}
+	if len(c.Hosts) != 2 || c.Hosts[0] != (Host{"a", 80, false, ""}) || c.Hosts[1] != (Host{"b", 8080, true, "backup"}) {
+		t.Errorf("Wrong hosts: %+v", c.Hosts)
+	}
+	if c.Owner == nil || c.Owner.Email != "x@example.com" {
+		t.Errorf("Wrong owner: %+v", c.Owner)
+	}
+}
+
+func TestMarshalUnchanged(t *testing.T) {
+	c := Config{}
+	doc, err := Unmarshal(config, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Ignored = "whatever"
+	if output, err := doc.Marshal(&c); err != nil || output != config {
+		t.Errorf("Document changed: %v\n%s", err, output)
+	}
+}
+
+func TestMarshalChanges(t *testing.T) {
+	c := Config{}
+	doc, err := Unmarshal(config, &c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Version = "2"
+	c.Name = "<Other>"
+	c.Timeout = 10
+	c.Script = "a ]]> b"
+	c.Hosts[0].Comment = "primary"
+	c.Hosts[0].Enabled = true
+	c.Hosts[1].Port = 443
+	c.Owner.Email = `"me"`
+
+	expected := `<?xml version="1.0"?>
+<!-- the configuration -->
+<config  version = '2'>
+	<name>&lt;Other&gt;</name>
+	<timeout>10</timeout>
+	<script><![CDATA[a ]]]]><![CDATA[> b]]></script>
+	<host name="a" port="80" enabled="true">primary</host>
+	<host
+		name="b"
+		port="443"   enabled="true">backup</host>
+	<owner email="&quot;me&quot;" />
+</config>
+`
+
+	output, err := doc.Marshal(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != expected {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+
+	again := Config{}
+	if _, err := Unmarshal(output, &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.Name != c.Name || again.Script != c.Script || again.Owner.Email != c.Owner.Email || again.Hosts[0] != c.Hosts[0] {
+		t.Errorf("Values not preserved: %+v", again)
+	}
+
+	// attribute names are case-sensitive
+	h := Host{}
+	doc, err = Unmarshal(`<host NAME="x" port="1"/>`, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Name = "y"
+	if output, err := doc.Marshal(&h); err != nil || output != `<host NAME="x" port="1" name="y"/>` {
+		t.Errorf("Unexpected output (%v): %s", err, output)
+	}
+}
+
+func TestMarshalStructureChanges(t *testing.T) {
+	for name, fn := range map[string]func(c *Config){
+		"add host":     func(c *Config) { c.Hosts = append(c.Hosts, Host{}) },
+		"remove owner": func(c *Config) { c.Owner = nil },
+		"add element":  func(c *Config) { c.Missing = "x" },
+	} {
+		c := Config{}
+		doc, err := Unmarshal(config, &c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn(&c)
+		if _, err := doc.Marshal(&c); err == nil {
+			t.Errorf("Expected error for %s", name)
+		}
+	}
+
+	c := Config{}
+	doc, _ := Unmarshal(config, &c)
+	if _, err := doc.Marshal(c); err != ErrInvalidValue {
+		t.Errorf("Expected invalid value error, got %v", err)
+	}
+}
+
+func TestMixedContent(t *testing.T) {
+	type P struct {
+		Text string `xml:",chardata"`
+	}
+
+	p := P{}
+	doc, err := Unmarshal(`<p>a <b>c</b> d</p>`, &p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Text != "a  d" {
+		t.Errorf("Wrong text: %s", p.Text)
+	}
+	p.Text = "x"
+	if _, err := doc.Marshal(&p); err == nil {
+		t.Error("Expected error changing mixed content")
+	}
+}
+
+func TestBrokenDocuments(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`<a>`,
+		`<a></b>`,
+		`<a/><b/>`,
+		`<a x="y"/>`,
+	} {
+		v := struct {
+			X int `xml:"x,attr"`
+		}{}
+		if _, err := Unmarshal(input, &v); err == nil {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package bind
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// node is an element of the parsed document, described by the spans of its
+// start and end tokens.
+type node struct {
+	name     string
+	start    gockl.Span
+	end      gockl.Span
+	children []*node
+	text     []gockl.Span
+}
+
+func parse(input string) (*node, error) {
+	var root *node
+	stack := []*node{}
+	z := gockl.New(input)
+
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+
+		switch span.Kind {
+		case gockl.StartElementKind, gockl.EmptyElementKind:
+			n := &node{name: gockl.StartElementToken(span.Raw(input)).Name(), start: span}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			} else {
+				return nil, fmt.Errorf("bind: multiple root elements at offset %d", span.Start)
+			}
+			if span.Kind == gockl.StartElementKind {
+				stack = append(stack, n)
+			}
+		case gockl.EndElementKind:
+			name := gockl.EndElementToken(span.Raw(input)).Name()
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return nil, fmt.Errorf("bind: unexpected end element </%s> at offset %d", name, span.Start)
+			}
+			stack[len(stack)-1].end = span
+			stack = stack[:len(stack)-1]
+		case gockl.TextKind, gockl.CDATAKind:
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.text = append(parent.text, span)
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("bind: unclosed element <%s>", stack[len(stack)-1].name)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("bind: no root element")
+	}
+
+	return root, nil
+}
+
+func (n *node) empty() bool {
+	return n.start.Kind == gockl.EmptyElementKind
+}
+
+func (n *node) token(input string) gockl.StartOrEmptyElementToken {
+	if n.empty() {
+		return gockl.EmptyElementToken(n.start.Raw(input))
+	}
+	return gockl.StartElementToken(n.start.Raw(input))
+}
+
+func (n *node) attribute(input, name string) (string, bool) {
+	for _, a := range n.token(input).AttributeSpans() {
+		if a.Name == name {
+			return a.Content, true
+		}
+	}
+	return "", false
+}
+
+func (n *node) childrenNamed(name string) []*node {
+	r := []*node{}
+	for _, c := range n.children {
+		if c.name == name {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func (n *node) chardata(input string) string {
+	buf := strings.Builder{}
+	for _, span := range n.text {
+		if span.Kind == gockl.CDATAKind {
+			content, _ := gockl.CDATAToken(span.Raw(input)).Content()
+			buf.WriteString(content)
+		} else {
+			buf.WriteString(gockl.Unescape(span.Raw(input)))
+		}
+	}
+	return buf.String()
+}
+
+type edit struct {
+	start int
+	end   int
+	text  string
+}
+
+type change struct {
+	attributes []gockl.Attribute
+	text       *string
+}
+
+func (c *change) edits(input string, n *node) ([]edit, error) {
+	r := []edit{}
+
+	raw := n.start.Raw(input)
+	start := raw
+	for _, a := range c.attributes {
+		if n.empty() {
+			start = string(gockl.EmptyElementToken(start).SetAttribute(a.Name, a.Content))
+		} else {
+			start = string(gockl.StartElementToken(start).SetAttribute(a.Name, a.Content))
+		}
+	}
+
+	if c.text != nil {
+		switch {
+		case len(n.text) == 1:
+			span := n.text[0]
+			text := gockl.EscapeText(*c.text)
+			if span.Kind == gockl.CDATAKind {
+				text = ""
+				for _, i := range gockl.NewCDATA(*c.text) {
+					text += i.Raw()
+				}
+			}
+			r = append(r, edit{span.Start, span.End, text})
+		case len(n.text) > 1:
+			return nil, fmt.Errorf("bind: cannot change mixed content of <%s> at offset %d", n.name, n.start.Start)
+		case n.empty():
+			start = strings.TrimRight(strings.TrimSuffix(start, "/>"), " \t\r\n") + ">" +
+				gockl.EscapeText(*c.text) + "</" + n.name + ">"
+		case len(n.children) == 0:
+			r = append(r, edit{n.start.End, n.start.End, gockl.EscapeText(*c.text)})
+		default:
+			return nil, fmt.Errorf("bind: cannot add text to <%s> at offset %d", n.name, n.start.Start)
+		}
+	}
+
+	if start != raw {
+		r = append(r, edit{n.start.Start, n.start.End, start})
+	}
+
+	return r, nil
+}
@@ -0,0 +1,356 @@
+// Package c14n implements Canonical XML 1.0 (http://www.w3.org/TR/xml-c14n)
+// and Exclusive XML Canonicalization 1.0 (http://www.w3.org/TR/xml-exc-c14n/)
+// of complete documents or captured subtrees using gockl tokens.
+//
+// As no DTD processing takes place, default attributes and entities declared
+// in a document type definition are not supported and attribute values are
+// normalized as if they were of type CDATA.
+package c14n
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// Options configures the canonicalization method.
+type Options struct {
+	// Exclusive selects Exclusive XML Canonicalization instead of
+	// Canonical XML 1.0.
+	Exclusive bool
+	// WithComments keeps comments in the output.
+	WithComments bool
+	// InclusivePrefixes lists namespace prefixes that are treated according
+	// to Canonical XML 1.0 rules when using Exclusive canonicalization. Use
+	// "#default" for the default namespace.
+	InclusivePrefixes []string
+	// Namespaces declared by ancestors of the input, which need to be taken
+	// into account when canonicalizing a subtree, mapped from prefix to
+	// namespace URI. Use "" as prefix for the default namespace.
+	Namespaces map[string]string
+}
+
+// String returns the canonical form of the XML document in input.
+func String(input string, o Options) (string, error) {
+	buf := strings.Builder{}
+	if err := Write(&buf, gockl.New(input), o); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+type frame struct {
+	name     string
+	inScope  map[string]string
+	rendered map[string]string
+}
+
+type attribute struct {
+	prefix string
+	local  string
+	uri    string
+	value  string
+}
+
+// Write canonicalizes all tokens of z and writes the result to w.
+func Write(w io.Writer, z *gockl.Tokenizer, o Options) error {
+	c := &canonicalizer{
+		w:         w,
+		o:         o,
+		inclusive: map[string]bool{},
+		stack:     []frame{{inScope: map[string]string{}, rendered: map[string]string{}}},
+	}
+	for _, p := range o.InclusivePrefixes {
+		if p == "#default" {
+			p = ""
+		}
+		c.inclusive[p] = true
+	}
+	for p, uri := range o.Namespaces {
+		c.stack[0].inScope[p] = uri
+	}
+
+	for {
+		t, err := z.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if err := c.token(t); err != nil {
+			return err
+		}
+		if c.err != nil {
+			return c.err
+		}
+	}
+
+	if len(c.stack) > 1 {
+		return fmt.Errorf("c14n: unclosed element <%s>", c.stack[len(c.stack)-1].name)
+	}
+
+	return c.err
+}
+
+type canonicalizer struct {
+	w         io.Writer
+	o         Options
+	inclusive map[string]bool
+	stack     []frame
+	// whether the document element has been seen already
+	seenRoot bool
+	err      error
+}
+
+func (c *canonicalizer) write(s ...string) {
+	for _, i := range s {
+		if c.err != nil {
+			return
+		}
+		_, c.err = io.WriteString(c.w, i)
+	}
+}
+
+// writeOutside writes nodes outside of the document element, which are
+// separated from the document element using line breaks.
+func (c *canonicalizer) writeOutside(s string) {
+	if len(c.stack) > 1 {
+		c.write(s)
+	} else if c.seenRoot {
+		c.write("\n", s)
+	} else {
+		c.write(s, "\n")
+	}
+}
+
+func (c *canonicalizer) token(t gockl.Token) error {
+	switch t := t.(type) {
+	case gockl.TextToken:
+		if len(c.stack) == 1 {
+			if strings.Trim(string(t), " \t\r\n") != "" {
+				return fmt.Errorf("c14n: text outside of document element")
+			}
+			return nil
+		}
+		text, err := unescape(normalizeNewlines(string(t)))
+		if err != nil {
+			return err
+		}
+		c.write(textEscaper.Replace(text))
+	case gockl.CDATAToken:
+		content, _ := t.Content()
+		c.write(textEscaper.Replace(normalizeNewlines(content)))
+	case gockl.CommentToken:
+		if c.o.WithComments {
+			content, _ := t.Content()
+			c.writeOutside("<!--" + normalizeNewlines(content) + "-->")
+		}
+	case gockl.ProcInstToken:
+		if t.Target() == "xml" {
+			return nil
+		}
+		pi := "<?" + t.Target()
+		if inst := t.Instruction(); inst != "" {
+			pi += " " + inst
+		}
+		c.writeOutside(normalizeNewlines(pi) + "?>")
+	case gockl.DirectiveToken:
+		// the document type declaration is removed
+	case gockl.StartElementToken:
+		return c.startElement(t, false)
+	case gockl.EmptyElementToken:
+		return c.startElement(t, true)
+	case gockl.EndElementToken:
+		if len(c.stack) == 1 || c.stack[len(c.stack)-1].name != t.Name() {
+			return fmt.Errorf("c14n: unexpected end element </%s>", t.Name())
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+		c.write("</", t.Name(), ">")
+	}
+
+	return nil
+}
+
+func splitName(name string) (string, string) {
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[:idx], name[idx+1:]
+	}
+	return "", name
+}
+
+func (c *canonicalizer) startElement(t gockl.StartOrEmptyElementToken, empty bool) error {
+	if len(c.stack) == 1 {
+		if c.seenRoot {
+			return fmt.Errorf("c14n: multiple document elements")
+		}
+		c.seenRoot = true
+	}
+
+	parent := c.stack[len(c.stack)-1]
+	f := frame{name: t.Name(), inScope: parent.inScope, rendered: parent.rendered}
+
+	attrs := []attribute{}
+	declared := map[string]string{}
+	for _, a := range t.AttributeSpans() {
+		value, err := unescape(normalizeAttribute(a.Content))
+		if err != nil {
+			return err
+		}
+
+		prefix, local := splitName(a.Name)
+		if prefix == "" && local == "xmlns" {
+			declared[""] = value
+		} else if prefix == "xmlns" {
+			declared[local] = value
+		} else {
+			attrs = append(attrs, attribute{prefix: prefix, local: local, value: value})
+		}
+	}
+
+	if len(declared) > 0 {
+		f.inScope = map[string]string{}
+		for p, uri := range parent.inScope {
+			f.inScope[p] = uri
+		}
+		for p, uri := range declared {
+			f.inScope[p] = uri
+		}
+	}
+
+	// resolve namespaces of attributes
+	utilized := map[string]bool{}
+	prefix, _ := splitName(f.name)
+	utilized[prefix] = true
+	if _, ok := f.inScope[prefix]; !ok && prefix != "" && prefix != "xml" {
+		return fmt.Errorf("c14n: undeclared namespace prefix %s", prefix)
+	}
+	for i, a := range attrs {
+		if a.prefix == "" {
+			continue
+		}
+		utilized[a.prefix] = true
+		if a.prefix == "xml" {
+			attrs[i].uri = xmlNamespace
+		} else if uri, ok := f.inScope[a.prefix]; ok {
+			attrs[i].uri = uri
+		} else {
+			return fmt.Errorf("c14n: undeclared namespace prefix %s", a.prefix)
+		}
+	}
+
+	// find namespace nodes to render
+	candidates := []string{}
+	if c.o.Exclusive {
+		for p := range utilized {
+			candidates = append(candidates, p)
+		}
+		for p := range c.inclusive {
+			if _, ok := f.inScope[p]; ok && !utilized[p] {
+				candidates = append(candidates, p)
+			}
+		}
+	} else {
+		for p := range f.inScope {
+			candidates = append(candidates, p)
+		}
+		if _, ok := f.inScope[""]; !ok {
+			candidates = append(candidates, "")
+		}
+	}
+	sort.Strings(candidates)
+
+	namespaces := []attribute{}
+	for _, p := range candidates {
+		if p == "xml" {
+			continue
+		}
+		uri := f.inScope[p]
+		if p != "" && uri == "" {
+			continue
+		}
+		if f.rendered[p] == uri {
+			continue
+		}
+		if len(namespaces) == 0 {
+			f.rendered = map[string]string{}
+			for k, v := range parent.rendered {
+				f.rendered[k] = v
+			}
+		}
+		f.rendered[p] = uri
+		namespaces = append(namespaces, attribute{local: p, value: uri})
+	}
+
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return attrs[i].local < attrs[j].local
+	})
+
+	c.write("<", f.name)
+	for _, ns := range namespaces {
+		if ns.local == "" {
+			c.write(` xmlns="`, attributeEscaper.Replace(ns.value), `"`)
+		} else {
+			c.write(" xmlns:", ns.local, `="`, attributeEscaper.Replace(ns.value), `"`)
+		}
+	}
+	for _, a := range attrs {
+		name := a.local
+		if a.prefix != "" {
+			name = a.prefix + ":" + a.local
+		}
+		c.write(" ", name, `="`, attributeEscaper.Replace(a.value), `"`)
+	}
+	c.write(">")
+
+	if empty {
+		c.write("</", f.name, ">")
+	} else {
+		c.stack = append(c.stack, f)
+	}
+
+	return nil
+}
+
+var (
+	textEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	newlineReplacer  = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+	attributeSpaces  = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ", "\t", " ")
+)
+
+func normalizeNewlines(s string) string {
+	return newlineReplacer.Replace(s)
+}
+
+func normalizeAttribute(s string) string {
+	return attributeSpaces.Replace(s)
+}
+
+// unescape resolves character and entity references and fails for entities
+// that are not predefined.
+func unescape(s string) (string, error) {
+	for rest := s; ; {
+		amp := strings.IndexByte(rest, '&')
+		if amp == -1 {
+			break
+		}
+		rest = rest[amp:]
+		semi := strings.IndexByte(rest, ';')
+		if semi == -1 || gockl.Unescape(rest[:semi+1]) == rest[:semi+1] {
+			return "", fmt.Errorf("c14n: unsupported entity reference in %q", s)
+		}
+		rest = rest[semi+1:]
+	}
+
+	return gockl.Unescape(s), nil
+}
@@ -0,0 +1,210 @@
+package c14n
+
+import (
+	"testing"
+)
+
+type example struct {
+	Input     string
+	Options   Options
+	Canonical string
+}
+
+// Examples taken from section 3 of http://www.w3.org/TR/xml-c14n, minus the
+// parts requiring DTD processing.
+var examples = map[string]example{
+	"3.1 without comments": {
+		Input: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+		Canonical: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!</doc>
+<?pi-without-data?>`,
+	},
+	"3.1 with comments": {
+		Input: `<?xml version="1.0"?>
+
+<?xml-stylesheet   href="doc.xsl"
+   type="text/xsl"   ?>
+
+<!DOCTYPE doc SYSTEM "doc.dtd">
+
+<doc>Hello, world!<!-- Comment 1 --></doc>
+
+<?pi-without-data     ?>
+
+<!-- Comment 2 -->
+
+<!-- Comment 3 -->`,
+		Options: Options{WithComments: true},
+		Canonical: `<?xml-stylesheet href="doc.xsl"
+   type="text/xsl"   ?>
+<doc>Hello, world!<!-- Comment 1 --></doc>
+<?pi-without-data?>
+<!-- Comment 2 -->
+<!-- Comment 3 -->`,
+	},
+	"3.2": {
+		Input: `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`,
+		Canonical: `<doc>
+   <clean>   </clean>
+   <dirty>   A   B   </dirty>
+   <mixed>
+      A
+      <clean>   </clean>
+      B
+      <dirty>   A   B   </dirty>
+      C
+   </mixed>
+</doc>`,
+	},
+	"3.3": {
+		Input: `<!DOCTYPE doc [<!ATTLIST e9 attr CDATA "default">]>
+<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+		Canonical: `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6 xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9 xmlns:a="http://www.ietf.org"></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+	},
+	"3.4": {
+		Input: "<doc>\r\n" + `   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`,
+		Canonical: `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>
+</doc>`,
+	},
+	"3.6": {
+		Input:     `<?xml version="1.0" encoding="ISO-8859-1"?>` + "\n<doc>&#169;</doc>",
+		Canonical: `<doc>©</doc>`,
+	},
+	"exclusive": {
+		Input: `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n0:local>`,
+		Options: Options{Exclusive: true},
+		Canonical: `<n0:local xmlns:n0="foo:bar">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+  </n1:elem2>
+</n0:local>`,
+	},
+	"exclusive with inclusive prefixes": {
+		Input: `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org" xmlns="urn:x">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff xmlns:n3="ftp://example.org"/>
+  </n1:elem2>
+</n0:local>`,
+		Options: Options{Exclusive: true, InclusivePrefixes: []string{"#default", "n3"}},
+		Canonical: `<n0:local xmlns="urn:x" xmlns:n0="foo:bar" xmlns:n3="ftp://example.org">
+  <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+     <n3:stuff></n3:stuff>
+  </n1:elem2>
+</n0:local>`,
+	},
+	"exclusive default namespace": {
+		Input:     `<a xmlns="urn:a"><b xmlns=""><c/></b><x:d xmlns:x="urn:x"/></a>`,
+		Options:   Options{Exclusive: true},
+		Canonical: `<a xmlns="urn:a"><b xmlns=""><c></c></b><x:d xmlns:x="urn:x"></x:d></a>`,
+	},
+	"subtree with inherited namespaces": {
+		Input:     `<n1:elem2 xml:lang="en"><n3:stuff/></n1:elem2>`,
+		Options:   Options{Namespaces: map[string]string{"n1": "http://example.net", "n3": "ftp://example.org"}},
+		Canonical: `<n1:elem2 xmlns:n1="http://example.net" xmlns:n3="ftp://example.org" xml:lang="en"><n3:stuff></n3:stuff></n1:elem2>`,
+	},
+	"exclusive subtree with inherited namespaces": {
+		Input:     `<n1:elem2 xml:lang="en"><n3:stuff/></n1:elem2>`,
+		Options:   Options{Exclusive: true, Namespaces: map[string]string{"n1": "http://example.net", "n3": "ftp://example.org"}},
+		Canonical: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`,
+	},
+}
+
+func TestExamples(t *testing.T) {
+	for name, e := range examples {
+		result, err := String(e.Input, e.Options)
+		if err != nil {
+			t.Errorf("Error canonicalizing %s: %s", name, err)
+		} else if result != e.Canonical {
+			t.Errorf("Wrong result for %s:\n%s\n--- expected:\n%s", name, result, e.Canonical)
+		}
+
+		// canonical form needs to be stable
+		if again, err := String(result, e.Options); err != nil || again != result {
+			t.Errorf("Canonical form of %s not stable: %v\n%s", name, err, again)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, input := range []string{
+		`<a>`,
+		`<a></b>`,
+		`<a/><b/>`,
+		`text<a/>`,
+		`<a>&custom;</a>`,
+		`<x:a/>`,
+		`<a x:b="1"/>`,
+	} {
+		if _, err := String(input, Options{}); err == nil {
+			t.Errorf("Expected error for %s", input)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+// Package check verifies that documents are well-formed XML, reporting all
+// problems found together with their locations.
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/roblillack/gockl"
+)
+
+// Error is a single well-formedness error.
+type Error struct {
+	gockl.Location
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Location.String() + ": " + e.Msg
+}
+
+// MaxErrors is the maximum number of errors reported for a single document.
+const MaxErrors = 100
+
+// String checks the document in input.
+func String(input string) []*Error {
+	return Check(gockl.New(input))
+}
+
+// Check reads all remaining tokens of z and returns the well-formedness
+// errors found.
+func Check(z *gockl.Tokenizer) []*Error {
+	c := &checker{input: z.Input, entities: map[string]bool{}}
+
+	for len(c.errors) < MaxErrors {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		c.token(span)
+	}
+
+	if len(c.errors) < MaxErrors {
+		if len(c.stack) > 0 {
+			top := c.stack[len(c.stack)-1]
+			c.errorf(top.offset, "element <%s> is never closed", top.name)
+		} else if !c.seenRoot {
+			c.errorf(len(c.input), "no document element")
+		}
+	}
+
+	return c.errors
+}
+
+type element struct {
+	name   string
+	offset int
+}
+
+type checker struct {
+	input    string
+	stack    []element
+	seenRoot bool
+	doctype  bool
+	entities map[string]bool
+	errors   []*Error
+}
+
+func (c *checker) errorf(offset int, format string, args ...interface{}) {
+	if len(c.errors) >= MaxErrors {
+		return
+	}
+	c.errors = append(c.errors, &Error{gockl.Locate(c.input, offset), fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) token(span gockl.Span) {
+	raw := span.Raw(c.input)
+	inside := len(c.stack) > 0
+
+	switch span.Kind {
+	case gockl.TextKind:
+		if idx := strings.IndexByte(raw, '<'); idx > -1 {
+			c.errorf(span.Start+idx, "invalid markup")
+		}
+		if idx := strings.Index(raw, "]]>"); idx > -1 {
+			c.errorf(span.Start+idx, "`]]>` not allowed in character data")
+		}
+		if !inside && strings.Trim(raw, " \t\r\n") != "" {
+			c.errorf(span.Start, "character data outside of document element")
+			return
+		}
+		c.references(raw, span.Start)
+	case gockl.CDATAKind:
+		if _, ok := gockl.CDATAToken(raw).Content(); !ok {
+			c.errorf(span.Start, "unterminated CDATA section")
+		}
+		if !inside {
+			c.errorf(span.Start, "CDATA section outside of document element")
+		}
+	case gockl.CommentKind:
+		content, ok := gockl.CommentToken(raw).Content()
+		if !ok {
+			c.errorf(span.Start, "unterminated comment")
+		} else if idx := strings.Index(content, "--"); idx > -1 {
+			c.errorf(span.Start+4+idx, "`--` not allowed in comments")
+		} else if strings.HasSuffix(content, "-") {
+			c.errorf(span.End-4, "comment must not end with `-`")
+		}
+	case gockl.ProcInstKind:
+		c.procInst(gockl.ProcInstToken(raw), span.Start)
+	case gockl.DirectiveKind:
+		c.directive(raw, span.Start)
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		c.startElement(raw, span)
+	case gockl.EndElementKind:
+		c.endElement(raw, span.Start)
+	}
+}
+
+func (c *checker) procInst(t gockl.ProcInstToken, offset int) {
+	if _, ok := t.Content(); !ok {
+		c.errorf(offset, "unterminated processing instruction")
+		return
+	}
+
+	target := t.Target()
+	if !isName(target) {
+		c.errorf(offset+2, "invalid processing instruction target %q", target)
+	} else if strings.EqualFold(target, "xml") && (target != "xml" || offset != 0) {
+		c.errorf(offset, "XML declaration only allowed at the start of the document")
+	}
+}
+
+func (c *checker) directive(raw string, offset int) {
+	if !strings.HasSuffix(raw, ">") {
+		c.errorf(offset, "unterminated declaration")
+		return
+	}
+
+	if !strings.HasPrefix(raw, "<!DOCTYPE") {
+		c.errorf(offset, "invalid declaration")
+		return
+	}
+
+	if c.doctype {
+		c.errorf(offset, "multiple document type declarations")
+	} else if c.seenRoot || len(c.stack) > 0 {
+		c.errorf(offset, "document type declaration after document element")
+	}
+	c.doctype = true
+
+	// remember entities declared in the internal subset
+	rest := raw
+	for {
+		idx := strings.Index(rest, "<!ENTITY")
+		if idx == -1 {
+			break
+		}
+		fields := strings.Fields(rest[idx+len("<!ENTITY"):])
+		if len(fields) > 0 && fields[0] != "%" {
+			c.entities[fields[0]] = true
+		}
+		rest = rest[idx+1:]
+	}
+}
+
+func (c *checker) startElement(raw string, span gockl.Span) {
+	if !strings.HasSuffix(raw, ">") {
+		c.errorf(span.Start, "unterminated start element")
+	}
+
+	el := gockl.StartElementToken(raw)
+	name := el.Name()
+	if !isName(name) {
+		c.errorf(span.Start+1, "invalid element name %q", name)
+	}
+
+	if len(c.stack) == 0 {
+		if c.seenRoot {
+			c.errorf(span.Start, "multiple document elements")
+		}
+		c.seenRoot = true
+	}
+
+	seen := map[string]bool{}
+	for _, a := range el.AttributeSpans() {
+		offset := span.Start + a.Start
+		if strings.IndexAny(raw[a.Start-1:a.Start], " \t\r\n") == -1 {
+			c.errorf(offset, "missing whitespace before attribute")
+		}
+		if !isName(a.Name) {
+			c.errorf(offset, "invalid attribute name %q", a.Name)
+			continue
+		}
+		if seen[a.Name] {
+			c.errorf(offset, "duplicate attribute %s", a.Name)
+		}
+		seen[a.Name] = true
+
+		if a.End == a.Start+len(a.Name) {
+			c.errorf(offset, "attribute %s has no value", a.Name)
+			continue
+		}
+		if a.Quote == 0 {
+			c.errorf(span.Start+a.ValueStart, "value of attribute %s is not quoted", a.Name)
+			continue
+		}
+		if a.ValueEnd >= len(raw) || raw[a.ValueEnd] != a.Quote {
+			c.errorf(span.Start+a.ValueStart, "unterminated value of attribute %s", a.Name)
+			continue
+		}
+		if idx := strings.IndexByte(a.Content, '<'); idx > -1 {
+			c.errorf(span.Start+a.ValueStart+idx, "`<` not allowed in attribute values")
+		}
+		c.references(a.Content, span.Start+a.ValueStart)
+	}
+
+	if span.Kind == gockl.StartElementKind {
+		c.stack = append(c.stack, element{name, span.Start})
+	}
+}
+
+func (c *checker) endElement(raw string, offset int) {
+	if !strings.HasSuffix(raw, ">") {
+		c.errorf(offset, "unterminated end element")
+	}
+
+	name := strings.TrimRight(strings.TrimSuffix(strings.TrimPrefix(raw, "</"), ">"), " \t\r\n")
+	if !isName(name) {
+		c.errorf(offset+2, "invalid element name %q", name)
+	}
+
+	if len(c.stack) == 0 {
+		c.errorf(offset, "unexpected end element </%s>", name)
+		return
+	}
+
+	top := c.stack[len(c.stack)-1]
+	if top.name != name {
+		c.errorf(offset, "end element </%s> does not match <%s> at %s", name, top.name, gockl.Locate(c.input, top.offset))
+		// recover, if the element was opened further up
+		for i := len(c.stack) - 2; i >= 0; i-- {
+			if c.stack[i].name == name {
+				c.stack = c.stack[:i]
+				return
+			}
+		}
+		return
+	}
+	c.stack = c.stack[:len(c.stack)-1]
+}
+
+// references checks the entity and character references in s.
+func (c *checker) references(s string, offset int) {
+	for pos := 0; ; {
+		idx := strings.IndexByte(s[pos:], '&')
+		if idx == -1 {
+			return
+		}
+		start := pos + idx
+		end := strings.IndexByte(s[start:], ';')
+		if end == -1 {
+			c.errorf(offset+start, "unterminated reference")
+			return
+		}
+
+		name := s[start+1 : start+end]
+		if !c.validReference(name) {
+			c.errorf(offset+start, "invalid reference &%s;", name)
+		}
+		pos = start + end + 1
+	}
+}
+
+func (c *checker) validReference(name string) bool {
+	switch name {
+	case "lt", "gt", "amp", "apos", "quot":
+		return true
+	}
+
+	if strings.HasPrefix(name, "#x") {
+		n, err := strconv.ParseUint(name[2:], 16, 32)
+		return err == nil && isChar(rune(n))
+	}
+	if strings.HasPrefix(name, "#") {
+		n, err := strconv.ParseUint(name[1:], 10, 32)
+		return err == nil && isChar(rune(n))
+	}
+
+	return isName(name) && c.entities[name]
+}
+
+func isChar(r rune) bool {
+	return r == 0x9 || r == 0xA || r == 0xD ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, r := range s {
+		if r == utf8.RuneError {
+			return false
+		}
+		if r == ':' || r == '_' || unicode.IsLetter(r) {
+			continue
+		}
+		if i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r) || r == 0xB7 || unicode.Is(unicode.Mn, r)) {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,78 @@
+package check
+
+import (
+	"testing"
+)
+
+func TestWellFormed(t *testing.T) {
+	for _, input := range []string{
+		`<doc/>`,
+		`<?xml version="1.0"?>
+<!DOCTYPE doc [
+  <!ENTITY custom "value">
+]>
+<!-- comment -->
+<doc a="1" b='&lt;&#65;&#x42;&custom;'>
+  <![CDATA[ <not markup> ]]>
+  <?pi data?>
+  <ns:child xmlns:ns="urn:x"   />
+  text &amp; more
+</doc   >
+`,
+	} {
+		if errors := String(input); len(errors) > 0 {
+			t.Errorf("Unexpected errors for %s: %v", input, errors)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for input, expected := range map[string]string{
+		``:                             "1:1: no document element",
+		`<doc>`:                        "1:1: element <doc> is never closed",
+		`<a></b>`:                      "1:4: end element </b> does not match <a> at 1:1",
+		`</a>`:                         "1:1: unexpected end element </a>",
+		`<a/><b/>`:                     "1:5: multiple document elements",
+		`text<a/>`:                     "1:1: character data outside of document element",
+		"<a>\n  <b c=d/></a>":          "2:8: value of attribute c is not quoted",
+		`<a b="1" b="2"/>`:             "1:10: duplicate attribute b",
+		`<a b="1"c="2"/>`:              "1:9: missing whitespace before attribute",
+		`<a b/>`:                       "1:4: attribute b has no value",
+		`<a b="<"/>`:                   "1:7: `<` not allowed in attribute values",
+		`<a>&nbsp;</a>`:                "1:4: invalid reference &nbsp;",
+		`<a>&#0;</a>`:                  "1:4: invalid reference &#0;",
+		`<a>a & b</a>`:                 "1:6: unterminated reference",
+		`<a>]]></a>`:                   "1:4: `]]>` not allowed in character data",
+		`<a><!-- a -- b --></a>`:       "1:11: `--` not allowed in comments",
+		`<a><!-- a ---></a>`:           "1:11: comment must not end with `-`",
+		`<a><![CDATA[x</a>`:            "1:4: unterminated CDATA section",
+		`<a/><![CDATA[x]]>`:            "1:5: CDATA section outside of document element",
+		` <?xml version="1.0"?><a/>`:   "1:2: XML declaration only allowed at the start of the document",
+		`<?1x?><a/>`:                   `1:3: invalid processing instruction target "1x"`,
+		`<!DOCTYPE a><!DOCTYPE a><a/>`: "1:13: multiple document type declarations",
+		`<a/><!DOCTYPE a>`:             "1:5: document type declaration after document element",
+		`<!ELEMENT a ANY><a/>`:         "1:1: invalid declaration",
+		`<1a/>`:                        `1:2: invalid element name "1a"`,
+		`<a><b attr="x></b></a>`:       "1:13: unterminated value of attribute attr",
+		`<a><b></a>`:                   "1:7: end element </a> does not match <b> at 1:4",
+	} {
+		errors := String(input)
+		if len(errors) == 0 {
+			t.Errorf("Expected error for %s", input)
+		} else if actual := errors[0].Error(); actual != expected {
+			t.Errorf("Wrong error for %s: %s (actual) != %s (expected)", input, actual, expected)
+		}
+	}
+}
+
+func TestMaxErrors(t *testing.T) {
+	input := "<a>"
+	for i := 0; i < 2*MaxErrors; i++ {
+		input += "&x;"
+	}
+	input += "</a>"
+
+	if errors := String(input); len(errors) != MaxErrors {
+		t.Errorf("Expected %d errors, got %d", MaxErrors, len(errors))
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/roblillack/gockl/check"
+)
+
+func init() {
+	register("check", "report well-formedness errors", runCheck)
+}
+
+func runCheck(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	quiet := flags.Bool("q", false, "only set the exit status")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return inputs(flags.Args(), stdin, stderr, func(in input) int {
+		errs := check.String(in.data)
+		if !*quiet {
+			for _, e := range errs {
+				fmt.Fprintf(stdout, "%s:%s\n", in.name, e)
+			}
+		}
+		if len(errs) > 0 {
+			return 1
+		}
+		return 0
+	})
+}
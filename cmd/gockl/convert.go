@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/roblillack/gockl/convert"
+	"github.com/roblillack/gockl/query"
+	"github.com/roblillack/gockl/tree"
+)
+
+func init() {
+	register("convert", "convert documents between XML, JSON, YAML and TOML", runConvert)
+}
+
+func runConvert(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	to := flags.String("to", "json", "format to convert XML into: json, yaml or toml")
+	from := flags.String("from", "", "format to convert into XML: json, yaml or toml")
+	convention := flags.String("convention", "badgerfish", "JSON convention: badgerfish, parker or jsonml")
+	indent := flags.String("indent", "  ", "indentation of nested JSON values")
+	root := flags.String("root", "root", "name of the document element when converting from JSON using the Parker convention")
+	sel := flags.String("select", "", "convert the first element matching this query instead of the whole document")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	c, err := convert.ParseConvention(*convention)
+	if err != nil {
+		fmt.Fprintf(stderr, "gockl: %s\n", err)
+		return 2
+	}
+	o := convert.Options{Convention: c, Indent: *indent, Root: *root}
+
+	var q *query.Query
+	if *sel != "" {
+		if *from != "" {
+			fmt.Fprintln(stderr, "gockl: -select cannot be used with -from")
+			return 2
+		}
+		if q, err = query.Compile(*sel); err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			return 2
+		}
+	}
+
+	var read func(string) (string, error)
+	switch *from {
+	case "":
+		if *to != "json" && *to != "yaml" && *to != "toml" {
+			fmt.Fprintf(stderr, "gockl: unknown format %s\n", *to)
+			return 2
+		}
+	case "json":
+		read = func(data string) (string, error) {
+			return convert.FromJSON(data, o)
+		}
+	case "yaml":
+		read = convert.FromYAML
+	case "toml":
+		read = convert.FromTOML
+	default:
+		fmt.Fprintf(stderr, "gockl: unknown format %s\n", *from)
+		return 2
+	}
+
+	return inputs(flags.Args(), stdin, stderr, func(in input) int {
+		if read != nil {
+			result, err := read(in.data)
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", in.name, err)
+				return 1
+			}
+			io.WriteString(stdout, result)
+			return 0
+		}
+
+		doc, err := tree.ParseString(in.data)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, err)
+			return 1
+		}
+		n, data := doc.Root, in.data
+		if q != nil {
+			n = nil
+			for _, m := range q.Select(doc) {
+				if m.IsElement() {
+					n, data = m, m.Raw()
+					break
+				}
+			}
+			if n == nil {
+				fmt.Fprintf(stderr, "%s: no element matches %s\n", in.name, *sel)
+				return 1
+			}
+		}
+
+		switch *to {
+		case "json":
+			result, err := convert.ToJSON(data, o)
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: %s\n", in.name, err)
+				return 1
+			}
+			io.WriteString(stdout, result)
+		case "yaml":
+			io.WriteString(stdout, convert.ToYAML(n))
+		case "toml":
+			io.WriteString(stdout, convert.ToTOML(n))
+		}
+		return 0
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/roblillack/gockl/edit"
+)
+
+func init() {
+	register("edit", "rewrite attributes, elements and text in place", runEdit)
+}
+
+// ruleList collects the rules given using repeated flags.
+type ruleList []edit.Rule
+
+func (l *ruleList) String() string {
+	return fmt.Sprint(*l)
+}
+
+func (l *ruleList) Set(s string) error {
+	r, err := edit.ParseRule(s)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, r)
+	return nil
+}
+
+// readRules reads one rule per line, ignoring empty lines and comments
+// starting with #.
+func readRules(name string) ([]edit.Rule, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rules := []edit.Rule{}
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r, err := edit.ParseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", name, line, err)
+		}
+		rules = append(rules, r)
+	}
+
+	return rules, s.Err()
+}
+
+func runEdit(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("edit", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	rules := ruleList{}
+	flags.Var(&rules, "e", "rule to apply, can be repeated")
+	ruleFile := flags.String("f", "", "read rules from file, one per line")
+	dryRun := flags.Bool("dry-run", false, "print a unified diff instead of changing files")
+	recursive := flags.Bool("r", false, "edit directories recursively")
+	include := flags.String("include", "*.xml,*.svg,*.xhtml", "comma-separated patterns of files to edit in directories")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gockl edit [flags] [file ...]")
+		fmt.Fprintln(stderr)
+		fmt.Fprintln(stderr, "rules:")
+		fmt.Fprintln(stderr, "  rename-attr <path> <name> <new name>")
+		fmt.Fprintln(stderr, "  set-attr <path> <name> <value>")
+		fmt.Fprintln(stderr, "  delete-element <path>")
+		fmt.Fprintln(stderr, "  replace-text <path> <regexp> <replacement>")
+		fmt.Fprintln(stderr)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *ruleFile != "" {
+		r, err := readRules(*ruleFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			return 2
+		}
+		rules = append(rules, r...)
+	}
+	if len(rules) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	files := flags.Args()
+	status := 0
+	if *recursive {
+		if len(files) == 0 {
+			files = []string{"."}
+		}
+		var err error
+		if files, err = walk(files, strings.Split(*include, ",")); err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			status = 2
+		}
+		stdin = nil
+	}
+
+	if r := inputs(files, stdin, stderr, func(in input) int {
+		result, err := edit.Apply(in.data, rules...)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, err)
+			return 1
+		}
+
+		if *dryRun {
+			io.WriteString(stdout, unifiedDiff(in.name, in.data, result))
+			return 0
+		}
+		if !in.file {
+			io.WriteString(stdout, result)
+			return 0
+		}
+		if result == in.data {
+			return 0
+		}
+		if err := writeFile(in.name, result); err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			return 2
+		}
+		return 0
+	}); r > status {
+		status = r
+	}
+
+	return status
+}
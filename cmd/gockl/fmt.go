@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/roblillack/gockl/format"
+)
+
+func init() {
+	register("fmt", "reindent documents in place", runFmt)
+}
+
+func runFmt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	indent := flags.String("indent", "  ", "indentation of nested elements")
+	width := flags.Int("width", 0, "wrap attributes of start elements longer than this")
+	list := flags.Bool("l", false, "only list files whose formatting differs")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	o := format.PrettyOptions{Indent: *indent, MaxWidth: *width}
+	return inputs(flags.Args(), stdin, stderr, func(in input) int {
+		result, err := format.Pretty(in.data, o)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, err)
+			return 1
+		}
+
+		if *list {
+			if result != in.data {
+				fmt.Fprintln(stdout, in.name)
+			}
+			return 0
+		}
+
+		if !in.file {
+			io.WriteString(stdout, result)
+			return 0
+		}
+
+		if result == in.data {
+			return 0
+		}
+		if err := writeFile(in.name, result); err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			return 2
+		}
+		return 0
+	})
+}
+
+// writeFile replaces the contents of an existing file keeping its
+// permissions.
+func writeFile(name, data string) error {
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(name, []byte(data), info.Mode().Perm())
+}
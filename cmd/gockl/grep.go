@@ -0,0 +1,148 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/grep"
+)
+
+func init() {
+	register("grep", "search element names, attributes and text", runGrep)
+}
+
+func runGrep(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("grep", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	o := grep.Options{}
+	flags.BoolVar(&o.ElementNames, "elements", false, "search element names")
+	flags.BoolVar(&o.AttributeNames, "attributes", false, "search attribute names")
+	flags.BoolVar(&o.AttributeValues, "values", false, "search attribute values")
+	flags.BoolVar(&o.Text, "text", false, "search text content")
+	ignoreCase := flags.Bool("i", false, "ignore case")
+	recursive := flags.Bool("r", false, "search directories recursively")
+	include := flags.String("include", "*.xml,*.svg,*.xhtml", "comma-separated patterns of files to search in directories")
+	list := flags.Bool("l", false, "only print the names of files containing matches")
+	count := flags.Bool("c", false, "only print the number of matching tokens per file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: gockl grep [flags] <regexp> [file ...]")
+		return 2
+	}
+
+	pattern := flags.Arg(0)
+	if *ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		fmt.Fprintf(stderr, "gockl: %s\n", err)
+		return 2
+	}
+
+	files := flags.Args()[1:]
+	status := 0
+	if *recursive {
+		if len(files) == 0 {
+			files = []string{"."}
+		}
+		if files, err = walk(files, strings.Split(*include, ",")); err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			status = 2
+		}
+		stdin = nil
+	}
+	names := len(files) > 1 || *recursive
+
+	found := false
+	if r := inputs(files, stdin, stderr, func(in input) int {
+		matches := grep.String(in.data, re, o)
+		if len(matches) > 0 {
+			found = true
+		}
+
+		if *list {
+			if len(matches) > 0 {
+				fmt.Fprintln(stdout, in.name)
+			}
+			return 0
+		}
+		l := gockl.NewLocator(in.data)
+		n := 0
+		for i, m := range matches {
+			// print and count every token only once
+			if i > 0 && matches[i-1].Token == m.Token {
+				continue
+			}
+			n++
+			if *count {
+				continue
+			}
+			if names {
+				fmt.Fprintf(stdout, "%s:", in.name)
+			}
+			context := m.Token.Raw(in.data)
+			if m.Kind == grep.Text && m.Tag.Kind != gockl.InvalidKind {
+				context = m.Tag.Raw(in.data) + context
+			}
+			fmt.Fprintf(stdout, "%s: %s\n", l.Locate(m.Start), context)
+		}
+		if *count {
+			if names {
+				fmt.Fprintf(stdout, "%s:%d\n", in.name, n)
+			} else {
+				fmt.Fprintln(stdout, n)
+			}
+		}
+		return 0
+	}); r > status {
+		status = r
+	}
+
+	if status == 0 && !found {
+		return 1
+	}
+	return status
+}
+
+// walk replaces all directories in files by the files below them matching
+// one of the include patterns.
+func walk(files []string, include []string) ([]string, error) {
+	r := []string{}
+	var walkErr error
+
+	for _, name := range files {
+		err := filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			if path == name {
+				r = append(r, path)
+				return nil
+			}
+			for _, pattern := range include {
+				if ok, _ := filepath.Match(strings.TrimSpace(pattern), info.Name()); ok {
+					r = append(r, path)
+					break
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			walkErr = err
+		}
+	}
+
+	return r, walkErr
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/highlight"
+)
+
+func init() {
+	register("highlight", "print documents with syntax highlighting", runHighlight)
+}
+
+func runHighlight(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("highlight", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	html := flags.Bool("html", false, "output HTML instead of ANSI escape sequences")
+	prefix := flags.String("prefix", "xml-", "prefix of the HTML class names")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return inputs(flags.Args(), stdin, stderr, func(in input) int {
+		var err error
+		if *html {
+			err = highlight.WriteHTML(stdout, gockl.New(in.data), *prefix)
+		} else {
+			err = highlight.WriteANSI(stdout, gockl.New(in.data), nil)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			return 2
+		}
+		return 0
+	})
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/roblillack/gockl/lint"
+)
+
+func init() {
+	register("lint", "report and fix problems found by lint rules", runLint)
+}
+
+func runLint(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	enable := flags.String("rules", "", "comma-separated names of the rules to run instead of all")
+	disable := flags.String("disable", "", "comma-separated names of rules not to run")
+	format := flags.String("format", "text", "output format: text, json or sarif")
+	list := flags.Bool("list", false, "list the available rules")
+	fix := flags.Bool("fix", false, "fix problems in place and report the remaining ones")
+	dryRun := flags.Bool("dry-run", false, "print a unified diff of the fixes instead of changing files")
+	recursive := flags.Bool("r", false, "lint directories recursively")
+	include := flags.String("include", "*.xml,*.svg,*.xhtml", "comma-separated patterns of files to lint in directories")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *list {
+		for _, r := range lint.Builtin() {
+			fmt.Fprintf(stdout, "%-16s %s\n", r.Name, r.Description)
+		}
+		return 0
+	}
+	if *format != "text" && *format != "json" && *format != "sarif" {
+		fmt.Fprintf(stderr, "gockl: unknown format %s\n", *format)
+		return 2
+	}
+
+	rules := lint.Builtin()
+	if *enable != "" {
+		rules = nil
+		for _, name := range strings.Split(*enable, ",") {
+			r := lint.Lookup(strings.TrimSpace(name))
+			if r == nil {
+				fmt.Fprintf(stderr, "gockl: unknown rule %s\n", name)
+				return 2
+			}
+			rules = append(rules, r)
+		}
+	}
+	if *disable != "" {
+		disabled := map[string]bool{}
+		for _, name := range strings.Split(*disable, ",") {
+			name = strings.TrimSpace(name)
+			if lint.Lookup(name) == nil {
+				fmt.Fprintf(stderr, "gockl: unknown rule %s\n", name)
+				return 2
+			}
+			disabled[name] = true
+		}
+		enabled := []*lint.Rule{}
+		for _, r := range rules {
+			if !disabled[r.Name] {
+				enabled = append(enabled, r)
+			}
+		}
+		rules = enabled
+	}
+
+	files := flags.Args()
+	status := 0
+	if *recursive {
+		if len(files) == 0 {
+			files = []string{"."}
+		}
+		var err error
+		if files, err = walk(files, strings.Split(*include, ",")); err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			status = 2
+		}
+		stdin = nil
+	}
+
+	// the report goes to stderr, if the fixed document is written to stdout
+	report := stdout
+	results := []lint.Result{}
+	if r := inputs(files, stdin, stderr, func(in input) int {
+		var problems []*lint.Problem
+		if !*fix && !*dryRun {
+			problems = lint.String(in.data, rules...)
+		} else {
+			var result string
+			result, problems = lint.Fix(in.data, rules...)
+			switch {
+			case *dryRun:
+				io.WriteString(stdout, unifiedDiff(in.name, in.data, result))
+			case !in.file:
+				io.WriteString(stdout, result)
+				report = stderr
+			case result != in.data:
+				if err := writeFile(in.name, result); err != nil {
+					fmt.Fprintf(stderr, "gockl: %s\n", err)
+					return 2
+				}
+			}
+		}
+
+		results = append(results, lint.Result{File: in.name, Problems: problems})
+		if *format == "text" && !*dryRun {
+			for _, p := range problems {
+				fmt.Fprintf(report, "%s:%s\n", in.name, p)
+			}
+		}
+		if len(problems) > 0 {
+			return 1
+		}
+		return 0
+	}); r > status {
+		status = r
+	}
+	if *dryRun {
+		return status
+	}
+
+	var err error
+	switch *format {
+	case "json":
+		err = lint.WriteJSON(report, results)
+	case "sarif":
+		err = lint.WriteSARIF(report, results, rules)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gockl: %s\n", err)
+		return 2
+	}
+	return status
+}
@@ -0,0 +1,121 @@
+// Command gockl provides tools for working with XML documents without
+// changing more of their markup than necessary.
+//
+// Usage:
+//
+//	gockl <command> [flags] [file ...]
+//
+// The commands are:
+//
+//	check      report well-formedness errors
+//	convert    convert documents between XML, JSON, YAML and TOML
+//	edit       rewrite attributes, elements and text in place
+//	fmt        reindent documents in place
+//	grep       search element names, attributes and text
+//	highlight  print documents with syntax highlighting
+//	lint       report and fix problems found by lint rules
+//	query      print the raw markup of all nodes matching a query
+//	tokens     dump the token stream
+//
+// If no files are given, the input is read from stdin.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{}
+
+func register(name, usage string, run func(args []string, stdin io.Reader, stdout, stderr io.Writer) int) {
+	commands[name] = command{usage, run}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: gockl <command> [flags] [file ...]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stdout)
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "gockl: unknown command %s\n", args[0])
+		usage(stderr)
+		return 2
+	}
+
+	return cmd.run(args[1:], stdin, stdout, stderr)
+}
+
+// input is a single document to be processed.
+type input struct {
+	// name is the file name or "<stdin>".
+	name string
+	// file is true, if the input has been read from a file.
+	file bool
+	data string
+}
+
+// inputs reads all files or stdin, if none are given, and calls fn for each
+// of them. A nil stdin is never read, as after walking directories without
+// any matching files. Errors are reported to stderr and cause a non-zero
+// return value.
+func inputs(files []string, stdin io.Reader, stderr io.Writer, fn func(in input) int) int {
+	if len(files) == 0 && stdin == nil {
+		return 0
+	}
+	if len(files) == 0 {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			return 2
+		}
+		return fn(input{"<stdin>", false, string(data)})
+	}
+
+	status := 0
+	for _, name := range files {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "gockl: %s\n", err)
+			status = 2
+			continue
+		}
+		if r := fn(input{name, true, string(data)}); r > status {
+			status = r
+		}
+	}
+
+	return status
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
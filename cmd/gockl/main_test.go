@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func execute(stdin string, args ...string) (int, string, string) {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	status := run(args, strings.NewReader(stdin), stdout, stderr)
+	return status, stdout.String(), stderr.String()
+}
+
+func TestUsage(t *testing.T) {
+	if status, _, stderr := execute(""); status != 2 || !strings.Contains(stderr, "tokens") {
+		t.Errorf("Unexpected result: %d, %s", status, stderr)
+	}
+	if status, _, stderr := execute("", "nope"); status != 2 || !strings.Contains(stderr, "unknown command nope") {
+		t.Errorf("Unexpected result: %d, %s", status, stderr)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if status, stdout, _ := execute("<doc><a></doc>", "check"); status != 1 || stdout != "<stdin>:1:9: end element </doc> does not match <a> at 1:6\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("<doc/>", "check"); status != 0 || stdout != "" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+}
+
+func TestFmt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gockl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "test.xml")
+	if err := ioutil.WriteFile(name, []byte("<doc><a>text</a><b/></doc>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if status, stdout, _ := execute("", "fmt", "-l", name); status != 0 || stdout != name+"\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, _, stderr := execute("", "fmt", "-indent", "\t", name); status != 0 {
+		t.Errorf("Unexpected result: %d, %q", status, stderr)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "<doc>\n\t<a>text</a>\n\t<b/>\n</doc>\n" {
+		t.Errorf("Unexpected file contents: %q", data)
+	}
+	if status, stdout, _ := execute("<doc><a/></doc>", "fmt"); status != 0 || stdout != "<doc>\n  <a/>\n</doc>\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	input := "<doc>\n  <a id=\"1\">x</a>\n  <a id=\"2\">y</a>\n</doc>"
+	if status, stdout, _ := execute(input, "query", "-n", "//a[@id=2]"); status != 0 || stdout != "<stdin>:3:3: <a id=\"2\">y</a>\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute(input, "query", "-text", "/doc/a"); status != 0 || stdout != "x\ny\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, _, _ := execute(input, "query", "b"); status != 1 {
+		t.Errorf("Unexpected status: %d", status)
+	}
+	if status, _, stderr := execute(input, "query", "a["); status != 2 || stderr == "" {
+		t.Errorf("Unexpected result: %d, %q", status, stderr)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	expected := "<stdin>:1:1\t0-5\tStartElement\t\"<doc>\"\n" +
+		"<stdin>:1:6\t5-7\tText\t\"\\n \"\n" +
+		"<stdin>:2:2\t7-11\tEmptyElement\t\"<a/>\"\n" +
+		"<stdin>:2:6\t11-17\tEndElement\t\"</doc>\"\n"
+	if status, stdout, _ := execute("<doc>\n <a/></doc>", "tokens"); status != 0 || stdout != expected {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+}
+
+func TestGrep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gockl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "icons"), 0755)
+	files := map[string]string{
+		"a.svg":           "<svg>\n  <use\n    xlink:href=\"#a\"/>\n</svg>",
+		"icons/b.svg":     "<svg><title>xlink</title><use href=\"#b\"/></svg>",
+		"icons/c.svg":     "<svg/>",
+		"icons/xlink.txt": "xlink",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, b, c := filepath.Join(dir, "a.svg"), filepath.Join(dir, "icons", "b.svg"), filepath.Join(dir, "icons", "c.svg")
+
+	if status, stdout, _ := execute("", "grep", "xlink", a); status != 0 || stdout != "3:5: <use\n    xlink:href=\"#a\"/>\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("", "grep", "-r", "-l", "xlink", dir); status != 0 || stdout != a+"\n"+b+"\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("", "grep", "-r", "-c", "-attributes", "href", dir); status != 0 || stdout != a+":1\n"+b+":1\n"+c+":0\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("", "grep", "-text", "-i", "XLINK", a, b); status != 0 || stdout != b+":1:13: <title>xlink\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, _, _ := execute("<doc/>", "grep", "-elements", "foo"); status != 1 {
+		t.Errorf("Unexpected status: %d", status)
+	}
+	if status, stdout, _ := execute(`<a href="a" alt="a"/>`, "grep", "-c", "-attributes", "-values", "a"); status != 0 || stdout != "1\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	empty := filepath.Join(dir, "empty")
+	os.Mkdir(empty, 0755)
+	if status, stdout, _ := execute("<xlink/>", "grep", "-r", "xlink", empty); status != 1 || stdout != "" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16"
+	b := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n17"
+	expected := `--- x
++++ x
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -13,4 +13,5 @@
+ 13
+ 14
+ 15
+-16
+\ No newline at end of file
++16
++17
+\ No newline at end of file
+`
+	if d := unifiedDiff("x", a, b); d != expected {
+		t.Errorf("Unexpected diff:\n%s", d)
+	}
+	if d := unifiedDiff("x", "", "a\n"); d != "--- x\n+++ x\n@@ -0,0 +1,1 @@\n+a\n" {
+		t.Errorf("Unexpected diff:\n%s", d)
+	}
+	if d := unifiedDiff("x", a, a); d != "" {
+		t.Errorf("Unexpected diff:\n%s", d)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gockl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "icon.svg")
+	input := "<svg version=\"1.1\">\n  <title>Icon</title>\n  <use xlink:href=\"#a\"/>\n</svg>\n"
+	if err := ioutil.WriteFile(name, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules := filepath.Join(dir, "rules")
+	if err := ioutil.WriteFile(rules, []byte("# SVG 2\nrename-attr //use xlink:href href\n\ndelete-element /svg/title\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diff := "--- " + name + "\n+++ " + name + "\n@@ -1,4 +1,3 @@\n <svg version=\"1.1\">\n-  <title>Icon</title>\n-  <use xlink:href=\"#a\"/>\n+  <use href=\"#a\"/>\n </svg>\n"
+	if status, stdout, stderr := execute("", "edit", "-dry-run", "-f", rules, name); status != 0 || stdout != diff {
+		t.Errorf("Unexpected result: %d, %q, %s", status, stdout, stderr)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != input {
+		t.Errorf("File changed during dry run: %q", data)
+	}
+
+	if status, _, stderr := execute("", "edit", "-f", rules, "-e", "set-attr /svg version 2", name); status != 0 {
+		t.Errorf("Unexpected result: %d, %s", status, stderr)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "<svg version=\"2\">\n  <use href=\"#a\"/>\n</svg>\n" {
+		t.Errorf("Unexpected file contents: %q", data)
+	}
+
+	if status, stdout, _ := execute("<a><b/></a>", "edit", "-e", "delete-element //b"); status != 0 || stdout != "<a></a>" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, _, stderr := execute("<a/>", "edit", "-e", "delete-element"); status != 2 || !strings.Contains(stderr, "missing arguments") {
+		t.Errorf("Unexpected result: %d, %q", status, stderr)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	diff = "--- icon.svg\n+++ icon.svg\n@@ -1,3 +1,3 @@\n-<svg version=\"2\">\n+<svg version=\"3\">\n   <use href=\"#a\"/>\n </svg>\n"
+	if status, stdout, stderr := execute("<svg/>", "edit", "-r", "-dry-run", "-e", "set-attr /svg version 3"); status != 0 || stdout != diff {
+		t.Errorf("Unexpected result: %d, %q, %s", status, stdout, stderr)
+	}
+	os.Mkdir("empty", 0755)
+	if status, stdout, stderr := execute("<svg/>", "edit", "-r", "-e", "set-attr /svg version 3", "empty"); status != 0 || stdout != "" {
+		t.Errorf("Unexpected result: %d, %q, %s", status, stdout, stderr)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	if status, stdout, _ := execute("<a/>", "highlight"); status != 0 || stdout != "\x1b[34m<a/>\x1b[0m" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("<a/>", "highlight", "-html", "-prefix", "x-"); status != 0 || stdout != `<span class="x-tag">&lt;a/&gt;</span>` {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+}
+
+func TestLint(t *testing.T) {
+	input := "<svg>\n  <rect style=\"fill: red\"/>\n</svg>"
+	expected := "<stdin>:1:1: <svg> without viewBox attribute (require-viewbox)\n<stdin>:2:9: inline style on <rect> (no-inline-style)\n"
+	if status, stdout, _ := execute(input, "lint"); status != 1 || stdout != expected {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute(input, "lint", "-disable", "require-viewbox, no-inline-style"); status != 0 || stdout != "" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute(input, "lint", "-rules", "no-inline-style", "-format", "json"); status != 1 || !strings.Contains(stdout, `"rule": "no-inline-style"`) || strings.Contains(stdout, "require-viewbox") {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute(input, "lint", "-format", "sarif"); status != 1 || !strings.Contains(stdout, `"ruleId": "require-viewbox"`) {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("", "lint", "-list"); status != 0 || !strings.Contains(stdout, "unused-defs") {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, _, stderr := execute(input, "lint", "-rules", "nope"); status != 2 || !strings.Contains(stderr, "unknown rule nope") {
+		t.Errorf("Unexpected result: %d, %q", status, stderr)
+	}
+
+	// fixing
+	if status, stdout, stderr := execute(input, "lint", "-fix"); status != 1 || stdout != "<svg>\n  <rect fill=\"red\"/>\n</svg>" || stderr != "<stdin>:1:1: <svg> without viewBox attribute (require-viewbox)\n" {
+		t.Errorf("Unexpected result: %d, %q, %q", status, stdout, stderr)
+	}
+
+	dir, err := ioutil.TempDir("", "gockl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "icon.svg")
+	input = "<svg width=\"16\" height=\"16\">\n  <rect style=\"fill: red\"/>\n</svg>\n"
+	if err := ioutil.WriteFile(name, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diff := "--- " + name + "\n+++ " + name + "\n@@ -1,3 +1,3 @@\n-<svg width=\"16\" height=\"16\">\n-  <rect style=\"fill: red\"/>\n+<svg width=\"16\" height=\"16\" viewBox=\"0 0 16 16\">\n+  <rect fill=\"red\"/>\n </svg>\n"
+	if status, stdout, stderr := execute("", "lint", "-dry-run", name); status != 0 || stdout != diff {
+		t.Errorf("Unexpected result: %d, %q, %s", status, stdout, stderr)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != input {
+		t.Errorf("File changed during dry run: %q", data)
+	}
+	if status, stdout, stderr := execute("", "lint", "-fix", name); status != 0 || stdout != "" {
+		t.Errorf("Unexpected result: %d, %q, %s", status, stdout, stderr)
+	}
+	if data, _ := ioutil.ReadFile(name); string(data) != "<svg width=\"16\" height=\"16\" viewBox=\"0 0 16 16\">\n  <rect fill=\"red\"/>\n</svg>\n" {
+		t.Errorf("Unexpected file contents: %q", data)
+	}
+
+	// stdin is not read after walking directories without matching files
+	empty := filepath.Join(dir, "empty")
+	os.Mkdir(empty, 0755)
+	if status, stdout, stderr := execute("<svg/>", "lint", "-r", empty); status != 0 || stdout != "" || stderr != "" {
+		t.Errorf("Unexpected result: %d, %q, %q", status, stdout, stderr)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	input := "<config>\n  <server name=\"a\"><port>80</port></server>\n</config>\n"
+	if status, stdout, _ := execute(input, "convert", "-indent", ""); status != 0 || stdout != "{\"config\":{\"server\":{\"@name\":\"a\",\"port\":{\"$\":\"80\"}}}}\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute(input, "convert", "-to", "yaml", "-select", "//server"); status != 0 || stdout != "server:\n  \"@name\": a\n  port: \"80\"\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute(input, "convert", "-to", "toml"); status != 0 || stdout != "[config.server]\n\"@name\" = \"a\"\nport = \"80\"\n" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+	if status, stdout, _ := execute("server:\n  port: 81\n", "convert", "-from", "yaml"); status != 0 || stdout != "<server><port>81</port></server>" {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+
+	_, json, _ := execute(input, "convert", "-convention", "jsonml")
+	if status, stdout, _ := execute(json, "convert", "-from", "json", "-convention", "jsonml"); status != 0 || stdout != input {
+		t.Errorf("Unexpected result: %d, %q", status, stdout)
+	}
+
+	if status, _, stderr := execute(input, "convert", "-select", "//nope"); status != 1 || !strings.Contains(stderr, "no element matches //nope") {
+		t.Errorf("Unexpected result: %d, %q", status, stderr)
+	}
+	if status, _, stderr := execute(input, "convert", "-to", "ini"); status != 2 || !strings.Contains(stderr, "unknown format ini") {
+		t.Errorf("Unexpected result: %d, %q", status, stderr)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/query"
+	"github.com/roblillack/gockl/tree"
+)
+
+func init() {
+	register("query", "print the raw markup of all nodes matching a query", runQuery)
+}
+
+func runQuery(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	text := flags.Bool("text", false, "print the text content instead of the raw markup")
+	positions := flags.Bool("n", false, "prefix each match with file:line:col")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "usage: gockl query [flags] <query> [file ...]")
+		return 2
+	}
+
+	q, err := query.Compile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "gockl: %s\n", err)
+		return 2
+	}
+
+	found := false
+	status := inputs(flags.Args()[1:], stdin, stderr, func(in input) int {
+		doc, err := tree.ParseString(in.data)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", in.name, err)
+			return 2
+		}
+
+		for _, n := range q.Select(doc) {
+			found = true
+			if *positions {
+				fmt.Fprintf(stdout, "%s:%s: ", in.name, gockl.Locate(in.data, n.Offset()))
+			}
+			if *text {
+				fmt.Fprintln(stdout, n.Text())
+			} else {
+				fmt.Fprintln(stdout, n.Raw())
+			}
+		}
+		return 0
+	})
+
+	if status == 0 && !found {
+		return 1
+	}
+	return status
+}
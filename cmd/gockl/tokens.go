@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/roblillack/gockl"
+)
+
+func init() {
+	register("tokens", "dump the token stream", runTokens)
+}
+
+func runTokens(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("tokens", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	return inputs(flags.Args(), stdin, stderr, func(in input) int {
+		z := gockl.New(in.data)
+		l := gockl.NewLocator(in.data)
+		for {
+			span, err := z.NextSpan()
+			if err != nil {
+				break
+			}
+			fmt.Fprintf(stdout, "%s:%s\t%d-%d\t%s\t%q\n", in.name, l.Locate(span.Start),
+				span.Start, span.End, span.Kind, span.Raw(in.data))
+		}
+		return 0
+	})
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	op   byte
+	text string
+}
+
+// lineDiff returns the lines of a and b as a sequence of unchanged (' '),
+// deleted ('-') and inserted ('+') lines.
+func lineDiff(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	r := []diffLine{}
+	for _, l := range a[:prefix] {
+		r = append(r, diffLine{' ', l})
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(x)*len(y) > 1<<24 {
+		// too expensive, report everything in between as changed
+		for _, l := range x {
+			r = append(r, diffLine{'-', l})
+		}
+		for _, l := range y {
+			r = append(r, diffLine{'+', l})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of
+		// x[i:] and y[j:]
+		lcs := make([][]int, len(x)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if x[i] == y[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(x) || j < len(y) {
+			switch {
+			case i < len(x) && j < len(y) && x[i] == y[j]:
+				r = append(r, diffLine{' ', x[i]})
+				i++
+				j++
+			case j == len(y) || (i < len(x) && lcs[i+1][j] >= lcs[i][j+1]):
+				r = append(r, diffLine{'-', x[i]})
+				i++
+			default:
+				r = append(r, diffLine{'+', y[j]})
+				j++
+			}
+		}
+	}
+
+	for _, l := range a[len(a)-suffix:] {
+		r = append(r, diffLine{' ', l})
+	}
+
+	return r
+}
+
+// unifiedDiff returns the differences between a and b in the unified diff
+// format or an empty string if there are none.
+func unifiedDiff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+
+	lines := lineDiff(splitLines(a), splitLines(b))
+	buf := strings.Builder{}
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", name, name)
+
+	for start := 0; start < len(lines); {
+		// find the next change
+		for start < len(lines) && lines[start].op == ' ' {
+			start++
+		}
+		if start == len(lines) {
+			break
+		}
+
+		// extend the hunk until there are more than twice the context lines
+		// without changes
+		end := start
+		for unchanged := 0; end < len(lines) && unchanged <= 2*diffContext; end++ {
+			if lines[end].op == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		for end > start && lines[end-1].op == ' ' {
+			end--
+		}
+
+		from, to := start-diffContext, end+diffContext
+		if from < 0 {
+			from = 0
+		}
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		aLine, bLine := 1, 1
+		for _, l := range lines[:from] {
+			if l.op != '+' {
+				aLine++
+			}
+			if l.op != '-' {
+				bLine++
+			}
+		}
+		aCount, bCount := 0, 0
+		for _, l := range lines[from:to] {
+			if l.op != '+' {
+				aCount++
+			}
+			if l.op != '-' {
+				bCount++
+			}
+		}
+		if aCount == 0 {
+			aLine--
+		}
+		if bCount == 0 {
+			bLine--
+		}
+
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", aLine, aCount, bLine, bCount)
+		for _, l := range lines[from:to] {
+			buf.WriteByte(l.op)
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		start = to
+	}
+
+	return buf.String()
+}
+
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
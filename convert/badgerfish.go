@@ -0,0 +1,223 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+type namespace struct {
+	prefix string
+	uri    string
+}
+
+// namespacePrefix returns the prefix declared by an xmlns attribute.
+func namespacePrefix(name string) (string, bool) {
+	if name == "xmlns" {
+		return "", true
+	}
+	if strings.HasPrefix(name, "xmlns:") {
+		return name[6:], true
+	}
+	return "", false
+}
+
+// declare returns the namespaces in scope after declaring prefix. The
+// original slice is left untouched.
+func declare(ns []namespace, prefix, uri string) []namespace {
+	r := []namespace{}
+	found := false
+	for _, d := range ns {
+		if d.prefix == prefix {
+			d.uri = uri
+			found = true
+		}
+		r = append(r, d)
+	}
+	if !found {
+		r = append(r, namespace{prefix, uri})
+	}
+	return r
+}
+
+// groups returns the child elements of n grouped by name, ordered by their
+// first appearance.
+func groups(n *tree.Node) ([]string, map[string][]*tree.Node) {
+	names := []string{}
+	elements := map[string][]*tree.Node{}
+	for _, c := range n.Elements() {
+		if _, ok := elements[c.Name()]; !ok {
+			names = append(names, c.Name())
+		}
+		elements[c.Name()] = append(elements[c.Name()], c)
+	}
+	return names, elements
+}
+
+// text returns the character data directly contained in n.
+func text(n *tree.Node) string {
+	buf := strings.Builder{}
+	for _, c := range n.Children {
+		if c.Kind() == gockl.TextKind || c.Kind() == gockl.CDATAKind {
+			buf.WriteString(c.Text())
+		}
+	}
+	return buf.String()
+}
+
+func writeBadgerFish(buf *bytes.Buffer, n *tree.Node, ns []namespace) {
+	attrs := n.Element().Attributes()
+	for _, a := range attrs {
+		if prefix, ok := namespacePrefix(a.Name); ok {
+			ns = declare(ns, prefix, gockl.Unescape(a.Content))
+		}
+	}
+
+	buf.WriteByte('{')
+	sep := ""
+	if len(ns) > 0 {
+		buf.WriteString(`"@xmlns":{`)
+		for i, d := range ns {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if d.prefix == "" {
+				writeString(buf, "$")
+			} else {
+				writeString(buf, d.prefix)
+			}
+			buf.WriteByte(':')
+			writeString(buf, d.uri)
+		}
+		buf.WriteByte('}')
+		sep = ","
+	}
+	for _, a := range attrs {
+		if _, ok := namespacePrefix(a.Name); ok {
+			continue
+		}
+		buf.WriteString(sep)
+		writeString(buf, "@"+a.Name)
+		buf.WriteByte(':')
+		writeString(buf, gockl.Unescape(a.Content))
+		sep = ","
+	}
+
+	names, elements := groups(n)
+	// whitespace between child elements is not content
+	if s := text(n); s != "" && (len(names) == 0 || strings.TrimSpace(s) != "") {
+		buf.WriteString(sep + `"$":`)
+		writeString(buf, s)
+		sep = ","
+	}
+	for _, name := range names {
+		buf.WriteString(sep)
+		writeString(buf, name)
+		buf.WriteByte(':')
+		if len(elements[name]) > 1 {
+			buf.WriteByte('[')
+		}
+		for i, c := range elements[name] {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeBadgerFish(buf, c, ns)
+		}
+		if len(elements[name]) > 1 {
+			buf.WriteByte(']')
+		}
+		sep = ","
+	}
+	buf.WriteByte('}')
+}
+
+// items returns the values of an array or v itself.
+func items(v *value) []*value {
+	if v.kind == arrayValue {
+		return v.items
+	}
+	return []*value{v}
+}
+
+func readBadgerFish(buf *strings.Builder, name string, v *value, ns []namespace) error {
+	if !validName(name) {
+		return fmt.Errorf("convert: invalid element name %q", name)
+	}
+
+	switch v.kind {
+	case nullValue:
+		buf.WriteString("<" + name + "/>")
+		return nil
+	case arrayValue:
+		return fmt.Errorf("convert: unexpected array for <%s>", name)
+	case objectValue:
+	default:
+		buf.WriteString("<" + name + ">" + gockl.EscapeText(v.text) + "</" + name + ">")
+		return nil
+	}
+
+	attrs := []gockl.Attribute{}
+	content := ""
+	children := []member{}
+	for _, m := range v.members {
+		switch {
+		case m.key == "@xmlns":
+			if m.value.kind != objectValue {
+				return fmt.Errorf("convert: @xmlns of <%s> must be an object", name)
+			}
+			declared := ns
+			for _, d := range m.value.members {
+				uri, ok := d.value.scalar()
+				if !ok {
+					return fmt.Errorf("convert: invalid namespace %s of <%s>", d.key, name)
+				}
+				prefix, attr := d.key, "xmlns:"+d.key
+				if prefix == "$" {
+					prefix, attr = "", "xmlns"
+				}
+				// only declare namespaces not inherited from the parent
+				inherited := false
+				for _, p := range declared {
+					inherited = inherited || (p.prefix == prefix && p.uri == uri)
+				}
+				if !inherited {
+					attrs = append(attrs, gockl.Attribute{Name: attr, Content: uri})
+					ns = declare(ns, prefix, uri)
+				}
+			}
+		case strings.HasPrefix(m.key, "@"):
+			s, ok := m.value.scalar()
+			if !ok || !validName(m.key[1:]) {
+				return fmt.Errorf("convert: invalid attribute %s of <%s>", m.key, name)
+			}
+			attrs = append(attrs, gockl.Attribute{Name: m.key[1:], Content: s})
+		case m.key == "$":
+			s, ok := m.value.scalar()
+			if !ok {
+				return fmt.Errorf("convert: invalid text content of <%s>", name)
+			}
+			content = s
+		default:
+			children = append(children, m)
+		}
+	}
+
+	empty := content == "" && len(children) == 0
+	writeStart(buf, name, attrs, empty)
+	if empty {
+		return nil
+	}
+	buf.WriteString(gockl.EscapeText(content))
+	for _, m := range children {
+		for _, item := range items(m.value) {
+			if err := readBadgerFish(buf, m.key, item, ns); err != nil {
+				return err
+			}
+		}
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
@@ -0,0 +1,303 @@
+// Package convert translates XML documents into JSON, YAML or TOML and back.
+// JSON is written using one of these conventions:
+//
+// BadgerFish maps elements to object members, attributes to members prefixed
+// by "@" and text content to "$" members, e.g. {"a":{"@href":"x","$":"y"}}.
+// The namespace declarations in scope are listed in "@xmlns" members, with
+// "$" for the default namespace. Elements of the same name are collected in
+// arrays.
+//
+// Parker drops attributes and the name of the document element. Elements
+// containing only text become strings, numbers, booleans or null (if empty),
+// e.g. {"item":[1,2]}.
+//
+// JsonML maps elements to arrays of their name, an object of attributes (if
+// any) and their children, e.g. ["a",{"href":"x"},"y"]. It is lossless: the
+// document's nodes are wrapped in a "#document" array, comments, CDATA
+// sections, processing instructions and directives become ["#comment", …],
+// ["#cdata", …], ["#pi", …] and ["#directive", …] with their raw content.
+// Markup that FromJSON would write differently is kept: start and end
+// elements in "@start" and "@end" members of the attributes, text as
+// ["#text", text, raw]. They are only used as long as they match the
+// element's name and attributes or the text, so the JSON can be changed
+// before converting it back.
+//
+// ToYAML and ToTOML export single elements using a simpler mapping meant to
+// be edited by hand, which is read back by FromYAML and FromTOML.
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+// Convention selects how XML is represented as JSON.
+type Convention uint8
+
+const (
+	BadgerFish Convention = iota
+	Parker
+	JsonML
+)
+
+var conventionNames = []string{
+	BadgerFish: "badgerfish",
+	Parker:     "parker",
+	JsonML:     "jsonml",
+}
+
+func (c Convention) String() string {
+	if int(c) < len(conventionNames) {
+		return conventionNames[c]
+	}
+	return fmt.Sprintf("Convention(%d)", c)
+}
+
+// ParseConvention returns the convention of the given name, e.g. "parker".
+func ParseConvention(name string) (Convention, error) {
+	for i, n := range conventionNames {
+		if strings.EqualFold(n, name) {
+			return Convention(i), nil
+		}
+	}
+	return 0, fmt.Errorf("convert: unknown convention %s", name)
+}
+
+// Options configures the conversion.
+type Options struct {
+	Convention Convention
+	// Indent is used to indent nested JSON values. If empty, the JSON is
+	// written on a single line.
+	Indent string
+	// Root is the name of the document element written by FromJSON using
+	// the Parker convention. Defaults to "root".
+	Root string
+}
+
+// ToJSON converts the XML document in input into JSON.
+func ToJSON(input string, o Options) (string, error) {
+	buf := strings.Builder{}
+	if err := WriteJSON(&buf, gockl.New(input), o); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// WriteJSON converts the XML document made up of the remaining tokens of z
+// into JSON and writes it to w.
+func WriteJSON(w io.Writer, z *gockl.Tokenizer, o Options) error {
+	doc, err := tree.Parse(z)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	switch o.Convention {
+	case BadgerFish:
+		buf.WriteByte('{')
+		writeString(buf, doc.Root.Name())
+		buf.WriteByte(':')
+		writeBadgerFish(buf, doc.Root, nil)
+		buf.WriteByte('}')
+	case Parker:
+		writeParker(buf, doc.Root)
+	case JsonML:
+		buf.WriteString(`["#document"`)
+		for _, n := range doc.Nodes {
+			buf.WriteByte(',')
+			writeJsonML(buf, n)
+		}
+		buf.WriteByte(']')
+	default:
+		return fmt.Errorf("convert: unknown convention %s", o.Convention)
+	}
+
+	if o.Indent != "" {
+		indented := &bytes.Buffer{}
+		if err := json.Indent(indented, buf.Bytes(), "", o.Indent); err != nil {
+			return err
+		}
+		buf = indented
+	}
+	buf.WriteByte('\n')
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// FromJSON converts JSON data into an XML document.
+func FromJSON(data string, o Options) (string, error) {
+	v, err := decode(data)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &strings.Builder{}
+	switch o.Convention {
+	case BadgerFish:
+		if v.kind != objectValue || len(v.members) != 1 {
+			return "", errors.New("convert: BadgerFish document must be an object with a single member")
+		}
+		err = readBadgerFish(buf, v.members[0].key, v.members[0].value, nil)
+	case Parker:
+		root := o.Root
+		if root == "" {
+			root = "root"
+		}
+		err = readParker(buf, root, v)
+	case JsonML:
+		err = readJsonMLDocument(buf, v)
+	default:
+		err = fmt.Errorf("convert: unknown convention %s", o.Convention)
+	}
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// writeString writes s as a JSON string. Invalid UTF-8 is replaced by
+// U+FFFD, just like encoding/json does.
+func writeString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buf.WriteString("\uFFFD")
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(byte(r))
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20:
+			buf.WriteString(`\u00`)
+			buf.WriteByte(hex[r>>4])
+			buf.WriteByte(hex[r&0xf])
+		default:
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+}
+
+type valueKind uint8
+
+const (
+	nullValue valueKind = iota
+	stringValue
+	numberValue
+	boolValue
+	arrayValue
+	objectValue
+)
+
+// value is a decoded JSON value, which keeps the order of object members.
+type value struct {
+	kind    valueKind
+	text    string
+	items   []*value
+	members []member
+}
+
+type member struct {
+	key   string
+	value *value
+}
+
+// scalar returns the text of strings, numbers and booleans.
+func (v *value) scalar() (string, bool) {
+	switch v.kind {
+	case stringValue, numberValue, boolValue:
+		return v.text, true
+	}
+	return "", false
+}
+
+func decode(data string) (*value, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	v, err := decodeValue(dec)
+	if err != nil {
+		return nil, fmt.Errorf("convert: %s", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("convert: unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func decodeValue(dec *json.Decoder) (*value, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := t.(type) {
+	case string:
+		return &value{kind: stringValue, text: t}, nil
+	case json.Number:
+		return &value{kind: numberValue, text: string(t)}, nil
+	case bool:
+		return &value{kind: boolValue, text: fmt.Sprint(t)}, nil
+	case json.Delim:
+		if t == '[' {
+			v := &value{kind: arrayValue}
+			for dec.More() {
+				item, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				v.items = append(v.items, item)
+			}
+			_, err := dec.Token()
+			return v, err
+		}
+		v := &value{kind: objectValue}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			item, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			v.members = append(v.members, member{key.(string), item})
+		}
+		_, err := dec.Token()
+		return v, err
+	}
+	return &value{kind: nullValue}, nil
+}
+
+// writeStart writes a start (or empty, if there is no content) element
+// using double quotes for all attributes.
+func writeStart(buf *strings.Builder, name string, attrs []gockl.Attribute, empty bool) {
+	buf.WriteString("<" + name)
+	for _, a := range attrs {
+		buf.WriteString(" " + a.Name + `="` + gockl.EscapeAttribute(a.Content, '"') + `"`)
+	}
+	if empty {
+		buf.WriteString("/>")
+	} else {
+		buf.WriteString(">")
+	}
+}
+
+func validName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\r\n<>&'\"=/!?")
+}
@@ -0,0 +1,323 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/roblillack/gockl/tree"
+)
+
+func TestBadgerFish(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<alice xmlns="http://some-namespace" xmlns:charlie="http://some-other-namespace" id="1">
+  <bob>charlie</bob>
+  <bob>david &amp; <![CDATA[eve]]></bob>
+  <charlie:edgar/>
+</alice>`
+	expected := `{"alice":{"@xmlns":{"$":"http://some-namespace","charlie":"http://some-other-namespace"},"@id":"1",` +
+		`"bob":[{"@xmlns":{"$":"http://some-namespace","charlie":"http://some-other-namespace"},"$":"charlie"},` +
+		`{"@xmlns":{"$":"http://some-namespace","charlie":"http://some-other-namespace"},"$":"david & eve"}],` +
+		`"charlie:edgar":{"@xmlns":{"$":"http://some-namespace","charlie":"http://some-other-namespace"}}}}` + "\n"
+	actual, err := ToJSON(input, Options{Convention: BadgerFish})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("Unexpected JSON:\n%s", actual)
+	}
+
+	xml, err := FromJSON(actual, Options{Convention: BadgerFish})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xml != `<alice xmlns="http://some-namespace" xmlns:charlie="http://some-other-namespace" id="1"><bob>charlie</bob><bob>david &amp; eve</bob><charlie:edgar/></alice>` {
+		t.Errorf("Unexpected XML:\n%s", xml)
+	}
+
+	if xml, err := FromJSON(`{"a":{"$":1,"b":[true,null,{"@x":"<"}]}}`, Options{}); err != nil || xml != `<a>1<b>true</b><b/><b x="&lt;"/></a>` {
+		t.Errorf("Unexpected result: %s, %v", xml, err)
+	}
+	for _, data := range []string{`[]`, `{"a":1,"b":2}`, `{"a":{"@x":{}}}`, `{"a b":1}`, `{"a":{"b":[[]]}}`, `{"a":1} x`} {
+		if _, err := FromJSON(data, Options{}); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+}
+
+func TestParker(t *testing.T) {
+	input := `<config>
+  <name>demo</name>
+  <port>8080</port>
+  <debug>false</debug>
+  <host>a</host>
+  <host>b</host>
+  <empty/>
+  <limits max="10"><soft>-1.5e3</soft><hard>12a</hard></limits>
+</config>`
+	expected := `{
+  "name": "demo",
+  "port": 8080,
+  "debug": false,
+  "host": [
+    "a",
+    "b"
+  ],
+  "empty": null,
+  "limits": {
+    "soft": -1.5e3,
+    "hard": "12a"
+  }
+}
+`
+	actual, err := ToJSON(input, Options{Convention: Parker, Indent: "  "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("Unexpected JSON:\n%s", actual)
+	}
+
+	xml, err := FromJSON(actual, Options{Convention: Parker, Root: "config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if xml != `<config><name>demo</name><port>8080</port><debug>false</debug><host>a</host><host>b</host><empty/><limits><soft>-1.5e3</soft><hard>12a</hard></limits></config>` {
+		t.Errorf("Unexpected XML:\n%s", xml)
+	}
+	if xml, err := FromJSON(`"x"`, Options{Convention: Parker}); err != nil || xml != "<root>x</root>" {
+		t.Errorf("Unexpected result: %s, %v", xml, err)
+	}
+	if _, err := FromJSON(`[1]`, Options{Convention: Parker}); err == nil || err.Error() != "convert: unexpected array for <root>" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestJsonML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE svg>
+<!-- icon -->
+<svg xmlns="http://www.w3.org/2000/svg"  viewBox='0 0 16 16'>
+  <title>A &amp; B &#x43;</title>
+  <g></g>
+  <style><![CDATA[ a > b {} ]]></style>
+  <?render fast?>
+  <path d="M0 0" />
+</svg >
+`
+	expected := `["#document",["#pi","xml version=\"1.0\" encoding=\"UTF-8\""],"\n",["#directive","DOCTYPE svg"],"\n",["#comment"," icon "],"\n",` +
+		`["svg",{"xmlns":"http://www.w3.org/2000/svg","viewBox":"0 0 16 16","@start":"<svg xmlns=\"http://www.w3.org/2000/svg\"  viewBox='0 0 16 16'>","@end":"</svg >"},` +
+		`"\n  ",["title",["#text","A & B C","A &amp; B &#x43;"]],"\n  ",["g",{"@start":"<g>"}],"\n  ",["style",["#cdata"," a > b {} "]],"\n  ",` +
+		`["#pi","render fast"],"\n  ",["path",{"d":"M0 0","@start":"<path d=\"M0 0\" />"}],"\n"],"\n"]` + "\n"
+	actual, err := ToJSON(input, Options{Convention: JsonML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual != expected {
+		t.Errorf("Unexpected JSON:\n%s", actual)
+	}
+
+	for _, o := range []Options{{Convention: JsonML}, {Convention: JsonML, Indent: "\t"}} {
+		data, err := ToJSON(input, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if xml, err := FromJSON(data, o); err != nil || xml != input {
+			t.Errorf("Round trip failed: %v\n%s", err, xml)
+		}
+	}
+
+	// raw markup is only used as long as it matches
+	data := strings.Replace(expected, `"viewBox":"0 0 16 16"`, `"viewBox":"0 0 32 32"`, 1)
+	data = strings.Replace(data, `"A & B C"`, `"A & B D"`, 1)
+	data = strings.Replace(data, `["g",{"@start":"<g>"}]`, `["g",{"@start":"<g>"},"x"]`, 1)
+	data = strings.Replace(data, `["path",{"d":"M0 0","@start":"<path d=\"M0 0\" />"}]`, `["path",{"d":"M0 0","@start":"<path d=\"M0 0\" />"},"x"]`, 1)
+	xml, err := FromJSON(data, Options{Convention: JsonML})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 32 32">`, `<title>A &amp; B D</title>`, `<g>x</g>`, `<path d="M0 0">x</path>`, `</svg >`} {
+		if !strings.Contains(xml, s) {
+			t.Errorf("Expected %s in:\n%s", s, xml)
+		}
+	}
+
+	if xml, err := FromJSON(`["a",{"b":"1"},"x",["c"],["#comment","y"]]`, Options{Convention: JsonML}); err != nil || xml != `<a b="1">x<c/><!--y--></a>` {
+		t.Errorf("Unexpected result: %s, %v", xml, err)
+	}
+	for _, data := range []string{`{}`, `[1]`, `["#comment","-->"]`, `["#pi","a?>"]`, `["a",{"b":[]}]`} {
+		if _, err := FromJSON(data, Options{Convention: JsonML}); err == nil {
+			t.Errorf("Expected error for %s", data)
+		}
+	}
+}
+
+func TestConvention(t *testing.T) {
+	for _, c := range []Convention{BadgerFish, Parker, JsonML} {
+		if parsed, err := ParseConvention(strings.ToUpper(c.String())); err != nil || parsed != c {
+			t.Errorf("Unable to parse %s: %v", c, err)
+		}
+	}
+	if _, err := ParseConvention("nope"); err == nil {
+		t.Error("Expected error for unknown convention")
+	}
+	if _, err := ToJSON("<a>", Options{}); err == nil {
+		t.Error("Expected error for unclosed element")
+	}
+}
+
+const config = `<config version="2">
+  <!-- servers -->
+  <server name="a" port="8080">primary</server>
+  <server name="b: backup">
+    <alias>b1</alias>
+    <alias>true</alias>
+  </server>
+  <timeout>30</timeout>
+  <motd>Hello,
+ "world" &amp; all</motd>
+  <empty/>
+</config>`
+
+func TestYAML(t *testing.T) {
+	doc, err := tree.ParseString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `config:
+  "@version": "2"
+  server:
+    - "@name": a
+      "@port": "8080"
+      "#text": primary
+    - "@name": "b: backup"
+      alias:
+        - b1
+        - "true"
+  timeout: "30"
+  motd: "Hello,\n \"world\" & all"
+  empty: ""
+`
+	actual := ToYAML(doc.Root)
+	if actual != expected {
+		t.Errorf("Unexpected YAML:\n%s", actual)
+	}
+
+	xml := `<config version="2"><server name="a" port="8080">primary</server><server name="b: backup"><alias>b1</alias><alias>true</alias></server><timeout>30</timeout><motd>Hello,
+ "world" &amp; all</motd><empty/></config>`
+	if result, err := FromYAML(actual); err != nil || result != xml {
+		t.Errorf("Unexpected XML: %v\n%s", err, result)
+	}
+
+	// hand-written YAML
+	edited := `---
+# generated
+config:
+  '@version': '3' # changed
+  server:
+  - '@name': a
+    '#text': 'it''s'
+  - {}
+  - ~
+  motd: |
+    Hello,
+      world
+  note: >-
+    folded
+    text
+
+    here
+  path: http://example.com/#top
+`
+	xml = `<config version="3"><server name="a">it's</server><server/><server/><motd>Hello,
+  world
+</motd><note>folded text
+here</note><path>http://example.com/#top</path></config>`
+	if result, err := FromYAML(edited); err != nil || result != xml {
+		t.Errorf("Unexpected XML: %v\n%s", err, result)
+	}
+
+	for data, msg := range map[string]string{
+		"":                        "convert: yaml: line 1: empty document",
+		"a:\n  b: 1\n c: 2":       "convert: yaml: line 3: unexpected indentation",
+		"a: [1, 2]":               "convert: yaml: line 1: flow collections are not supported",
+		"a:\n  - 1\n  b: 2":       "convert: yaml: line 3: unexpected indentation",
+		"a: \"x":                  "convert: yaml: line 1: unterminated quoted scalar",
+		"a: \"x\\q\"":             "convert: yaml: line 1: invalid escape sequence \\q",
+		"- a":                     "convert: document must be a mapping of element names",
+		"a:\n  \"@b\":\n    c: 1": "convert: invalid attribute @b of <a>",
+	} {
+		if _, err := FromYAML(data); err == nil || err.Error() != msg {
+			t.Errorf("Unexpected error for %q: %v", data, err)
+		}
+	}
+}
+
+func TestTOML(t *testing.T) {
+	doc, err := tree.ParseString(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[config]
+"@version" = "2"
+timeout = "30"
+motd = "Hello,\n \"world\" & all"
+empty = ""
+
+[[config.server]]
+"@name" = "a"
+"@port" = "8080"
+"#text" = "primary"
+
+[[config.server]]
+"@name" = "b: backup"
+alias = ["b1", "true"]
+`
+	actual := ToTOML(doc.Root)
+	if actual != expected {
+		t.Errorf("Unexpected TOML:\n%s", actual)
+	}
+
+	xml := `<config version="2"><timeout>30</timeout><motd>Hello,
+ "world" &amp; all</motd><empty/><server name="a" port="8080">primary</server><server name="b: backup"><alias>b1</alias><alias>true</alias></server></config>`
+	if result, err := FromTOML(actual); err != nil || result != xml {
+		t.Errorf("Unexpected XML: %v\n%s", err, result)
+	}
+
+	// hand-written TOML
+	edited := `# generated
+[config]
+"@version" = 3 # changed
+started = 1979-05-27 07:32:00
+server = [
+  { "@name" = 'a', "#text" = "it's" },
+  "b",
+]
+motd = """
+Hello,\
+   world \u00e9"""
+path = '''
+C:\temp'''
+
+[config.limits.soft]
+max = 10
+`
+	xml = `<config version="3"><started>1979-05-27 07:32:00</started><server name="a">it's</server><server>b</server><motd>Hello,world é</motd><path>C:\temp</path><limits><soft><max>10</max></soft></limits></config>`
+	if result, err := FromTOML(edited); err != nil || result != xml {
+		t.Errorf("Unexpected XML: %v\n%s", err, result)
+	}
+
+	for data, msg := range map[string]string{
+		"a = 1\na = 2":     "convert: toml: line 2: a is already defined",
+		"[a\nb = 1":        "convert: toml: line 1: expected ]",
+		"a = \"x\nb = 1":   "convert: toml: line 1: unterminated string",
+		"a = [1 2]":        "convert: toml: line 1: expected , or ]",
+		"a = 1 b = 2":      "convert: toml: line 1: expected end of line",
+		"a = 1\n[[a]]":     "convert: toml: line 2: a is not an array of tables",
+		"= 1":              "convert: toml: line 1: expected key",
+		"a = { b = [[]] }": "convert: unexpected array for <b>",
+	} {
+		if _, err := FromTOML(data); err == nil || err.Error() != msg {
+			t.Errorf("Unexpected error for %q: %v", data, err)
+		}
+	}
+}
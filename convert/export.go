@@ -0,0 +1,116 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+// element returns the mapping of the element n used for YAML and TOML:
+// Attributes become members prefixed by "@", the text content a "#text"
+// member and child elements members named after them, with arrays for
+// elements of the same name. Elements without attributes and child elements
+// are mapped to their text.
+func element(n *tree.Node) *value {
+	attrs := n.Element().AttributeSpans()
+	names, elements := groups(n)
+	s := text(n)
+	if len(attrs) == 0 && len(names) == 0 {
+		return &value{kind: stringValue, text: s}
+	}
+
+	v := &value{kind: objectValue}
+	for _, a := range attrs {
+		v.members = append(v.members, member{"@" + a.Name, &value{kind: stringValue, text: gockl.Unescape(a.Content)}})
+	}
+	// whitespace between child elements is not content
+	if s != "" && (len(names) == 0 || strings.TrimSpace(s) != "") {
+		v.members = append(v.members, member{"#text", &value{kind: stringValue, text: s}})
+	}
+	for _, name := range names {
+		if len(elements[name]) == 1 {
+			v.members = append(v.members, member{name, element(elements[name][0])})
+			continue
+		}
+		list := &value{kind: arrayValue}
+		for _, c := range elements[name] {
+			list.items = append(list.items, element(c))
+		}
+		v.members = append(v.members, member{name, list})
+	}
+	return v
+}
+
+// readElements writes the elements described by the members of v, which
+// is the reverse of element.
+func readElements(buf *strings.Builder, v *value) error {
+	if v.kind != objectValue {
+		return errors.New("convert: document must be a mapping of element names")
+	}
+	for _, m := range v.members {
+		for _, item := range items(m.value) {
+			if err := readElement(buf, m.key, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readElement(buf *strings.Builder, name string, v *value) error {
+	if !validName(name) {
+		return fmt.Errorf("convert: invalid element name %q", name)
+	}
+
+	switch v.kind {
+	case nullValue:
+		buf.WriteString("<" + name + "/>")
+		return nil
+	case arrayValue:
+		return fmt.Errorf("convert: unexpected array for <%s>", name)
+	case objectValue:
+	default:
+		if v.text == "" {
+			buf.WriteString("<" + name + "/>")
+		} else {
+			buf.WriteString("<" + name + ">" + gockl.EscapeText(v.text) + "</" + name + ">")
+		}
+		return nil
+	}
+
+	attrs := []gockl.Attribute{}
+	content := ""
+	children := &value{kind: objectValue}
+	for _, m := range v.members {
+		s, ok := m.value.scalar()
+		switch {
+		case strings.HasPrefix(m.key, "@"):
+			if (!ok && m.value.kind != nullValue) || !validName(m.key[1:]) {
+				return fmt.Errorf("convert: invalid attribute %s of <%s>", m.key, name)
+			}
+			attrs = append(attrs, gockl.Attribute{Name: m.key[1:], Content: s})
+		case m.key == "#text":
+			if !ok && m.value.kind != nullValue {
+				return fmt.Errorf("convert: invalid text content of <%s>", name)
+			}
+			content = s
+		default:
+			children.members = append(children.members, m)
+		}
+	}
+
+	empty := content == "" && len(children.members) == 0
+	writeStart(buf, name, attrs, empty)
+	if empty {
+		return nil
+	}
+	buf.WriteString(gockl.EscapeText(content))
+	if err := readElements(buf, children); err != nil {
+		return err
+	}
+	buf.WriteString("</" + name + ">")
+	return nil
+}
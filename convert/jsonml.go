@@ -0,0 +1,246 @@
+package convert
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+func writeJsonML(buf *bytes.Buffer, n *tree.Node) {
+	raw := n.Raw()[:n.Start.End-n.Offset()]
+
+	switch n.Kind() {
+	case gockl.TextKind:
+		s := gockl.Unescape(raw)
+		if gockl.EscapeText(s) == raw {
+			writeString(buf, s)
+			return
+		}
+		buf.WriteString(`["#text",`)
+		writeString(buf, s)
+		buf.WriteByte(',')
+		writeString(buf, raw)
+		buf.WriteByte(']')
+	case gockl.CDATAKind:
+		content, _ := gockl.CDATAToken(raw).Content()
+		writeSpecial(buf, "#cdata", content)
+	case gockl.CommentKind:
+		content, _ := gockl.CommentToken(raw).Content()
+		writeSpecial(buf, "#comment", content)
+	case gockl.ProcInstKind:
+		content, _ := gockl.ProcInstToken(raw).Content()
+		writeSpecial(buf, "#pi", content)
+	case gockl.DirectiveKind:
+		writeSpecial(buf, "#directive", strings.TrimSuffix(strings.TrimPrefix(raw, "<!"), ">"))
+	default:
+		writeJsonMLElement(buf, n, raw)
+	}
+}
+
+func writeSpecial(buf *bytes.Buffer, kind, content string) {
+	buf.WriteString(`["` + kind + `",`)
+	writeString(buf, content)
+	buf.WriteByte(']')
+}
+
+func writeJsonMLElement(buf *bytes.Buffer, n *tree.Node, start string) {
+	buf.WriteByte('[')
+	writeString(buf, n.Name())
+
+	attrs := []gockl.Attribute{}
+	for _, a := range n.Element().AttributeSpans() {
+		attrs = append(attrs, gockl.Attribute{Name: a.Name, Content: gockl.Unescape(a.Content)})
+	}
+	canonical := strings.Builder{}
+	writeStart(&canonical, n.Name(), attrs, len(n.Children) == 0)
+	if start == canonical.String() {
+		start = ""
+	}
+	end := ""
+	if n.End.Kind == gockl.EndElementKind {
+		end = n.Raw()[n.End.Start-n.Offset():]
+		if end == "</"+n.Name()+">" {
+			end = ""
+		}
+	}
+
+	if len(attrs) > 0 || start != "" || end != "" {
+		buf.WriteString(",{")
+		for i, a := range attrs {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeString(buf, a.Name)
+			buf.WriteByte(':')
+			writeString(buf, a.Content)
+		}
+		sep := len(attrs) > 0
+		for _, f := range []struct{ key, raw string }{{"@start", start}, {"@end", end}} {
+			if f.raw == "" {
+				continue
+			}
+			if sep {
+				buf.WriteByte(',')
+			}
+			writeString(buf, f.key)
+			buf.WriteByte(':')
+			writeString(buf, f.raw)
+			sep = true
+		}
+		buf.WriteByte('}')
+	}
+
+	for _, c := range n.Children {
+		buf.WriteByte(',')
+		writeJsonML(buf, c)
+	}
+	buf.WriteByte(']')
+}
+
+func readJsonMLDocument(buf *strings.Builder, v *value) error {
+	if v.kind != arrayValue || len(v.items) == 0 || v.items[0].text != "#document" {
+		return readJsonML(buf, v)
+	}
+	for _, item := range v.items[1:] {
+		if err := readJsonML(buf, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJsonML(buf *strings.Builder, v *value) error {
+	if s, ok := v.scalar(); ok {
+		buf.WriteString(gockl.EscapeText(s))
+		return nil
+	}
+	if v.kind != arrayValue || len(v.items) == 0 || v.items[0].kind != stringValue {
+		return errors.New("convert: JsonML nodes must be strings or arrays starting with a name")
+	}
+
+	kind := v.items[0].text
+	args := []string{}
+	for _, item := range v.items[1:] {
+		s, _ := item.scalar()
+		args = append(args, s)
+	}
+	switch kind {
+	case "#text":
+		if len(args) == 0 {
+			return errors.New("convert: #text without text")
+		}
+		if len(args) > 1 && gockl.Unescape(args[1]) == args[0] && !strings.ContainsRune(args[1], '<') {
+			buf.WriteString(args[1])
+		} else {
+			buf.WriteString(gockl.EscapeText(args[0]))
+		}
+	case "#cdata":
+		for _, t := range gockl.NewCDATA(strings.Join(args, "")) {
+			buf.WriteString(t.Raw())
+		}
+	case "#comment":
+		content := strings.Join(args, "")
+		if strings.Contains(content, "-->") {
+			return errors.New("convert: invalid comment content")
+		}
+		buf.WriteString("<!--" + content + "-->")
+	case "#pi":
+		content := strings.Join(args, "")
+		if strings.Contains(content, "?>") {
+			return errors.New("convert: invalid processing instruction content")
+		}
+		buf.WriteString("<?" + content + "?>")
+	case "#directive":
+		buf.WriteString("<!" + strings.Join(args, "") + ">")
+	default:
+		return readJsonMLElement(buf, kind, v.items[1:])
+	}
+	return nil
+}
+
+func readJsonMLElement(buf *strings.Builder, name string, rest []*value) error {
+	if !validName(name) {
+		return fmt.Errorf("convert: invalid element name %q", name)
+	}
+
+	attrs := []gockl.Attribute{}
+	start, end := "", ""
+	if len(rest) > 0 && rest[0].kind == objectValue {
+		for _, m := range rest[0].members {
+			s, ok := m.value.scalar()
+			switch {
+			case !ok:
+				return fmt.Errorf("convert: invalid attribute %s of <%s>", m.key, name)
+			case m.key == "@start":
+				start = s
+			case m.key == "@end":
+				end = s
+			case !validName(m.key):
+				return fmt.Errorf("convert: invalid attribute %s of <%s>", m.key, name)
+			default:
+				attrs = append(attrs, gockl.Attribute{Name: m.key, Content: s})
+			}
+		}
+		rest = rest[1:]
+	}
+
+	empty := len(rest) == 0
+	if kind, ok := matchStart(start, name, attrs); ok && (kind == gockl.StartElementKind || empty) {
+		buf.WriteString(start)
+		empty = kind == gockl.EmptyElementKind
+	} else {
+		writeStart(buf, name, attrs, empty)
+	}
+	if empty {
+		return nil
+	}
+
+	for _, c := range rest {
+		if err := readJsonML(buf, c); err != nil {
+			return err
+		}
+	}
+	if matchEnd(end, name) {
+		buf.WriteString(end)
+	} else {
+		buf.WriteString("</" + name + ">")
+	}
+	return nil
+}
+
+// single returns the only token of raw.
+func single(raw string) (gockl.Span, bool) {
+	// the tokenizer treats inputs shorter than four bytes as text
+	span, err := gockl.New(raw + "\n").NextSpan()
+	return span, err == nil && span.End == len(raw) && strings.HasSuffix(raw, ">")
+}
+
+// matchStart reports whether raw is a start or empty element of the given
+// name and attributes and returns its kind.
+func matchStart(raw, name string, attrs []gockl.Attribute) (gockl.TokenKind, bool) {
+	span, ok := single(raw)
+	if !ok || (span.Kind != gockl.StartElementKind && span.Kind != gockl.EmptyElementKind) {
+		return 0, false
+	}
+	t := span.Token(raw).(gockl.StartOrEmptyElementToken)
+	spans := t.AttributeSpans()
+	if t.Name() != name || len(spans) != len(attrs) {
+		return 0, false
+	}
+	for i, a := range spans {
+		if a.Name != attrs[i].Name || gockl.Unescape(a.Content) != attrs[i].Content {
+			return 0, false
+		}
+	}
+	return span.Kind, true
+}
+
+// matchEnd reports whether raw is an end element of the given name.
+func matchEnd(raw, name string) bool {
+	span, ok := single(raw)
+	return ok && span.Kind == gockl.EndElementKind && gockl.EndElementToken(raw).Name() == name
+}
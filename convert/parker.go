@@ -0,0 +1,80 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+func writeParker(buf *bytes.Buffer, n *tree.Node) {
+	names, elements := groups(n)
+	if len(names) == 0 {
+		switch s := text(n); {
+		case s == "":
+			buf.WriteString("null")
+		case s == "true" || s == "false" || jsonNumber.MatchString(s):
+			buf.WriteString(s)
+		default:
+			writeString(buf, s)
+		}
+		return
+	}
+
+	buf.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		writeString(buf, name)
+		buf.WriteByte(':')
+		if len(elements[name]) > 1 {
+			buf.WriteByte('[')
+		}
+		for j, c := range elements[name] {
+			if j > 0 {
+				buf.WriteByte(',')
+			}
+			writeParker(buf, c)
+		}
+		if len(elements[name]) > 1 {
+			buf.WriteByte(']')
+		}
+	}
+	buf.WriteByte('}')
+}
+
+func readParker(buf *strings.Builder, name string, v *value) error {
+	if !validName(name) {
+		return fmt.Errorf("convert: invalid element name %q", name)
+	}
+
+	switch v.kind {
+	case nullValue:
+		buf.WriteString("<" + name + "/>")
+	case arrayValue:
+		return fmt.Errorf("convert: unexpected array for <%s>", name)
+	case objectValue:
+		if len(v.members) == 0 {
+			buf.WriteString("<" + name + "/>")
+			return nil
+		}
+		buf.WriteString("<" + name + ">")
+		for _, m := range v.members {
+			for _, item := range items(m.value) {
+				if err := readParker(buf, m.key, item); err != nil {
+					return err
+				}
+			}
+		}
+		buf.WriteString("</" + name + ">")
+	default:
+		buf.WriteString("<" + name + ">" + gockl.EscapeText(v.text) + "</" + name + ">")
+	}
+	return nil
+}
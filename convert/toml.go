@@ -0,0 +1,496 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/roblillack/gockl/tree"
+)
+
+// ToTOML converts the element n and its descendants into a TOML document
+// using the same mapping as ToYAML. As TOML requires simple values to
+// precede tables, child elements mapped to tables are moved behind their
+// siblings.
+func ToTOML(n *tree.Node) string {
+	buf := &strings.Builder{}
+	writeTOML(buf, nil, &value{kind: objectValue, members: []member{{n.Name(), element(n)}}})
+	return buf.String()
+}
+
+// FromTOML converts a TOML document as written by ToTOML back into XML. All
+// values other than tables and arrays are treated as text.
+func FromTOML(data string) (string, error) {
+	v, err := parseTOML(data)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &strings.Builder{}
+	if err := readElements(buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// tables reports whether v is an array of tables.
+func tables(v *value) bool {
+	if v.kind != arrayValue || len(v.items) == 0 {
+		return false
+	}
+	for _, item := range v.items {
+		if item.kind != objectValue {
+			return false
+		}
+	}
+	return true
+}
+
+func writeTOML(buf *strings.Builder, path []string, v *value) {
+	for _, m := range v.members {
+		if m.value.kind != objectValue && !tables(m.value) {
+			buf.WriteString(tomlKey(m.key) + " = ")
+			writeTOMLValue(buf, m.value)
+			buf.WriteString("\n")
+		}
+	}
+
+	for _, m := range v.members {
+		p := append(path[:len(path):len(path)], tomlKey(m.key))
+		switch {
+		case m.value.kind == objectValue:
+			// tables without simple values are defined by their sub-tables
+			for _, c := range m.value.members {
+				if c.value.kind != objectValue && !tables(c.value) {
+					tomlHeader(buf, "["+strings.Join(p, ".")+"]")
+					break
+				}
+			}
+			writeTOML(buf, p, m.value)
+		case tables(m.value):
+			for _, item := range m.value.items {
+				tomlHeader(buf, "[["+strings.Join(p, ".")+"]]")
+				writeTOML(buf, p, item)
+			}
+		}
+	}
+}
+
+func tomlHeader(buf *strings.Builder, header string) {
+	if buf.Len() > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString(header + "\n")
+}
+
+func writeTOMLValue(buf *strings.Builder, v *value) {
+	switch v.kind {
+	case arrayValue:
+		buf.WriteString("[")
+		for i, item := range v.items {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeTOMLValue(buf, item)
+		}
+		buf.WriteString("]")
+	case objectValue:
+		buf.WriteString("{")
+		for i, m := range v.members {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(" " + tomlKey(m.key) + " = ")
+			writeTOMLValue(buf, m.value)
+		}
+		buf.WriteString(" }")
+	default:
+		buf.WriteString(tomlString(v.text))
+	}
+}
+
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+func tomlKey(key string) string {
+	if bareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlString(s string) string {
+	buf := strings.Builder{}
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\u%04x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+type tomlParser struct {
+	s   string
+	pos int
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(p.s[:p.pos], "\n")
+	return fmt.Errorf("convert: toml: line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+func (p *tomlParser) has(s string) bool {
+	return strings.HasPrefix(p.s[p.pos:], s)
+}
+
+// skip skips whitespace and comments and, if newlines is set, line breaks.
+func (p *tomlParser) skip(newlines bool) {
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == ' ' || c == '\t' || (newlines && (c == '\r' || c == '\n')):
+			p.pos++
+		case c == '#':
+			for p.pos < len(p.s) && p.s[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func parseTOML(data string) (*value, error) {
+	p := &tomlParser{s: data}
+	root := &value{kind: objectValue}
+	current := root
+	for {
+		p.skip(true)
+		if p.pos == len(p.s) {
+			return root, nil
+		}
+
+		if p.has("[") {
+			end := "]"
+			if p.has("[[") {
+				end = "]]"
+			}
+			p.pos += len(end)
+			keys, err := p.keys()
+			if err != nil {
+				return nil, err
+			}
+			if !p.has(end) {
+				return nil, p.errorf("expected %s", end)
+			}
+			p.pos += len(end)
+			if current, err = p.table(root, keys, end == "]]"); err != nil {
+				return nil, err
+			}
+		} else {
+			keys, err := p.keys()
+			if err != nil {
+				return nil, err
+			}
+			if !p.has("=") {
+				return nil, p.errorf("expected =")
+			}
+			p.pos++
+			p.skip(false)
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.set(current, keys, v); err != nil {
+				return nil, err
+			}
+		}
+
+		p.skip(false)
+		if p.pos < len(p.s) && !p.has("\n") && !p.has("\r\n") {
+			return nil, p.errorf("expected end of line")
+		}
+	}
+}
+
+// keys parses a dotted key.
+func (p *tomlParser) keys() ([]string, error) {
+	keys := []string{}
+	for {
+		p.skip(false)
+		switch {
+		case p.has(`"`):
+			k, err := p.basic(false)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		case p.has("'"):
+			k, err := p.literal(false)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, k)
+		default:
+			start := p.pos
+			for p.pos < len(p.s) && bareKey.MatchString(p.s[p.pos:p.pos+1]) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, p.errorf("expected key")
+			}
+			keys = append(keys, p.s[start:p.pos])
+		}
+		p.skip(false)
+		if !p.has(".") {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func lookup(t *value, key string) *value {
+	for _, m := range t.members {
+		if m.key == key {
+			return m.value
+		}
+	}
+	return nil
+}
+
+// table returns the table defined by a header, creating it if necessary.
+func (p *tomlParser) table(root *value, keys []string, array bool) (*value, error) {
+	t := root
+	for i, k := range keys {
+		last := i == len(keys)-1
+		v := lookup(t, k)
+		switch {
+		case v == nil && last && array:
+			v = &value{kind: arrayValue, items: []*value{{kind: objectValue}}}
+			t.members = append(t.members, member{k, v})
+			return v.items[0], nil
+		case v == nil:
+			v = &value{kind: objectValue}
+			t.members = append(t.members, member{k, v})
+		case last && array:
+			if !tables(v) {
+				return nil, p.errorf("%s is not an array of tables", k)
+			}
+			v.items = append(v.items, &value{kind: objectValue})
+			return v.items[len(v.items)-1], nil
+		case tables(v) && !last:
+			v = v.items[len(v.items)-1]
+		case v.kind != objectValue:
+			return nil, p.errorf("%s is already defined", k)
+		}
+		t = v
+	}
+	return t, nil
+}
+
+// set adds the value of a dotted key to the table t.
+func (p *tomlParser) set(t *value, keys []string, v *value) error {
+	for _, k := range keys[:len(keys)-1] {
+		next := lookup(t, k)
+		if next == nil {
+			next = &value{kind: objectValue}
+			t.members = append(t.members, member{k, next})
+		} else if next.kind != objectValue {
+			return p.errorf("%s is already defined", k)
+		}
+		t = next
+	}
+	k := keys[len(keys)-1]
+	if lookup(t, k) != nil {
+		return p.errorf("%s is already defined", k)
+	}
+	t.members = append(t.members, member{k, v})
+	return nil
+}
+
+var localTime = regexp.MustCompile(`^ [0-9]{2}:`)
+
+func (p *tomlParser) value() (*value, error) {
+	switch {
+	case p.has(`"""`), p.has(`"`):
+		s, err := p.basic(p.has(`"""`))
+		return &value{kind: stringValue, text: s}, err
+	case p.has("'''"), p.has("'"):
+		s, err := p.literal(p.has("'''"))
+		return &value{kind: stringValue, text: s}, err
+	case p.has("["):
+		p.pos++
+		v := &value{kind: arrayValue}
+		for {
+			p.skip(true)
+			if p.has("]") {
+				p.pos++
+				return v, nil
+			}
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.items = append(v.items, item)
+			p.skip(true)
+			if p.has(",") {
+				p.pos++
+			} else if !p.has("]") {
+				return nil, p.errorf("expected , or ]")
+			}
+		}
+	case p.has("{"):
+		p.pos++
+		v := &value{kind: objectValue}
+		for {
+			p.skip(false)
+			if p.has("}") && len(v.members) == 0 {
+				p.pos++
+				return v, nil
+			}
+			keys, err := p.keys()
+			if err != nil {
+				return nil, err
+			}
+			if !p.has("=") {
+				return nil, p.errorf("expected =")
+			}
+			p.pos++
+			p.skip(false)
+			item, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.set(v, keys, item); err != nil {
+				return nil, err
+			}
+			p.skip(false)
+			if p.has("}") {
+				p.pos++
+				return v, nil
+			}
+			if !p.has(",") {
+				return nil, p.errorf("expected , or }")
+			}
+			p.pos++
+		}
+	}
+
+	// numbers, booleans and dates are kept as they are
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(" \t\r\n,]}#", rune(p.s[p.pos])) {
+		p.pos++
+		if localTime.MatchString(p.s[p.pos:]) {
+			p.pos++
+		}
+	}
+	if start == p.pos {
+		return nil, p.errorf("expected value")
+	}
+	return &value{kind: stringValue, text: p.s[start:p.pos]}, nil
+}
+
+// newline skips a line break directly following the opening delimiter of a
+// multi-line string.
+func (p *tomlParser) newline() {
+	if p.has("\r\n") {
+		p.pos += 2
+	} else if p.has("\n") {
+		p.pos++
+	}
+}
+
+func (p *tomlParser) basic(multi bool) (string, error) {
+	delim := `"`
+	if multi {
+		delim = `"""`
+	}
+	p.pos += len(delim)
+	if multi {
+		p.newline()
+	}
+
+	buf := strings.Builder{}
+	for p.pos < len(p.s) {
+		if p.has(delim) {
+			p.pos += len(delim)
+			return buf.String(), nil
+		}
+
+		c := p.s[p.pos]
+		if c == '\n' && !multi {
+			return "", p.errorf("unterminated string")
+		}
+		p.pos++
+		switch {
+		case c != '\\':
+			buf.WriteByte(c)
+		case multi && lineEnding(p.s[p.pos:]):
+			// a line ending backslash trims all following whitespace
+			for p.pos < len(p.s) && strings.ContainsRune(" \t\r\n", rune(p.s[p.pos])) {
+				p.pos++
+			}
+		case p.pos < len(p.s):
+			e := p.s[p.pos]
+			p.pos++
+			if r, ok := tomlEscapes[e]; ok {
+				buf.WriteString(r)
+				continue
+			}
+			digits := map[byte]int{'u': 4, 'U': 8}[e]
+			if digits == 0 || p.pos+digits > len(p.s) {
+				return "", p.errorf("invalid escape sequence \\%c", e)
+			}
+			r, err := strconv.ParseUint(p.s[p.pos:p.pos+digits], 16, 32)
+			if err != nil {
+				return "", p.errorf("invalid escape sequence \\%c%s", e, p.s[p.pos:p.pos+digits])
+			}
+			buf.WriteRune(rune(r))
+			p.pos += digits
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// lineEnding reports whether s starts with a line break, optionally
+// preceded by whitespace.
+func lineEnding(s string) bool {
+	s = strings.TrimLeft(s, " \t")
+	return strings.HasPrefix(s, "\n") || strings.HasPrefix(s, "\r\n")
+}
+
+var tomlEscapes = map[byte]string{
+	'b': "\b", 't': "\t", 'n': "\n", 'f': "\f", 'r': "\r", 'e': "\x1b", '"': `"`, '\\': `\`,
+}
+
+func (p *tomlParser) literal(multi bool) (string, error) {
+	delim := "'"
+	if multi {
+		delim = "'''"
+	}
+	p.pos += len(delim)
+	if multi {
+		p.newline()
+	}
+
+	end := strings.Index(p.s[p.pos:], delim)
+	if end == -1 || (!multi && strings.Contains(p.s[p.pos:p.pos+end], "\n")) {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.s[p.pos : p.pos+end]
+	p.pos += end + len(delim)
+	return s, nil
+}
@@ -0,0 +1,406 @@
+package convert
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/roblillack/gockl/tree"
+)
+
+// ToYAML converts the element n and its descendants into a YAML mapping with
+// the element's name as only key. Attributes become keys prefixed by "@",
+// text content "#text" keys and elements of the same name sequences.
+// Elements without attributes and child elements are mapped to their text.
+func ToYAML(n *tree.Node) string {
+	buf := &strings.Builder{}
+	writeYAML(buf, &value{kind: objectValue, members: []member{{n.Name(), element(n)}}}, "")
+	return buf.String()
+}
+
+// FromYAML converts a YAML mapping as written by ToYAML back into XML.
+// Only block mappings and sequences of plain, quoted or block scalars are
+// supported, all scalars are treated as text.
+func FromYAML(data string) (string, error) {
+	p := newYAMLParser(data)
+	if p.peek() == nil {
+		return "", p.errorf(nil, "empty document")
+	}
+	v, err := p.block()
+	if err != nil {
+		return "", err
+	}
+	if l := p.peek(); l != nil {
+		return "", p.errorf(l, "unexpected indentation")
+	}
+
+	buf := &strings.Builder{}
+	if err := readElements(buf, v); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeYAML(buf *strings.Builder, v *value, indent string) {
+	for _, m := range v.members {
+		buf.WriteString(indent + yamlScalar(m.key) + ":")
+		writeYAMLValue(buf, m.value, indent)
+	}
+}
+
+// writeYAMLValue writes v following a key or sequence indicator.
+func writeYAMLValue(buf *strings.Builder, v *value, indent string) {
+	switch v.kind {
+	case objectValue:
+		buf.WriteString("\n")
+		writeYAML(buf, v, indent+"  ")
+	case arrayValue:
+		buf.WriteString("\n")
+		for _, item := range v.items {
+			buf.WriteString(indent + "  -")
+			if item.kind != objectValue {
+				writeYAMLValue(buf, item, indent+"  ")
+				continue
+			}
+			// the first key follows the indicator
+			sub := &strings.Builder{}
+			writeYAML(sub, item, indent+"    ")
+			buf.WriteString(" " + strings.TrimPrefix(sub.String(), indent+"    "))
+		}
+	case nullValue:
+		buf.WriteString(" ~\n")
+	default:
+		buf.WriteString(" " + yamlScalar(v.text) + "\n")
+	}
+}
+
+// yamlSpecial matches plain scalars which would not be read as strings.
+var yamlSpecial = regexp.MustCompile(`^(~|null|Null|NULL|true|True|TRUE|false|False|FALSE|yes|Yes|YES|no|No|NO|on|On|ON|off|Off|OFF|y|Y|n|N|[-+]?\.(inf|Inf|INF)|\.(nan|NaN|NAN))$|^[-+.]?[0-9]`)
+
+// yamlScalar returns s as plain scalar, if possible, or double-quoted.
+func yamlScalar(s string) string {
+	plain := s != "" && strings.TrimSpace(s) == s && !yamlSpecial.MatchString(s) &&
+		!strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") &&
+		!strings.Contains(s, ": ") && !strings.Contains(s, " #") && !strings.HasSuffix(s, ":")
+	for _, r := range s {
+		plain = plain && r >= 0x20 && r != 0x7f && r != utf8.RuneError
+	}
+	if plain {
+		return s
+	}
+
+	buf := strings.Builder{}
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&buf, `\x%02x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	// text is the line without indentation and trailing whitespace.
+	text string
+	raw  string
+	// blank is true for empty lines and comments.
+	blank bool
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func newYAMLParser(data string) *yamlParser {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.Replace(data, "\r\n", "\n", -1), "\n") {
+		text := strings.TrimLeft(raw, " ")
+		l := yamlLine{i + 1, len(raw) - len(text), strings.TrimRight(text, " \t"), raw, false}
+		// document markers and directives are ignored
+		l.blank = l.text == "" || l.text[0] == '#' || (l.indent == 0 && (l.text == "---" || l.text == "..." || l.text[0] == '%'))
+		p.lines = append(p.lines, l)
+	}
+	return p
+}
+
+func (p *yamlParser) errorf(l *yamlLine, format string, args ...interface{}) error {
+	num := len(p.lines)
+	if l != nil {
+		num = l.num
+	}
+	return fmt.Errorf("convert: yaml: line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next line, which is not blank.
+func (p *yamlParser) peek() *yamlLine {
+	for p.pos < len(p.lines) && p.lines[p.pos].blank {
+		p.pos++
+	}
+	if p.pos == len(p.lines) {
+		return nil
+	}
+	return &p.lines[p.pos]
+}
+
+func sequenceItem(s string) bool {
+	return s == "-" || strings.HasPrefix(s, "- ")
+}
+
+// block parses the mapping or sequence starting at the next line.
+func (p *yamlParser) block() (*value, error) {
+	l := p.peek()
+	if sequenceItem(l.text) {
+		return p.sequence(l.indent)
+	}
+	return p.mapping(l.indent)
+}
+
+func (p *yamlParser) mapping(indent int) (*value, error) {
+	v := &value{kind: objectValue}
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent {
+			return v, nil
+		}
+		if l.indent > indent || sequenceItem(l.text) {
+			return nil, p.errorf(l, "unexpected indentation")
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, p.errorf(l, "expected key")
+		}
+		p.pos++
+		item, err := p.value(l, rest, indent, true)
+		if err != nil {
+			return nil, err
+		}
+		v.members = append(v.members, member{key, item})
+	}
+}
+
+func (p *yamlParser) sequence(indent int) (*value, error) {
+	v := &value{kind: arrayValue}
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent || (l.indent == indent && !sequenceItem(l.text)) {
+			return v, nil
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, "unexpected indentation")
+		}
+
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var item *value
+		var err error
+		if _, _, ok := splitYAMLKey(rest); ok {
+			// a mapping starting on the line of the indicator
+			offset := l.indent + len(l.text) - len(rest)
+			p.lines[p.pos] = yamlLine{l.num, offset, rest, l.raw, false}
+			item, err = p.mapping(offset)
+		} else {
+			p.pos++
+			item, err = p.value(l, rest, indent, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		v.items = append(v.items, item)
+	}
+}
+
+// value parses the value following a key or sequence indicator on line l.
+func (p *yamlParser) value(l *yamlLine, rest string, indent int, key bool) (*value, error) {
+	switch {
+	case rest == "" || rest[0] == '#':
+		next := p.peek()
+		if next != nil && next.indent > indent {
+			return p.block()
+		}
+		// sequences may have the same indentation as their key
+		if key && next != nil && next.indent == indent && sequenceItem(next.text) {
+			return p.sequence(indent)
+		}
+		return &value{kind: nullValue}, nil
+	case rest[0] == '|' || rest[0] == '>':
+		return p.blockScalar(l, rest, indent)
+	case rest == "[]":
+		return &value{kind: arrayValue}, nil
+	case rest == "{}":
+		return &value{kind: objectValue}, nil
+	case rest[0] == '[' || rest[0] == '{':
+		return nil, p.errorf(l, "flow collections are not supported")
+	}
+
+	s, n, err := yamlQuoted(rest)
+	if err != nil {
+		return nil, p.errorf(l, "%s", err)
+	}
+	if n == 0 {
+		// plain scalar
+		if idx := strings.Index(rest, " #"); idx > -1 {
+			rest = rest[:idx]
+		}
+		switch s = strings.TrimSpace(rest); s {
+		case "~", "null", "Null", "NULL":
+			return &value{kind: nullValue}, nil
+		}
+		return &value{kind: stringValue, text: s}, nil
+	}
+	if after := strings.TrimSpace(rest[n:]); after != "" && after[0] != '#' {
+		return nil, p.errorf(l, "unexpected %s after quoted scalar", after)
+	}
+	return &value{kind: stringValue, text: s}, nil
+}
+
+// blockScalar parses a literal (|) or folded (>) block scalar.
+func (p *yamlParser) blockScalar(l *yamlLine, header string, indent int) (*value, error) {
+	if idx := strings.Index(header, " #"); idx > -1 {
+		header = header[:idx]
+	}
+	style, chomp := header[0], strings.TrimSpace(header[1:])
+	if chomp != "" && chomp != "-" && chomp != "+" {
+		return nil, p.errorf(l, "unsupported block scalar header %s", header)
+	}
+
+	lines := []string{}
+	blockIndent := -1
+	for ; p.pos < len(p.lines); p.pos++ {
+		next := p.lines[p.pos]
+		if strings.TrimSpace(next.raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		if blockIndent == -1 {
+			if next.indent <= indent {
+				break
+			}
+			blockIndent = next.indent
+		}
+		if next.indent < blockIndent {
+			break
+		}
+		lines = append(lines, next.raw[blockIndent:])
+	}
+
+	end := len(lines)
+	for end > 0 && lines[end-1] == "" {
+		end--
+	}
+	buf := strings.Builder{}
+	for i, line := range lines[:end] {
+		prev := ""
+		if i > 0 {
+			prev = lines[i-1]
+		}
+		// folding joins lines, which are not empty or more indented
+		folded := style == '>' && prev != "" && prev[0] != ' '
+		switch {
+		case i == 0:
+		case folded && line == "":
+		case folded && line[0] != ' ':
+			buf.WriteByte(' ')
+		default:
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	switch {
+	case chomp == "+":
+		buf.WriteString(strings.Repeat("\n", len(lines)-end+1))
+	case chomp == "" && end > 0:
+		buf.WriteByte('\n')
+	}
+	return &value{kind: stringValue, text: buf.String()}, nil
+}
+
+// splitYAMLKey splits a line of a mapping into the key and the rest.
+func splitYAMLKey(s string) (string, string, bool) {
+	key, n, err := yamlQuoted(s)
+	if err != nil {
+		return "", "", false
+	}
+	if n == 0 {
+		idx := strings.Index(s, ": ")
+		if idx == -1 && strings.HasSuffix(s, ":") {
+			idx = len(s) - 1
+		}
+		if idx < 1 || strings.Contains(s[:idx], " #") {
+			return "", "", false
+		}
+		key, n = strings.TrimSpace(s[:idx]), idx
+	}
+
+	rest := strings.TrimLeft(s[n:], " ")
+	if rest != ":" && !strings.HasPrefix(rest, ": ") {
+		return "", "", false
+	}
+	return key, strings.TrimSpace(rest[1:]), true
+}
+
+// yamlQuoted parses the single- or double-quoted scalar at the start of s
+// and returns its value and length. The length is zero, if s does not start
+// with a quote.
+func yamlQuoted(s string) (string, int, error) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", 0, nil
+	}
+
+	buf := strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\'' && s[0] == '\'':
+			if i+1 < len(s) && s[i+1] == '\'' {
+				buf.WriteByte('\'')
+				i++
+				continue
+			}
+			return buf.String(), i + 1, nil
+		case c == '"' && s[0] == '"':
+			return buf.String(), i + 1, nil
+		case c == '\\' && s[0] == '"' && i+1 < len(s):
+			i++
+			if r, ok := yamlEscapes[s[i]]; ok {
+				buf.WriteString(r)
+				continue
+			}
+			digits := map[byte]int{'x': 2, 'u': 4, 'U': 8}[s[i]]
+			if digits == 0 || i+digits >= len(s) {
+				return "", 0, fmt.Errorf("invalid escape sequence \\%c", s[i])
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+digits], 16, 32)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid escape sequence \\%s", s[i:i+1+digits])
+			}
+			buf.WriteRune(rune(r))
+			i += digits
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted scalar")
+}
+
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v",
+	'f': "\f", 'r': "\r", 'e': "\x1b", ' ': " ", '"': `"`, '/': "/", '\\': `\`,
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
@@ -0,0 +1,482 @@
+// Package diff compares two XML documents structurally. Differences that do
+// not change the meaning of a document, like attribute order, quote style,
+// the form of character references or `<a/>` vs. `<a></a>`, are ignored.
+package diff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+type ChangeKind uint8
+
+const (
+	// Insert is a node only present in the new document.
+	Insert ChangeKind = iota + 1
+	// Delete is a node only present in the old document.
+	Delete
+	// Move is a node present in both documents, but at different places.
+	Move
+	// AddAttribute is an attribute only present in the new document.
+	AddAttribute
+	// RemoveAttribute is an attribute only present in the old document.
+	RemoveAttribute
+	// ChangeAttribute is an attribute with different values.
+	ChangeAttribute
+	// ChangeText is a text node or comment with different content.
+	ChangeText
+)
+
+var kindNames = []string{"", "insert", "delete", "move", "add-attribute", "remove-attribute", "change-attribute", "change-text"}
+
+func (k ChangeKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return ""
+}
+
+// Range is a range of bytes in one of the inputs.
+type Range struct {
+	Start int
+	End   int
+}
+
+// Change describes a single difference between the two documents.
+type Change struct {
+	Kind ChangeKind
+	// OldPath and NewPath are the paths of the affected node in both
+	// documents. For insertions, OldPath is the path of the parent element
+	// in the old document and vice versa for deletions.
+	OldPath string
+	NewPath string
+	// Old and New are the ranges of the affected node or attribute in both
+	// inputs. For insertions, Old is the empty range where the node would
+	// have to be inserted into the old document and vice versa for
+	// deletions. For added attributes, Old is the range of the start
+	// element token and vice versa for removed attributes.
+	Old Range
+	New Range
+	// Name is the name of the attribute for attribute changes.
+	Name     string
+	OldValue string
+	NewValue string
+}
+
+// Options controls which nodes are considered significant.
+type Options struct {
+	// Comments enables comparing comments.
+	Comments bool
+	// Whitespace enables comparing whitespace-only text nodes.
+	Whitespace bool
+	// NoMoves reports moved nodes as pairs of deletions and insertions.
+	NoMoves bool
+}
+
+// Compare reads both tokenizers completely and returns the differences in
+// document order.
+func Compare(a, b *gockl.Tokenizer, o Options) ([]Change, error) {
+	docA, err := tree.Parse(a)
+	if err != nil {
+		return nil, err
+	}
+	docB, err := tree.Parse(b)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &differ{
+		o:          o,
+		signatures: map[*tree.Node]string{},
+		inserted:   map[int]unit{},
+		deleted:    map[int]unit{},
+	}
+	d.children(docA.Nodes, docB.Nodes, nil, nil, 0, 0)
+	if !o.NoMoves {
+		d.detectMoves()
+	}
+
+	return d.changes, nil
+}
+
+// Strings compares two documents given as strings.
+func Strings(a, b string, o Options) ([]Change, error) {
+	return Compare(gockl.New(a), gockl.New(b), o)
+}
+
+type differ struct {
+	o          Options
+	signatures map[*tree.Node]string
+	changes    []Change
+	// indices of insertions and deletions in changes
+	inserted map[int]unit
+	deleted  map[int]unit
+}
+
+// unit is a single node or a run of adjacent text nodes, that are compared
+// as a whole.
+type unit struct {
+	first *tree.Node
+	last  *tree.Node
+}
+
+func (u unit) isText() bool {
+	k := u.first.Kind()
+	return k == gockl.TextKind || k == gockl.CDATAKind
+}
+
+func (u unit) text() string {
+	buf := strings.Builder{}
+	for n := u.first; ; n = nextSibling(n) {
+		buf.WriteString(n.Text())
+		if n == u.last {
+			break
+		}
+	}
+	return buf.String()
+}
+
+func (u unit) path() string {
+	return u.first.Path()
+}
+
+func (u unit) r() Range {
+	return Range{u.first.Offset(), u.last.EndOffset()}
+}
+
+func nextSibling(n *tree.Node) *tree.Node {
+	siblings := n.Parent.Children
+	for i, c := range siblings {
+		if c == n && i+1 < len(siblings) {
+			return siblings[i+1]
+		}
+	}
+	return nil
+}
+
+func (d *differ) significant(nodes []*tree.Node) []unit {
+	r := []unit{}
+	for _, n := range nodes {
+		switch n.Kind() {
+		case gockl.StartElementKind, gockl.EmptyElementKind, gockl.ProcInstKind:
+		case gockl.TextKind, gockl.CDATAKind:
+			if len(r) > 0 && r[len(r)-1].isText() && n.Parent != nil {
+				r[len(r)-1].last = n
+				continue
+			}
+		case gockl.CommentKind:
+			if !d.o.Comments {
+				continue
+			}
+		default:
+			continue
+		}
+		r = append(r, unit{n, n})
+	}
+
+	if d.o.Whitespace {
+		return r
+	}
+
+	filtered := r[:0]
+	for _, u := range r {
+		if u.isText() && strings.Trim(u.text(), " \t\r\n") == "" {
+			continue
+		}
+		filtered = append(filtered, u)
+	}
+	return filtered
+}
+
+// key is used to match nodes that are not equal, but similar enough to be
+// compared in detail.
+func key(u unit) string {
+	n := u.first
+	switch n.Kind() {
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		return "<" + n.Name()
+	case gockl.TextKind, gockl.CDATAKind:
+		return "#"
+	case gockl.CommentKind:
+		return "!"
+	case gockl.ProcInstKind:
+		return "?" + gockl.ProcInstToken(n.Token().Raw()).Target()
+	}
+	return ""
+}
+
+// signature is equal for units that are considered equal.
+func (d *differ) signature(u unit) string {
+	n := u.first
+	if s, ok := d.signatures[n]; ok {
+		return s
+	}
+
+	buf := strings.Builder{}
+	switch n.Kind() {
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		buf.WriteString("<" + n.Name())
+		attrs := attributes(n)
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			buf.WriteString(" " + name + "=" + attrs[name].value)
+		}
+		buf.WriteString(">")
+		for _, c := range d.significant(n.Children) {
+			buf.WriteString(d.signature(c))
+		}
+		buf.WriteString("</>")
+	case gockl.TextKind, gockl.CDATAKind:
+		buf.WriteString("#" + u.text())
+	case gockl.CommentKind:
+		content, _ := gockl.CommentToken(n.Token().Raw()).Content()
+		buf.WriteString("!" + content)
+	default:
+		buf.WriteString(n.Token().Raw())
+	}
+
+	d.signatures[n] = buf.String()
+	return d.signatures[n]
+}
+
+type attribute struct {
+	value string
+	r     Range
+}
+
+func attributes(n *tree.Node) map[string]attribute {
+	r := map[string]attribute{}
+	for _, a := range n.Element().AttributeSpans() {
+		r[a.Name] = attribute{gockl.Unescape(a.Content), Range{n.Offset() + a.Start, n.Offset() + a.End}}
+	}
+	return r
+}
+
+func path(n *tree.Node) string {
+	if n == nil {
+		return ""
+	}
+	return n.Path()
+}
+
+// lcs returns the index pairs of the longest common subsequence of a and b
+// using the given equality function. Only common prefixes and suffixes are
+// matched if the lists in between are too long to compare.
+func lcs(a, b []unit, eq func(x, y unit) bool) [][2]int {
+	r := [][2]int{}
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && eq(a[prefix], b[prefix]) {
+		r = append(r, [2]int{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && eq(a[len(a)-1-suffix], b[len(b)-1-suffix]) {
+		suffix++
+	}
+
+	x, y := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	if len(x)*len(y) <= 1<<24 {
+		table := make([][]int, len(x)+1)
+		for i := range table {
+			table[i] = make([]int, len(y)+1)
+		}
+		for i := len(x) - 1; i >= 0; i-- {
+			for j := len(y) - 1; j >= 0; j-- {
+				if eq(x[i], y[j]) {
+					table[i][j] = table[i+1][j+1] + 1
+				} else if table[i+1][j] >= table[i][j+1] {
+					table[i][j] = table[i+1][j]
+				} else {
+					table[i][j] = table[i][j+1]
+				}
+			}
+		}
+
+		for i, j := 0, 0; i < len(x) && j < len(y); {
+			if eq(x[i], y[j]) {
+				r = append(r, [2]int{prefix + i, prefix + j})
+				i++
+				j++
+			} else if table[i+1][j] >= table[i][j+1] {
+				i++
+			} else {
+				j++
+			}
+		}
+	}
+
+	for k := suffix; k > 0; k-- {
+		r = append(r, [2]int{len(a) - k, len(b) - k})
+	}
+	return r
+}
+
+// children compares the child node lists of two matched parents. posA and
+// posB are the offsets where the content of the parents start.
+func (d *differ) children(nodesA, nodesB []*tree.Node, parentA, parentB *tree.Node, posA, posB int) {
+	a := d.significant(nodesA)
+	b := d.significant(nodesB)
+
+	// first, find nodes that are completely equal …
+	equal := lcs(a, b, func(x, y unit) bool {
+		return d.signature(x) == d.signature(y)
+	})
+	equal = append(equal, [2]int{len(a), len(b)})
+
+	// … then try to match the remaining nodes in between by name
+	i, j := 0, 0
+	for _, anchor := range equal {
+		gapA, gapB := a[i:anchor[0]], b[j:anchor[1]]
+		similar := lcs(gapA, gapB, func(x, y unit) bool {
+			return key(x) == key(y)
+		})
+		similar = append(similar, [2]int{len(gapA), len(gapB)})
+
+		k, l := 0, 0
+		for _, m := range similar {
+			for ; k < m[0]; k++ {
+				d.deleted[len(d.changes)] = gapA[k]
+				d.changes = append(d.changes, Change{
+					Kind:    Delete,
+					OldPath: gapA[k].path(),
+					NewPath: path(parentB),
+					Old:     gapA[k].r(),
+					New:     Range{posB, posB},
+				})
+			}
+			for ; l < m[1]; l++ {
+				d.inserted[len(d.changes)] = gapB[l]
+				d.changes = append(d.changes, Change{
+					Kind:    Insert,
+					OldPath: path(parentA),
+					NewPath: gapB[l].path(),
+					Old:     Range{posA, posA},
+					New:     gapB[l].r(),
+				})
+			}
+			if m[0] < len(gapA) {
+				d.compare(gapA[m[0]], gapB[m[1]])
+				posA, posB = gapA[m[0]].r().End, gapB[m[1]].r().End
+				k, l = m[0]+1, m[1]+1
+			}
+		}
+
+		if anchor[0] < len(a) {
+			posA, posB = a[anchor[0]].r().End, b[anchor[1]].r().End
+		}
+		i, j = anchor[0]+1, anchor[1]+1
+	}
+}
+
+// compare compares two units which have been matched by key.
+func (d *differ) compare(ua, ub unit) {
+	if d.signature(ua) == d.signature(ub) {
+		return
+	}
+
+	if !ua.first.IsElement() {
+		d.changes = append(d.changes, Change{
+			Kind:     ChangeText,
+			OldPath:  ua.path(),
+			NewPath:  ub.path(),
+			Old:      ua.r(),
+			New:      ub.r(),
+			OldValue: d.signature(ua)[1:],
+			NewValue: d.signature(ub)[1:],
+		})
+		return
+	}
+
+	a, b := ua.first, ub.first
+	attrsA, attrsB := attributes(a), attributes(b)
+	for _, span := range a.Element().AttributeSpans() {
+		name := span.Name
+		old := attrsA[name]
+		if attr, ok := attrsB[name]; !ok {
+			d.changes = append(d.changes, Change{
+				Kind:     RemoveAttribute,
+				OldPath:  a.Path(),
+				NewPath:  b.Path(),
+				Old:      old.r,
+				New:      Range{b.Start.Start, b.Start.End},
+				Name:     name,
+				OldValue: old.value,
+			})
+		} else if attr.value != old.value {
+			d.changes = append(d.changes, Change{
+				Kind:     ChangeAttribute,
+				OldPath:  a.Path(),
+				NewPath:  b.Path(),
+				Old:      old.r,
+				New:      attr.r,
+				Name:     name,
+				OldValue: old.value,
+				NewValue: attr.value,
+			})
+		}
+	}
+	for _, span := range b.Element().AttributeSpans() {
+		name := span.Name
+		if _, ok := attrsA[name]; !ok {
+			d.changes = append(d.changes, Change{
+				Kind:     AddAttribute,
+				OldPath:  a.Path(),
+				NewPath:  b.Path(),
+				Old:      Range{a.Start.Start, a.Start.End},
+				New:      attrsB[name].r,
+				Name:     name,
+				NewValue: attrsB[name].value,
+			})
+		}
+	}
+
+	d.children(a.Children, b.Children, a, b, a.ContentOffset(), b.ContentOffset())
+}
+
+// detectMoves turns pairs of deleted and inserted nodes, that are equal,
+// into moves.
+func (d *differ) detectMoves() {
+	inserted := map[string][]int{}
+	for idx := range d.changes {
+		if n, ok := d.inserted[idx]; ok {
+			s := d.signature(n)
+			inserted[s] = append(inserted[s], idx)
+		}
+	}
+
+	dropped := map[int]bool{}
+	for idx := range d.changes {
+		n, ok := d.deleted[idx]
+		if !ok {
+			continue
+		}
+		s := d.signature(n)
+		if candidates := inserted[s]; len(candidates) > 0 {
+			m := d.inserted[candidates[0]]
+			d.changes[idx] = Change{
+				Kind:    Move,
+				OldPath: n.path(),
+				NewPath: m.path(),
+				Old:     n.r(),
+				New:     m.r(),
+			}
+			dropped[candidates[0]] = true
+			inserted[s] = candidates[1:]
+		}
+	}
+
+	r := []Change{}
+	for idx, c := range d.changes {
+		if !dropped[idx] {
+			r = append(r, c)
+		}
+	}
+	d.changes = r
+}
@@ -0,0 +1,151 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/roblillack/gockl/tree"
+)
+
+func TestIgnoredDifferences(t *testing.T) {
+	a := `<?xml version="1.0"?>
+<doc a="1" b='2 &amp; 3'>
+  <!-- comment -->
+  <empty></empty>
+  <text>&#65;&lt;<![CDATA[B]]></text>
+</doc>`
+	b := `<?xml version="1.0"?><doc b="2 &#38; 3"   a="1"><empty/><text>A&lt;B</text></doc>`
+
+	changes, err := Strings(a, b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes, got: %+v", changes)
+	}
+
+	changes, err = Strings(a, b, Options{Comments: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != Delete || changes[0].OldPath != "/doc/comment()" {
+		t.Errorf("Expected deleted comment, got: %+v", changes)
+	}
+}
+
+func TestChanges(t *testing.T) {
+	a := `<doc>
+  <title lang="en" old="x">Hello</title>
+  <item id="1"/>
+  <item id="2"/>
+  <item id="3"><sub>deep</sub></item>
+  <gone/>
+</doc>`
+	b := `<doc>
+  <item id="3"><sub>deep</sub></item>
+  <title lang="de" new="y">Hallo</title>
+  <item id="1"/>
+  <item id="2"/>
+  <added/>
+</doc>`
+
+	changes, err := Strings(a, b, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset := func(doc, s string) int {
+		for i := 0; i+len(s) <= len(doc); i++ {
+			if doc[i:i+len(s)] == s {
+				return i
+			}
+		}
+		t.Fatalf("%s not found", s)
+		return -1
+	}
+	rangeOf := func(doc, s string) Range {
+		start := offset(doc, s)
+		return Range{start, start + len(s)}
+	}
+
+	expected := []Change{
+		{
+			Kind: ChangeAttribute, OldPath: "/doc/title", NewPath: "/doc/title",
+			Old: rangeOf(a, `lang="en"`), New: rangeOf(b, `lang="de"`),
+			Name: "lang", OldValue: "en", NewValue: "de",
+		},
+		{
+			Kind: RemoveAttribute, OldPath: "/doc/title", NewPath: "/doc/title",
+			Old: rangeOf(a, `old="x"`), New: rangeOf(b, `<title lang="de" new="y">`),
+			Name: "old", OldValue: "x",
+		},
+		{
+			Kind: AddAttribute, OldPath: "/doc/title", NewPath: "/doc/title",
+			Old: rangeOf(a, `<title lang="en" old="x">`), New: rangeOf(b, `new="y"`),
+			Name: "new", NewValue: "y",
+		},
+		{
+			Kind: ChangeText, OldPath: "/doc/title/text()", NewPath: "/doc/title/text()",
+			Old: rangeOf(a, "Hello"), New: rangeOf(b, "Hallo"),
+			OldValue: "Hello", NewValue: "Hallo",
+		},
+		{
+			Kind: Move, OldPath: "/doc/item[3]", NewPath: "/doc/item[1]",
+			Old: rangeOf(a, `<item id="3"><sub>deep</sub></item>`), New: rangeOf(b, `<item id="3"><sub>deep</sub></item>`),
+		},
+		{
+			Kind: Delete, OldPath: "/doc/gone", NewPath: "/doc",
+			Old: rangeOf(a, `<gone/>`), New: Range{rangeOf(b, `<item id="2"/>`).End, rangeOf(b, `<item id="2"/>`).End},
+		},
+		{
+			Kind: Insert, OldPath: "/doc", NewPath: "/doc/added",
+			Old: Range{rangeOf(a, `<item id="2"/>`).End, rangeOf(a, `<item id="2"/>`).End}, New: rangeOf(b, `<added/>`),
+		},
+	}
+
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes, got %d: %+v", len(expected), len(changes), changes)
+	}
+	for i, c := range changes {
+		if i < len(expected) && !reflect.DeepEqual(c, expected[i]) {
+			t.Errorf("Wrong change %d:\n%+v (actual)\n%+v (expected)", i, c, expected[i])
+		}
+	}
+}
+
+func TestReplacedRoot(t *testing.T) {
+	changes, err := Strings(`<a/>`, `<b/>`, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Kind != Delete || changes[1].Kind != Insert {
+		t.Errorf("Expected root replacement, got: %+v", changes)
+	}
+}
+
+func TestBrokenDocuments(t *testing.T) {
+	if _, err := Strings(`<a>`, `<a/>`, Options{}); err == nil {
+		t.Error("Expected error for broken old document")
+	}
+	if _, err := Strings(`<a/>`, `<a></b>`, Options{}); err == nil {
+		t.Error("Expected error for broken new document")
+	}
+}
+
+func TestManySiblings(t *testing.T) {
+	// too many siblings for comparing every pair, only the common prefix and
+	// suffix are matched
+	n := 20000
+	nodes := make([]tree.Node, n)
+	a, b := make([]unit, n), make([]unit, n)
+	for i := range a {
+		a[i].first = &nodes[i]
+		b[i].first = &nodes[n-1-i]
+	}
+	b[0].first, b[n-1].first = &nodes[0], &nodes[n-1]
+
+	r := lcs(a, b, func(x, y unit) bool { return x.first == y.first })
+	if !reflect.DeepEqual(r, [][2]int{{0, 0}, {n - 1, n - 1}}) {
+		t.Errorf("Unexpected result: %v", r)
+	}
+}
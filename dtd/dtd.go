@@ -0,0 +1,669 @@
+// Package dtd validates documents against document type definitions.
+//
+// Element type declarations are compiled into automata, which are used to
+// check the content of elements while streaming through the tokens of a
+// document. Attribute declarations are used to check for undeclared,
+// missing and invalid attributes, including the integrity of ID and IDREF
+// attributes. The DTD is read from the document's internal subset and, using
+// a Resolver, from external subsets and external parameter entities.
+package dtd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// ContentKind describes the allowed content of an element type.
+type ContentKind uint8
+
+const (
+	// Empty elements must not have any content.
+	Empty ContentKind = iota + 1
+	// Any allows any content consisting of declared elements.
+	Any
+	// Mixed allows character data mixed with a list of elements.
+	Mixed
+	// Children allows element content matching a content model only.
+	Children
+)
+
+// Element is an element type declaration.
+type Element struct {
+	Name string
+	Kind ContentKind
+	// Model is the content specification as written in the declaration.
+	Model string
+	// Names are the elements allowed in mixed content.
+	Names []string
+
+	automaton *automaton
+}
+
+// DefaultKind describes the default declaration of an attribute.
+type DefaultKind uint8
+
+const (
+	// Implied attributes are optional and have no default.
+	Implied DefaultKind = iota + 1
+	// Required attributes must be present on every element.
+	Required
+	// Fixed attributes must have the default value, if present.
+	Fixed
+	// Value attributes are optional and have a default value.
+	Value
+)
+
+// Attribute is the declaration of a single attribute of an element type.
+type Attribute struct {
+	Name string
+	// Type is one of CDATA, ID, IDREF, IDREFS, ENTITY, ENTITIES, NMTOKEN,
+	// NMTOKENS, NOTATION or ENUMERATION.
+	Type string
+	// Values lists the allowed values of NOTATION and ENUMERATION
+	// attributes.
+	Values  []string
+	Default DefaultKind
+	// Value is the default value of Fixed and Value attributes.
+	Value string
+}
+
+// DTD is a document type definition.
+type DTD struct {
+	// Name is the name of the document element.
+	Name     string
+	Elements map[string]*Element
+	// Attributes maps element names to the declarations of their
+	// attributes.
+	Attributes map[string]map[string]*Attribute
+	// Entities maps the names of internal general entities to their
+	// replacement text.
+	Entities map[string]string
+	// External lists general entities declared using an external
+	// identifier. Unparsed entities are mapped to true.
+	External  map[string]bool
+	Notations map[string]bool
+
+	parameters map[string]*entity
+}
+
+type entity struct {
+	value    string
+	publicID string
+	systemID string
+	base     string
+}
+
+func newDTD() *DTD {
+	return &DTD{
+		Elements:   map[string]*Element{},
+		Attributes: map[string]map[string]*Attribute{},
+		Entities:   map[string]string{},
+		External:   map[string]bool{},
+		Notations:  map[string]bool{},
+		parameters: map[string]*entity{},
+	}
+}
+
+// Defaults returns the default values of the attributes of the given element
+// type.
+func (d *DTD) Defaults(element string) map[string]string {
+	r := map[string]string{}
+	for name, a := range d.Attributes[element] {
+		if a.Default == Fixed || a.Default == Value {
+			r[name] = a.Value
+		}
+	}
+	return r
+}
+
+// Resolver loads external subsets and external parameter entities.
+type Resolver interface {
+	Resolve(publicID, systemID string) (string, error)
+}
+
+// ResolverFunc is a function implementing Resolver.
+type ResolverFunc func(publicID, systemID string) (string, error)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(publicID, systemID string) (string, error) {
+	return f(publicID, systemID)
+}
+
+// DirResolver returns a Resolver that loads system identifiers that are
+// relative paths from the given directory. Absolute paths, URLs and paths
+// leaving the directory are rejected.
+func DirResolver(dir string) Resolver {
+	return ResolverFunc(func(publicID, systemID string) (string, error) {
+		// backslashes are not allowed in URIs, but separate paths on Windows
+		clean := path.Clean(systemID)
+		if strings.ContainsAny(systemID, ":\\") || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return "", fmt.Errorf("dtd: refusing to load %s", systemID)
+		}
+		name := filepath.Join(dir, filepath.FromSlash(clean))
+		if rel, err := filepath.Rel(dir, name); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("dtd: refusing to load %s", systemID)
+		}
+
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	})
+}
+
+// SyntaxError is returned for malformed declarations.
+type SyntaxError struct {
+	// SystemID is the system identifier of the external subset or entity
+	// containing the error or empty for the internal subset.
+	SystemID string
+	gockl.Location
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.SystemID != "" {
+		return "dtd: " + e.SystemID + ":" + e.Location.String() + ": " + e.Msg
+	}
+	return "dtd: " + e.Location.String() + ": " + e.Msg
+}
+
+// Parse parses the declarations of an external subset. External parameter
+// entities are loaded using r, which may be nil.
+func Parse(s string, r Resolver) (*DTD, error) {
+	d := newDTD()
+	p := &parser{d: d, r: r}
+	if err := p.parse(s, source{text: s}); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// source is the text being parsed, either the document, the internal subset
+// or an external entity, used for error positions.
+type source struct {
+	text     string
+	systemID string
+	// offset of the declarations inside of text
+	offset int
+}
+
+type parser struct {
+	d     *DTD
+	r     Resolver
+	depth int
+}
+
+func (p *parser) errorf(src source, offset int, format string, args ...interface{}) error {
+	return &SyntaxError{src.systemID, gockl.Locate(src.text, src.offset+offset), fmt.Sprintf(format, args...)}
+}
+
+// resolve loads an external entity relative to the one containing the
+// reference.
+func (p *parser) resolve(e *entity) (string, string, error) {
+	systemID := e.systemID
+	if e.base != "" && !strings.Contains(systemID, ":") && !path.IsAbs(systemID) {
+		systemID = path.Join(path.Dir(e.base), systemID)
+	}
+	if p.r == nil {
+		return "", systemID, fmt.Errorf("no resolver to load %s", systemID)
+	}
+	text, err := p.r.Resolve(e.publicID, systemID)
+	return text, systemID, err
+}
+
+// parameter returns the replacement text of a parameter entity.
+func (p *parser) parameter(name string) (string, source, error) {
+	e, ok := p.d.parameters[name]
+	if !ok {
+		return "", source{}, fmt.Errorf("undeclared parameter entity %%%s;", name)
+	}
+	if e.systemID == "" {
+		return e.value, source{text: e.value, systemID: "%" + name + ";"}, nil
+	}
+
+	text, systemID, err := p.resolve(e)
+	if err != nil {
+		return "", source{}, err
+	}
+	return text, source{text: text, systemID: systemID}, nil
+}
+
+// parse parses the declarations in s, which starts at src.offset of src.
+func (p *parser) parse(s string, src source) error {
+	if p.depth > 16 {
+		return p.errorf(src, 0, "parameter entities nested too deeply")
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	for pos := 0; pos < len(s); {
+		rest := s[pos:]
+		switch {
+		case strings.IndexByte(" \t\r\n", rest[0]) > -1:
+			pos++
+		case rest[0] == '%':
+			end := strings.IndexByte(rest, ';')
+			if end == -1 || !isName(rest[1:end]) {
+				return p.errorf(src, pos, "invalid parameter entity reference")
+			}
+			text, sub, err := p.parameter(rest[1:end])
+			if err != nil {
+				return p.errorf(src, pos, "%s", err)
+			}
+			if err := p.parse(text, sub); err != nil {
+				// report errors inside internal entities at the reference
+				if e, ok := err.(*SyntaxError); ok && strings.HasPrefix(e.SystemID, "%") {
+					e.SystemID = src.systemID
+					e.Location = gockl.Locate(src.text, src.offset+pos)
+				}
+				return err
+			}
+			pos += end + 1
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest, "-->")
+			if end == -1 {
+				return p.errorf(src, pos, "unterminated comment")
+			}
+			pos += end + 3
+		case strings.HasPrefix(rest, "<?"):
+			end := strings.Index(rest, "?>")
+			if end == -1 {
+				return p.errorf(src, pos, "unterminated processing instruction")
+			}
+			pos += end + 2
+		case strings.HasPrefix(rest, "<!["):
+			n, err := p.conditional(rest, src, pos)
+			if err != nil {
+				return err
+			}
+			pos += n
+		case strings.HasPrefix(rest, "<!"):
+			end := declarationEnd(rest)
+			if end == -1 {
+				return p.errorf(src, pos, "unterminated declaration")
+			}
+			if err := p.declaration(rest[2:end], src, pos); err != nil {
+				return err
+			}
+			pos += end + 1
+		default:
+			return p.errorf(src, pos, "unexpected character %q", rest[0])
+		}
+	}
+
+	return nil
+}
+
+// declarationEnd returns the index of the closing bracket of the
+// declaration starting at s, skipping quoted literals.
+func declarationEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			end := strings.IndexByte(s[i+1:], s[i])
+			if end == -1 {
+				return -1
+			}
+			i += end + 1
+		case '>':
+			return i
+		}
+	}
+	return -1
+}
+
+// conditional handles an INCLUDE or IGNORE section starting at s and returns
+// its length.
+func (p *parser) conditional(s string, src source, offset int) (int, error) {
+	pos := 3
+	for pos < len(s) && strings.IndexByte(" \t\r\n", s[pos]) > -1 {
+		pos++
+	}
+	open := strings.IndexByte(s[pos:], '[')
+	if open == -1 {
+		return 0, p.errorf(src, offset, "invalid conditional section")
+	}
+	keyword := strings.TrimSpace(s[pos : pos+open])
+	if strings.HasPrefix(keyword, "%") && strings.HasSuffix(keyword, ";") {
+		text, _, err := p.parameter(keyword[1 : len(keyword)-1])
+		if err != nil {
+			return 0, p.errorf(src, offset, "%s", err)
+		}
+		keyword = strings.TrimSpace(text)
+	}
+	pos += open + 1
+
+	// find the end, taking nested sections into account
+	depth := 1
+	end := pos
+	for depth > 0 {
+		next := strings.Index(s[end:], "]]>")
+		if next == -1 {
+			return 0, p.errorf(src, offset, "unterminated conditional section")
+		}
+		depth += strings.Count(s[end:end+next], "<![") - 1
+		end += next + 3
+	}
+
+	switch keyword {
+	case "INCLUDE":
+		if err := p.parse(s[pos:end-3], source{src.text, src.systemID, src.offset + offset + pos}); err != nil {
+			return 0, err
+		}
+	case "IGNORE":
+	default:
+		return 0, p.errorf(src, offset, "invalid conditional section keyword %s", keyword)
+	}
+
+	return end, nil
+}
+
+// expand replaces parameter entity references outside of literals.
+func (p *parser) expand(s string) (string, error) {
+	if !strings.Contains(s, "%") {
+		return s, nil
+	}
+
+	buf := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(s[i+1:], c)
+			if end == -1 {
+				end = len(s) - i - 1
+			}
+			buf.WriteString(s[i : i+end+2])
+			i += end + 1
+		case c == '%' && i+1 < len(s) && strings.IndexByte(" \t\r\n", s[i+1]) == -1:
+			end := strings.IndexByte(s[i:], ';')
+			if end == -1 {
+				return "", fmt.Errorf("invalid parameter entity reference")
+			}
+			text, _, err := p.parameter(s[i+1 : i+end])
+			if err != nil {
+				return "", err
+			}
+			if p.depth > 16 {
+				return "", fmt.Errorf("parameter entities nested too deeply")
+			}
+			p.depth++
+			text, err = p.expand(text)
+			p.depth--
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(" " + text + " ")
+			i += end
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// declaration handles a single markup declaration without the leading `<!`
+// and the closing bracket.
+func (p *parser) declaration(decl string, src source, offset int) error {
+	keyword := decl
+	if idx := strings.IndexAny(decl, " \t\r\n"); idx > -1 {
+		keyword = decl[:idx]
+	}
+
+	var err error
+	s := &scanner{}
+	if keyword == "ENTITY" {
+		// parameter entity references are not expanded in entity
+		// declarations, as they are only allowed in between them
+		s.s = decl[len(keyword):]
+	} else if s.s, err = p.expand(decl[len(keyword):]); err != nil {
+		return p.errorf(src, offset, "%s", err)
+	}
+
+	switch keyword {
+	case "ELEMENT":
+		err = p.element(s)
+	case "ATTLIST":
+		err = p.attlist(s)
+	case "ENTITY":
+		err = p.entity(s, src)
+	case "NOTATION":
+		err = p.notation(s)
+	default:
+		err = fmt.Errorf("unknown declaration <!%s", keyword)
+	}
+	if err == nil && !s.end() {
+		err = fmt.Errorf("unexpected %q in <!%s declaration", s.rest(), keyword)
+	}
+	if err != nil {
+		return p.errorf(src, offset, "%s", err)
+	}
+
+	return nil
+}
+
+func (p *parser) element(s *scanner) error {
+	if !s.space() {
+		return fmt.Errorf("missing element name")
+	}
+	name := s.name()
+	if name == "" {
+		return fmt.Errorf("missing element name")
+	}
+	if !s.space() {
+		return fmt.Errorf("missing content specification for <%s>", name)
+	}
+	if _, ok := p.d.Elements[name]; ok {
+		return fmt.Errorf("element type <%s> declared more than once", name)
+	}
+
+	start := s.pos
+	el, err := parseContent(name, s)
+	if err != nil {
+		return err
+	}
+	el.Model = strings.TrimSpace(s.s[start:s.pos])
+	p.d.Elements[name] = el
+
+	return nil
+}
+
+func (p *parser) attlist(s *scanner) error {
+	s.space()
+	element := s.name()
+	if element == "" {
+		return fmt.Errorf("missing element name")
+	}
+	if p.d.Attributes[element] == nil {
+		p.d.Attributes[element] = map[string]*Attribute{}
+	}
+	attrs := p.d.Attributes[element]
+
+	for {
+		s.space()
+		if s.end() {
+			return nil
+		}
+
+		a := &Attribute{Name: s.name()}
+		if a.Name == "" || !s.space() {
+			return fmt.Errorf("invalid attribute definition for <%s>", element)
+		}
+
+		switch {
+		case s.peek() == '(':
+			a.Type = "ENUMERATION"
+		default:
+			a.Type = s.name()
+			s.space()
+		}
+		switch a.Type {
+		case "CDATA", "ID", "IDREF", "IDREFS", "ENTITY", "ENTITIES", "NMTOKEN", "NMTOKENS":
+		case "NOTATION", "ENUMERATION":
+			values, err := s.enumeration()
+			if err != nil {
+				return err
+			}
+			a.Values = values
+		default:
+			return fmt.Errorf("invalid type %s of attribute %s", a.Type, a.Name)
+		}
+		s.space()
+
+		if s.peek() == '#' {
+			s.pos++
+			switch s.name() {
+			case "REQUIRED":
+				a.Default = Required
+			case "IMPLIED":
+				a.Default = Implied
+			case "FIXED":
+				a.Default = Fixed
+				s.space()
+			default:
+				return fmt.Errorf("invalid default declaration of attribute %s", a.Name)
+			}
+		} else {
+			a.Default = Value
+		}
+		if a.Default == Fixed || a.Default == Value {
+			value, ok := s.literal()
+			if !ok {
+				return fmt.Errorf("missing default value of attribute %s", a.Name)
+			}
+			a.Value = normalize(gockl.Unescape(value), a.Type)
+		}
+
+		if err := p.checkAttribute(element, a); err != nil {
+			return err
+		}
+		// the first declaration is binding
+		if _, ok := attrs[a.Name]; !ok {
+			attrs[a.Name] = a
+		}
+	}
+}
+
+func (p *parser) checkAttribute(element string, a *Attribute) error {
+	if a.Type == "ID" {
+		if a.Default == Fixed || a.Default == Value {
+			return fmt.Errorf("ID attribute %s must be #IMPLIED or #REQUIRED", a.Name)
+		}
+		for _, other := range p.d.Attributes[element] {
+			if other.Type == "ID" && other.Name != a.Name {
+				return fmt.Errorf("element type <%s> has more than one ID attribute", element)
+			}
+		}
+	}
+	if a.Default == Fixed || a.Default == Value {
+		if msg := checkValue(a, a.Value); msg != "" {
+			return fmt.Errorf("invalid default value of attribute %s: %s", a.Name, msg)
+		}
+	}
+	return nil
+}
+
+func (p *parser) entity(s *scanner, src source) error {
+	s.space()
+	parameter := false
+	if s.peek() == '%' {
+		s.pos++
+		parameter = true
+		if !s.space() {
+			return fmt.Errorf("missing whitespace after %%")
+		}
+	}
+
+	name := s.name()
+	if name == "" || !s.space() {
+		return fmt.Errorf("missing entity name")
+	}
+
+	e := &entity{base: src.systemID}
+	if value, ok := s.literal(); ok {
+		e.value = value
+		if parameter {
+			e.value = unescapeCharRefs(value)
+		}
+	} else {
+		switch s.name() {
+		case "SYSTEM":
+		case "PUBLIC":
+			s.space()
+			if e.publicID, ok = s.literal(); !ok {
+				return fmt.Errorf("missing public identifier of entity %s", name)
+			}
+		default:
+			return fmt.Errorf("invalid declaration of entity %s", name)
+		}
+		s.space()
+		if e.systemID, ok = s.literal(); !ok {
+			return fmt.Errorf("missing system identifier of entity %s", name)
+		}
+	}
+
+	s.space()
+	unparsed := false
+	if !parameter && e.systemID != "" && s.name() == "NDATA" {
+		s.space()
+		if s.name() == "" {
+			return fmt.Errorf("missing notation of entity %s", name)
+		}
+		unparsed = true
+	}
+
+	// the first declaration is binding
+	if parameter {
+		if _, ok := p.d.parameters[name]; !ok {
+			p.d.parameters[name] = e
+		}
+	} else if _, ok := p.d.Entities[name]; !ok && !p.d.External[name] {
+		if e.systemID != "" {
+			p.d.External[name] = unparsed
+		} else {
+			p.d.Entities[name] = e.value
+		}
+	}
+
+	return nil
+}
+
+func (p *parser) notation(s *scanner) error {
+	s.space()
+	name := s.name()
+	if name == "" {
+		return fmt.Errorf("missing notation name")
+	}
+	p.d.Notations[name] = true
+
+	// skip the external or public identifier
+	s.pos = len(s.s)
+	return nil
+}
+
+// unescapeCharRefs replaces character references in parameter entity
+// values, which are included immediately.
+func unescapeCharRefs(s string) string {
+	buf := strings.Builder{}
+	for {
+		idx := strings.Index(s, "&#")
+		if idx == -1 {
+			buf.WriteString(s)
+			return buf.String()
+		}
+		end := strings.IndexByte(s[idx:], ';')
+		if end == -1 {
+			buf.WriteString(s)
+			return buf.String()
+		}
+		buf.WriteString(s[:idx])
+		buf.WriteString(gockl.Unescape(s[idx : idx+end+1]))
+		s = s[idx+end+1:]
+	}
+}
@@ -0,0 +1,196 @@
+package dtd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const catalog = `<!ENTITY % inline "b | i">
+<!ELEMENT catalog (title, item+, note?)>
+<!ELEMENT title (#PCDATA)>
+<!ELEMENT item ((name, price) | ref)*>
+<!ELEMENT name (#PCDATA | %inline;)*>
+<!ELEMENT price (#PCDATA)>
+<!ELEMENT ref EMPTY>
+<!ELEMENT note ANY>
+<!ELEMENT b (#PCDATA)>
+<!ELEMENT i (#PCDATA)>
+<!ATTLIST catalog version CDATA #FIXED "1.0">
+<!ATTLIST item
+          id ID #REQUIRED
+          status (new | sold | gone) "new"
+          tags NMTOKENS #IMPLIED>
+<!ATTLIST ref to IDREF #REQUIRED>
+<!ATTLIST price currency CDATA "EUR">
+<!ENTITY shop "Shop &amp; Co">`
+
+// conditional sections are only allowed in external subsets
+const conditional = `
+<![IGNORE[ <!ELEMENT broken ( ]]>
+<![INCLUDE[ <!ATTLIST note lang NMTOKEN #IMPLIED> ]]>`
+
+func TestParse(t *testing.T) {
+	d, err := Parse(catalog+conditional, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if el := d.Elements["item"]; el.Kind != Children || el.Model != "((name, price) | ref)*" {
+		t.Errorf("Unexpected element declaration: %+v", el)
+	}
+	if el := d.Elements["name"]; el.Kind != Mixed || strings.Join(el.Names, ",") != "b,i" {
+		t.Errorf("Unexpected element declaration: %+v", el)
+	}
+	if a := d.Attributes["item"]["status"]; a.Type != "ENUMERATION" || a.Default != Value || a.Value != "new" || len(a.Values) != 3 {
+		t.Errorf("Unexpected attribute declaration: %+v", a)
+	}
+	if a := d.Attributes["note"]["lang"]; a == nil || a.Type != "NMTOKEN" {
+		t.Errorf("Unexpected attribute declaration: %+v", a)
+	}
+	if _, ok := d.Elements["broken"]; ok {
+		t.Error("Ignored section was included")
+	}
+	if d.Entities["shop"] != "Shop &amp; Co" {
+		t.Errorf("Unexpected entity: %q", d.Entities["shop"])
+	}
+	if defaults := d.Defaults("price"); len(defaults) != 1 || defaults["currency"] != "EUR" {
+		t.Errorf("Unexpected defaults: %v", defaults)
+	}
+
+	for input, expected := range map[string]string{
+		"<!ELEMENT a (b,c|d)>":                    "dtd: 1:1: invalid content model for <a>: unexpected \"|d)\"",
+		"<!ELEMENT a EMPTY>\n<!ELEMENT a ANY>":    "dtd: 2:1: element type <a> declared more than once",
+		"<!ATTLIST a b (x|y) \"z\">":              "dtd: 1:1: invalid default value of attribute b: \"z\" is not one of x, y",
+		"<!ATTLIST a id ID \"x\">":                "dtd: 1:1: ID attribute id must be #IMPLIED or #REQUIRED",
+		"<!ELEMENT a (#PCDATA|b)>":                "dtd: 1:1: mixed content model for <a> must end with )*",
+		"%undeclared;":                            "dtd: 1:1: undeclared parameter entity %undeclared;",
+		"<!ENTITY % p \"<!ELEMENT\">\n  %p;":      "dtd: 2:3: unterminated declaration",
+		"<!ELEMENT a (b)":                         "dtd: 1:1: unterminated declaration",
+		"<!FOO a>":                                "dtd: 1:1: unknown declaration <!FOO",
+		"<![INCLUDE[ <!ELEMENT a (b)> ]]> x":      "dtd: 1:34: unexpected character 'x'",
+		"<![INCLUDE[\n <!ELEMENT a (b)>\n x ]]> ": "dtd: 3:2: unexpected character 'x'",
+	} {
+		_, err := Parse(input, nil)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %s, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for input, expected := range map[string][]string{
+		`<catalog><title>T</title><item id="a"><name>x <b>y</b></name><price>1</price></item></catalog>`:                                                        nil,
+		`<catalog version="1.0"><title>T &shop;</title><item id="a" status="sold" tags=" x  y "/><item id="b"><ref to="a"/></item><note>x<b/></note></catalog>`: nil,
+		`<catalog><item id="a"/></catalog>`: {
+			"1:10: element <item> not allowed in <catalog> here, expected <title>",
+		},
+		`<catalog><title>T</title></catalog>`: {
+			"1:26: content of <catalog> is incomplete, expected <item>",
+		},
+		`<catalog><title>T</title><item id="a">text<name/><name/></item></catalog>`: {
+			"1:39: character data not allowed in <item>",
+			"1:50: element <name> not allowed in <item> here, expected <price>",
+		},
+		`<catalog version="2"><title><b/></title><item id="1" status="old"/><item/></catalog>`: {
+			"1:19: invalid value of attribute version: \"2\" does not match the fixed value \"1.0\"",
+			"1:29: element <b> not allowed in <title>",
+			"1:51: invalid value of attribute id: \"1\" is not a valid name",
+			"1:62: invalid value of attribute status: \"old\" is not one of new, sold, gone",
+			"1:68: required attribute id missing on <item>",
+		},
+		`<catalog><title>&unknown;</title><item id="a"><ref to="b">x</ref></item><item id="a"/><foo bar="1"/></catalog>`: {
+			"1:17: undeclared entity &unknown;",
+			"1:59: element <ref> must be empty",
+			"1:83: duplicate ID \"a\"",
+			"1:87: element <foo> not allowed in <catalog> here, expected <item> or <note>",
+			"1:87: element <foo> not declared",
+			"1:56: IDREF \"b\" does not match any ID",
+		},
+	} {
+		doc := "<!DOCTYPE catalog [\n" + catalog + "\n]>\n"
+		errs := String(doc+input, Options{})
+		actual := []string{}
+		for _, e := range errs {
+			// strip the DOCTYPE lines
+			e.Line -= strings.Count(doc, "\n")
+			actual = append(actual, e.Error())
+		}
+		if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%s: unexpected errors:\n%s", input, strings.Join(actual, "\n"))
+		}
+	}
+
+	if errs := String("<a/>", Options{}); len(errs) != 1 || errs[0].Msg != "no document type declaration" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if errs := String(`<!DOCTYPE b [<!ELEMENT a EMPTY>]><a/>`, Options{}); len(errs) != 1 || errs[0].Msg != "document element <a> does not match document type b" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if errs := String("<!DOCTYPE a [\n<!ELEMENT a (b>\n]><a/>", Options{}); len(errs) != 1 || errs[0].Error() != "2:1: invalid content model for <a>: missing )" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+
+	d, _ := Parse(`<!ELEMENT a EMPTY>`, nil)
+	if errs := String("<a>x</a>", Options{DTD: d}); len(errs) != 1 || errs[0].Error() != "1:4: element <a> must be empty" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dtd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "doc.dtd"), []byte("<!ENTITY % common SYSTEM \"common.ent\">\n%common;\n<!ELEMENT doc (p*)>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "sub", "common.ent"), []byte("<!ELEMENT p (#PCDATA)>\n<!ATTLIST p class CDATA #IMPLIED>"), 0644)
+
+	r := DirResolver(dir)
+	input := `<!DOCTYPE doc SYSTEM "sub/doc.dtd" [<!ATTLIST doc lang NMTOKEN "en">]><doc lang="de"><p class="x">text</p></doc>`
+	if errs := String(input, Options{Resolver: r}); len(errs) != 0 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if errs := String(`<doc><q/></doc>`, Options{DTD: mustParse(t, r)}); len(errs) != 2 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+
+	for systemID, expected := range map[string]string{
+		"missing.dtd":           "1:1: cannot read external subset: open " + filepath.Join(dir, "missing.dtd") + ": no such file or directory",
+		"../doc.dtd":            "1:1: cannot read external subset: dtd: refusing to load ../doc.dtd",
+		"http://example.com/x":  "1:1: cannot read external subset: dtd: refusing to load http://example.com/x",
+		"/etc/passwd":           "1:1: cannot read external subset: dtd: refusing to load /etc/passwd",
+		`..\..\secret.dtd`:      `1:1: cannot read external subset: dtd: refusing to load ..\..\secret.dtd`,
+		"sub/../sub/common.ent": "",
+	} {
+		errs := String(fmt.Sprintf(`<!DOCTYPE p SYSTEM "%s"><p/>`, systemID), Options{Resolver: r})
+		actual := ""
+		if len(errs) > 0 {
+			actual = errs[0].Error()
+		}
+		if actual != expected {
+			t.Errorf("%s: unexpected errors: %v", systemID, errs)
+		}
+	}
+
+	if errs := String(`<!DOCTYPE doc SYSTEM "doc.dtd"><doc/>`, Options{}); len(errs) != 1 || errs[0].Msg != "cannot read external subset: no resolver to load doc.dtd" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func mustParse(t *testing.T, r Resolver) *DTD {
+	text, err := r.Resolve("", "sub/doc.dtd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &parser{d: newDTD(), r: r}
+	if err := p.parse(text, source{text: text, systemID: "sub/doc.dtd"}); err != nil {
+		t.Fatal(err)
+	}
+	return p.d
+}
@@ -0,0 +1,412 @@
+package dtd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scanner reads the parts of a markup declaration.
+type scanner struct {
+	s   string
+	pos int
+}
+
+func (s *scanner) end() bool {
+	s.space()
+	return s.pos >= len(s.s)
+}
+
+func (s *scanner) rest() string {
+	return s.s[s.pos:]
+}
+
+func (s *scanner) peek() byte {
+	if s.pos < len(s.s) {
+		return s.s[s.pos]
+	}
+	return 0
+}
+
+// space skips whitespace and reports whether there was any.
+func (s *scanner) space() bool {
+	start := s.pos
+	for s.pos < len(s.s) && strings.IndexByte(" \t\r\n", s.s[s.pos]) > -1 {
+		s.pos++
+	}
+	return s.pos > start
+}
+
+// name reads a name or name token.
+func (s *scanner) name() string {
+	start := s.pos
+	for s.pos < len(s.s) {
+		r, size := utf8.DecodeRuneInString(s.s[s.pos:])
+		if !isNameChar(r) {
+			break
+		}
+		s.pos += size
+	}
+	return s.s[start:s.pos]
+}
+
+func (s *scanner) literal() (string, bool) {
+	q := s.peek()
+	if q != '"' && q != '\'' {
+		return "", false
+	}
+	end := strings.IndexByte(s.s[s.pos+1:], q)
+	if end == -1 {
+		return "", false
+	}
+	r := s.s[s.pos+1 : s.pos+1+end]
+	s.pos += end + 2
+	return r, true
+}
+
+// enumeration reads a list of name tokens like `(a|b|c)`.
+func (s *scanner) enumeration() ([]string, error) {
+	if s.peek() != '(' {
+		return nil, fmt.Errorf("expected (")
+	}
+	s.pos++
+
+	r := []string{}
+	for {
+		s.space()
+		name := s.name()
+		if name == "" {
+			return nil, fmt.Errorf("invalid enumeration")
+		}
+		r = append(r, name)
+		s.space()
+		switch s.peek() {
+		case '|':
+			s.pos++
+		case ')':
+			s.pos++
+			return r, nil
+		default:
+			return nil, fmt.Errorf("invalid enumeration")
+		}
+	}
+}
+
+// particle is a node of a content model.
+type particle struct {
+	// name is empty for sequences and choices
+	name     string
+	choice   bool
+	children []*particle
+	// occurrence is one of 0, '?', '*' and '+'
+	occurrence byte
+}
+
+func (s *scanner) occurrence() byte {
+	switch c := s.peek(); c {
+	case '?', '*', '+':
+		s.pos++
+		return c
+	}
+	return 0
+}
+
+// parseContent parses a content specification.
+func parseContent(name string, s *scanner) (*Element, error) {
+	el := &Element{Name: name}
+
+	if s.peek() != '(' {
+		switch s.name() {
+		case "EMPTY":
+			el.Kind = Empty
+		case "ANY":
+			el.Kind = Any
+		default:
+			return nil, fmt.Errorf("invalid content specification for <%s>", name)
+		}
+		return el, nil
+	}
+
+	start := s.pos
+	s.pos++
+	s.space()
+	if strings.HasPrefix(s.rest(), "#PCDATA") {
+		s.pos += len("#PCDATA")
+		el.Kind = Mixed
+		el.Names = []string{}
+		for {
+			s.space()
+			if s.peek() == ')' {
+				s.pos++
+				break
+			}
+			if s.peek() != '|' {
+				return nil, fmt.Errorf("invalid mixed content model for <%s>", name)
+			}
+			s.pos++
+			s.space()
+			n := s.name()
+			if n == "" {
+				return nil, fmt.Errorf("invalid mixed content model for <%s>", name)
+			}
+			el.Names = append(el.Names, n)
+		}
+		if s.occurrence() != '*' && len(el.Names) > 0 {
+			return nil, fmt.Errorf("mixed content model for <%s> must end with )*", name)
+		}
+		return el, nil
+	}
+
+	s.pos = start
+	p, err := s.particle()
+	if err != nil {
+		return nil, fmt.Errorf("invalid content model for <%s>: %s", name, err)
+	}
+	el.Kind = Children
+	el.automaton = compile(p)
+
+	return el, nil
+}
+
+func (s *scanner) particle() (*particle, error) {
+	if s.peek() != '(' {
+		name := s.name()
+		if name == "" {
+			return nil, fmt.Errorf("expected name at %q", s.rest())
+		}
+		return &particle{name: name, occurrence: s.occurrence()}, nil
+	}
+
+	s.pos++
+	p := &particle{}
+	var separator byte
+	for {
+		s.space()
+		child, err := s.particle()
+		if err != nil {
+			return nil, err
+		}
+		p.children = append(p.children, child)
+		s.space()
+
+		c := s.peek()
+		if c == 0 {
+			return nil, fmt.Errorf("missing )")
+		}
+		if c == ')' {
+			s.pos++
+			break
+		}
+		if (c != '|' && c != ',') || (separator != 0 && c != separator) {
+			return nil, fmt.Errorf("unexpected %q", s.rest())
+		}
+		separator = c
+		s.pos++
+	}
+	p.choice = separator == '|'
+	p.occurrence = s.occurrence()
+
+	return p, nil
+}
+
+// automaton is a nondeterministic finite automaton built from a content
+// model. State 0 is the start state.
+type automaton struct {
+	states []state
+	accept int
+}
+
+type state struct {
+	// either a transition for the element name to next
+	name string
+	next int
+	// or epsilon transitions
+	epsilon []int
+}
+
+func (a *automaton) add() int {
+	a.states = append(a.states, state{next: -1})
+	return len(a.states) - 1
+}
+
+func compile(p *particle) *automaton {
+	a := &automaton{}
+	start := a.add()
+	a.accept = a.add()
+	a.build(p, start, a.accept)
+	return a
+}
+
+// build adds the states for p between from and to.
+func (a *automaton) build(p *particle, from, to int) {
+	in, out := a.add(), a.add()
+	a.states[from].epsilon = append(a.states[from].epsilon, in)
+	a.states[out].epsilon = append(a.states[out].epsilon, to)
+
+	switch p.occurrence {
+	case '?':
+		a.states[in].epsilon = append(a.states[in].epsilon, out)
+	case '*':
+		a.states[in].epsilon = append(a.states[in].epsilon, out)
+		a.states[out].epsilon = append(a.states[out].epsilon, in)
+	case '+':
+		a.states[out].epsilon = append(a.states[out].epsilon, in)
+	}
+
+	switch {
+	case p.name != "":
+		s := a.add()
+		a.states[in].epsilon = append(a.states[in].epsilon, s)
+		a.states[s].name, a.states[s].next = p.name, out
+	case p.choice:
+		for _, c := range p.children {
+			a.build(c, in, out)
+		}
+	default:
+		current := in
+		for _, c := range p.children {
+			next := a.add()
+			a.build(c, current, next)
+			current = next
+		}
+		a.states[current].epsilon = append(a.states[current].epsilon, out)
+	}
+}
+
+// closure adds all states reachable using epsilon transitions.
+func (a *automaton) closure(states []int) []int {
+	seen := map[int]bool{}
+	r := []int{}
+	var visit func(int)
+	visit = func(s int) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		r = append(r, s)
+		for _, e := range a.states[s].epsilon {
+			visit(e)
+		}
+	}
+	for _, s := range states {
+		visit(s)
+	}
+	return r
+}
+
+func (a *automaton) start() []int {
+	return a.closure([]int{0})
+}
+
+func (a *automaton) step(current []int, name string) []int {
+	next := []int{}
+	for _, s := range current {
+		if a.states[s].name == name {
+			next = append(next, a.states[s].next)
+		}
+	}
+	return a.closure(next)
+}
+
+func (a *automaton) accepts(current []int) bool {
+	for _, s := range current {
+		if s == a.accept {
+			return true
+		}
+	}
+	return false
+}
+
+// expected returns the element names allowed next.
+func (a *automaton) expected(current []int) []string {
+	seen := map[string]bool{}
+	r := []string{}
+	for _, s := range current {
+		if n := a.states[s].name; n != "" && !seen[n] {
+			seen[n] = true
+			r = append(r, "<"+n+">")
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+func isNameChar(r rune) bool {
+	return r == ':' || r == '_' || r == '-' || r == '.' || r == 0xB7 ||
+		unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+func isNmtoken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !isNameChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isName(s string) bool {
+	if !isNmtoken(s) {
+		return false
+	}
+	r, _ := utf8.DecodeRuneInString(s)
+	return r == ':' || r == '_' || unicode.IsLetter(r)
+}
+
+// normalize normalizes an attribute value according to its type.
+func normalize(value, typ string) string {
+	if typ == "CDATA" {
+		return value
+	}
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// checkValue checks a normalized attribute value against the declaration
+// and returns a description of the problem or an empty string.
+func checkValue(a *Attribute, value string) string {
+	switch a.Type {
+	case "ID", "IDREF", "ENTITY":
+		if !isName(value) {
+			return fmt.Sprintf("%q is not a valid name", value)
+		}
+	case "IDREFS", "ENTITIES":
+		if value == "" {
+			return "empty list of names"
+		}
+		for _, v := range strings.Fields(value) {
+			if !isName(v) {
+				return fmt.Sprintf("%q is not a valid name", v)
+			}
+		}
+	case "NMTOKEN":
+		if !isNmtoken(value) {
+			return fmt.Sprintf("%q is not a valid name token", value)
+		}
+	case "NMTOKENS":
+		if value == "" {
+			return "empty list of name tokens"
+		}
+		for _, v := range strings.Fields(value) {
+			if !isNmtoken(v) {
+				return fmt.Sprintf("%q is not a valid name token", v)
+			}
+		}
+	case "NOTATION", "ENUMERATION":
+		for _, v := range a.Values {
+			if v == value {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not one of %s", value, strings.Join(a.Values, ", "))
+	}
+
+	if a.Default == Fixed && value != a.Value {
+		return fmt.Sprintf("%q does not match the fixed value %q", value, a.Value)
+	}
+	return ""
+}
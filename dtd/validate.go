@@ -0,0 +1,361 @@
+package dtd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Error is a single validity error.
+type Error struct {
+	gockl.Location
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Location.String() + ": " + e.Msg
+}
+
+// MaxErrors is the maximum number of errors reported for a single document.
+const MaxErrors = 100
+
+// Options configures the validation.
+type Options struct {
+	// Resolver loads the external subset and external parameter entities.
+	// If it is nil, documents referring to external declarations cannot be
+	// validated.
+	Resolver Resolver
+	// DTD is used instead of the document type declaration of the
+	// document, if set.
+	DTD *DTD
+}
+
+// String validates the document in input.
+func String(input string, o Options) []*Error {
+	return Validate(gockl.New(input), o)
+}
+
+// Validate reads all remaining tokens of z and returns the validity errors
+// found. Well-formedness is not checked, use the check package for that.
+// References to general entities are not expanded, but treated as
+// character data.
+func Validate(z *gockl.Tokenizer, o Options) []*Error {
+	v := &validator{input: z.Input, o: o, d: o.DTD, ids: map[string]bool{}}
+
+	for len(v.errors) < MaxErrors && !v.failed {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		v.token(span)
+	}
+
+	if v.failed || len(v.errors) >= MaxErrors {
+		return v.errors
+	}
+	if v.d == nil {
+		v.errorf(0, "no document type declaration")
+		return v.errors
+	}
+
+	for _, ref := range v.idrefs {
+		if !v.ids[ref.name] {
+			v.errorf(ref.offset, "IDREF %q does not match any ID", ref.name)
+		}
+	}
+
+	return v.errors
+}
+
+type frame struct {
+	name  string
+	el    *Element
+	state []int
+}
+
+type reference struct {
+	name   string
+	offset int
+}
+
+type validator struct {
+	input  string
+	o      Options
+	d      *DTD
+	stack  []frame
+	root   bool
+	ids    map[string]bool
+	idrefs []reference
+	errors []*Error
+	// failed is set if the DTD could not be read
+	failed bool
+}
+
+func (v *validator) errorf(offset int, format string, args ...interface{}) {
+	if len(v.errors) >= MaxErrors {
+		return
+	}
+	v.errors = append(v.errors, &Error{gockl.Locate(v.input, offset), fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) token(span gockl.Span) {
+	raw := span.Raw(v.input)
+	var top *frame
+	if len(v.stack) > 0 {
+		top = &v.stack[len(v.stack)-1]
+	}
+
+	switch span.Kind {
+	case gockl.DirectiveKind:
+		if strings.HasPrefix(raw, "<!DOCTYPE") && v.o.DTD == nil && v.d == nil {
+			v.doctype(raw, span.Start)
+		}
+	case gockl.TextKind:
+		if top == nil {
+			return
+		}
+		v.references(raw, span.Start)
+		if top.el == nil {
+			return
+		}
+		if top.el.Kind == Empty {
+			v.errorf(span.Start, "element <%s> must be empty", top.name)
+		} else if top.el.Kind == Children && strings.Trim(raw, " \t\r\n") != "" {
+			v.errorf(span.Start, "character data not allowed in <%s>", top.name)
+		}
+	case gockl.CDATAKind:
+		if top == nil || top.el == nil {
+			return
+		}
+		if top.el.Kind == Empty {
+			v.errorf(span.Start, "element <%s> must be empty", top.name)
+		} else if top.el.Kind == Children {
+			v.errorf(span.Start, "CDATA section not allowed in <%s>", top.name)
+		}
+	case gockl.CommentKind, gockl.ProcInstKind:
+		if top != nil && top.el != nil && top.el.Kind == Empty {
+			v.errorf(span.Start, "element <%s> must be empty", top.name)
+		}
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		v.startElement(span.Token(v.input).(gockl.StartOrEmptyElementToken), span)
+		if span.Kind == gockl.EmptyElementKind {
+			v.endElement(span.End)
+		}
+	case gockl.EndElementKind:
+		v.endElement(span.Start)
+	}
+}
+
+// doctype reads the DTD from the internal and external subsets.
+func (v *validator) doctype(raw string, offset int) {
+	v.d = newDTD()
+	p := &parser{d: v.d, r: v.o.Resolver}
+
+	s := &scanner{s: raw, pos: len("<!DOCTYPE")}
+	s.space()
+	v.d.Name = s.name()
+	s.space()
+
+	external := &entity{}
+	switch s.name() {
+	case "SYSTEM":
+		s.space()
+		external.systemID, _ = s.literal()
+	case "PUBLIC":
+		s.space()
+		external.publicID, _ = s.literal()
+		s.space()
+		external.systemID, _ = s.literal()
+	}
+	s.space()
+
+	// the internal subset is read first, so that its declarations take
+	// precedence
+	if s.peek() == '[' {
+		end := len(strings.TrimRight(strings.TrimSuffix(raw, ">"), " \t\r\n")) - 1
+		if end <= s.pos || raw[end] != ']' {
+			v.errorf(offset, "unterminated internal subset")
+			v.failed = true
+			return
+		}
+		err := p.parse(raw[s.pos+1:end], source{text: v.input, offset: offset + s.pos + 1})
+		if e, ok := err.(*SyntaxError); ok && e.SystemID == "" {
+			v.errors = append(v.errors, &Error{e.Location, e.Msg})
+			v.failed = true
+			return
+		} else if err != nil {
+			v.errorf(offset, "%s", err)
+			v.failed = true
+			return
+		}
+	}
+
+	if external.systemID != "" {
+		text, systemID, err := p.resolve(external)
+		if err == nil {
+			err = p.parse(text, source{text: text, systemID: systemID})
+		}
+		if err != nil {
+			v.errorf(offset, "cannot read external subset: %s", err)
+			v.failed = true
+		}
+	}
+}
+
+var predefined = map[string]bool{"amp": true, "lt": true, "gt": true, "apos": true, "quot": true}
+
+// references checks that all entity references in s are declared.
+func (v *validator) references(s string, offset int) {
+	if v.d == nil {
+		return
+	}
+	for pos := 0; ; {
+		idx := strings.IndexByte(s[pos:], '&')
+		if idx == -1 {
+			return
+		}
+		pos += idx
+		end := strings.IndexByte(s[pos:], ';')
+		if end == -1 {
+			return
+		}
+		name := s[pos+1 : pos+end]
+		if !strings.HasPrefix(name, "#") && !predefined[name] {
+			if _, ok := v.d.Entities[name]; !ok {
+				if unparsed, ok := v.d.External[name]; !ok {
+					v.errorf(offset+pos, "undeclared entity &%s;", name)
+				} else if unparsed {
+					v.errorf(offset+pos, "reference to unparsed entity &%s;", name)
+				}
+			}
+		}
+		pos += end + 1
+	}
+}
+
+func (v *validator) startElement(t gockl.StartOrEmptyElementToken, span gockl.Span) {
+	if v.d == nil {
+		v.errorf(span.Start, "no document type declaration")
+		v.failed = true
+		return
+	}
+
+	name := t.Name()
+	if len(v.stack) == 0 {
+		if !v.root && v.d.Name != "" && name != v.d.Name {
+			v.errorf(span.Start, "document element <%s> does not match document type %s", name, v.d.Name)
+		}
+		v.root = true
+	} else if top := &v.stack[len(v.stack)-1]; top.el != nil {
+		switch top.el.Kind {
+		case Empty:
+			v.errorf(span.Start, "element <%s> must be empty", top.name)
+		case Mixed:
+			allowed := false
+			for _, n := range top.el.Names {
+				allowed = allowed || n == name
+			}
+			if !allowed {
+				v.errorf(span.Start, "element <%s> not allowed in <%s>", name, top.name)
+			}
+		case Children:
+			if top.state != nil {
+				next := top.el.automaton.step(top.state, name)
+				if len(next) == 0 {
+					if expected := top.el.automaton.expected(top.state); len(expected) > 0 {
+						v.errorf(span.Start, "element <%s> not allowed in <%s> here, expected %s", name, top.name, strings.Join(expected, " or "))
+					} else {
+						v.errorf(span.Start, "element <%s> not allowed in <%s> here, expected </%s>", name, top.name, top.name)
+					}
+					// stop checking the content of the parent
+					next = nil
+				}
+				top.state = next
+			}
+		}
+	}
+
+	el := v.d.Elements[name]
+	if el == nil {
+		v.errorf(span.Start, "element <%s> not declared", name)
+	}
+	f := frame{name: name, el: el}
+	if el != nil && el.Kind == Children {
+		f.state = el.automaton.start()
+	}
+	v.stack = append(v.stack, f)
+
+	if el != nil || v.d.Attributes[name] != nil {
+		v.attributes(t, name, span.Start)
+	}
+}
+
+func (v *validator) endElement(offset int) {
+	if len(v.stack) == 0 {
+		return
+	}
+	top := v.stack[len(v.stack)-1]
+	v.stack = v.stack[:len(v.stack)-1]
+
+	if top.el != nil && top.el.Kind == Children && top.state != nil && !top.el.automaton.accepts(top.state) {
+		v.errorf(offset, "content of <%s> is incomplete, expected %s", top.name, strings.Join(top.el.automaton.expected(top.state), " or "))
+	}
+}
+
+func (v *validator) attributes(t gockl.StartOrEmptyElementToken, name string, offset int) {
+	decls := v.d.Attributes[name]
+	seen := map[string]bool{}
+
+	for _, a := range t.AttributeSpans() {
+		seen[a.Name] = true
+		if strings.HasPrefix(a.Name, "xmlns") {
+			if _, ok := decls[a.Name]; !ok {
+				continue
+			}
+		}
+
+		decl, ok := decls[a.Name]
+		if !ok {
+			v.errorf(offset+a.Start, "attribute %s not declared for <%s>", a.Name, name)
+			continue
+		}
+
+		v.references(a.Content, offset+a.ValueStart)
+		value := normalize(gockl.Unescape(a.Content), decl.Type)
+		if msg := checkValue(decl, value); msg != "" {
+			v.errorf(offset+a.ValueStart, "invalid value of attribute %s: %s", a.Name, msg)
+			continue
+		}
+
+		switch decl.Type {
+		case "ID":
+			if v.ids[value] {
+				v.errorf(offset+a.ValueStart, "duplicate ID %q", value)
+			}
+			v.ids[value] = true
+		case "IDREF", "IDREFS":
+			for _, ref := range strings.Fields(value) {
+				v.idrefs = append(v.idrefs, reference{ref, offset + a.ValueStart})
+			}
+		case "ENTITY", "ENTITIES":
+			for _, e := range strings.Fields(value) {
+				if !v.d.External[e] {
+					v.errorf(offset+a.ValueStart, "attribute %s does not refer to an unparsed entity: %s", a.Name, e)
+				}
+			}
+		}
+	}
+
+	missing := []string{}
+	for n, decl := range decls {
+		if decl.Default == Required && !seen[n] {
+			missing = append(missing, n)
+		}
+	}
+	sort.Strings(missing)
+	for _, n := range missing {
+		v.errorf(offset, "required attribute %s missing on <%s>", n, name)
+	}
+}
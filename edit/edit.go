@@ -0,0 +1,375 @@
+// Package edit rewrites documents using simple rules, like renaming or
+// setting attributes, deleting elements or replacing text. Only the tokens
+// affected by a rule are touched, all other bytes are kept as they are.
+package edit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/query"
+	"github.com/roblillack/gockl/tree"
+)
+
+// Kind is the kind of a rule.
+type Kind uint8
+
+const (
+	// RenameAttribute renames the attribute Name to Value.
+	RenameAttribute Kind = iota + 1
+	// SetAttribute sets the attribute Name to Value, adding it if
+	// necessary.
+	SetAttribute
+	// DeleteElement deletes the element including all its content.
+	DeleteElement
+	// ReplaceText replaces all matches of Pattern in the text content
+	// directly inside of the element with Value, which may contain
+	// references to submatches like in regexp.Regexp.ReplaceAllString.
+	ReplaceText
+)
+
+var kindNames = map[Kind]string{
+	RenameAttribute: "rename-attr",
+	SetAttribute:    "set-attr",
+	DeleteElement:   "delete-element",
+	ReplaceText:     "replace-text",
+}
+
+func (k Kind) String() string {
+	if s, ok := kindNames[k]; ok {
+		return s
+	}
+	return "invalid"
+}
+
+// Rule is a single edit applied to all elements selected by Path.
+type Rule struct {
+	Kind    Kind
+	Path    *query.Query
+	Name    string
+	Value   string
+	Pattern *regexp.Regexp
+}
+
+func (r Rule) String() string {
+	args := []string{r.Kind.String(), r.Path.String()}
+	switch r.Kind {
+	case RenameAttribute, SetAttribute:
+		args = append(args, r.Name, r.Value)
+	case ReplaceText:
+		args = append(args, r.Pattern.String(), r.Value)
+	}
+
+	for i, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\r\n'\"\\") {
+			args[i] = `'` + strings.Replace(a, `'`, `'\''`, -1) + `'`
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// ParseRule parses a rule of one of the forms
+//
+//	rename-attr <path> <name> <new name>
+//	set-attr <path> <name> <value>
+//	delete-element <path>
+//	replace-text <path> <regexp> <replacement>
+//
+// Arguments are separated by whitespace and can be quoted using single or
+// double quotes like in a POSIX shell.
+func ParseRule(s string) (Rule, error) {
+	args, err := split(s)
+	if err != nil {
+		return Rule{}, err
+	}
+	if len(args) < 2 {
+		return Rule{}, fmt.Errorf("edit: missing arguments in rule %s", s)
+	}
+
+	r := Rule{}
+	for k, name := range kindNames {
+		if name == args[0] {
+			r.Kind = k
+		}
+	}
+
+	expected := 4
+	switch r.Kind {
+	case 0:
+		return Rule{}, fmt.Errorf("edit: unknown rule %s", args[0])
+	case DeleteElement:
+		expected = 2
+	}
+	if len(args) != expected {
+		return Rule{}, fmt.Errorf("edit: %s expects %d arguments", args[0], expected-1)
+	}
+
+	if r.Path, err = query.Compile(args[1]); err != nil {
+		return Rule{}, err
+	}
+
+	switch r.Kind {
+	case RenameAttribute, SetAttribute:
+		r.Name, r.Value = args[2], args[3]
+		if r.Name == "" || (r.Kind == RenameAttribute && r.Value == "") {
+			return Rule{}, fmt.Errorf("edit: empty attribute name in rule %s", s)
+		}
+	case ReplaceText:
+		if r.Pattern, err = regexp.Compile(args[2]); err != nil {
+			return Rule{}, fmt.Errorf("edit: %s", err)
+		}
+		r.Value = args[3]
+	}
+
+	return r, nil
+}
+
+func split(s string) ([]string, error) {
+	args := []string{}
+	buf := strings.Builder{}
+	inArg := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			if inArg {
+				args = append(args, buf.String())
+				buf.Reset()
+				inArg = false
+			}
+		case c == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end == -1 {
+				return nil, fmt.Errorf("edit: unterminated quote in rule %s", s)
+			}
+			buf.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte(`"\$`+"`", s[i+1]) > -1 {
+					i++
+				}
+				buf.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return nil, fmt.Errorf("edit: unterminated quote in rule %s", s)
+			}
+			inArg = true
+		case c == '\\' && i+1 < len(s):
+			i++
+			buf.WriteByte(s[i])
+			inArg = true
+		default:
+			buf.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, buf.String())
+	}
+
+	return args, nil
+}
+
+type edit struct {
+	start int
+	end   int
+	text  string
+}
+
+// Apply applies the rules one after another to input and returns the
+// result.
+func Apply(input string, rules ...Rule) (string, error) {
+	for _, r := range rules {
+		doc, err := tree.ParseString(input)
+		if err != nil {
+			return "", err
+		}
+
+		edits := []edit{}
+		deleted := map[*tree.Node]bool{}
+		for _, n := range r.Path.Select(doc) {
+			if !n.IsElement() || deletedAncestor(n, deleted) {
+				continue
+			}
+			e, err := r.edits(n)
+			if err != nil {
+				return "", err
+			}
+			edits = append(edits, e...)
+			if r.Kind == DeleteElement {
+				deleted[n] = true
+			}
+		}
+
+		input = apply(input, edits)
+	}
+
+	return input, nil
+}
+
+func deletedAncestor(n *tree.Node, deleted map[*tree.Node]bool) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if deleted[p] {
+			return true
+		}
+	}
+	return false
+}
+
+func apply(input string, edits []edit) string {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start < edits[j].start
+	})
+
+	buf := strings.Builder{}
+	pos := 0
+	for _, e := range edits {
+		buf.WriteString(input[pos:e.start])
+		buf.WriteString(e.text)
+		pos = e.end
+	}
+	buf.WriteString(input[pos:])
+
+	return buf.String()
+}
+
+func (r Rule) edits(n *tree.Node) ([]edit, error) {
+	el := n.Element()
+
+	switch r.Kind {
+	case RenameAttribute:
+		if _, exists := n.Attribute(r.Value); exists && r.Name != r.Value {
+			if _, ok := n.Attribute(r.Name); ok {
+				return nil, fmt.Errorf("edit: cannot rename %s, <%s> at offset %d already has an attribute %s", r.Name, n.Name(), n.Offset(), r.Value)
+			}
+		}
+		for _, a := range el.AttributeSpans() {
+			if a.Name == r.Name {
+				start := n.Offset() + a.Start
+				return []edit{{start, start + len(a.Name), r.Value}}, nil
+			}
+		}
+	case SetAttribute:
+		var raw string
+		if t, ok := el.(gockl.StartElementToken); ok {
+			raw = t.SetAttribute(r.Name, r.Value).Raw()
+		} else {
+			raw = el.(gockl.EmptyElementToken).SetAttribute(r.Name, r.Value).Raw()
+		}
+		if raw != el.Raw() {
+			return []edit{{n.Offset(), n.ContentOffset(), raw}}, nil
+		}
+	case DeleteElement:
+		return []edit{deletion(n)}, nil
+	case ReplaceText:
+		return r.replaceText(n), nil
+	}
+
+	return nil, nil
+}
+
+// deletion removes the node. If it is on a line of its own, the whole line
+// is removed.
+func deletion(n *tree.Node) edit {
+	e := edit{n.Offset(), n.EndOffset(), ""}
+
+	if n.Parent == nil {
+		return e
+	}
+	siblings := n.Parent.Children
+	i := 0
+	for siblings[i] != n {
+		i++
+	}
+	if i == 0 {
+		return e
+	}
+
+	prev := siblings[i-1]
+	if prev.Kind() != gockl.TextKind {
+		return e
+	}
+	before := prev.Raw()
+	nl := strings.LastIndexByte(before, '\n')
+	if nl == -1 || strings.Trim(before[nl:], " \t\n") != "" {
+		return e
+	}
+	if i+1 < len(siblings) {
+		next := siblings[i+1]
+		if next.Kind() != gockl.TextKind || !strings.HasPrefix(strings.TrimLeft(next.Raw(), " \t\r"), "\n") {
+			return e
+		}
+	}
+
+	if nl > 0 && before[nl-1] == '\r' {
+		nl--
+	}
+	e.start = prev.Offset() + nl
+	return e
+}
+
+func (r Rule) replaceText(n *tree.Node) []edit {
+	edits := []edit{}
+
+	for _, c := range n.Children {
+		raw := c.Raw()
+		switch c.Kind() {
+		case gockl.TextKind:
+			// replace only the matches, so that references elsewhere are
+			// kept as they are
+			text, offsets := unescape(raw)
+			for _, m := range r.Pattern.FindAllStringSubmatchIndex(text, -1) {
+				result := string(r.Pattern.ExpandString(nil, r.Value, text, m))
+				if result != text[m[0]:m[1]] {
+					edits = append(edits, edit{c.Offset() + offsets[m[0]], c.Offset() + offsets[m[1]], gockl.EscapeText(result)})
+				}
+			}
+		case gockl.CDATAKind:
+			text, _ := gockl.CDATAToken(raw).Content()
+			if result := r.Pattern.ReplaceAllString(text, r.Value); result != text {
+				buf := strings.Builder{}
+				for _, t := range gockl.NewCDATA(result) {
+					buf.WriteString(t.Raw())
+				}
+				edits = append(edits, edit{c.Offset(), c.EndOffset(), buf.String()})
+			}
+		}
+	}
+
+	return edits
+}
+
+// unescape returns the unescaped text together with the offsets of its bytes
+// inside of raw and the length of raw as the last offset. Bytes resulting from
+// a reference are mapped to the start of the reference.
+func unescape(raw string) (string, []int) {
+	buf := strings.Builder{}
+	offsets := make([]int, 0, len(raw)+1)
+	for i := 0; i < len(raw); {
+		if raw[i] == '&' {
+			if end := strings.IndexByte(raw[i:], ';'); end > -1 {
+				ref := raw[i : i+end+1]
+				if text := gockl.Unescape(ref); text != ref && strings.IndexByte(ref[1:], '&') == -1 {
+					buf.WriteString(text)
+					for len(offsets) < buf.Len() {
+						offsets = append(offsets, i)
+					}
+					i += len(ref)
+					continue
+				}
+			}
+		}
+		buf.WriteByte(raw[i])
+		offsets = append(offsets, i)
+		i++
+	}
+
+	return buf.String(), append(offsets, len(raw))
+}
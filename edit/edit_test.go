@@ -0,0 +1,114 @@
+package edit
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRule(t *testing.T) {
+	for input, expected := range map[string]string{
+		`rename-attr //use xlink:href href`:         `rename-attr //use xlink:href href`,
+		`set-attr "/doc/item[@id='1']" title 'a b'`: `set-attr '/doc/item[@id='\''1'\'']' title 'a b'`,
+		`delete-element  //metadata `:               `delete-element //metadata`,
+		`replace-text //title "(\w+) \"x\"" '$1'`:   `replace-text //title '(\w+) "x"' $1`,
+		`set-attr //a b ""`:                         `set-attr //a b ''`,
+	} {
+		r, err := ParseRule(input)
+		if err != nil {
+			t.Errorf("%s: %s", input, err)
+			continue
+		}
+		if r.String() != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, r.String())
+		}
+		if again, err := ParseRule(r.String()); err != nil || again.String() != r.String() {
+			t.Errorf("%s: does not round-trip: %v", input, err)
+		}
+	}
+
+	for _, input := range []string{"", "foo //a", "delete-element", "delete-element //a b", "set-attr //a b", "rename-attr //a b ''", "set-attr a[ b c", "replace-text //a ( b", "set-attr '//a b c"} {
+		if _, err := ParseRule(input); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	input := `<svg xmlns:xlink="http://www.w3.org/1999/xlink" version='1.1'>
+  <metadata>
+    <metadata/>
+  </metadata>
+  <use   xlink:href = "#a" />
+  <g><use xlink:href="#b"/><title>Old &amp; ugly <![CDATA[old]]></title></g>
+  <text>keep</text>
+</svg>`
+
+	for rules, expected := range map[string]string{
+		"rename-attr //use xlink:href href": `<svg xmlns:xlink="http://www.w3.org/1999/xlink" version='1.1'>
+  <metadata>
+    <metadata/>
+  </metadata>
+  <use   href = "#a" />
+  <g><use href="#b"/><title>Old &amp; ugly <![CDATA[old]]></title></g>
+  <text>keep</text>
+</svg>`,
+		"set-attr /svg version 2\nset-attr //g/use class 'x<y'": `<svg xmlns:xlink="http://www.w3.org/1999/xlink" version='2'>
+  <metadata>
+    <metadata/>
+  </metadata>
+  <use   xlink:href = "#a" />
+  <g><use xlink:href="#b" class="x&lt;y"/><title>Old &amp; ugly <![CDATA[old]]></title></g>
+  <text>keep</text>
+</svg>`,
+		"delete-element //metadata\ndelete-element //g/use": `<svg xmlns:xlink="http://www.w3.org/1999/xlink" version='1.1'>
+  <use   xlink:href = "#a" />
+  <g><title>Old &amp; ugly <![CDATA[old]]></title></g>
+  <text>keep</text>
+</svg>`,
+		"replace-text //title '(?i)old' new\nreplace-text //text x y": `<svg xmlns:xlink="http://www.w3.org/1999/xlink" version='1.1'>
+  <metadata>
+    <metadata/>
+  </metadata>
+  <use   xlink:href = "#a" />
+  <g><use xlink:href="#b"/><title>new &amp; ugly <![CDATA[new]]></title></g>
+  <text>keep</text>
+</svg>`,
+	} {
+		list := []Rule{}
+		for _, line := range strings.Split(rules, "\n") {
+			r, err := ParseRule(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			list = append(list, r)
+		}
+
+		result, err := Apply(input, list...)
+		if err != nil {
+			t.Errorf("%s: %s", rules, err)
+			continue
+		}
+		if result != expected {
+			t.Errorf("%s: unexpected result:\n%s", rules, result)
+		}
+	}
+
+	r, _ := ParseRule("replace-text //p bar baz")
+	if result, err := Apply(`<p>Caf&#233; &amp; bar &#x62;ar b&amp;ar</p>`, r); err != nil || result != `<p>Caf&#233; &amp; baz baz b&amp;ar</p>` {
+		t.Errorf("Unexpected result replacing text with references: %v %s", err, result)
+	}
+	r, _ = ParseRule("replace-text //p '(a)&(b)' '$2<$1'")
+	if result, err := Apply(`<p>&#169; a&amp;b</p>`, r); err != nil || result != `<p>&#169; b&lt;a</p>` {
+		t.Errorf("Unexpected result replacing references: %v %s", err, result)
+	}
+
+	r, _ = ParseRule("set-attr /svg viewbox 1")
+	if result, err := Apply(`<svg viewBox="0 0 1 1"/>`, r); err != nil || result != `<svg viewBox="0 0 1 1" viewbox="1"/>` {
+		t.Errorf("Unexpected result setting attribute with different case: %v %s", err, result)
+	}
+
+	r, _ = ParseRule("rename-attr //a x y")
+	if _, err := Apply(`<a x="1" y="2"/>`, r); err == nil {
+		t.Error("Expected error when renaming to an existing attribute")
+	}
+}
@@ -0,0 +1,93 @@
+package gockl
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var predefinedEntities = map[string]string{
+	"lt":   "<",
+	"gt":   ">",
+	"amp":  "&",
+	"apos": "'",
+	"quot": `"`,
+}
+
+// Unescape replaces the predefined XML entities and character references in s
+// with the characters they represent. Unknown or malformed references are left
+// untouched.
+func Unescape(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+
+	buf := strings.Builder{}
+	for {
+		amp := strings.IndexByte(s, '&')
+		if amp == -1 {
+			break
+		}
+		buf.WriteString(s[:amp])
+		s = s[amp:]
+
+		semi := strings.IndexByte(s, ';')
+		if semi == -1 {
+			break
+		}
+
+		if r, ok := resolveEntity(s[1:semi]); ok {
+			buf.WriteString(r)
+			s = s[semi+1:]
+		} else {
+			buf.WriteByte('&')
+			s = s[1:]
+		}
+	}
+	buf.WriteString(s)
+
+	return buf.String()
+}
+
+func resolveEntity(name string) (string, bool) {
+	if r, ok := predefinedEntities[name]; ok {
+		return r, true
+	}
+
+	if len(name) < 2 || name[0] != '#' {
+		return "", false
+	}
+
+	var n uint64
+	var err error
+	if name[1] == 'x' {
+		n, err = strconv.ParseUint(name[2:], 16, 32)
+	} else {
+		n, err = strconv.ParseUint(name[1:], 10, 32)
+	}
+	if err != nil || !utf8.ValidRune(rune(n)) {
+		return "", false
+	}
+
+	return string(rune(n)), true
+}
+
+// EscapeText escapes s for use as character data.
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+// EscapeAttribute escapes s for use as an attribute value enclosed in the
+// given quote character.
+func EscapeAttribute(s string, quote byte) string {
+	if quote == '\'' {
+		return singleQuoteEscaper.Replace(s)
+	}
+	return doubleQuoteEscaper.Replace(s)
+}
+
+var (
+	textEscaper        = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	doubleQuoteEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	singleQuoteEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "'", "&apos;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
@@ -0,0 +1,190 @@
+package format
+
+import (
+	"testing"
+)
+
+func TestPretty(t *testing.T) {
+	input := `<?xml version="1.0"?><!-- top --><doc><head><title>A   title</title>
+<meta name="a"/></head>
+        <body><p>Some <b>mixed</b>   <i>content</i></p><pre xml:space="preserve"><line/>
+   <line/></pre>
+<empty>   </empty><list><item/><!-- c --><item><sub>x</sub></item></list></body></doc>`
+
+	expected := `<?xml version="1.0"?>
+<!-- top -->
+<doc>
+  <head>
+    <title>A   title</title>
+    <meta name="a"/>
+  </head>
+  <body>
+    <p>Some <b>mixed</b>   <i>content</i></p>
+    <pre xml:space="preserve"><line/>
+   <line/></pre>
+    <empty>   </empty>
+    <list>
+      <item/>
+      <!-- c -->
+      <item>
+        <sub>x</sub>
+      </item>
+    </list>
+  </body>
+</doc>
+`
+
+	result, err := Pretty(input, PrettyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("Unexpected result:\n%s", result)
+	}
+
+	again, err := Pretty(result, PrettyOptions{})
+	if err != nil || again != result {
+		t.Errorf("Formatting not idempotent: %v\n%s", err, again)
+	}
+}
+
+func TestPrettyPreserveReset(t *testing.T) {
+	input := `<doc xml:space="preserve"> <a xml:space="default"><b/> <c/></a> </doc>`
+	expected := `<doc xml:space="preserve"> <a xml:space="default"><b/> <c/></a> </doc>` + "\n"
+
+	// the content of doc is preserved, including its children
+	if result, err := Pretty(input, PrettyOptions{}); err != nil || result != expected {
+		t.Errorf("Unexpected result: %v\n%s", err, result)
+	}
+
+	input = `<doc><a xml:space="preserve"> <b/> </a><c><d/></c></doc>`
+	expected = "<doc>\n\t<a xml:space=\"preserve\"> <b/> </a>\n\t<c>\n\t\t<d/>\n\t</c>\n</doc>\n"
+	if result, err := Pretty(input, PrettyOptions{Indent: "\t"}); err != nil || result != expected {
+		t.Errorf("Unexpected result: %v\n%s", err, result)
+	}
+}
+
+func TestPrettyWrapping(t *testing.T) {
+	input := `<doc><element first="1" second='2'   third="3"><short a="1"   b="2"/></element><x
+    y="z"/></doc>`
+	expected := `<doc>
+  <element
+    first="1"
+    second='2'
+    third="3">
+    <short a="1" b="2"/>
+  </element>
+  <x y="z"/>
+</doc>
+`
+
+	o := PrettyOptions{MaxWidth: 40}
+	result, err := Pretty(input, o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != expected {
+		t.Errorf("Unexpected result:\n%s", result)
+	}
+
+	again, err := Pretty(result, o)
+	if err != nil || again != result {
+		t.Errorf("Formatting not idempotent: %v\n%s", err, again)
+	}
+}
+
+func TestPrettyErrors(t *testing.T) {
+	if _, err := Pretty(`<a><b></a>`, PrettyOptions{}); err == nil {
+		t.Error("Expected error for broken document")
+	}
+}
+
+const svg = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Generator: Some Tool -->
+<svg xmlns="http://www.w3.org/2000/svg"   viewBox = "0 0 10 10" >
+  <style>
+    /* keep */
+    .a { fill: red; }
+  </style>
+  <g  id="group" >
+    <rect x="1" y="1"></rect>
+    <circle r='2' />
+  </g>
+  <text>Hello <tspan>big</tspan> <tspan>world</tspan></text>
+  <text xml:space="preserve">   </text>
+  <desc>  </desc>
+</svg>
+`
+
+func TestMinify(t *testing.T) {
+	for name, test := range map[string]struct {
+		Options  MinifyOptions
+		Expected string
+	}{
+		"all": {
+			MinifyOptions{},
+			`<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><style>
+    /* keep */
+    .a { fill: red; }
+  </style><g id="group"><rect x="1" y="1"/><circle r='2'/></g><text>Hello <tspan>big</tspan> <tspan>world</tspan></text><text xml:space="preserve">   </text><desc/></svg>`,
+		},
+		"keep comments and whitespace": {
+			MinifyOptions{KeepComments: true, KeepWhitespace: true, KeepTagWhitespace: true},
+			`<?xml version="1.0" encoding="UTF-8"?>
+<!-- Generator: Some Tool -->
+<svg xmlns="http://www.w3.org/2000/svg"   viewBox = "0 0 10 10" >
+  <style>
+    /* keep */
+    .a { fill: red; }
+  </style>
+  <g  id="group" >
+    <rect x="1" y="1"/>
+    <circle r='2' />
+  </g>
+  <text>Hello <tspan>big</tspan> <tspan>world</tspan></text>
+  <text xml:space="preserve">   </text>
+  <desc>  </desc>
+</svg>
+`,
+		},
+		"keep everything": {
+			MinifyOptions{KeepComments: true, KeepWhitespace: true, KeepTagWhitespace: true, KeepEmptyPairs: true},
+			svg,
+		},
+	} {
+		result, err := Minify(svg, test.Options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != test.Expected {
+			t.Errorf("Unexpected result for %s:\n%s", name, result)
+		}
+	}
+}
+
+func TestMinifyTextElements(t *testing.T) {
+	for input, expected := range map[string]string{
+		`<svg> <text> <tspan>big</tspan> <tspan>world</tspan> </text> </svg>`: `<svg><text> <tspan>big</tspan> <tspan>world</tspan> </text></svg>`,
+		`<div> <p><b>a</b> <i>b</i></p> </div>`:                               `<div><p><b>a</b> <i>b</i></p></div>`,
+		`<p>a <span> <b>b</b> <i>c</i> </span></p>`:                           `<p>a <span> <b>b</b> <i>c</i> </span></p>`,
+		`<doc> <x>a <y> <z/> </y></x> </doc>`:                                 `<doc><x>a <y> <z/> </y></x></doc>`,
+	} {
+		if result, err := Minify(input, MinifyOptions{}); err != nil || result != expected {
+			t.Errorf("Unexpected result for %s: %v\n%s", input, err, result)
+		}
+	}
+
+	input := `<r> <p><b>a</b> <i>b</i></p> </r>`
+	if result, err := Minify(input, MinifyOptions{TextElements: []string{}}); err != nil || result != `<r><p><b>a</b><i>b</i></p></r>` {
+		t.Errorf("Unexpected result without text elements: %v\n%s", err, result)
+	}
+}
+
+func TestMinifyRawText(t *testing.T) {
+	input := `<html><script><!-- not a comment --> </script> <x:style>  <a></a> </x:style> <!-- comment --></html>`
+	expected := `<html><script><!-- not a comment --> </script><x:style>  <a></a> </x:style></html>`
+
+	if result, err := Minify(input, MinifyOptions{}); err != nil || result != expected {
+		t.Errorf("Unexpected result: %v\n%s", err, result)
+	}
+}
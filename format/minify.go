@@ -0,0 +1,206 @@
+package format
+
+import (
+	"io"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+// MinifyOptions configures the minifier. The zero value enables all
+// transformations.
+type MinifyOptions struct {
+	// KeepComments disables removing comments.
+	KeepComments bool
+	// KeepWhitespace disables removing whitespace-only text between
+	// elements. Whitespace in text elements, elements containing
+	// non-whitespace text (mixed content) or `xml:space="preserve"` and
+	// their descendants is never removed.
+	KeepWhitespace bool
+	// KeepEmptyPairs disables shortening `<a></a>` to `<a/>`.
+	KeepEmptyPairs bool
+	// KeepTagWhitespace disables normalizing the whitespace between the
+	// attributes of elements.
+	KeepTagWhitespace bool
+	// RawTextElements are elements, which content is left untouched
+	// completely. Defaults to `script` and `style`.
+	RawTextElements []string
+	// TextElements are elements containing text, even if all of it is
+	// inside of child elements, like `<p><b>a</b> <i>b</i></p>`. Defaults
+	// to DefaultTextElements.
+	TextElements []string
+}
+
+// DefaultTextElements are the SVG and XHTML elements, which contain text.
+var DefaultTextElements = []string{
+	"text", "tspan", "textPath",
+	"p", "h1", "h2", "h3", "h4", "h5", "h6", "li", "dt", "dd", "td", "th",
+	"caption", "figcaption", "blockquote", "pre", "label", "button", "option",
+	"a", "abbr", "b", "bdi", "bdo", "cite", "code", "del", "dfn", "em", "i",
+	"ins", "kbd", "mark", "q", "s", "samp", "small", "span", "strong", "sub",
+	"sup", "time", "u", "var",
+}
+
+// Minify removes insignificant whitespace, comments and markup from the
+// document in input.
+func Minify(input string, o MinifyOptions) (string, error) {
+	buf := strings.Builder{}
+	if err := WriteMinified(&buf, gockl.New(input), o); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// WriteMinified minifies the remaining tokens of z and writes the result to
+// w.
+func WriteMinified(w io.Writer, z *gockl.Tokenizer, o MinifyOptions) error {
+	doc, err := tree.Parse(z)
+	if err != nil {
+		return err
+	}
+
+	if o.RawTextElements == nil {
+		o.RawTextElements = []string{"script", "style"}
+	}
+	if o.TextElements == nil {
+		o.TextElements = DefaultTextElements
+	}
+
+	m := &minifier{o: o, input: doc.Input}
+	m.nodes(doc.Nodes, false, false)
+
+	_, err = io.WriteString(w, m.buf.String())
+	return err
+}
+
+type minifier struct {
+	o     MinifyOptions
+	input string
+	buf   strings.Builder
+}
+
+func (m *minifier) isRawText(n *tree.Node) bool {
+	return matches(n, m.o.RawTextElements)
+}
+
+// isText reports whether whitespace in the element is significant, because
+// it is a text element or contains text directly.
+func (m *minifier) isText(n *tree.Node) bool {
+	return isMixed(n) || matches(n, m.o.TextElements)
+}
+
+func matches(n *tree.Node, names []string) bool {
+	name := n.Name()
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		name = name[idx+1:]
+	}
+	for _, i := range names {
+		if strings.EqualFold(i, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *minifier) nodes(nodes []*tree.Node, mixed, preserve bool) {
+	for _, n := range nodes {
+		switch n.Kind() {
+		case gockl.CommentKind:
+			if !m.o.KeepComments {
+				continue
+			}
+		case gockl.TextKind:
+			if isWhitespace(n) && !m.o.KeepWhitespace && !mixed && !preserve {
+				continue
+			}
+		case gockl.StartElementKind, gockl.EmptyElementKind:
+			m.element(n, mixed, preserve)
+			continue
+		}
+
+		m.buf.WriteString(n.Raw())
+	}
+}
+
+func (m *minifier) element(n *tree.Node, mixed, preserve bool) {
+	preserve = preserves(n, preserve)
+	mixed = mixed || m.isText(n)
+
+	if n.Kind() == gockl.EmptyElementKind || (!m.o.KeepEmptyPairs && !m.hasContent(n, mixed, preserve)) {
+		m.startElement(n, true)
+		return
+	}
+
+	m.startElement(n, false)
+	if m.isRawText(n) {
+		m.buf.WriteString(m.input[n.ContentOffset():n.ContentEndOffset()])
+	} else {
+		m.nodes(n.Children, mixed, preserve)
+	}
+
+	if m.o.KeepTagWhitespace {
+		m.buf.WriteString(n.End.Raw(m.input))
+	} else {
+		m.buf.WriteString("</" + n.Name() + ">")
+	}
+}
+
+// hasContent reports whether anything of the element's content will be
+// written.
+func (m *minifier) hasContent(n *tree.Node, mixed, preserve bool) bool {
+	if m.isRawText(n) {
+		return n.ContentOffset() < n.ContentEndOffset()
+	}
+
+	for _, c := range n.Children {
+		switch c.Kind() {
+		case gockl.CommentKind:
+			if m.o.KeepComments {
+				return true
+			}
+		case gockl.TextKind:
+			if !isWhitespace(c) || m.o.KeepWhitespace || mixed || preserve {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+func (m *minifier) startElement(n *tree.Node, empty bool) {
+	raw := n.Start.Raw(m.input)
+
+	if m.o.KeepTagWhitespace {
+		if empty && n.Kind() == gockl.StartElementKind {
+			raw = strings.TrimSuffix(raw, ">") + "/>"
+		}
+		m.buf.WriteString(raw)
+		return
+	}
+
+	el := n.Element()
+	m.buf.WriteString("<" + el.Name())
+	for _, a := range el.AttributeSpans() {
+		m.buf.WriteString(" " + a.Name)
+		if a.End == a.Start+len(a.Name) {
+			// attribute without a value
+			continue
+		}
+		m.buf.WriteString("=")
+		if a.Quote == 0 {
+			m.buf.WriteString(a.Content)
+		} else {
+			m.buf.WriteString(string(a.Quote) + a.Content + string(a.Quote))
+		}
+	}
+
+	if empty {
+		m.buf.WriteString("/>")
+	} else {
+		m.buf.WriteString(">")
+	}
+}
@@ -0,0 +1,181 @@
+// Package format reformats XML documents by only changing insignificant
+// whitespace and markup, leaving all character data untouched.
+package format
+
+import (
+	"io"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+// PrettyOptions configures the pretty-printer.
+type PrettyOptions struct {
+	// Indent is used to indent nested elements. Defaults to two spaces.
+	Indent string
+	// MaxWidth enables wrapping the attributes of start elements onto
+	// separate lines, if the element would otherwise exceed this number of
+	// bytes. Zero leaves all start elements untouched.
+	MaxWidth int
+}
+
+// Pretty reindents the document in input. Only whitespace-only text between
+// elements is changed, elements containing non-whitespace text (mixed
+// content) or `xml:space="preserve"` are kept as they are.
+func Pretty(input string, o PrettyOptions) (string, error) {
+	buf := strings.Builder{}
+	if err := WritePretty(&buf, gockl.New(input), o); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// WritePretty reindents the remaining tokens of z and writes the result to w.
+func WritePretty(w io.Writer, z *gockl.Tokenizer, o PrettyOptions) error {
+	doc, err := tree.Parse(z)
+	if err != nil {
+		return err
+	}
+
+	if o.Indent == "" {
+		o.Indent = "  "
+	}
+
+	p := &printer{o: o, input: doc.Input}
+	first := true
+	for _, n := range doc.Nodes {
+		if isWhitespace(n) {
+			continue
+		}
+		if !first {
+			p.buf.WriteString("\n")
+		}
+		first = false
+		p.node(n, 0, false)
+	}
+	p.buf.WriteString("\n")
+
+	_, err = io.WriteString(w, p.buf.String())
+	return err
+}
+
+type printer struct {
+	o     PrettyOptions
+	input string
+	buf   strings.Builder
+}
+
+func isWhitespace(n *tree.Node) bool {
+	return n.Kind() == gockl.TextKind && strings.Trim(n.Token().Raw(), " \t\r\n") == ""
+}
+
+// isMixed reports whether an element contains character data, so that the
+// whitespace between its children is significant.
+func isMixed(n *tree.Node) bool {
+	for _, c := range n.Children {
+		switch c.Kind() {
+		case gockl.CDATAKind:
+			return true
+		case gockl.TextKind:
+			if !isWhitespace(c) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// preserves reports whether the content of an element needs to be preserved
+// due to xml:space, given whether the parent's content is preserved.
+func preserves(n *tree.Node, inherited bool) bool {
+	if space, ok := n.Attribute("xml:space"); ok {
+		return space == "preserve"
+	}
+	return inherited
+}
+
+func (p *printer) node(n *tree.Node, depth int, preserve bool) {
+	if !n.IsElement() {
+		p.buf.WriteString(n.Raw())
+		return
+	}
+
+	preserve = preserves(n, preserve)
+	if preserve || isMixed(n) {
+		p.buf.WriteString(n.Raw())
+		return
+	}
+
+	p.startElement(n, depth)
+	if n.Kind() == gockl.EmptyElementKind {
+		return
+	}
+
+	hasContent := false
+	for _, c := range n.Children {
+		if !isWhitespace(c) {
+			hasContent = true
+			break
+		}
+	}
+
+	if !hasContent {
+		// keep the content of elements with only whitespace as it is
+		p.buf.WriteString(p.input[n.ContentOffset():n.EndOffset()])
+		return
+	}
+
+	for _, c := range n.Children {
+		if isWhitespace(c) {
+			continue
+		}
+		p.buf.WriteString("\n")
+		p.indent(depth + 1)
+		p.node(c, depth+1, preserve)
+	}
+	p.buf.WriteString("\n")
+	p.indent(depth)
+	p.buf.WriteString(n.End.Raw(p.input))
+}
+
+func (p *printer) startElement(n *tree.Node, depth int) {
+	raw := n.Start.Raw(p.input)
+	if p.o.MaxWidth <= 0 {
+		p.buf.WriteString(raw)
+		return
+	}
+
+	el := n.Element()
+	attrs := el.AttributeSpans()
+	closing := ">"
+	if n.Kind() == gockl.EmptyElementKind {
+		closing = "/>"
+	}
+
+	line := "<" + el.Name()
+	for _, a := range attrs {
+		line += " " + raw[a.Start:a.End]
+	}
+	line += closing
+
+	if len(attrs) < 2 || len(p.o.Indent)*depth+len(line) <= p.o.MaxWidth {
+		p.buf.WriteString(line)
+		return
+	}
+
+	p.buf.WriteString("<" + el.Name())
+	for _, a := range attrs {
+		p.buf.WriteString("\n")
+		p.indent(depth + 1)
+		p.buf.WriteString(raw[a.Start:a.End])
+	}
+	p.buf.WriteString(closing)
+}
+
+func (p *printer) indent(depth int) {
+	for i := 0; i < depth; i++ {
+		p.buf.WriteString(p.o.Indent)
+	}
+}
@@ -1,15 +1,33 @@
 package gockl
 
 import (
+	"errors"
 	"io"
 	"strings"
 )
 
 var spaceChars = " \t\r\n"
 
+// MaxLookahead is the maximum number of tokens that can be looked ahead
+// using PeekN.
+const MaxLookahead = 64
+
+var (
+	ErrLookahead = errors.New("gockl: lookahead limit exceeded")
+	ErrUnread    = errors.New("gockl: cannot unread token")
+)
+
 type Tokenizer struct {
 	Input    string
 	Position int
+
+	// lookahead buffer, only valid as long as Position == peekedAt
+	peeked   []Span
+	peekedAt int
+
+	// last token returned, only valid as long as Position == prev.End
+	prev    Span
+	hasPrev bool
 }
 
 func New(input string) *Tokenizer {
@@ -112,10 +130,124 @@ func (me *Tokenizer) has(next string) bool {
 }
 
 func (me *Tokenizer) Next() (Token, error) {
-	if me.Position >= len(me.Input) {
-		return nil, io.EOF
+	span, err := me.NextSpan()
+	if err != nil {
+		return nil, err
+	}
+
+	return span.Token(me.Input), nil
+}
+
+// NextSpan reads the next token like Next, but only returns its kind and
+// offsets into Input instead of allocating a Token value.
+func (me *Tokenizer) NextSpan() (Span, error) {
+	var span Span
+
+	if len(me.peeked) > 0 && me.peekedAt == me.Position {
+		span = me.peeked[0]
+		me.peeked = me.peeked[1:]
+		me.Position = span.End
+		me.peekedAt = span.End
+	} else {
+		me.peeked = me.peeked[:0]
+		if me.Position >= len(me.Input) {
+			me.hasPrev = false
+			return Span{}, io.EOF
+		}
+
+		start := me.Position
+		kind := me.scan()
+		span = Span{Kind: kind, Start: start, End: me.Position}
 	}
 
+	me.prev = span
+	me.hasPrev = true
+
+	return span, nil
+}
+
+// Peek returns the next token without consuming it.
+func (me *Tokenizer) Peek() (Token, error) {
+	spans, err := me.peekSpans(1)
+	if len(spans) == 0 {
+		return nil, err
+	}
+
+	return spans[0].Token(me.Input), nil
+}
+
+// PeekN returns the next n tokens without consuming them. If less than n
+// tokens are left, the remaining tokens are returned together with io.EOF.
+// At most MaxLookahead tokens can be looked ahead, ErrLookahead is returned
+// for larger or negative values of n. The lookahead is discarded, if Position
+// is changed manually.
+func (me *Tokenizer) PeekN(n int) ([]Token, error) {
+	spans, err := me.peekSpans(n)
+
+	r := make([]Token, len(spans))
+	for i, span := range spans {
+		r[i] = span.Token(me.Input)
+	}
+
+	return r, err
+}
+
+func (me *Tokenizer) peekSpans(n int) ([]Span, error) {
+	if n < 0 || n > MaxLookahead {
+		return nil, ErrLookahead
+	}
+
+	if me.peekedAt != me.Position {
+		me.peeked = me.peeked[:0]
+		me.peekedAt = me.Position
+	}
+
+	pos := me.Position
+	if len(me.peeked) > 0 {
+		pos = me.peeked[len(me.peeked)-1].End
+	}
+
+	for len(me.peeked) < n && pos < len(me.Input) {
+		old := me.Position
+		me.Position = pos
+		kind := me.scan()
+		me.peeked = append(me.peeked, Span{Kind: kind, Start: pos, End: me.Position})
+		pos = me.Position
+		me.Position = old
+	}
+
+	if len(me.peeked) < n {
+		return me.peeked, io.EOF
+	}
+
+	return me.peeked[:n], nil
+}
+
+// Unread pushes back the last token returned by Next or NextSpan, so that it
+// will be returned again. Only a single token can be unread and only as long
+// as Position has not been changed manually.
+func (me *Tokenizer) Unread() error {
+	if !me.hasPrev || me.Position != me.prev.End {
+		return ErrUnread
+	}
+
+	if len(me.peeked) > 0 && me.peekedAt == me.Position {
+		if len(me.peeked) >= MaxLookahead {
+			me.peeked = me.peeked[:MaxLookahead-1]
+		}
+		me.peeked = append([]Span{me.prev}, me.peeked...)
+	} else {
+		me.peeked = append(me.peeked[:0], me.prev)
+	}
+
+	me.Position = me.prev.Start
+	me.peekedAt = me.Position
+	me.hasPrev = false
+
+	return nil
+}
+
+func (me *Tokenizer) scan() TokenKind {
 	if me.Position >= len(me.Input)-3 {
 		goto dunno
 	}
@@ -124,36 +256,42 @@ func (me *Tokenizer) Next() (Token, error) {
 	case '<':
 		switch me.Input[me.Position+1] {
 		case '?':
-			return ProcInstToken(me.shift("?>")), nil
+			me.shift("?>")
+			return ProcInstKind
 		case '!':
 			if me.has("<!--") {
-				return CommentToken(me.shift("-->")), nil
+				me.shift("-->")
+				return CommentKind
 			}
 
 			if me.has("<![CDATA[") {
-				return CDATAToken(me.shift("]]>")), nil
+				me.shift("]]>")
+				return CDATAKind
 			}
 
 			r := me.shift(">")
 			if strings.HasPrefix(r, "<!DOCTYPE") && strings.Contains(r, "[") {
-				r += me.shift("]") + me.shift(">")
+				me.shift("]")
+				me.shift(">")
 			}
 
-			return DirectiveToken(r), nil
+			return DirectiveKind
 		case '/':
-			return EndElementToken(me.shift(">")), nil
+			me.shift(">")
+			return EndElementKind
 		default:
 			raw := me.shiftToTagEnd()
 
 			if len(raw) >= 3 && raw[len(raw)-2] == '/' {
-				return EmptyElementToken(raw), nil
+				return EmptyElementKind
 			}
 
-			return StartElementToken(raw), nil
+			return StartElementKind
 		}
 	}
 
 dunno:
 
-	return TextToken(me.shiftUntil('<')), nil
+	me.shiftUntil('<')
+	return TextKind
 }
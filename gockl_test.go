@@ -2,6 +2,7 @@ package gockl
 
 import (
 	"bytes"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -39,6 +40,10 @@ var documents map[string]DocumentInfo = map[string]DocumentInfo{
 		Data:         `<!DOCTYPE[`,
 		ElementNames: []string{},
 	},
+	"whitespace in end elements": {
+		Data:         "<a><b></b ></a\n>",
+		ElementNames: []string{"a", "b", "b", "a"},
+	},
 	"simple-svg": {
 		Data: `<?xml version="1.0" encoding="UTF-8"?>
 <svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="100%" height="100%" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 1920 1080">
@@ -443,3 +448,401 @@ func TestParsingFringeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestContentAccessors(t *testing.T) {
+	type contentTest struct {
+		Token      interface{ Content() (string, bool) }
+		Content    string
+		Terminated bool
+	}
+
+	for _, i := range []contentTest{
+		{CDATAToken(`<![CDATA[</p>]]>`), `</p>`, true},
+		{CDATAToken(`<![CDATA[]]>`), ``, true},
+		{CDATAToken(`<![CDATA[abc`), `abc`, false},
+		{CDATAToken(`<![CDATA[abc]]`), `abc]]`, false},
+		{CommentToken(`<!-- hello -->`), ` hello `, true},
+		{CommentToken(`<!-->`), `>`, false},
+		{CommentToken(`<!-- hello`), ` hello`, false},
+		{ProcInstToken(`<?xml version="1.0"?>`), `xml version="1.0"`, true},
+		{ProcInstToken(`<?xml`), `xml`, false},
+	} {
+		content, ok := i.Token.Content()
+		if content != i.Content || ok != i.Terminated {
+			t.Errorf("Wrong content for %v: got '%s'/%v, expected '%s'/%v", i.Token, content, ok, i.Content, i.Terminated)
+		}
+	}
+
+	pi := ProcInstToken(`<?xml-stylesheet  href="a.xsl" ?>`)
+	if target := pi.Target(); target != "xml-stylesheet" {
+		t.Errorf("Wrong target: %s", target)
+	}
+	if inst := pi.Instruction(); inst != `href="a.xsl" ` {
+		t.Errorf("Wrong instruction: %s", inst)
+	}
+}
+
+func TestConstructors(t *testing.T) {
+	for content, expected := range map[string][]CDATAToken{
+		"":          {`<![CDATA[]]>`},
+		"a < b":     {`<![CDATA[a < b]]>`},
+		"a]]>b":     {`<![CDATA[a]]]]>`, `<![CDATA[>b]]>`},
+		"]]>]]>":    {`<![CDATA[]]]]>`, `<![CDATA[>]]]]>`, `<![CDATA[>]]>`},
+		"x]]]>y]]>": {`<![CDATA[x]]]]]>`, `<![CDATA[>y]]]]>`, `<![CDATA[>]]>`},
+	} {
+		result := NewCDATA(content)
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Wrong CDATA sections for '%s': %v", content, result)
+		}
+
+		joined := ""
+		for _, tok := range result {
+			c, ok := tok.Content()
+			if !ok {
+				t.Errorf("Unterminated CDATA section: %s", tok)
+			}
+			joined += c
+		}
+		if joined != content {
+			t.Errorf("CDATA content not preserved: '%s' != '%s'", joined, content)
+		}
+	}
+
+	if c, err := NewComment(" ok "); err != nil || c != `<!-- ok -->` {
+		t.Errorf("Unexpected comment: %s/%v", c, err)
+	}
+	for _, content := range []string{"a--b", "a-"} {
+		if _, err := NewComment(content); err == nil {
+			t.Errorf("Expected error for comment content '%s'", content)
+		}
+	}
+
+	if pi, err := NewProcInst("xml", `version="1.0"`); err != nil || pi != `<?xml version="1.0"?>` {
+		t.Errorf("Unexpected processing instruction: %s/%v", pi, err)
+	}
+	for _, target := range []string{"", "a b", "1abc", "a/b", "-a", "a?"} {
+		if _, err := NewProcInst(target, ""); err == nil {
+			t.Errorf("Expected error for invalid target '%s'", target)
+		}
+	}
+	if pi, err := NewProcInst("ä-1.x", ""); err != nil || pi != `<?ä-1.x?>` {
+		t.Errorf("Unexpected processing instruction: %s/%v", pi, err)
+	}
+	if _, err := NewProcInst("a", "?>"); err == nil {
+		t.Error("Expected error for invalid instruction")
+	}
+}
+
+func TestSpans(t *testing.T) {
+	for name, info := range documents {
+		tokens := getAllTokens(info.Data)
+		z := New(info.Data)
+
+		for pos := 0; ; pos++ {
+			span, err := z.NextSpan()
+			if err != nil {
+				if pos != len(tokens) {
+					t.Errorf("Got %d spans instead of %d tokens for document %s", pos, len(tokens), name)
+				}
+				break
+			}
+			if pos >= len(tokens) {
+				t.Errorf("Span pos %d not existing for document %s", pos, name)
+				break
+			}
+			if span.Kind != tokens[pos].Kind() {
+				t.Errorf("Kind not matching at pos %d for document %s: %s (actual) != %s (expected)", pos, name, span.Kind, tokens[pos].Kind())
+			}
+			if tok := span.Token(info.Data); !reflect.DeepEqual(tok, tokens[pos]) {
+				t.Errorf("Token not matching at pos %d for document %s: %v (actual) != %v (expected)", pos, name, tok, tokens[pos])
+			}
+		}
+	}
+
+	data := documents["simple-svg"].Data
+	allocs := testing.AllocsPerRun(10, func() {
+		z := Tokenizer{Input: data}
+		for {
+			if _, err := z.NextSpan(); err != nil {
+				break
+			}
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("NextSpan allocated %f times", allocs)
+	}
+}
+
+func TestPeekAndUnread(t *testing.T) {
+	data := documents["simple-svg"].Data
+	tokens := getAllTokens(data)
+	z := New(data)
+
+	if tok, err := z.Peek(); err != nil || tok != tokens[0] {
+		t.Errorf("Wrong token peeked: %v/%v", tok, err)
+	}
+	if z.Position != 0 {
+		t.Errorf("Peek moved position to %d", z.Position)
+	}
+
+	if err := z.Unread(); err != ErrUnread {
+		t.Errorf("Expected unread error at start, got %v", err)
+	}
+
+	peeked, err := z.PeekN(3)
+	if err != nil || !reflect.DeepEqual(peeked, tokens[:3]) {
+		t.Errorf("Wrong tokens peeked: %v/%v", peeked, err)
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tok, err := z.Next()
+		if err != nil || tok != tokens[i] {
+			t.Fatalf("Wrong token at pos %d: %v/%v", i, tok, err)
+		}
+
+		if i%2 == 0 {
+			if err := z.Unread(); err != nil {
+				t.Fatalf("Unable to unread at pos %d: %v", i, err)
+			}
+			if err := z.Unread(); err != ErrUnread {
+				t.Fatalf("Expected error on second unread at pos %d, got %v", i, err)
+			}
+			if tok, err := z.Peek(); err != nil || tok != tokens[i] {
+				t.Fatalf("Wrong token peeked after unread at pos %d: %v/%v", i, tok, err)
+			}
+			if tok, err := z.Next(); err != nil || tok != tokens[i] {
+				t.Fatalf("Wrong token after unread at pos %d: %v/%v", i, tok, err)
+			}
+		}
+
+		if i+2 < len(tokens) {
+			if peeked, err := z.PeekN(2); err != nil || !reflect.DeepEqual(peeked, tokens[i+1:i+3]) {
+				t.Fatalf("Wrong tokens peeked at pos %d: %v/%v", i, peeked, err)
+			}
+		}
+	}
+
+	if peeked, err := z.PeekN(2); len(peeked) != 0 || err != io.EOF {
+		t.Errorf("Expected EOF when peeking at end, got %v/%v", peeked, err)
+	}
+	if _, err := z.PeekN(MaxLookahead + 1); err != ErrLookahead {
+		t.Errorf("Expected lookahead error, got %v", err)
+	}
+	if _, err := z.PeekN(-1); err != ErrLookahead {
+		t.Errorf("Expected lookahead error for negative n, got %v", err)
+	}
+
+	// changing the position manually invalidates lookahead and unread
+	z = New(data)
+	z.PeekN(5)
+	z.Next()
+	z.Position = 0
+	if err := z.Unread(); err != ErrUnread {
+		t.Errorf("Expected unread error after moving position, got %v", err)
+	}
+	if tok, err := z.Next(); err != nil || tok != tokens[0] {
+		t.Errorf("Wrong token after moving position: %v/%v", tok, err)
+	}
+}
+
+func TestSkipAndCaptureElement(t *testing.T) {
+	data := `<doc><metadata a="1"><metadata>x</metadata><br/><metadata/></metadata><body>text</body><empty/></doc>`
+
+	z := New(data)
+	z.Next()
+	if err := z.SkipElement(); err != nil {
+		t.Fatalf("Unable to skip root element: %v", err)
+	}
+	if z.Position != len(data) {
+		t.Errorf("Root element not skipped completely, position: %d", z.Position)
+	}
+
+	z = New(data)
+	z.Next()
+	if _, err := z.CaptureElement(); err != nil {
+		t.Fatalf("Unable to capture root element: %v", err)
+	}
+	if err := z.SkipElement(); err != ErrNoElement {
+		t.Errorf("Expected error when skipping after end element, got %v", err)
+	}
+
+	z = New(data)
+	z.Next()
+	z.Next()
+	if raw, err := z.CaptureElement(); err != nil || raw != `<metadata a="1"><metadata>x</metadata><br/><metadata/></metadata>` {
+		t.Errorf("Wrong element captured: %s/%v", raw, err)
+	}
+	if tok, err := z.Next(); err != nil || tok != StartElementToken(`<body>`) {
+		t.Errorf("Wrong token after capture: %v/%v", tok, err)
+	}
+	z.SkipElement()
+	z.Next()
+	if raw, err := z.CaptureElement(); err != nil || raw != `<empty/>` {
+		t.Errorf("Wrong empty element captured: %s/%v", raw, err)
+	}
+	if tok, err := z.Next(); err != nil || tok != EndElementToken(`</doc>`) {
+		t.Errorf("Wrong token after capturing empty element: %v/%v", tok, err)
+	}
+
+	z = New(`<a><a></a>`)
+	z.Next()
+	if raw, err := z.CaptureElement(); err != io.ErrUnexpectedEOF || raw != `<a><a></a>` {
+		t.Errorf("Expected unexpected EOF, got %s/%v", raw, err)
+	}
+
+	z = New("<a><a></a ></a\n>text")
+	z.Next()
+	if raw, err := z.CaptureElement(); err != nil || raw != "<a><a></a ></a\n>" {
+		t.Errorf("Wrong element with whitespace in end elements captured: %s/%v", raw, err)
+	}
+
+	z = New(`text<a>`)
+	z.Next()
+	if err := z.SkipElement(); err != ErrNoElement {
+		t.Errorf("Expected error when skipping text, got %v", err)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for input, expected := range map[string]string{
+		"plain":                   "plain",
+		"a &lt; b &amp;&amp; c":   "a < b && c",
+		"&quot;&apos;&gt;":        `"'>`,
+		"&#65;&#x42;&#x263A;":     "AB☺",
+		"&unknown; & &#xZZ; &amp": "&unknown; & &#xZZ; &amp",
+		"&&amp;;":                 "&&;",
+		"&#1114112; &#0x41; &#;":  "&#1114112; &#0x41; &#;",
+	} {
+		if actual := Unescape(input); actual != expected {
+			t.Errorf("Wrong result unescaping '%s': '%s' (actual) != '%s' (expected)", input, actual, expected)
+		}
+	}
+}
+
+func TestTokenReader(t *testing.T) {
+	type Metadata struct {
+		Title  string   `xml:"title"`
+		Tags   []string `xml:"tag"`
+		Author struct {
+			Name string `xml:"name,attr"`
+		} `xml:"author"`
+		Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	}
+
+	data := `<?xml version="1.0"?>
+<doc><!-- c --><metadata xml:lang="de">
+  <title>Fish &amp; Chips</title>
+  <tag>a</tag><tag><![CDATA[<b>]]></tag>
+  <author name="R &quot;B&quot;"/>
+</metadata><body/></doc>`
+
+	z := New(data)
+	for {
+		tok, err := z.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if el, ok := tok.(StartElementToken); ok && el.Name() == "metadata" {
+			break
+		}
+	}
+	z.Unread()
+
+	m := Metadata{}
+	if err := xml.NewTokenDecoder(NewTokenReader(z)).Decode(&m); err != nil {
+		t.Fatalf("Unable to decode: %v", err)
+	}
+
+	if m.Title != "Fish & Chips" || !reflect.DeepEqual(m.Tags, []string{"a", "<b>"}) || m.Author.Name != `R "B"` || m.Lang != "de" {
+		t.Errorf("Wrong result: %+v", m)
+	}
+
+	if tok, err := z.Next(); err != nil || tok != EmptyElementToken(`<body/>`) {
+		t.Errorf("Wrong token after decoding: %v/%v", tok, err)
+	}
+
+	r := NewTokenReader(New(`<?xml version="1.0"?><!DOCTYPE x><x a='1'/>`))
+	expected := []xml.Token{
+		xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0"`)},
+		xml.Directive("DOCTYPE x"),
+		xml.StartElement{Name: xml.Name{Local: "x"}, Attr: []xml.Attr{{Name: xml.Name{Local: "a"}, Value: "1"}}},
+		xml.EndElement{Name: xml.Name{Local: "x"}},
+	}
+	for _, e := range expected {
+		if tok, err := r.Token(); err != nil || !reflect.DeepEqual(tok, e) {
+			t.Errorf("Wrong token: %#v (actual) != %#v (expected)", tok, e)
+		}
+	}
+	if tok, err := r.Token(); err != io.EOF {
+		t.Errorf("Expected EOF, got %v/%v", tok, err)
+	}
+}
+
+func TestAttributeSpans(t *testing.T) {
+	raw := "<svg a=\"1\"  b = 'x y'\n c=d e/>"
+	tok := EmptyElementToken(raw)
+	expected := []AttributeSpan{
+		{Attribute{"a", "1"}, 5, 10, 8, 9, '"'},
+		{Attribute{"b", "x y"}, 12, 21, 17, 20, '\''},
+		{Attribute{"c", "d"}, 23, 26, 25, 26, 0},
+		{Attribute{"e", ""}, 27, 28, 28, 28, 0},
+	}
+
+	if spans := tok.AttributeSpans(); !reflect.DeepEqual(spans, expected) {
+		t.Errorf("Wrong attribute spans: %v", spans)
+	}
+
+	for _, test := range []struct {
+		Token    StartOrEmptyElementToken
+		Name     string
+		Value    string
+		Expected string
+	}{
+		{tok, "a", "<2>", "<svg a=\"&lt;2&gt;\"  b = 'x y'\n c=d e/>"},
+		{tok, "b", "it's", "<svg a=\"1\"  b = 'it&apos;s'\n c=d e/>"},
+		{tok, "B", "it's", "<svg a=\"1\"  b = 'x y'\n c=d e B=\"it's\"/>"},
+		{tok, "c", "e f", "<svg a=\"1\"  b = 'x y'\n c=\"e f\" e/>"},
+		{tok, "f", "g", "<svg a=\"1\"  b = 'x y'\n c=d e f=\"g\"/>"},
+		{EmptyElementToken(`<br />`), "x", "1", `<br x="1" />`},
+		{StartElementToken(`<p>`), "x", "1", `<p x="1">`},
+		{StartElementToken("<p\n>"), "x", "1", "<p x=\"1\"\n>"},
+	} {
+		var result string
+		switch tok := test.Token.(type) {
+		case StartElementToken:
+			result = string(tok.SetAttribute(test.Name, test.Value))
+		case EmptyElementToken:
+			result = string(tok.SetAttribute(test.Name, test.Value))
+		}
+		if result != test.Expected {
+			t.Errorf("Wrong result setting %s on %s: %s", test.Name, test.Token, result)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	input := "<a>\n  <b/>\r\n<c/></a>"
+	for offset, expected := range map[int]Location{
+		0:   {0, 1, 1},
+		3:   {3, 1, 4},
+		4:   {4, 2, 1},
+		6:   {6, 2, 3},
+		12:  {12, 3, 1},
+		100: {len(input), 3, 9},
+	} {
+		if actual := Locate(input, offset); actual != expected {
+			t.Errorf("Wrong location for offset %d: %v (actual) != %v (expected)", offset, actual, expected)
+		}
+	}
+
+	if s := Locate(input, 6).String(); s != "2:3" {
+		t.Errorf("Wrong string representation: %s", s)
+	}
+
+	l := NewLocator(input)
+	for _, offset := range []int{0, 3, 4, 12, 13, 6, 100, 4} {
+		if actual, expected := l.Locate(offset), Locate(input, offset); actual != expected {
+			t.Errorf("Locator returned wrong location for offset %d: %v (actual) != %v (expected)", offset, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+// Package grep searches XML documents for element names, attribute names,
+// attribute values and text content matching a regular expression.
+//
+// All matching is done on the raw markup, so that every match can be mapped
+// back to its exact position in the input. This means entity and character
+// references in values and text are not expanded.
+package grep
+
+import (
+	"regexp"
+
+	"github.com/roblillack/gockl"
+)
+
+// Kind describes what part of the document matched.
+type Kind uint8
+
+const (
+	// ElementName is a match in the name of a start or empty element.
+	ElementName Kind = iota + 1
+	// AttributeName is a match in the name of an attribute.
+	AttributeName
+	// AttributeValue is a match in the value of an attribute.
+	AttributeValue
+	// Text is a match in text or CDATA content.
+	Text
+)
+
+func (k Kind) String() string {
+	switch k {
+	case ElementName:
+		return "element"
+	case AttributeName:
+		return "attribute"
+	case AttributeValue:
+		return "value"
+	case Text:
+		return "text"
+	}
+	return "invalid"
+}
+
+// Options selects the parts of the document to search. If none are set, all
+// parts are searched.
+type Options struct {
+	ElementNames    bool
+	AttributeNames  bool
+	AttributeValues bool
+	Text            bool
+}
+
+func (o Options) all() bool {
+	return !o.ElementNames && !o.AttributeNames && !o.AttributeValues && !o.Text
+}
+
+// Match is a single match.
+type Match struct {
+	Kind Kind
+	// Start and End are the offsets of the matched bytes in the input.
+	Start int
+	End   int
+	// Tag is the start or empty element the match occurred in. For text
+	// matches, it is the enclosing element, which might be missing (Kind is
+	// gockl.InvalidKind) for text outside of the document element.
+	Tag gockl.Span
+	// Token is the token the match occurred in. For element and attribute
+	// matches, it is equal to Tag.
+	Token gockl.Span
+}
+
+// String searches the document in input.
+func String(input string, re *regexp.Regexp, o Options) []Match {
+	return Search(gockl.New(input), re, o)
+}
+
+// Search searches all remaining tokens of z and returns the matches in
+// document order.
+func Search(z *gockl.Tokenizer, re *regexp.Regexp, o Options) []Match {
+	r := []Match{}
+	stack := []gockl.Span{}
+	all := o.all()
+
+	find := func(kind Kind, s string, offset int, tag, token gockl.Span) {
+		for _, m := range re.FindAllStringIndex(s, -1) {
+			r = append(r, Match{kind, offset + m[0], offset + m[1], tag, token})
+		}
+	}
+
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+
+		switch span.Kind {
+		case gockl.StartElementKind, gockl.EmptyElementKind:
+			el := span.Token(z.Input).(gockl.StartOrEmptyElementToken)
+			if all || o.ElementNames {
+				find(ElementName, el.Name(), span.Start+1, span, span)
+			}
+			for _, a := range el.AttributeSpans() {
+				if all || o.AttributeNames {
+					find(AttributeName, a.Name, span.Start+a.Start, span, span)
+				}
+				if all || o.AttributeValues {
+					find(AttributeValue, a.Content, span.Start+a.ValueStart, span, span)
+				}
+			}
+			if span.Kind == gockl.StartElementKind {
+				stack = append(stack, span)
+			}
+		case gockl.EndElementKind:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case gockl.TextKind, gockl.CDATAKind:
+			if !all && !o.Text {
+				continue
+			}
+			tag := gockl.Span{}
+			if len(stack) > 0 {
+				tag = stack[len(stack)-1]
+			}
+			raw := span.Raw(z.Input)
+			if span.Kind == gockl.TextKind {
+				find(Text, raw, span.Start, tag, span)
+			} else if content, _ := gockl.CDATAToken(raw).Content(); content != "" {
+				find(Text, content, span.Start+len("<![CDATA["), tag, span)
+			}
+		}
+	}
+
+	return r
+}
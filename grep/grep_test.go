@@ -0,0 +1,68 @@
+package grep
+
+import (
+	"regexp"
+	"testing"
+)
+
+const input = `<?xml version="1.0"?>
+<svg xmlns:xlink="http://www.w3.org/1999/xlink"
+     viewBox="0 0 10 10">
+  <use xlink:href='#icon'/>
+  <text>Use the <tspan class=icon>icon</tspan><![CDATA[ icon ]]></text>
+</svg>
+`
+
+func TestSearch(t *testing.T) {
+	type result struct {
+		kind  Kind
+		match string
+		tag   string
+	}
+
+	for _, test := range []struct {
+		re       string
+		o        Options
+		expected []result
+	}{
+		{"icon", Options{}, []result{
+			{AttributeValue, "icon", "<use xlink:href='#icon'/>"},
+			{AttributeValue, "icon", "<tspan class=icon>"},
+			{Text, "icon", "<tspan class=icon>"},
+			{Text, "icon", "<text>"},
+		}},
+		{"icon", Options{Text: true}, []result{
+			{Text, "icon", "<tspan class=icon>"},
+			{Text, "icon", "<text>"},
+		}},
+		{"(?i)^use$", Options{ElementNames: true}, []result{
+			{ElementName, "use", "<use xlink:href='#icon'/>"},
+		}},
+		{"^xlink:", Options{AttributeNames: true}, []result{
+			{AttributeName, "xlink:", "<use xlink:href='#icon'/>"},
+		}},
+		{"xlink", Options{ElementNames: true, AttributeNames: true}, []result{
+			{AttributeName, "xlink", `<svg xmlns:xlink="http://www.w3.org/1999/xlink"
+     viewBox="0 0 10 10">`},
+			{AttributeName, "xlink", "<use xlink:href='#icon'/>"},
+		}},
+		{"[0-9]+ [0-9]+$", Options{AttributeValues: true}, []result{
+			{AttributeValue, "10 10", `<svg xmlns:xlink="http://www.w3.org/1999/xlink"
+     viewBox="0 0 10 10">`},
+		}},
+		{"version", Options{}, []result{}},
+	} {
+		matches := String(input, regexp.MustCompile(test.re), test.o)
+		if len(matches) != len(test.expected) {
+			t.Errorf("%s: expected %d matches, got %d: %v", test.re, len(test.expected), len(matches), matches)
+			continue
+		}
+		for i, m := range matches {
+			e := test.expected[i]
+			if m.Kind != e.kind || input[m.Start:m.End] != e.match || m.Tag.Raw(input) != e.tag {
+				t.Errorf("%s: expected %s match %q in %s, got %s match %q in %s", test.re,
+					e.kind, e.match, e.tag, m.Kind, input[m.Start:m.End], m.Tag.Raw(input))
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package highlight adds syntax highlighting to XML documents, either using
+// ANSI escape sequences for terminals or HTML <span> elements. Apart from the
+// added markup (and HTML escaping), the output is the original input.
+package highlight
+
+import (
+	"html"
+	"io"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Class is the syntactical class of a part of the document.
+type Class uint8
+
+const (
+	// None is used for whitespace inside of tags.
+	None Class = iota
+	// Tag is used for element names and the brackets and slashes around
+	// them, as well as the equal signs between attribute names and values.
+	Tag
+	AttributeName
+	// AttributeValue is used for attribute values including their quotes.
+	AttributeValue
+	Text
+	CDATA
+	Comment
+	ProcInst
+	Directive
+)
+
+var classNames = []string{"none", "tag", "attr-name", "attr-value", "text", "cdata", "comment", "pi", "directive"}
+
+func (c Class) String() string {
+	if int(c) < len(classNames) {
+		return classNames[c]
+	}
+	return "invalid"
+}
+
+// Segment is a part of the input of a single class.
+type Segment struct {
+	Class Class
+	Start int
+	End   int
+}
+
+// Segments splits all remaining tokens of z into segments. Together, the
+// segments cover the input without gaps, adjacent segments are always of
+// different classes.
+func Segments(z *gockl.Tokenizer) []Segment {
+	r := []Segment{}
+	add := func(c Class, start, end int) {
+		if start >= end {
+			return
+		}
+		if len(r) > 0 && r[len(r)-1].Class == c && r[len(r)-1].End == start {
+			r[len(r)-1].End = end
+			return
+		}
+		r = append(r, Segment{c, start, end})
+	}
+
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+
+		switch span.Kind {
+		case gockl.TextKind:
+			add(Text, span.Start, span.End)
+		case gockl.CDATAKind:
+			add(CDATA, span.Start, span.End)
+		case gockl.CommentKind:
+			add(Comment, span.Start, span.End)
+		case gockl.ProcInstKind:
+			add(ProcInst, span.Start, span.End)
+		case gockl.DirectiveKind:
+			add(Directive, span.Start, span.End)
+		case gockl.EndElementKind:
+			add(Tag, span.Start, span.End)
+		case gockl.StartElementKind, gockl.EmptyElementKind:
+			raw := span.Raw(z.Input)
+			pos := span.Start
+			for _, a := range span.Token(z.Input).(gockl.StartOrEmptyElementToken).AttributeSpans() {
+				if pos == span.Start {
+					// the bracket and element name
+					name := span.Start + a.Start
+					for name > pos && strings.IndexByte(" \t\r\n", z.Input[name-1]) > -1 {
+						name--
+					}
+					add(Tag, pos, name)
+					pos = name
+				}
+				add(None, pos, span.Start+a.Start)
+				pos = span.Start + a.Start + len(a.Name)
+				add(AttributeName, span.Start+a.Start, pos)
+				if a.End == a.Start+len(a.Name) {
+					continue
+				}
+				value := span.Start + a.ValueStart
+				if a.Quote != 0 {
+					value--
+				}
+				add(Tag, pos, value)
+				pos = span.Start + a.End
+				add(AttributeValue, value, pos)
+			}
+
+			// the closing bracket
+			closing := span.End
+			if strings.HasSuffix(raw, "/>") {
+				closing -= 2
+			} else if strings.HasSuffix(raw, ">") {
+				closing--
+			}
+			if pos == span.Start {
+				add(Tag, pos, span.End)
+				continue
+			}
+			add(None, pos, closing)
+			add(Tag, closing, span.End)
+		}
+	}
+
+	return r
+}
+
+// Theme maps classes to ANSI SGR parameters, like "1;34" for bold blue.
+type Theme map[Class]string
+
+// DefaultTheme uses the basic ANSI colors only.
+var DefaultTheme = Theme{
+	Tag:            "34",
+	AttributeName:  "36",
+	AttributeValue: "32",
+	CDATA:          "33",
+	Comment:        "90",
+	ProcInst:       "35",
+	Directive:      "35",
+}
+
+// ANSI returns the input highlighted using the given theme or the
+// DefaultTheme if theme is nil.
+func ANSI(input string, theme Theme) string {
+	buf := strings.Builder{}
+	WriteANSI(&buf, gockl.New(input), theme)
+	return buf.String()
+}
+
+// WriteANSI highlights all remaining tokens of z using the given theme or the
+// DefaultTheme if theme is nil, and writes the result to w.
+func WriteANSI(w io.Writer, z *gockl.Tokenizer, theme Theme) error {
+	if theme == nil {
+		theme = DefaultTheme
+	}
+
+	for _, s := range Segments(z) {
+		text := z.Input[s.Start:s.End]
+		if code := theme[s.Class]; code != "" {
+			text = "\x1b[" + code + "m" + text + "\x1b[0m"
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HTML returns the input escaped for use in HTML with all segments wrapped
+// in <span> elements. The class of each span is the prefix followed by the
+// name of the segment's class, e.g. "xml-attr-name" for the prefix "xml-".
+func HTML(input string, prefix string) string {
+	buf := strings.Builder{}
+	WriteHTML(&buf, gockl.New(input), prefix)
+	return buf.String()
+}
+
+// WriteHTML highlights all remaining tokens of z like HTML does and writes
+// the result to w.
+func WriteHTML(w io.Writer, z *gockl.Tokenizer, prefix string) error {
+	for _, s := range Segments(z) {
+		text := html.EscapeString(z.Input[s.Start:s.End])
+		if s.Class != None {
+			text = `<span class="` + html.EscapeString(prefix+s.Class.String()) + `">` + text + "</span>"
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package highlight
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/roblillack/gockl"
+)
+
+func TestSegments(t *testing.T) {
+	input := `<?xml version="1.0"?><!DOCTYPE a><a  x = 'y' b=c
+  checked>t &amp; <![CDATA[<>]]><!-- c --><b/><c d="e" /></a>`
+
+	expected := []string{
+		`pi:<?xml version="1.0"?>`,
+		`directive:<!DOCTYPE a>`,
+		`tag:<a`, `none:  `, `attr-name:x`, `tag: = `, `attr-value:'y'`, `none: `,
+		`attr-name:b`, `tag:=`, `attr-value:c`, "none:\n  ", `attr-name:checked`, `tag:>`,
+		`text:t &amp; `,
+		`cdata:<![CDATA[<>]]>`,
+		`comment:<!-- c -->`,
+		`tag:<b/><c`, `none: `, `attr-name:d`, `tag:=`, `attr-value:"e"`, `none: `, `tag:/></a>`,
+	}
+
+	segments := Segments(gockl.New(input))
+	actual := []string{}
+	pos := 0
+	for _, s := range segments {
+		if s.Start != pos {
+			t.Errorf("Gap before segment %v", s)
+		}
+		pos = s.End
+		actual = append(actual, s.Class.String()+":"+input[s.Start:s.End])
+	}
+	if pos != len(input) {
+		t.Errorf("Segments end at %d", pos)
+	}
+
+	if strings.Join(actual, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected segments:\n%s", strings.Join(actual, "\n"))
+	}
+}
+
+func TestANSI(t *testing.T) {
+	if s := ANSI(`<a x="1">b</a>`, nil); s != "\x1b[34m<a\x1b[0m \x1b[36mx\x1b[0m\x1b[34m=\x1b[0m\x1b[32m\"1\"\x1b[0m\x1b[34m>\x1b[0mb\x1b[34m</a>\x1b[0m" {
+		t.Errorf("Unexpected result: %q", s)
+	}
+	if s := ANSI(`<a>b</a>`, Theme{Text: "1"}); s != "<a>\x1b[1mb\x1b[0m</a>" {
+		t.Errorf("Unexpected result: %q", s)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	if s := HTML(`<a x="&amp;">b</a>`, "xml-"); s != `<span class="xml-tag">&lt;a</span> <span class="xml-attr-name">x</span><span class="xml-tag">=</span><span class="xml-attr-value">&#34;&amp;amp;&#34;</span><span class="xml-tag">&gt;</span><span class="xml-text">b</span><span class="xml-tag">&lt;/a&gt;</span>` {
+		t.Errorf("Unexpected result: %s", s)
+	}
+}
@@ -0,0 +1,75 @@
+package gockl
+
+// TokenKind identifies the type of a token without the need for a type
+// switch.
+type TokenKind uint8
+
+const (
+	InvalidKind TokenKind = iota
+	TextKind
+	CDATAKind
+	CommentKind
+	DirectiveKind
+	ProcInstKind
+	StartElementKind
+	EndElementKind
+	EmptyElementKind
+)
+
+var kindNames = []string{
+	InvalidKind:      "Invalid",
+	TextKind:         "Text",
+	CDATAKind:        "CDATA",
+	CommentKind:      "Comment",
+	DirectiveKind:    "Directive",
+	ProcInstKind:     "ProcInst",
+	StartElementKind: "StartElement",
+	EndElementKind:   "EndElement",
+	EmptyElementKind: "EmptyElement",
+}
+
+func (k TokenKind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return kindNames[InvalidKind]
+}
+
+// Span describes a token by its kind and its byte offsets into the input of
+// the Tokenizer that produced it.
+type Span struct {
+	Kind  TokenKind
+	Start int
+	End   int
+}
+
+// Raw returns the raw text of the span from the given input.
+func (s Span) Raw(input string) string {
+	return input[s.Start:s.End]
+}
+
+// Token converts the span into the Token type matching its kind.
+func (s Span) Token(input string) Token {
+	raw := input[s.Start:s.End]
+
+	switch s.Kind {
+	case TextKind:
+		return TextToken(raw)
+	case CDATAKind:
+		return CDATAToken(raw)
+	case CommentKind:
+		return CommentToken(raw)
+	case DirectiveKind:
+		return DirectiveToken(raw)
+	case ProcInstKind:
+		return ProcInstToken(raw)
+	case StartElementKind:
+		return StartElementToken(raw)
+	case EndElementKind:
+		return EndElementToken(raw)
+	case EmptyElementKind:
+		return EmptyElementToken(raw)
+	}
+
+	return nil
+}
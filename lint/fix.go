@@ -0,0 +1,118 @@
+package lint
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Edit replaces the bytes from Start to End of the input by Text.
+type Edit struct {
+	Start int
+	End   int
+	Text  string
+}
+
+func (e Edit) overlaps(o Edit) bool {
+	return e.Start == o.Start || (e.Start < o.End && o.Start < e.End)
+}
+
+// ReportFix adds a problem at the given offset of the input, which is fixed
+// by applying all edits of fix.
+func (c *Context) ReportFix(offset int, fix []Edit, format string, args ...interface{}) {
+	c.Report(offset, format, args...)
+	c.problems[len(c.problems)-1].Fix = fix
+}
+
+// RemoveAttribute returns an edit removing the attribute a of the current
+// element together with the whitespace in front of it.
+func (c *Context) RemoveAttribute(a gockl.AttributeSpan) Edit {
+	start := c.Span.Start + a.Start
+	for start > c.Span.Start && strings.IndexByte(" \t\r\n", c.Input[start-1]) > -1 {
+		start--
+	}
+	return Edit{start, c.Span.Start + a.End, ""}
+}
+
+// RenameAttribute returns an edit renaming the attribute a of the current
+// element.
+func (c *Context) RenameAttribute(a gockl.AttributeSpan, name string) Edit {
+	start := c.Span.Start + a.Start
+	return Edit{start, start + len(a.Name), name}
+}
+
+// SetAttribute returns an edit setting the attribute name of the current
+// element to value. Only the value is replaced if the attribute exists,
+// otherwise it is added in front of the closing bracket.
+func (c *Context) SetAttribute(name, value string) Edit {
+	t, _ := c.Element()
+	for _, a := range t.AttributeSpans() {
+		if a.Name != name {
+			continue
+		}
+		if a.Quote == 0 {
+			return Edit{c.Span.Start + a.Start, c.Span.Start + a.End, name + `="` + gockl.EscapeAttribute(value, '"') + `"`}
+		}
+		return Edit{c.Span.Start + a.ValueStart, c.Span.Start + a.ValueEnd, gockl.EscapeAttribute(value, a.Quote)}
+	}
+
+	// keep whitespace in front of the closing bracket where it is
+	raw := c.Span.Raw(c.Input)
+	end := strings.TrimSuffix(strings.TrimSuffix(raw, ">"), "/")
+	pos := c.Span.Start + len(strings.TrimRight(end, " \t\r\n"))
+	return Edit{pos, pos, " " + name + `="` + gockl.EscapeAttribute(value, '"') + `"`}
+}
+
+// MaxPasses is the maximum number of times Fix checks a document.
+const MaxPasses = 10
+
+// Fix applies the fixes of the problems found in input. As fixes with
+// overlapping edits cannot be applied at once, the document is checked
+// again until no more fixes can be applied. Fix returns the resulting
+// document and the problems remaining in it.
+func Fix(input string, rules ...*Rule) (string, []*Problem) {
+	problems := String(input, rules...)
+	for pass := 0; pass < MaxPasses; pass++ {
+		result := Apply(input, problems)
+		if result == input {
+			break
+		}
+		input = result
+		problems = String(input, rules...)
+	}
+	return input, problems
+}
+
+// Apply applies the fixes of problems to input. Fixes overlapping with the
+// fixes of previous problems are left out.
+func Apply(input string, problems []*Problem) string {
+	edits := []Edit{}
+	for _, p := range problems {
+		conflict := false
+		for _, e := range p.Fix {
+			for _, accepted := range edits {
+				if e.overlaps(accepted) {
+					conflict = true
+				}
+			}
+		}
+		if !conflict {
+			edits = append(edits, p.Fix...)
+		}
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].Start < edits[j].Start
+	})
+
+	buf := strings.Builder{}
+	pos := 0
+	for _, e := range edits {
+		buf.WriteString(input[pos:e.Start])
+		buf.WriteString(e.Text)
+		pos = e.End
+	}
+	buf.WriteString(input[pos:])
+	return buf.String()
+}
@@ -0,0 +1,244 @@
+// Package lint checks documents against a configurable set of rules, like
+// the built-in ones for SVG files.
+//
+// Rules see the document token by token, together with the stack of open
+// elements. They can attach edits fixing the problems found, which are
+// applied using Fix. Problems can be suppressed using comments:
+//
+//	<!-- gockl-lint-disable no-inline-style -->
+//	... problems found by no-inline-style are not reported here ...
+//	<!-- gockl-lint-enable no-inline-style -->
+//	<!-- gockl-lint-disable-next-line -->
+//	... no problems are reported on this line ...
+//
+// Without rule names, the comments apply to all rules.
+package lint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Rule describes a lint rule.
+type Rule struct {
+	// Name identifies the rule in reports and suppression comments.
+	Name        string
+	Description string
+	// New returns a Checker for a single document.
+	New func() Checker
+}
+
+// Checker checks a single document.
+type Checker interface {
+	// Token is called for every token of the document.
+	Token(c *Context)
+	// End is called after the last token.
+	End(c *Context)
+}
+
+// CheckerFunc is a Checker that only looks at single tokens.
+type CheckerFunc func(c *Context)
+
+// Token calls f.
+func (f CheckerFunc) Token(c *Context) {
+	f(c)
+}
+
+// End does nothing.
+func (f CheckerFunc) End(c *Context) {}
+
+// Element is an open element.
+type Element struct {
+	Name   string
+	Offset int
+	Token  gockl.StartOrEmptyElementToken
+}
+
+// Context is passed to the checkers.
+type Context struct {
+	Input string
+	// Span is the current token. It is empty when the checkers are ended.
+	Span gockl.Span
+	// Stack lists the open elements, outermost first. It does not contain
+	// the element of the current start, empty or end element token.
+	Stack []Element
+
+	rule     string
+	problems []*Problem
+}
+
+// Element returns the current token, if it is a start or empty element.
+func (c *Context) Element() (gockl.StartOrEmptyElementToken, bool) {
+	if c.Span.Kind != gockl.StartElementKind && c.Span.Kind != gockl.EmptyElementKind {
+		return nil, false
+	}
+	t, ok := c.Span.Token(c.Input).(gockl.StartOrEmptyElementToken)
+	return t, ok
+}
+
+// Parent returns the innermost open element.
+func (c *Context) Parent() (Element, bool) {
+	if len(c.Stack) == 0 {
+		return Element{}, false
+	}
+	return c.Stack[len(c.Stack)-1], true
+}
+
+// Report adds a problem at the given offset of the input.
+func (c *Context) Report(offset int, format string, args ...interface{}) {
+	c.problems = append(c.problems, &Problem{gockl.Locate(c.Input, offset), c.rule, fmt.Sprintf(format, args...), nil})
+}
+
+// Problem is a single problem found by a rule.
+type Problem struct {
+	gockl.Location
+	Rule string
+	Msg  string
+	// Fix lists the edits fixing the problem, if the rule knows how to.
+	Fix []Edit
+}
+
+func (p *Problem) Error() string {
+	return p.Location.String() + ": " + p.Msg + " (" + p.Rule + ")"
+}
+
+// String checks the document in input.
+func String(input string, rules ...*Rule) []*Problem {
+	return Lint(gockl.New(input), rules...)
+}
+
+// Lint reads all remaining tokens of z, checks them using rules and returns
+// the problems found that are not suppressed, ordered by their location.
+func Lint(z *gockl.Tokenizer, rules ...*Rule) []*Problem {
+	c := &Context{Input: z.Input}
+	checkers := make([]Checker, len(rules))
+	for i, r := range rules {
+		checkers[i] = r.New()
+	}
+	suppressions := []suppression{}
+
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		c.Span = span
+		if span.Kind == gockl.EndElementKind && len(c.Stack) > 0 {
+			c.Stack = c.Stack[:len(c.Stack)-1]
+		}
+		if span.Kind == gockl.CommentKind {
+			if s, ok := parseSuppression(c.Input, span); ok {
+				suppressions = append(suppressions, s)
+			}
+		}
+
+		for i, ch := range checkers {
+			c.rule = rules[i].Name
+			ch.Token(c)
+		}
+
+		if span.Kind == gockl.StartElementKind {
+			t := span.Token(c.Input).(gockl.StartElementToken)
+			c.Stack = append(c.Stack, Element{t.Name(), span.Start, t})
+		}
+	}
+
+	c.Span = gockl.Span{}
+	for i, ch := range checkers {
+		c.rule = rules[i].Name
+		ch.End(c)
+	}
+
+	problems := []*Problem{}
+	for _, p := range c.problems {
+		if !suppressed(p, suppressions) {
+			problems = append(problems, p)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Offset < problems[j].Offset
+	})
+	return problems
+}
+
+type suppressionKind uint8
+
+const (
+	disable suppressionKind = iota
+	enable
+	disableNextLine
+)
+
+var suppressionKinds = map[string]suppressionKind{
+	"gockl-lint-disable":           disable,
+	"gockl-lint-enable":            enable,
+	"gockl-lint-disable-next-line": disableNextLine,
+}
+
+type suppression struct {
+	kind suppressionKind
+	// rules is empty for all rules
+	rules    map[string]bool
+	location gockl.Location
+}
+
+func parseSuppression(input string, span gockl.Span) (suppression, bool) {
+	content, ok := gockl.CommentToken(span.Raw(input)).Content()
+	if !ok {
+		return suppression{}, false
+	}
+	fields := strings.Fields(strings.Replace(content, ",", " ", -1))
+	if len(fields) == 0 {
+		return suppression{}, false
+	}
+	kind, ok := suppressionKinds[fields[0]]
+	if !ok {
+		return suppression{}, false
+	}
+
+	s := suppression{kind, map[string]bool{}, gockl.Locate(input, span.End)}
+	for _, name := range fields[1:] {
+		s.rules[name] = true
+	}
+	return s, true
+}
+
+func (s suppression) applies(rule string) bool {
+	return len(s.rules) == 0 || s.rules[rule]
+}
+
+func suppressed(p *Problem, suppressions []suppression) bool {
+	// all is set if all rules are disabled, except for the ones in
+	// enabled. Otherwise, only the rules in disabled are.
+	all := false
+	disabled, enabled := map[string]bool{}, map[string]bool{}
+	for _, s := range suppressions {
+		if s.location.Offset > p.Offset {
+			break
+		}
+		switch {
+		case s.kind == disableNextLine:
+			if s.location.Line+1 == p.Line && s.applies(p.Rule) {
+				return true
+			}
+		case len(s.rules) == 0:
+			all = s.kind == disable
+			disabled, enabled = map[string]bool{}, map[string]bool{}
+		default:
+			for name := range s.rules {
+				if all {
+					enabled[name] = s.kind == enable
+				} else {
+					disabled[name] = s.kind == disable
+				}
+			}
+		}
+	}
+	if all {
+		return !enabled[p.Rule]
+	}
+	return disabled[p.Rule]
+}
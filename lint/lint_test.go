@@ -0,0 +1,203 @@
+package lint
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const icon = `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="16">
+  <style>.a { fill: url(#styled); }</style>
+  <defs>
+    <linearGradient id="used"><stop offset="0"/></linearGradient>
+    <linearGradient id="styled"/>
+    <path id="linked" d="M0 0"/>
+    <path id="unused" d="M1 1"/>
+  </defs>
+  <rect id="r" style="fill: red" fill="url(#used)"/>
+  <use xlink:href="#linked" xlink:title="x"/>
+  <svg id="r"><circle r="1"/></svg>
+</svg>
+`
+
+func problems(input string, rules ...*Rule) string {
+	r := []string{}
+	for _, p := range String(input, rules...) {
+		r = append(r, p.Error())
+	}
+	return strings.Join(r, "\n")
+}
+
+func TestBuiltin(t *testing.T) {
+	expected := []string{
+		"1:1: <svg> without viewBox attribute (require-viewbox)",
+		"1:41: unneeded declaration of the XLink namespace (no-xlink)",
+		"7:5: <path id=\"unused\"> is never used (unused-defs)",
+		"9:16: inline style on <rect> (no-inline-style)",
+		"10:8: xlink:href is deprecated, use href (no-xlink)",
+		"10:29: xlink:title is deprecated (no-xlink)",
+		"11:8: duplicate id r, first used at 9:9 (duplicate-id)",
+	}
+	if actual := problems(icon, Builtin()...); actual != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected problems:\n%s", actual)
+	}
+
+	if Lookup("unused-defs") != UnusedDefs || Lookup("nope") != nil {
+		t.Error("Unexpected lookup result")
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	input := `<doc>
+  <a style="x"/>
+  <!-- gockl-lint-disable-next-line -->
+  <b style="x" id="b"/>
+  <!-- gockl-lint-disable no-inline-style -->
+  <c style="x" id="b"/>
+  <!-- gockl-lint-disable -->
+  <d style="x" id="b"/>
+  <!-- gockl-lint-enable duplicate-id, other -->
+  <e style="x" id="b"/>
+  <!-- gockl-lint-enable -->
+  <f style="x" id="b"/>
+</doc>`
+	expected := []string{
+		"2:6: inline style on <a> (no-inline-style)",
+		"6:16: duplicate id b, first used at 4:16 (duplicate-id)",
+		"10:16: duplicate id b, first used at 4:16 (duplicate-id)",
+		"12:6: inline style on <f> (no-inline-style)",
+		"12:16: duplicate id b, first used at 4:16 (duplicate-id)",
+	}
+	if actual := problems(input, NoInlineStyle, DuplicateID); actual != strings.Join(expected, "\n") {
+		t.Errorf("Unexpected problems:\n%s", actual)
+	}
+}
+
+func TestCustomRule(t *testing.T) {
+	depth := &Rule{
+		Name: "max-depth",
+		New: func() Checker {
+			return CheckerFunc(func(c *Context) {
+				if t, ok := c.Element(); ok && len(c.Stack) >= 2 {
+					p, _ := c.Parent()
+					c.Report(c.Span.Start, "<%s> nested too deeply in <%s>", t.Name(), p.Name)
+				}
+			})
+		},
+	}
+	if actual := problems("<a><b><c><d/></c></b><e/></a>", depth); actual != "1:7: <c> nested too deeply in <b> (max-depth)\n1:10: <d> nested too deeply in <c> (max-depth)" {
+		t.Errorf("Unexpected problems:\n%s", actual)
+	}
+}
+
+func TestReports(t *testing.T) {
+	results := []Result{{"a.svg", String(`<svg style="x"/>`, NoInlineStyle, RequireViewBox)}, {"b.svg", nil}}
+
+	buf := &bytes.Buffer{}
+	if err := WriteJSON(buf, results); err != nil {
+		t.Fatal(err)
+	}
+	problems := []map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &problems); err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 || problems[1]["file"] != "a.svg" || problems[1]["column"] != 6.0 || problems[1]["rule"] != "no-inline-style" {
+		t.Errorf("Unexpected JSON: %s", buf)
+	}
+
+	buf.Reset()
+	if err := WriteSARIF(buf, results, []*Rule{RequireViewBox, NoInlineStyle}); err != nil {
+		t.Fatal(err)
+	}
+	log := struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct{ ID string }
+				}
+			}
+			Results []struct {
+				RuleID    string
+				RuleIndex int
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartColumn int }
+					}
+				}
+			}
+		}
+	}{}
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != 2 || len(log.Runs[0].Results) != 2 {
+		t.Fatalf("Unexpected SARIF: %s", buf)
+	}
+	r := log.Runs[0].Results[1]
+	if r.RuleID != "no-inline-style" || r.RuleIndex != 1 || r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "a.svg" || r.Locations[0].PhysicalLocation.Region.StartColumn != 6 {
+		t.Errorf("Unexpected SARIF: %s", buf)
+	}
+}
+
+func TestFix(t *testing.T) {
+	input := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="16px" height="16" >
+  <rect style="fill: red; stroke-width:2" x="1"/>
+  <g style="fill: red !important"/>
+  <use xlink:href="#a"/>
+</svg>`
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" width="16px" height="16" viewBox="0 0 16 16" >
+  <rect fill="red" stroke-width="2" x="1"/>
+  <g style="fill: red !important"/>
+  <use href="#a"/>
+</svg>`
+
+	result, remaining := Fix(input, Builtin()...)
+	if result != expected {
+		t.Errorf("Unexpected result:\n%s", result)
+	}
+	if len(remaining) != 1 || remaining[0].Error() != "3:6: inline style on <g> (no-inline-style)" || remaining[0].Fix != nil {
+		t.Errorf("Unexpected problems: %v", remaining)
+	}
+
+	// the declaration is kept as long as XLink is used
+	input = `<svg xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 1 1"><use xlink:href="#a" href="#b"/></svg>`
+	if result, remaining := Fix(input, NoXLink); result != input || len(remaining) != 2 {
+		t.Errorf("Unexpected result: %s, %v", result, remaining)
+	}
+
+	// attribute names are case-sensitive
+	input = `<svg viewbox="0 0 1 1" WIDTH="1" width="2" height="2"/>`
+	if result, _ := Fix(input, RequireViewBox); result != `<svg viewbox="0 0 1 1" WIDTH="1" width="2" height="2" viewBox="0 0 2 2"/>` {
+		t.Errorf("Unexpected result: %s", result)
+	}
+
+	class := &Rule{
+		Name: "class",
+		New: func() Checker {
+			return CheckerFunc(func(c *Context) {
+				if t, ok := c.Element(); ok {
+					if v, _ := t.Attribute("class"); v != "x" {
+						c.ReportFix(c.Span.Start, []Edit{c.SetAttribute("class", "x")}, "wrong class")
+					}
+				}
+			})
+		},
+	}
+	if result, _ := Fix(`<a class=y><b class='z'/><c /></a>`, class); result != `<a class="x"><b class='x'/><c class="x" /></a>` {
+		t.Errorf("Unexpected result: %s", result)
+	}
+
+	// overlapping fixes are left out
+	problems := []*Problem{
+		{Fix: []Edit{{1, 3, "X"}}},
+		{Fix: []Edit{{2, 4, "Y"}}},
+		{Fix: []Edit{{4, 4, "Z"}}},
+		{Fix: []Edit{{4, 5, ""}}},
+	}
+	if result := Apply("abcdef", problems); result != "aXdZef" {
+		t.Errorf("Unexpected result: %s", result)
+	}
+}
@@ -0,0 +1,169 @@
+package lint
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Result lists the problems found in a single file.
+type Result struct {
+	File     string
+	Problems []*Problem
+}
+
+type jsonProblem struct {
+	File    string     `json:"file"`
+	Line    int        `json:"line"`
+	Column  int        `json:"column"`
+	Offset  int        `json:"offset"`
+	Rule    string     `json:"rule"`
+	Message string     `json:"message"`
+	Fix     []jsonEdit `json:"fix,omitempty"`
+}
+
+type jsonEdit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// WriteJSON writes the problems of all results as a single JSON array.
+// Fixes are given as byte offsets.
+func WriteJSON(w io.Writer, results []Result) error {
+	problems := []jsonProblem{}
+	for _, r := range results {
+		for _, p := range r.Problems {
+			jp := jsonProblem{r.File, p.Line, p.Column, p.Offset, p.Rule, p.Msg, nil}
+			for _, e := range p.Fix {
+				jp.Fix = append(jp.Fix, jsonEdit{e.Start, e.End, e.Text})
+			}
+			problems = append(problems, jp)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(problems)
+}
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+		Region struct {
+			StartLine   int `json:"startLine"`
+			StartColumn int `json:"startColumn"`
+		} `json:"region"`
+	} `json:"physicalLocation"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation struct {
+		URI string `json:"uri"`
+	} `json:"artifactLocation"`
+	Replacements []sarifReplacement `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion struct {
+		ByteOffset int `json:"byteOffset"`
+		ByteLength int `json:"byteLength"`
+	} `json:"deletedRegion"`
+	InsertedContent *sarifMessage `json:"insertedContent,omitempty"`
+}
+
+// WriteSARIF writes the results as a SARIF 2.1.0 log. The rules are listed
+// as the rules of the tool, problems of other rules are left out.
+func WriteSARIF(w io.Writer, results []Result, rules []*Rule) error {
+	run := sarifRun{
+		Tool: sarifTool{sarifDriver{
+			Name:           "gockl",
+			InformationURI: "https://github.com/roblillack/gockl",
+			Rules:          []sarifRule{},
+		}},
+		Results: []sarifResult{},
+	}
+	index := map[string]int{}
+	for i, r := range rules {
+		index[r.Name] = i
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{r.Name, sarifMessage{r.Description}})
+	}
+
+	for _, r := range results {
+		for _, p := range r.Problems {
+			i, ok := index[p.Rule]
+			if !ok {
+				continue
+			}
+			l := sarifLocation{}
+			l.PhysicalLocation.ArtifactLocation.URI = r.File
+			l.PhysicalLocation.Region.StartLine = p.Line
+			l.PhysicalLocation.Region.StartColumn = p.Column
+			result := sarifResult{p.Rule, i, "warning", sarifMessage{p.Msg}, []sarifLocation{l}, nil}
+			if len(p.Fix) > 0 {
+				change := sarifArtifactChange{}
+				change.ArtifactLocation.URI = r.File
+				for _, e := range p.Fix {
+					rep := sarifReplacement{}
+					rep.DeletedRegion.ByteOffset = e.Start
+					rep.DeletedRegion.ByteLength = e.End - e.Start
+					if e.Text != "" {
+						rep.InsertedContent = &sarifMessage{e.Text}
+					}
+					change.Replacements = append(change.Replacements, rep)
+				}
+				result.Fixes = []sarifFix{{sarifMessage{p.Msg}, []sarifArtifactChange{change}}}
+			}
+			run.Results = append(run.Results, result)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{"2.1.0", "https://json.schemastore.org/sarif-2.1.0.json", []sarifRun{run}})
+}
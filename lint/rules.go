@@ -0,0 +1,309 @@
+package lint
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Builtin returns the built-in rules.
+func Builtin() []*Rule {
+	return []*Rule{
+		DuplicateID,
+		NoInlineStyle,
+		NoXLink,
+		RequireViewBox,
+		UnusedDefs,
+	}
+}
+
+// Lookup returns the built-in rule with the given name or nil.
+func Lookup(name string) *Rule {
+	for _, r := range Builtin() {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+func local(name string) string {
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// attribute returns the raw value of the attribute name, unlike
+// t.Attribute comparing the names case-sensitively.
+func attribute(t gockl.StartOrEmptyElementToken, name string) (string, bool) {
+	for _, a := range t.AttributeSpans() {
+		if a.Name == name {
+			return a.Content, true
+		}
+	}
+	return "", false
+}
+
+// DuplicateID reports id attributes used more than once.
+var DuplicateID = &Rule{
+	Name:        "duplicate-id",
+	Description: "id attributes must be unique",
+	New: func() Checker {
+		seen := map[string]gockl.Location{}
+		return CheckerFunc(func(c *Context) {
+			t, ok := c.Element()
+			if !ok {
+				return
+			}
+			for _, a := range t.AttributeSpans() {
+				if a.Name != "id" && a.Name != "xml:id" {
+					continue
+				}
+				id := strings.TrimSpace(gockl.Unescape(a.Content))
+				if first, ok := seen[id]; ok {
+					c.Report(c.Span.Start+a.Start, "duplicate id %s, first used at %s", id, first)
+				} else {
+					seen[id] = gockl.Locate(c.Input, c.Span.Start+a.Start)
+				}
+			}
+		})
+	},
+}
+
+// NoInlineStyle reports style attributes. Styles of SVG elements only
+// setting properties that are available as presentation attributes are
+// fixed by using these.
+var NoInlineStyle = &Rule{
+	Name:        "no-inline-style",
+	Description: "styles must not be set using style attributes",
+	New: func() Checker {
+		return CheckerFunc(func(c *Context) {
+			t, ok := c.Element()
+			if !ok {
+				return
+			}
+			for _, a := range t.AttributeSpans() {
+				if a.Name != "style" {
+					continue
+				}
+				if attrs, ok := presentationAttributes(c, t, gockl.Unescape(a.Content)); ok {
+					c.ReportFix(c.Span.Start+a.Start, []Edit{{c.Span.Start + a.Start, c.Span.Start + a.End, attrs}}, "inline style on <%s>", t.Name())
+				} else {
+					c.Report(c.Span.Start+a.Start, "inline style on <%s>", t.Name())
+				}
+			}
+		})
+	},
+}
+
+var presentation = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`alignment-baseline baseline-shift
+		clip-path clip-rule color color-interpolation color-interpolation-filters
+		cursor direction display dominant-baseline fill fill-opacity fill-rule
+		filter flood-color flood-opacity font-family font-size font-size-adjust
+		font-stretch font-style font-variant font-weight image-rendering
+		letter-spacing lighting-color marker-end marker-mid marker-start mask
+		opacity overflow pointer-events shape-rendering stop-color stop-opacity
+		stroke stroke-dasharray stroke-dashoffset stroke-linecap stroke-linejoin
+		stroke-miterlimit stroke-opacity stroke-width text-anchor
+		text-decoration text-rendering unicode-bidi visibility word-spacing
+		writing-mode`) {
+		presentation[name] = true
+	}
+}
+
+// presentationAttributes converts the declarations of style to
+// presentation attributes. It reports whether that was possible.
+func presentationAttributes(c *Context, t gockl.StartOrEmptyElementToken, style string) (string, bool) {
+	svg := local(t.Name()) == "svg"
+	for _, e := range c.Stack {
+		svg = svg || local(e.Name) == "svg"
+	}
+	if !svg || strings.Contains(style, "/*") {
+		return "", false
+	}
+
+	attrs := []string{}
+	for _, decl := range strings.Split(style, ";") {
+		if strings.TrimSpace(decl) == "" {
+			continue
+		}
+		idx := strings.IndexByte(decl, ':')
+		if idx == -1 {
+			return "", false
+		}
+		name, value := strings.TrimSpace(decl[:idx]), strings.TrimSpace(decl[idx+1:])
+		if !presentation[name] || value == "" || strings.Contains(value, "!") {
+			return "", false
+		}
+		if _, exists := attribute(t, name); exists {
+			return "", false
+		}
+		attrs = append(attrs, name+`="`+gockl.EscapeAttribute(value, '"')+`"`)
+	}
+	if len(attrs) == 0 {
+		return "", false
+	}
+	return strings.Join(attrs, " "), true
+}
+
+// NoXLink reports attributes in the XLink namespace, which are deprecated
+// in SVG 2. xlink:href is fixed by renaming it, unused declarations of the
+// namespace are removed.
+var NoXLink = &Rule{
+	Name:        "no-xlink",
+	Description: "XLink attributes are deprecated in SVG 2",
+	New: func() Checker {
+		return &noXLink{}
+	},
+}
+
+type noXLink struct {
+	declarations []xlinkDeclaration
+	used         bool
+}
+
+type xlinkDeclaration struct {
+	offset int
+	remove Edit
+}
+
+func (x *noXLink) Token(c *Context) {
+	t, ok := c.Element()
+	if !ok {
+		return
+	}
+	for _, a := range t.AttributeSpans() {
+		switch {
+		case a.Name == "xmlns:xlink":
+			x.declarations = append(x.declarations, xlinkDeclaration{c.Span.Start + a.Start, c.RemoveAttribute(a)})
+		case a.Name == "xlink:href":
+			x.used = true
+			if _, exists := attribute(t, "href"); exists {
+				c.Report(c.Span.Start+a.Start, "xlink:href is deprecated, use href")
+			} else {
+				c.ReportFix(c.Span.Start+a.Start, []Edit{c.RenameAttribute(a, "href")}, "xlink:href is deprecated, use href")
+			}
+		case strings.HasPrefix(a.Name, "xlink:"):
+			x.used = true
+			c.Report(c.Span.Start+a.Start, "%s is deprecated", a.Name)
+		}
+	}
+}
+
+func (x *noXLink) End(c *Context) {
+	for _, d := range x.declarations {
+		if x.used {
+			c.Report(d.offset, "unneeded declaration of the XLink namespace")
+		} else {
+			c.ReportFix(d.offset, []Edit{d.remove}, "unneeded declaration of the XLink namespace")
+		}
+	}
+}
+
+// RequireViewBox reports outermost svg elements without viewBox attribute.
+// If the width and height are given in pixels, a matching viewBox is added.
+var RequireViewBox = &Rule{
+	Name:        "require-viewbox",
+	Description: "svg elements must have a viewBox attribute",
+	New: func() Checker {
+		return CheckerFunc(func(c *Context) {
+			t, ok := c.Element()
+			if !ok || local(t.Name()) != "svg" {
+				return
+			}
+			for _, e := range c.Stack {
+				if local(e.Name) == "svg" {
+					return
+				}
+			}
+			if _, ok := attribute(t, "viewBox"); ok {
+				return
+			}
+			width, _ := attribute(t, "width")
+			height, _ := attribute(t, "height")
+			if pixels(width) && pixels(height) {
+				viewBox := "0 0 " + strings.TrimSuffix(strings.TrimSpace(width), "px") + " " + strings.TrimSuffix(strings.TrimSpace(height), "px")
+				c.ReportFix(c.Span.Start, []Edit{c.SetAttribute("viewBox", viewBox)}, "<%s> without viewBox attribute", t.Name())
+			} else {
+				c.Report(c.Span.Start, "<%s> without viewBox attribute", t.Name())
+			}
+		})
+	},
+}
+
+var pixelLength = regexp.MustCompile(`^\s*[0-9]+(\.[0-9]+)?(px)?\s*$`)
+
+func pixels(s string) bool {
+	return pixelLength.MatchString(s)
+}
+
+// UnusedDefs reports elements inside of defs elements, whose id is not
+// referenced by a URL or link anywhere in the document.
+var UnusedDefs = &Rule{
+	Name:        "unused-defs",
+	Description: "definitions must be referenced",
+	New: func() Checker {
+		return &unusedDefs{used: map[string]bool{}}
+	},
+}
+
+var urlReference = regexp.MustCompile(`url\(\s*['"]?#([^)'"\s]+)`)
+
+type unusedDefs struct {
+	defs []definition
+	used map[string]bool
+}
+
+type definition struct {
+	id     string
+	offset int
+	name   string
+}
+
+func (u *unusedDefs) references(s string) {
+	for _, m := range urlReference.FindAllStringSubmatch(s, -1) {
+		u.used[m[1]] = true
+	}
+}
+
+func (u *unusedDefs) Token(c *Context) {
+	switch c.Span.Kind {
+	case gockl.TextKind, gockl.CDATAKind:
+		// stylesheets in style elements
+		if p, ok := c.Parent(); ok && local(p.Name) == "style" {
+			u.references(c.Span.Raw(c.Input))
+		}
+		return
+	}
+
+	t, ok := c.Element()
+	if !ok {
+		return
+	}
+	for _, a := range t.AttributeSpans() {
+		value := gockl.Unescape(a.Content)
+		if local(a.Name) == "href" && strings.HasPrefix(value, "#") {
+			u.used[value[1:]] = true
+		}
+		u.references(value)
+	}
+
+	if p, ok := c.Parent(); ok && local(p.Name) == "defs" {
+		if id, ok := attribute(t, "id"); ok {
+			u.defs = append(u.defs, definition{strings.TrimSpace(id), c.Span.Start, t.Name()})
+		}
+	}
+}
+
+func (u *unusedDefs) End(c *Context) {
+	for _, d := range u.defs {
+		if !u.used[d.id] {
+			c.Report(d.offset, "<%s id=%q> is never used", d.name, d.id)
+		}
+	}
+}
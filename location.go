@@ -0,0 +1,66 @@
+package gockl
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Location describes a position inside of an input by its byte offset as
+// well as line and column. Lines and columns start at 1, columns are counted
+// in bytes.
+type Location struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// Locate returns the location of the given byte offset inside of input.
+func Locate(input string, offset int) Location {
+	if offset > len(input) {
+		offset = len(input)
+	}
+
+	before := input[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := offset - strings.LastIndexByte(before, '\n')
+
+	return Location{Offset: offset, Line: line, Column: column}
+}
+
+func (l Location) String() string {
+	return strconv.Itoa(l.Line) + ":" + strconv.Itoa(l.Column)
+}
+
+// Locator computes the locations of increasing offsets inside of an input
+// without rescanning it from the start every time.
+type Locator struct {
+	input string
+	last  Location
+}
+
+// NewLocator returns a Locator for input.
+func NewLocator(input string) *Locator {
+	return &Locator{input: input, last: Location{Line: 1, Column: 1}}
+}
+
+// Locate returns the location of the given byte offset. It is cheapest if
+// called with increasing offsets.
+func (me *Locator) Locate(offset int) Location {
+	if offset > len(me.input) {
+		offset = len(me.input)
+	}
+	if offset < me.last.Offset {
+		me.last = Location{Line: 1, Column: 1}
+	}
+
+	between := me.input[me.last.Offset:offset]
+	if lines := strings.Count(between, "\n"); lines > 0 {
+		me.last.Line += lines
+		me.last.Column = len(between) - strings.LastIndexByte(between, '\n')
+	} else {
+		me.last.Column += len(between)
+	}
+	me.last.Offset = offset
+
+	return me.last
+}
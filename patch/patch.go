@@ -0,0 +1,528 @@
+// Package patch records the differences between two XML documents as a list
+// of minimal edit operations, which can then be applied to other copies of
+// the original document, like customized versions of a template. All bytes
+// not affected by an operation are left untouched.
+//
+// Patches are serialized as XML:
+//
+//	<patch>
+//	  <set-attribute path="/doc/title" name="lang" old="en" offset="15">de</set-attribute>
+//	  <remove-attribute path="/doc/title" name="old" old="x" offset="25"/>
+//	  <replace-text path="/doc/title/text()" old="Hello" offset="33">Hallo</replace-text>
+//	  <delete path="/doc/gone" offset="83"><gone/></delete>
+//	  <insert path="/doc" after="/doc/item[2]" offset="80"><added/></insert>
+//	</patch>
+package patch
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/diff"
+	"github.com/roblillack/gockl/tree"
+)
+
+type OpKind uint8
+
+const (
+	// SetAttribute sets the attribute Name of the element at Path to New.
+	SetAttribute OpKind = iota + 1
+	// RemoveAttribute removes the attribute Name of the element at Path.
+	RemoveAttribute
+	// ReplaceText replaces the text or comment at Path with New.
+	ReplaceText
+	// Delete removes the node at Path, which needs to be equal to Old.
+	Delete
+	// Insert inserts the markup New into the element at Path, following the
+	// child element at After or as first child, if After is empty. Skip text
+	// nodes and comments following After are kept in front of the markup.
+	Insert
+)
+
+var opNames = []string{"", "set-attribute", "remove-attribute", "replace-text", "delete", "insert"}
+
+func (k OpKind) String() string {
+	if int(k) < len(opNames) {
+		return opNames[k]
+	}
+	return ""
+}
+
+// Op is a single patch operation.
+type Op struct {
+	Kind  OpKind
+	Path  string
+	After string
+	Skip  int
+	Name  string
+	// Old is the value expected to be found in the document, HasOld reports
+	// whether an old value is expected at all.
+	Old    string
+	HasOld bool
+	New    string
+	// Offset is the position of the affected node in the original document.
+	// It is only used for reporting conflicts.
+	Offset int
+}
+
+// Patch is a list of operations.
+type Patch []Op
+
+// Conflict is returned if an operation cannot be applied, because the
+// document does not match the expectations of the operation.
+type Conflict struct {
+	Op  Op
+	Msg string
+}
+
+func (c *Conflict) Error() string {
+	return fmt.Sprintf("patch: conflict applying %s to %s (original offset %d): %s", c.Op.Kind, c.Op.Path, c.Op.Offset, c.Msg)
+}
+
+// Make creates a patch which turns document a into document b.
+func Make(a, b string) (Patch, error) {
+	changes, err := diff.Strings(a, b, diff.Options{NoMoves: true, Comments: true})
+	if err != nil {
+		return nil, err
+	}
+
+	docA, err := tree.ParseString(a)
+	if err != nil {
+		return nil, err
+	}
+	docB, err := tree.ParseString(b)
+	if err != nil {
+		return nil, err
+	}
+
+	p := Patch{}
+	for _, c := range changes {
+		switch c.Kind {
+		case diff.AddAttribute:
+			p = append(p, Op{Kind: SetAttribute, Path: c.OldPath, Name: c.Name, New: c.NewValue, Offset: c.Old.Start})
+		case diff.ChangeAttribute:
+			p = append(p, Op{Kind: SetAttribute, Path: c.OldPath, Name: c.Name, Old: c.OldValue, HasOld: true, New: c.NewValue, Offset: c.Old.Start})
+		case diff.RemoveAttribute:
+			p = append(p, Op{Kind: RemoveAttribute, Path: c.OldPath, Name: c.Name, Old: c.OldValue, HasOld: true, Offset: c.Old.Start})
+		case diff.ChangeText:
+			p = append(p, Op{Kind: ReplaceText, Path: c.OldPath, Old: c.OldValue, HasOld: true, New: c.NewValue, Offset: c.Old.Start})
+		case diff.Delete:
+			p = append(p, Op{Kind: Delete, Path: c.OldPath, Old: a[c.Old.Start:c.Old.End], HasOld: true, Offset: c.Old.Start})
+		case diff.Insert:
+			// include the indentation of the inserted node
+			start := c.New.Start
+			if n := docB.Lookup(c.NewPath); n != nil {
+				start = leadingSpace(n)
+			}
+			after, skip := precedingElement(docA, c.OldPath, c.Old.Start)
+			p = append(p, Op{Kind: Insert, Path: c.OldPath, After: after, Skip: skip, New: b[start:c.New.End], Offset: c.Old.Start})
+		default:
+			return nil, fmt.Errorf("patch: unsupported change %s", c.Kind)
+		}
+	}
+
+	return p, nil
+}
+
+// precedingElement returns the path of the last child element of the element
+// at path, that starts before offset, and the number of other nodes between
+// it and offset. Paths of text nodes are not used, as they change as soon as
+// elements are added or removed.
+func precedingElement(doc *tree.Document, path string, offset int) (string, int) {
+	var children []*tree.Node
+	if path == "" {
+		children = doc.Nodes
+	} else if parent := doc.Lookup(path); parent != nil {
+		children = parent.Children
+	}
+
+	r, skip := "", 0
+	for _, c := range children {
+		if c.Offset() >= offset {
+			break
+		}
+		if c.Element() != nil {
+			r, skip = c.Path(), 0
+		} else {
+			skip++
+		}
+	}
+	return r, skip
+}
+
+// leadingSpace returns the offset of the whitespace-only text in front of n or
+// the offset of n, if there is none.
+func leadingSpace(n *tree.Node) int {
+	if prev := previous(n); prev != nil && prev.Kind() == gockl.TextKind && strings.Trim(prev.Token().Raw(), " \t\r\n") == "" {
+		return prev.Offset()
+	}
+	return n.Offset()
+}
+
+// previous returns the preceding sibling of n.
+func previous(n *tree.Node) *tree.Node {
+	if n.Parent == nil {
+		return nil
+	}
+	for i, c := range n.Parent.Children {
+		if c == n && i > 0 {
+			return n.Parent.Children[i-1]
+		}
+	}
+	return nil
+}
+
+type edit struct {
+	start int
+	end   int
+	text  string
+	op    Op
+}
+
+// Apply applies all operations of the patch to input. If any of the
+// operations conflict with the input, a *Conflict is returned and no changes
+// are made.
+func Apply(input string, p Patch) (string, error) {
+	doc, err := tree.ParseString(input)
+	if err != nil {
+		return "", err
+	}
+
+	edits := []edit{}
+	for _, op := range p {
+		e, err := resolve(doc, op)
+		if err != nil {
+			return "", err
+		}
+		edits = append(edits, e...)
+	}
+
+	sort.SliceStable(edits, func(i, j int) bool {
+		if edits[i].start != edits[j].start {
+			return edits[i].start < edits[j].start
+		}
+		return edits[i].end < edits[j].end
+	})
+
+	buf := strings.Builder{}
+	pos := 0
+	for _, e := range edits {
+		if e.start < pos {
+			return "", &Conflict{e.op, "overlaps with another operation"}
+		}
+		buf.WriteString(input[pos:e.start])
+		buf.WriteString(e.text)
+		pos = e.end
+	}
+	buf.WriteString(input[pos:])
+
+	return buf.String(), nil
+}
+
+func resolve(doc *tree.Document, op Op) ([]edit, error) {
+	var n *tree.Node
+	if op.Path != "" || op.Kind != Insert {
+		if n = doc.Lookup(op.Path); n == nil {
+			return nil, &Conflict{op, "node not found"}
+		}
+	}
+
+	switch op.Kind {
+	case SetAttribute, RemoveAttribute:
+		return attributeEdit(n, op)
+	case ReplaceText:
+		return textEdit(doc, n, op)
+	case Delete:
+		if !equal(n.Raw(), op.Old) {
+			return nil, &Conflict{op, "node has been modified"}
+		}
+		// remove the indentation of the node as well
+		return []edit{{leadingSpace(n), n.EndOffset(), "", op}}, nil
+	case Insert:
+		return insertEdit(doc, n, op)
+	}
+
+	return nil, &Conflict{op, "unknown operation"}
+}
+
+func attributeEdit(n *tree.Node, op Op) ([]edit, error) {
+	el := n.Element()
+	if el == nil {
+		return nil, &Conflict{op, "not an element"}
+	}
+
+	current, exists := n.Attribute(op.Name)
+	if op.Kind == SetAttribute && exists && current == op.New {
+		return nil, nil
+	}
+	if op.Kind == RemoveAttribute && !exists {
+		return nil, nil
+	}
+	if exists != op.HasOld || current != op.Old {
+		return nil, &Conflict{op, fmt.Sprintf("attribute %s has been modified", op.Name)}
+	}
+
+	raw := el.Raw()
+	for _, a := range el.AttributeSpans() {
+		if a.Name != op.Name {
+			continue
+		}
+
+		if op.Kind == SetAttribute {
+			if a.Quote == 0 {
+				return []edit{{n.Offset() + a.Start, n.Offset() + a.End, a.Name + `="` + gockl.EscapeAttribute(op.New, '"') + `"`, op}}, nil
+			}
+			return []edit{{n.Offset() + a.ValueStart, n.Offset() + a.ValueEnd, gockl.EscapeAttribute(op.New, a.Quote), op}}, nil
+		}
+
+		// remove the attribute together with the whitespace in front
+		start := a.Start
+		for start > 0 && strings.IndexByte(" \t\r\n", raw[start-1]) > -1 {
+			start--
+		}
+		return []edit{{n.Offset() + start, n.Offset() + a.End, "", op}}, nil
+	}
+
+	if op.Kind == RemoveAttribute {
+		return nil, &Conflict{op, "attribute not found"}
+	}
+
+	// append the new attribute, keeping whitespace in front of the closing
+	// bracket where it is
+	end := strings.TrimSuffix(strings.TrimSuffix(raw, ">"), "/")
+	pos := len(strings.TrimRight(end, " \t\r\n"))
+
+	return []edit{{n.Offset() + pos, n.Offset() + pos, " " + op.Name + `="` + gockl.EscapeAttribute(op.New, '"') + `"`, op}}, nil
+}
+
+func textEdit(doc *tree.Document, n *tree.Node, op Op) ([]edit, error) {
+	if n.Kind() == gockl.CommentKind {
+		content, _ := gockl.CommentToken(n.Token().Raw()).Content()
+		if content == op.New {
+			return nil, nil
+		}
+		if content != op.Old {
+			return nil, &Conflict{op, "comment has been modified"}
+		}
+		comment, err := gockl.NewComment(op.New)
+		if err != nil {
+			return nil, &Conflict{op, err.Error()}
+		}
+		return []edit{{n.Offset(), n.EndOffset(), comment.Raw(), op}}, nil
+	}
+
+	if n.Kind() != gockl.TextKind && n.Kind() != gockl.CDATAKind {
+		return nil, &Conflict{op, "not a text node"}
+	}
+
+	// collect the run of adjacent text nodes
+	siblings := doc.Nodes
+	if n.Parent != nil {
+		siblings = n.Parent.Children
+	}
+	start, end := n.Offset(), n.EndOffset()
+	text := ""
+	for i, found := 0, false; i < len(siblings); i++ {
+		c := siblings[i]
+		if c == n {
+			found = true
+		}
+		if !found {
+			continue
+		}
+		if c.Kind() != gockl.TextKind && c.Kind() != gockl.CDATAKind {
+			break
+		}
+		text += c.Text()
+		end = c.EndOffset()
+	}
+
+	if text == op.New {
+		return nil, nil
+	}
+	if text == op.Old {
+		return []edit{{start, end, gockl.EscapeText(op.New), op}}, nil
+	}
+
+	// allow for different indentation in the target document, but keep it
+	trimmed := strings.Trim(text, " \t\r\n")
+	if trimmed == "" || trimmed != strings.Trim(op.Old, " \t\r\n") {
+		return nil, &Conflict{op, "text has been modified"}
+	}
+
+	raw := doc.Input[start:end]
+	lead := raw[:len(raw)-len(strings.TrimLeft(raw, " \t\r\n"))]
+	trail := raw[len(strings.TrimRight(raw, " \t\r\n")):]
+
+	return []edit{{start, end, lead + gockl.EscapeText(strings.Trim(op.New, " \t\r\n")) + trail, op}}, nil
+}
+
+func insertEdit(doc *tree.Document, parent *tree.Node, op Op) ([]edit, error) {
+	siblings := doc.Nodes
+	if parent != nil {
+		siblings = parent.Children
+	}
+	var prev *tree.Node
+	i := 0
+	if op.After != "" {
+		after := doc.Lookup(op.After)
+		if after == nil || after.Parent != parent {
+			return nil, &Conflict{op, "preceding node not found"}
+		}
+		for siblings[i] != after {
+			i++
+		}
+		prev = after
+		i++
+	}
+	// skip the text and comments in front of the markup, as far as they
+	// are still there
+	for k := 0; k < op.Skip && i < len(siblings) && siblings[i].Element() == nil; k++ {
+		prev = siblings[i]
+		i++
+	}
+	if prev != nil {
+		return []edit{{prev.EndOffset(), prev.EndOffset(), indent(doc, prev, op.New), op}}, nil
+	}
+
+	if parent == nil {
+		return []edit{{0, 0, op.New, op}}, nil
+	}
+
+	if parent.Kind() == gockl.EmptyElementKind {
+		raw := parent.Token().Raw()
+		start := strings.TrimRight(strings.TrimSuffix(raw, "/>"), " \t\r\n") + ">"
+		return []edit{{parent.Offset(), parent.EndOffset(), start + op.New + "</" + parent.Name() + ">", op}}, nil
+	}
+
+	var first *tree.Node
+	for _, c := range parent.Children {
+		if c.Kind() != gockl.TextKind || strings.Trim(c.Token().Raw(), " \t\r\n") != "" {
+			first = c
+			break
+		}
+	}
+	return []edit{{parent.ContentOffset(), parent.ContentOffset(), indent(doc, first, op.New), op}}, nil
+}
+
+// indent replaces the whitespace in front of the inserted markup with the
+// whitespace in front of the sibling node, so that the indentation of the
+// document is kept.
+func indent(doc *tree.Document, sibling *tree.Node, markup string) string {
+	content := strings.TrimLeft(markup, " \t\r\n")
+	if content == markup || sibling == nil {
+		return markup
+	}
+	if start := leadingSpace(sibling); start < sibling.Offset() {
+		return doc.Input[start:sibling.Offset()] + content
+	}
+	return markup
+}
+
+// equal reports whether two fragments are structurally equal.
+func equal(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	changes, err := diff.Strings("<_>"+a+"</_>", "<_>"+b+"</_>", diff.Options{})
+	return err == nil && len(changes) == 0
+}
+
+// String returns the XML serialization of the patch.
+func (p Patch) String() string {
+	buf := strings.Builder{}
+	buf.WriteString("<patch>\n")
+
+	for _, op := range p {
+		buf.WriteString("  <" + op.Kind.String() + ` path="` + gockl.EscapeAttribute(op.Path, '"') + `"`)
+		if op.After != "" {
+			buf.WriteString(` after="` + gockl.EscapeAttribute(op.After, '"') + `"`)
+		}
+		if op.Skip > 0 {
+			buf.WriteString(` skip="` + strconv.Itoa(op.Skip) + `"`)
+		}
+		if op.Name != "" {
+			buf.WriteString(` name="` + gockl.EscapeAttribute(op.Name, '"') + `"`)
+		}
+		if op.HasOld && op.Kind != Delete {
+			buf.WriteString(` old="` + gockl.EscapeAttribute(op.Old, '"') + `"`)
+		}
+		buf.WriteString(` offset="` + strconv.Itoa(op.Offset) + `"`)
+
+		content := ""
+		switch op.Kind {
+		case SetAttribute, ReplaceText:
+			content = gockl.EscapeText(op.New)
+		case Delete:
+			content = op.Old
+		case Insert:
+			content = op.New
+		}
+
+		if content == "" && op.Kind != SetAttribute && op.Kind != ReplaceText {
+			buf.WriteString("/>\n")
+		} else {
+			buf.WriteString(">" + content + "</" + op.Kind.String() + ">\n")
+		}
+	}
+
+	buf.WriteString("</patch>\n")
+	return buf.String()
+}
+
+// Parse reads a patch from its XML serialization.
+func Parse(input string) (Patch, error) {
+	doc, err := tree.ParseString(input)
+	if err != nil {
+		return nil, err
+	}
+	if doc.Root.Name() != "patch" {
+		return nil, fmt.Errorf("patch: unexpected document element <%s>", doc.Root.Name())
+	}
+
+	p := Patch{}
+	for _, el := range doc.Root.Elements() {
+		op := Op{}
+		for k, name := range opNames {
+			if name != "" && name == el.Name() {
+				op.Kind = OpKind(k)
+			}
+		}
+		if op.Kind == 0 {
+			return nil, fmt.Errorf("patch: unknown operation <%s>", el.Name())
+		}
+
+		op.Path, _ = el.Attribute("path")
+		op.After, _ = el.Attribute("after")
+		op.Name, _ = el.Attribute("name")
+		op.Old, op.HasOld = el.Attribute("old")
+		if skip, ok := el.Attribute("skip"); ok {
+			if op.Skip, err = strconv.Atoi(skip); err != nil || op.Skip < 0 {
+				return nil, fmt.Errorf("patch: invalid skip %s", skip)
+			}
+		}
+		if offset, ok := el.Attribute("offset"); ok {
+			if op.Offset, err = strconv.Atoi(offset); err != nil {
+				return nil, fmt.Errorf("patch: invalid offset %s", offset)
+			}
+		}
+
+		content := input[el.ContentOffset():el.ContentEndOffset()]
+		switch op.Kind {
+		case SetAttribute, ReplaceText:
+			op.New = el.Text()
+		case Delete:
+			op.Old, op.HasOld = content, true
+		case Insert:
+			op.New = content
+		}
+
+		p = append(p, op)
+	}
+
+	return p, nil
+}
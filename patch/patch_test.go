@@ -0,0 +1,175 @@
+package patch
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/roblillack/gockl/diff"
+)
+
+const original = `<doc>
+  <title lang="en" old="x">Hello</title>
+  <item id="1"/>
+  <item id="2"/>
+  <gone/>
+  <!-- note -->
+</doc>`
+
+const modified = `<doc>
+  <title lang="de" new="y">Hallo</title>
+  <item id="1"/>
+  <item id="2"><sub/></item>
+  <added/>
+  <!-- note -->
+</doc>`
+
+// customized is a reformatted copy of the original with additional changes
+const customized = `<?xml version="1.0"?>
+<doc   custom='yes'>
+    <title old='x' lang='en' >
+        Hello
+    </title>
+    <item id="1"/>
+    <custom/>
+    <item id="2"></item>
+    <gone></gone>
+    <!-- note -->
+</doc>`
+
+func TestApplyToOriginal(t *testing.T) {
+	p, err := Make(original, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Apply(original, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if changes, err := diff.Strings(result, modified, diff.Options{Comments: true}); err != nil || len(changes) > 0 {
+		t.Errorf("Result differs from modified document: %v %+v\n%s", err, changes, result)
+	}
+}
+
+func TestApplyToCustomized(t *testing.T) {
+	p, err := Make(original, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Apply(customized, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<?xml version="1.0"?>
+<doc   custom='yes'>
+    <title lang='de' new="y" >
+        Hallo
+    </title>
+    <item id="1"/>
+    <custom/>
+    <item id="2"><sub/></item>
+    <added/>
+    <!-- note -->
+</doc>`
+	if result != expected {
+		t.Errorf("Unexpected result:\n%s", result)
+	}
+
+	// inserts keep their position relative to the preceding element
+	for _, c := range [][4]string{
+		{`<d><a/>one<b/>two</d>`, `<d><a/>one<b/>two<y/></d>`, `<d><c/>zero<a/>one<b/>two</d>`, `<d><c/>zero<a/>one<b/>two<y/></d>`},
+		{`<d>one<a/></d>`, `<d>one<y/><a/></d>`, `<d>one<!-- c --><a/></d>`, `<d>one<y/><!-- c --><a/></d>`},
+		{`<d><a/>one</d>`, `<d><a/>one<y/></d>`, `<d><a/><c/></d>`, `<d><a/><y/><c/></d>`},
+	} {
+		p, err := Make(c[0], c[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := Apply(c[2], p); err != nil || result != c[3] {
+			t.Errorf("Unexpected result for %s: %v\n%s", c[2], err, result)
+		}
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	p, err := Make(original, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string]string{
+		"changed attribute": `<doc><title lang="fr" old="x">Hello</title><item id="1"/><item id="2"/><gone/></doc>`,
+		"changed text":      `<doc><title lang="en" old="x">Bonjour</title><item id="1"/><item id="2"/><gone/></doc>`,
+		"missing element":   `<doc><title lang="en" old="x">Hello</title><item id="1"/><gone/></doc>`,
+		"modified subtree":  `<doc><title lang="en" old="x">Hello</title><item id="1"/><item id="2"/><gone a="b"/></doc>`,
+	} {
+		_, err := Apply(input, p)
+		if _, ok := err.(*Conflict); !ok {
+			t.Errorf("Expected conflict for %s, got: %v", name, err)
+		}
+	}
+}
+
+func TestIdempotentOperations(t *testing.T) {
+	p := Patch{
+		{Kind: SetAttribute, Path: "/doc", Name: "a", Old: "1", HasOld: true, New: "2"},
+		{Kind: RemoveAttribute, Path: "/doc", Name: "b", Old: "1", HasOld: true},
+		{Kind: ReplaceText, Path: "/doc/text()", Old: "x", HasOld: true, New: "y"},
+	}
+
+	input := `<doc a="2">y</doc>`
+	if result, err := Apply(input, p); err != nil || result != input {
+		t.Errorf("Expected no changes, got: %s/%v", result, err)
+	}
+}
+
+func TestSerialization(t *testing.T) {
+	p, err := Make(original, modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := Parse(p.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(parsed, p) {
+		t.Errorf("Patch not preserved:\n%+v\n%+v\n%s", parsed, p, p.String())
+	}
+
+	p, _ = Make(`<d><a/>one</d>`, `<d><a/>one<y/></d>`)
+	if parsed, err := Parse(p.String()); err != nil || !reflect.DeepEqual(parsed, p) || p[0].Skip != 1 {
+		t.Errorf("Patch not preserved: %v\n%s", err, p.String())
+	}
+
+	if _, err := Parse(`<patch><frobnicate/></patch>`); err == nil {
+		t.Error("Expected error for unknown operation")
+	}
+	if _, err := Parse(`<diff/>`); err == nil {
+		t.Error("Expected error for unknown document element")
+	}
+}
+
+func TestApplyExactly(t *testing.T) {
+	for _, c := range [][2]string{
+		{original, modified},
+		{`<d><x/>hello</d>`, `<d><x/>hello<y/></d>`},
+		{`<d>hello<x/></d>`, `<d>hello<y/><x/></d>`},
+		{`<d>hello<x/>world</d>`, `<d>hello<x/><y/>world<z/></d>`},
+		{`<d><!-- c --><x/></d>`, `<d><!-- c --><y/><x/></d>`},
+		{"<d>\n  <x/>\n</d>", "<d>\n  <y/>\n  <x/>\n  <z/>\n</d>"},
+		{"<d>\n  <x/>\n  <y/>\n</d>", "<d>\n  <z/>\n</d>"},
+	} {
+		p, err := Make(c[0], c[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := Apply(c[0], p); err != nil || result != c[1] {
+			t.Errorf("Unexpected result for %s: %v\n%s", c[1], err, result)
+		}
+	}
+}
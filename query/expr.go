@@ -0,0 +1,282 @@
+package query
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+type axis uint8
+
+const (
+	childAxis axis = iota
+	descendantAxis
+	parentAxis
+	selfAxis
+	attributeAxis
+)
+
+type step struct {
+	axis  axis
+	test  string
+	preds []expr
+}
+
+type valueKind uint8
+
+const (
+	nodeSetValue valueKind = iota
+	stringValue
+	numberValue
+	booleanValue
+)
+
+type value struct {
+	kind valueKind
+	// string values of the nodes for node sets
+	set []string
+	s   string
+	n   float64
+	b   bool
+}
+
+func (v value) bool() bool {
+	switch v.kind {
+	case nodeSetValue:
+		return len(v.set) > 0
+	case stringValue:
+		return v.s != ""
+	case numberValue:
+		return v.n != 0 && !math.IsNaN(v.n)
+	}
+	return v.b
+}
+
+func (v value) string() string {
+	switch v.kind {
+	case nodeSetValue:
+		if len(v.set) > 0 {
+			return v.set[0]
+		}
+		return ""
+	case numberValue:
+		if v.n == math.Trunc(v.n) && !math.IsInf(v.n, 0) {
+			return strconv.FormatInt(int64(v.n), 10)
+		}
+		return strconv.FormatFloat(v.n, 'f', -1, 64)
+	case booleanValue:
+		return strconv.FormatBool(v.b)
+	}
+	return v.s
+}
+
+func toNumber(s string) float64 {
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return n
+}
+
+func (v value) number() float64 {
+	switch v.kind {
+	case numberValue:
+		return v.n
+	case booleanValue:
+		if v.b {
+			return 1
+		}
+		return 0
+	}
+	return toNumber(v.string())
+}
+
+type context struct {
+	ev   *evaluator
+	node *tree.Node
+	pos  int
+	size int
+}
+
+type expr interface {
+	eval(c *context) value
+}
+
+type literal value
+
+func (l literal) eval(c *context) value {
+	return value(l)
+}
+
+type pathExpr struct {
+	absolute bool
+	steps    []step
+}
+
+// simple reports whether the path only uses the child and descendant axes,
+// so that it can be matched in reverse.
+func (p *pathExpr) simple() bool {
+	for _, s := range p.steps {
+		if s.axis != childAxis && s.axis != descendantAxis {
+			return false
+		}
+	}
+	return true
+}
+
+func stringValueOf(n *tree.Node) string {
+	if n.Kind() == gockl.CommentKind {
+		content, _ := gockl.CommentToken(n.Token().Raw()).Content()
+		return content
+	}
+	if n.Kind() == gockl.ProcInstKind {
+		return gockl.ProcInstToken(n.Token().Raw()).Instruction()
+	}
+	if n.Kind() == gockl.InvalidKind {
+		// document node
+		buf := strings.Builder{}
+		for _, c := range n.Children {
+			buf.WriteString(c.Text())
+		}
+		return buf.String()
+	}
+	return n.Text()
+}
+
+func (p *pathExpr) eval(c *context) value {
+	steps := p.steps
+	last := steps[len(steps)-1]
+
+	if last.axis == attributeAxis {
+		steps = steps[:len(steps)-1]
+	}
+
+	nodes := []*tree.Node{c.node}
+	if len(steps) > 0 || p.absolute {
+		nodes = c.ev.path(&pathExpr{p.absolute, steps}, c.node)
+	}
+
+	r := value{kind: nodeSetValue, set: []string{}}
+	for _, n := range nodes {
+		if last.axis != attributeAxis {
+			r.set = append(r.set, stringValueOf(n))
+			continue
+		}
+		el := n.Element()
+		if el == nil {
+			continue
+		}
+		for _, a := range el.AttributeSpans() {
+			if last.test == "*" || a.Name == last.test {
+				r.set = append(r.set, gockl.Unescape(a.Content))
+			}
+		}
+	}
+
+	return r
+}
+
+type binaryExpr struct {
+	op string
+	l  expr
+	r  expr
+}
+
+func (b *binaryExpr) eval(c *context) value {
+	switch b.op {
+	case "or":
+		return value{kind: booleanValue, b: b.l.eval(c).bool() || b.r.eval(c).bool()}
+	case "and":
+		return value{kind: booleanValue, b: b.l.eval(c).bool() && b.r.eval(c).bool()}
+	}
+
+	return value{kind: booleanValue, b: compare(b.op, b.l.eval(c), b.r.eval(c))}
+}
+
+func compare(op string, l, r value) bool {
+	if l.kind == nodeSetValue {
+		for _, s := range l.set {
+			if compare(op, value{kind: stringValue, s: s}, r) {
+				return true
+			}
+		}
+		return false
+	}
+	if r.kind == nodeSetValue {
+		for _, s := range r.set {
+			if compare(op, l, value{kind: stringValue, s: s}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch op {
+	case "<":
+		return l.number() < r.number()
+	case "<=":
+		return l.number() <= r.number()
+	case ">":
+		return l.number() > r.number()
+	case ">=":
+		return l.number() >= r.number()
+	}
+
+	var equal bool
+	if l.kind == booleanValue || r.kind == booleanValue {
+		equal = l.bool() == r.bool()
+	} else if l.kind == numberValue || r.kind == numberValue {
+		equal = l.number() == r.number()
+	} else {
+		equal = l.string() == r.string()
+	}
+
+	if op == "!=" {
+		return !equal
+	}
+	return equal
+}
+
+type functionExpr struct {
+	name string
+	args []expr
+}
+
+func (f *functionExpr) arg(c *context, i int) value {
+	if i < len(f.args) {
+		return f.args[i].eval(c)
+	}
+	return value{kind: stringValue, s: stringValueOf(c.node)}
+}
+
+func (f *functionExpr) eval(c *context) value {
+	switch f.name {
+	case "not":
+		return value{kind: booleanValue, b: !f.arg(c, 0).bool()}
+	case "contains":
+		return value{kind: booleanValue, b: strings.Contains(f.arg(c, 0).string(), f.arg(c, 1).string())}
+	case "starts-with":
+		return value{kind: booleanValue, b: strings.HasPrefix(f.arg(c, 0).string(), f.arg(c, 1).string())}
+	case "ends-with":
+		return value{kind: booleanValue, b: strings.HasSuffix(f.arg(c, 0).string(), f.arg(c, 1).string())}
+	case "count":
+		return value{kind: numberValue, n: float64(len(f.arg(c, 0).set))}
+	case "string":
+		return value{kind: stringValue, s: f.arg(c, 0).string()}
+	case "string-length":
+		return value{kind: numberValue, n: float64(len([]rune(f.arg(c, 0).string())))}
+	case "normalize-space":
+		return value{kind: stringValue, s: strings.Join(strings.Fields(f.arg(c, 0).string()), " ")}
+	case "position":
+		return value{kind: numberValue, n: float64(c.pos)}
+	case "last":
+		return value{kind: numberValue, n: float64(c.size)}
+	case "name":
+		return value{kind: stringValue, s: c.node.Name()}
+	}
+
+	return value{kind: booleanValue}
+}
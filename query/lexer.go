@@ -0,0 +1,77 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind uint8
+
+const (
+	tEOF tokenKind = iota
+	tName
+	tString
+	tNumber
+	tOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isNameChar(r rune, first bool) bool {
+	if r == '_' || unicode.IsLetter(r) {
+		return true
+	}
+	return !first && (r == '-' || r == '.' || r == ':' || unicode.IsDigit(r))
+}
+
+func lex(expr string) ([]token, error) {
+	r := []token{}
+
+	for pos := 0; pos < len(expr); {
+		c := expr[pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			pos++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expr[pos+1:], c)
+			if end == -1 {
+				return nil, fmt.Errorf("query: unterminated string at position %d", pos)
+			}
+			r = append(r, token{tString, expr[pos+1 : pos+1+end], pos})
+			pos += end + 2
+		case c >= '0' && c <= '9' || (c == '.' && pos+1 < len(expr) && expr[pos+1] >= '0' && expr[pos+1] <= '9'):
+			start := pos
+			for pos < len(expr) && (expr[pos] >= '0' && expr[pos] <= '9' || expr[pos] == '.') {
+				pos++
+			}
+			r = append(r, token{tNumber, expr[start:pos], start})
+		case strings.HasPrefix(expr[pos:], "//"), strings.HasPrefix(expr[pos:], ".."),
+			strings.HasPrefix(expr[pos:], "!="), strings.HasPrefix(expr[pos:], "<="),
+			strings.HasPrefix(expr[pos:], ">="):
+			r = append(r, token{tOp, expr[pos : pos+2], pos})
+			pos += 2
+		case strings.IndexByte("/[]()@,=<>*.", c) > -1:
+			r = append(r, token{tOp, expr[pos : pos+1], pos})
+			pos++
+		default:
+			start := pos
+			for i, ch := range expr[pos:] {
+				if !isNameChar(ch, i == 0) {
+					break
+				}
+				pos = start + i + len(string(ch))
+			}
+			if pos == start {
+				return nil, fmt.Errorf("query: unexpected character %q at position %d", c, pos)
+			}
+			r = append(r, token{tName, expr[start:pos], start})
+		}
+	}
+
+	return append(r, token{tEOF, "", len(expr)}), nil
+}
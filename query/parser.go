@@ -0,0 +1,263 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) is(op string) bool {
+	t := p.peek()
+	return t.kind == tOp && t.text == op
+}
+
+func (p *parser) isName(name string) bool {
+	t := p.peek()
+	return t.kind == tName && t.text == name
+}
+
+func (p *parser) expect(op string) error {
+	if !p.is(op) {
+		t := p.peek()
+		return fmt.Errorf("query: expected %s at position %d", op, t.pos)
+	}
+	p.next()
+	return nil
+}
+
+var nodeTests = map[string]bool{
+	"text":                   true,
+	"comment":                true,
+	"node":                   true,
+	"processing-instruction": true,
+}
+
+func (p *parser) path() (*pathExpr, error) {
+	r := &pathExpr{}
+	a := childAxis
+
+	if p.is("/") {
+		p.next()
+		r.absolute = true
+	} else if p.is("//") {
+		p.next()
+		r.absolute = true
+		a = descendantAxis
+	}
+
+	for {
+		s, err := p.step(a)
+		if err != nil {
+			return nil, err
+		}
+		r.steps = append(r.steps, s)
+
+		if p.is("/") {
+			a = childAxis
+		} else if p.is("//") {
+			a = descendantAxis
+		} else {
+			break
+		}
+		if s.axis == attributeAxis {
+			return nil, fmt.Errorf("query: attribute step must be the last step at position %d", p.peek().pos)
+		}
+		p.next()
+	}
+
+	return r, nil
+}
+
+func (p *parser) step(a axis) (step, error) {
+	s := step{axis: a}
+	t := p.next()
+
+	switch {
+	case t.kind == tOp && (t.text == "." || t.text == ".."):
+		if a == descendantAxis {
+			return s, fmt.Errorf("query: unsupported step %s at position %d", t.text, t.pos)
+		}
+		s.test = "node()"
+		s.axis = selfAxis
+		if t.text == ".." {
+			s.axis = parentAxis
+		}
+		return s, nil
+	case t.kind == tOp && t.text == "@":
+		if a == descendantAxis {
+			return s, fmt.Errorf("query: unsupported attribute step at position %d", t.pos)
+		}
+		s.axis = attributeAxis
+		t = p.next()
+		if t.kind == tName || (t.kind == tOp && t.text == "*") {
+			s.test = t.text
+			return s, nil
+		}
+		return s, fmt.Errorf("query: expected attribute name at position %d", t.pos)
+	case t.kind == tOp && t.text == "*":
+		s.test = "*"
+	case t.kind == tName:
+		s.test = t.text
+		if nodeTests[t.text] && p.is("(") {
+			p.next()
+			if err := p.expect(")"); err != nil {
+				return s, err
+			}
+			s.test += "()"
+		}
+	default:
+		return s, fmt.Errorf("query: expected step at position %d", t.pos)
+	}
+
+	for p.is("[") {
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return s, err
+		}
+		if err := p.expect("]"); err != nil {
+			return s, err
+		}
+		s.preds = append(s.preds, e)
+	}
+
+	return s, nil
+}
+
+func (p *parser) or() (expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("or") {
+		p.next()
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{"or", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (expr, error) {
+	l, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.isName("and") {
+		p.next()
+		r, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{"and", l, r}
+	}
+	return l, nil
+}
+
+var comparisonOps = map[string]bool{"=": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true}
+
+func (p *parser) comparison() (expr, error) {
+	l, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tOp && comparisonOps[t.text] {
+		p.next()
+		r, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		return &binaryExpr{t.text, l, r}, nil
+	}
+	return l, nil
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.peek()
+
+	switch {
+	case t.kind == tString:
+		p.next()
+		return literal{kind: stringValue, s: t.text}, nil
+	case t.kind == tNumber:
+		p.next()
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("query: invalid number at position %d", t.pos)
+		}
+		return literal{kind: numberValue, n: n}, nil
+	case t.kind == tOp && t.text == "(":
+		p.next()
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	case t.kind == tName && !nodeTests[t.text] && p.tokens[p.pos+1].kind == tOp && p.tokens[p.pos+1].text == "(":
+		return p.function()
+	}
+
+	return p.path()
+}
+
+var functions = map[string][2]int{
+	"not":             {1, 1},
+	"contains":        {2, 2},
+	"starts-with":     {2, 2},
+	"ends-with":       {2, 2},
+	"count":           {1, 1},
+	"string":          {0, 1},
+	"string-length":   {0, 1},
+	"normalize-space": {0, 1},
+	"position":        {0, 0},
+	"last":            {0, 0},
+	"name":            {0, 0},
+}
+
+func (p *parser) function() (expr, error) {
+	t := p.next()
+	p.next()
+
+	f := &functionExpr{name: t.text}
+	for !p.is(")") {
+		if len(f.args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		f.args = append(f.args, e)
+	}
+	p.next()
+
+	arity, ok := functions[f.name]
+	if !ok {
+		return nil, fmt.Errorf("query: unknown function %s at position %d", f.name, t.pos)
+	}
+	if len(f.args) < arity[0] || len(f.args) > arity[1] {
+		return nil, fmt.Errorf("query: wrong number of arguments for %s at position %d", f.name, t.pos)
+	}
+
+	return f, nil
+}
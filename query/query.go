@@ -0,0 +1,305 @@
+// Package query selects nodes of a tree using a subset of XPath 1.0.
+//
+// Supported are absolute and relative location paths using the child (`/`),
+// descendant (`//`), parent (`..`), self (`.`) and attribute (`@`) axes,
+// the node tests `name`, `*`, `text()`, `comment()`,
+// `processing-instruction()` and `node()`, as well as predicates with
+// positions, comparisons (`=`, `!=`, `<`, `<=`, `>`, `>=`), `and`, `or` and
+// the functions not, contains, starts-with, ends-with, count, string,
+// string-length, normalize-space, position, last and name.
+//
+// Attributes can only be used inside of predicates, queries always select
+// nodes. Relative queries are evaluated like queries starting with `//`.
+//
+// Expressions like the ones used in predicates can be compiled on their own
+// using CompileExpr and evaluated relative to a context node.
+package query
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+// Query is a compiled query.
+type Query struct {
+	expr string
+	path *pathExpr
+}
+
+// Compile parses a query.
+func Compile(expr string) (*Query, error) {
+	tokens, err := lex(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	path, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tEOF {
+		return nil, fmt.Errorf("query: unexpected %q at position %d", t.text, t.pos)
+	}
+	if path.steps[len(path.steps)-1].axis == attributeAxis {
+		return nil, fmt.Errorf("query: %s selects attributes, not nodes", expr)
+	}
+
+	if !path.absolute {
+		path.absolute = true
+		if path.steps[0].axis == childAxis {
+			path.steps[0].axis = descendantAxis
+		}
+	}
+
+	return &Query{expr, path}, nil
+}
+
+// MustCompile is like Compile, but panics if the query cannot be parsed.
+func MustCompile(expr string) *Query {
+	q, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.expr
+}
+
+// Select returns all nodes of the document matching the query in document
+// order.
+func (q *Query) Select(doc *tree.Document) []*tree.Node {
+	root := &tree.Node{Children: doc.Nodes}
+	ev := &evaluator{root: root}
+	return ev.path(q.path, root)
+}
+
+// Match reports whether the query would select the given node.
+func (q *Query) Match(n *tree.Node) bool {
+	top := n
+	for top.Parent != nil {
+		top = top.Parent
+	}
+	ev := &evaluator{root: &tree.Node{Children: []*tree.Node{top}}}
+
+	if q.path.simple() {
+		return ev.match(q.path.steps, len(q.path.steps)-1, n)
+	}
+
+	for _, i := range ev.path(q.path, ev.root) {
+		if i == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Expr is a compiled expression.
+type Expr struct {
+	expr string
+	e    expr
+}
+
+// CompileExpr parses an expression.
+func CompileExpr(s string) (*Expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tEOF {
+		return nil, fmt.Errorf("query: unexpected %q at position %d", t.text, t.pos)
+	}
+
+	return &Expr{s, e}, nil
+}
+
+func (e *Expr) String() string {
+	return e.expr
+}
+
+func (e *Expr) eval(n *tree.Node) value {
+	top := n
+	for top.Parent != nil {
+		top = top.Parent
+	}
+	ev := &evaluator{root: &tree.Node{Children: []*tree.Node{top}}}
+	return e.e.eval(&context{ev, n, 1, 1})
+}
+
+// Test evaluates the expression with n as context node and converts the
+// result to a boolean. Numbers are not compared to the position, unlike in
+// predicates.
+func (e *Expr) Test(n *tree.Node) bool {
+	return e.eval(n).bool()
+}
+
+// Value evaluates the expression with n as context node and converts the
+// result to a string.
+func (e *Expr) Value(n *tree.Node) string {
+	return e.eval(n).string()
+}
+
+type evaluator struct {
+	root *tree.Node
+}
+
+func (ev *evaluator) parent(n *tree.Node) *tree.Node {
+	if n == ev.root {
+		return nil
+	}
+	if n.Parent == nil {
+		return ev.root
+	}
+	return n.Parent
+}
+
+func testNode(n *tree.Node, test string) bool {
+	switch test {
+	case "node()":
+		return true
+	case "text()":
+		return n.Kind() == gockl.TextKind || n.Kind() == gockl.CDATAKind
+	case "comment()":
+		return n.Kind() == gockl.CommentKind
+	case "processing-instruction()":
+		return n.Kind() == gockl.ProcInstKind
+	case "*":
+		return n.IsElement()
+	}
+	return n.IsElement() && n.Name() == test
+}
+
+func (ev *evaluator) filter(candidates []*tree.Node, preds []expr) []*tree.Node {
+	for _, pred := range preds {
+		r := []*tree.Node{}
+		for i, c := range candidates {
+			v := pred.eval(&context{ev, c, i + 1, len(candidates)})
+			if v.kind == numberValue {
+				if v.n == float64(i+1) {
+					r = append(r, c)
+				}
+			} else if v.bool() {
+				r = append(r, c)
+			}
+		}
+		candidates = r
+	}
+	return candidates
+}
+
+func (ev *evaluator) children(n *tree.Node, s step) []*tree.Node {
+	r := []*tree.Node{}
+	for _, c := range n.Children {
+		if testNode(c, s.test) {
+			r = append(r, c)
+		}
+	}
+	return ev.filter(r, s.preds)
+}
+
+func descendantsOrSelf(n *tree.Node, r []*tree.Node) []*tree.Node {
+	r = append(r, n)
+	for _, c := range n.Children {
+		r = descendantsOrSelf(c, r)
+	}
+	return r
+}
+
+func (ev *evaluator) path(p *pathExpr, context *tree.Node) []*tree.Node {
+	current := []*tree.Node{context}
+	if p.absolute {
+		current = []*tree.Node{ev.root}
+	}
+
+	for _, s := range p.steps {
+		next := []*tree.Node{}
+		seen := map[*tree.Node]bool{}
+		add := func(nodes []*tree.Node) {
+			for _, n := range nodes {
+				if !seen[n] {
+					seen[n] = true
+					next = append(next, n)
+				}
+			}
+		}
+
+		for _, c := range current {
+			switch s.axis {
+			case childAxis:
+				add(ev.children(c, s))
+			case descendantAxis:
+				for _, d := range descendantsOrSelf(c, nil) {
+					add(ev.children(d, s))
+				}
+			case parentAxis:
+				if p := ev.parent(c); p != nil {
+					add(ev.filter([]*tree.Node{p}, s.preds))
+				}
+			case selfAxis:
+				add(ev.filter([]*tree.Node{c}, s.preds))
+			}
+		}
+
+		if len(current) > 1 || s.axis == descendantAxis {
+			sort.SliceStable(next, func(i, j int) bool {
+				return next[i].Offset() < next[j].Offset()
+			})
+		}
+		current = next
+	}
+
+	return current
+}
+
+// match checks whether n is selected by steps[0:i+1] by matching the steps
+// in reverse.
+func (ev *evaluator) match(steps []step, i int, n *tree.Node) bool {
+	s := steps[i]
+	if !testNode(n, s.test) {
+		return false
+	}
+
+	p := ev.parent(n)
+	if p == nil {
+		return false
+	}
+
+	if len(s.preds) > 0 {
+		found := false
+		for _, c := range ev.children(p, s) {
+			if c == n {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if i == 0 {
+		return s.axis == descendantAxis || p == ev.root
+	}
+
+	if s.axis == childAxis {
+		return p != ev.root && ev.match(steps, i-1, p)
+	}
+
+	for a := p; a != nil && a != ev.root; a = ev.parent(a) {
+		if ev.match(steps, i-1, a) {
+			return true
+		}
+	}
+	return false
+}
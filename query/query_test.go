@@ -0,0 +1,146 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/roblillack/gockl/tree"
+)
+
+const doc = `<?xml version="1.0"?>
+<library>
+  <book id="b1" lang="en"><title>Go</title><price currency="EUR">30</price></book>
+  <book id="b2" lang="de"><title>XML</title><price>15.5</price></book>
+  <!-- shelf -->
+  <shelf><book id="b3"><title>  Deep   Nesting </title></book></shelf>
+</library>
+`
+
+func TestSelect(t *testing.T) {
+	d, err := tree.ParseString(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for expr, expected := range map[string][]string{
+		"/library/book/title":                                          {"<title>Go</title>", "<title>XML</title>"},
+		"//title/text()":                                               {"Go", "XML", "  Deep   Nesting "},
+		"book[2]/title":                                                {"<title>XML</title>"},
+		"/library/book[last()]/@id/..":                                 nil,
+		"//book[@lang='de']/title":                                     {"<title>XML</title>"},
+		"//book[not(@lang)]/title":                                     {"<title>  Deep   Nesting </title>"},
+		"//price[. > 20]":                                              {`<price currency="EUR">30</price>`},
+		"//book[price < 20 or @id = 'b3']/@id/.":                       nil,
+		"//book[price < 20 or @id = 'b3']/title":                       {"<title>XML</title>", "<title>  Deep   Nesting </title>"},
+		"//title[normalize-space() = 'Deep Nesting']/../../..":         {d.Root.Raw()},
+		"//comment()":                                                  {"<!-- shelf -->"},
+		"/library/*[position() = 3]/book/title":                        {"<title>  Deep   Nesting </title>"},
+		"//book[count(price) = 0]/title":                               {"<title>  Deep   Nesting </title>"},
+		"//book[contains(title, 'M') and starts-with(@id, 'b')]/price": {"<price>15.5</price>"},
+		"//*[name() = 'shelf']/book/title/text()":                      {"  Deep   Nesting "},
+		"//price[@currency]":                                           {`<price currency="EUR">30</price>`},
+		"/book":                                                        {},
+	} {
+		q, err := Compile(expr)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("%s: expected compile error", expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", expr, err)
+			continue
+		}
+
+		result := q.Select(d)
+		if len(result) != len(expected) {
+			t.Errorf("%s: expected %d results, got %d", expr, len(expected), len(result))
+			continue
+		}
+		for i, n := range result {
+			if n.Raw() != expected[i] {
+				t.Errorf("%s: expected %s, got %s", expr, expected[i], n.Raw())
+			}
+			if !q.Match(n) {
+				t.Errorf("%s: %s selected, but not matched", expr, n.Raw())
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	d, err := tree.ParseString(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b3 := d.Lookup("/library/shelf/book")
+	if b3 == nil {
+		t.Fatal("book not found")
+	}
+	for expr, expected := range map[string]bool{
+		"book":                  true,
+		"shelf/book":            true,
+		"/library/book":         false,
+		"/library//book":        true,
+		"library/shelf/book[1]": true,
+		"book[2]":               false,
+		"book[@id = 'b3']":      true,
+		"shelf/book/..":         false,
+	} {
+		if r := MustCompile(expr).Match(b3); r != expected {
+			t.Errorf("%s: expected %v, got %v", expr, expected, r)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{"", "/", "a[", "a[1", "a]", "a['x]", "a[foo()]", "a[contains(b)]", "a//.", "@id/a", "a b"} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestExpr(t *testing.T) {
+	d, err := tree.ParseString(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2 := d.Lookup("/library/book[2]")
+
+	for expr, expected := range map[string]string{
+		"@id":                          "b2",
+		"title":                        "XML",
+		"price > 15":                   "true",
+		"price > 15 and @currency":     "false",
+		"count(../book)":               "2",
+		"count(//book)":                "3",
+		"/library/book[1]/@lang":       "en",
+		"normalize-space(//shelf)":     "Deep Nesting",
+		"name()":                       "book",
+		"not(../shelf/book/@lang)":     "true",
+		"string-length(title) = 3":     "true",
+		"'literal'":                    "literal",
+		"(price)":                      "15.5",
+		"starts-with(@lang, 'd') or 1": "true",
+	} {
+		e, err := CompileExpr(expr)
+		if err != nil {
+			t.Errorf("%s: %s", expr, err)
+			continue
+		}
+		if v := e.Value(b2); v != expected {
+			t.Errorf("%s: expected %s, got %s", expr, expected, v)
+		}
+		if e.Test(b2) != (expected != "false") {
+			t.Errorf("%s: unexpected test result", expr)
+		}
+	}
+
+	for _, expr := range []string{"", "a b", "count(", "1 ="} {
+		if _, err := CompileExpr(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
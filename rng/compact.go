@@ -0,0 +1,668 @@
+package rng
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/roblillack/gockl/xsd"
+)
+
+type ctokenKind uint8
+
+const (
+	cEOF ctokenKind = iota
+	cIdentifier
+	cKeyword
+	cCName
+	cNsName
+	cLiteral
+	cOp
+)
+
+type ctoken struct {
+	kind   ctokenKind
+	value  string
+	offset int
+}
+
+func (t ctoken) String() string {
+	switch t.kind {
+	case cEOF:
+		return "end of schema"
+	case cLiteral:
+		return strconv.Quote(t.value)
+	}
+	return "'" + t.value + "'"
+}
+
+var keywords = map[string]bool{
+	"attribute": true, "default": true, "datatypes": true, "div": true, "element": true,
+	"empty": true, "external": true, "grammar": true, "include": true, "inherit": true,
+	"list": true, "mixed": true, "namespace": true, "notAllowed": true, "parent": true,
+	"start": true, "string": true, "text": true, "token": true,
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isNameRune(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// lex splits a schema in the compact syntax into tokens, skipping comments
+// and annotations.
+func lex(src *source) ([]ctoken, error) {
+	s := src.input
+	r := []ctoken{}
+	pos := 0
+
+	name := func() string {
+		start := pos
+		for pos < len(s) {
+			c, size := utf8.DecodeRuneInString(s[pos:])
+			if !isNameRune(c) {
+				break
+			}
+			pos += size
+		}
+		return s[start:pos]
+	}
+	// skipBrackets skips an annotation starting at pos.
+	skipBrackets := func() error {
+		start := pos
+		depth := 0
+		for pos < len(s) {
+			switch s[pos] {
+			case '[':
+				depth++
+			case ']':
+				depth--
+				if depth == 0 {
+					pos++
+					return nil
+				}
+			case '"', '\'':
+				end := strings.IndexByte(s[pos+1:], s[pos])
+				if end == -1 {
+					return src.errorf(pos, "unterminated literal")
+				}
+				pos += end + 1
+			}
+			pos++
+		}
+		return src.errorf(start, "unterminated annotation")
+	}
+
+	for pos < len(s) {
+		c, size := utf8.DecodeRuneInString(s[pos:])
+		start := pos
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\ufeff':
+			pos += size
+		case c == '#':
+			for pos < len(s) && s[pos] != '\n' {
+				pos++
+			}
+		case c == '[':
+			if err := skipBrackets(); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(s[pos:], ">>"):
+			pos += 2
+			for pos < len(s) && s[pos] != '[' {
+				pos++
+			}
+			if err := skipBrackets(); err != nil {
+				return nil, err
+			}
+		case c == '"' || c == '\'':
+			quote := s[pos : pos+1]
+			if strings.HasPrefix(s[pos:], quote+quote+quote) {
+				quote += quote + quote
+			}
+			pos += len(quote)
+			end := strings.Index(s[pos:], quote)
+			if end == -1 {
+				return nil, src.errorf(start, "unterminated literal")
+			}
+			r = append(r, ctoken{cLiteral, s[pos : pos+end], start})
+			pos += end + len(quote)
+		case c == '\\':
+			pos++
+			n := name()
+			if n == "" {
+				return nil, src.errorf(start, "invalid escaped identifier")
+			}
+			r = append(r, ctoken{cIdentifier, n, start})
+		case isNameStart(c):
+			n := name()
+			switch {
+			case strings.HasPrefix(s[pos:], ":*"):
+				pos += 2
+				r = append(r, ctoken{cNsName, n, start})
+			case strings.HasPrefix(s[pos:], ":"):
+				pos++
+				l := name()
+				if l == "" {
+					return nil, src.errorf(start, "invalid name %s:", n)
+				}
+				r = append(r, ctoken{cCName, n + ":" + l, start})
+			case keywords[n]:
+				r = append(r, ctoken{cKeyword, n, start})
+			default:
+				r = append(r, ctoken{cIdentifier, n, start})
+			}
+		case strings.HasPrefix(s[pos:], "|=") || strings.HasPrefix(s[pos:], "&="):
+			pos += 2
+			r = append(r, ctoken{cOp, s[start:pos], start})
+		case strings.ContainsRune("={}(),|&?*+-~", c):
+			pos++
+			r = append(r, ctoken{cOp, string(c), start})
+		default:
+			return nil, src.errorf(start, "unexpected character %q", c)
+		}
+	}
+
+	return append(r, ctoken{cEOF, "", len(s)}), nil
+}
+
+// compactParser reads a single schema document in the compact syntax.
+type compactParser struct {
+	b          *builder
+	src        *source
+	tokens     []ctoken
+	pos        int
+	namespaces map[string]string
+	datatypes  map[string]string
+	grammar    *grammar
+	// defined collects the names defined by the content of an include
+	defined map[string]bool
+	err     error
+}
+
+func (b *builder) readCompact(text, location, ns string) (*compactParser, error) {
+	src := &source{text, location}
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &compactParser{
+		b:          b,
+		src:        src,
+		tokens:     tokens,
+		namespaces: map[string]string{"": ns, "xml": "http://www.w3.org/XML/1998/namespace"},
+		datatypes:  map[string]string{"xsd": xsdDatatypes},
+	}
+	p.declarations(ns)
+	return p, p.err
+}
+
+func (b *builder) parseCompact(text, location, ns string) (*pattern, error) {
+	p, err := b.readCompact(text, location, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	var r *pattern
+	if p.isGrammar() {
+		p.grammar = newGrammar(nil)
+		p.grammarContent(nil)
+		r = b.ref(p.grammar, "", p.src, 0)
+	} else {
+		r = p.pattern()
+	}
+	p.expect(cEOF, "")
+	return r, p.err
+}
+
+func (b *builder) includeCompact(text, location, ns string, g *grammar, overrides map[string]bool) error {
+	p, err := b.readCompact(text, location, ns)
+	if err != nil {
+		return err
+	}
+	p.grammar = g
+	p.grammarContent(overrides)
+	p.expect(cEOF, "")
+	return p.err
+}
+
+func (p *compactParser) errorf(t ctoken, format string, args ...interface{}) *pattern {
+	if p.err == nil {
+		p.err = p.src.errorf(t.offset, format, args...)
+	}
+	// stop parsing
+	p.pos = len(p.tokens) - 1
+	return notAllowed
+}
+
+func (p *compactParser) peek() ctoken {
+	return p.tokens[p.pos]
+}
+
+func (p *compactParser) next() ctoken {
+	t := p.tokens[p.pos]
+	if t.kind != cEOF {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is of the given kind and value.
+func (p *compactParser) is(kind ctokenKind, value string) bool {
+	t := p.peek()
+	return t.kind == kind && t.value == value
+}
+
+func (p *compactParser) expect(kind ctokenKind, value string) ctoken {
+	t := p.next()
+	if t.kind != kind || (value != "" && t.value != value) {
+		expected := map[ctokenKind]string{cEOF: "end of schema", cIdentifier: "identifier", cLiteral: "literal"}[kind]
+		if value != "" {
+			expected = "'" + value + "'"
+		}
+		p.errorf(t, "expected %s, found %s", expected, t)
+	}
+	return t
+}
+
+func (p *compactParser) literal() string {
+	s := p.expect(cLiteral, "").value
+	for p.is(cOp, "~") {
+		p.next()
+		s += p.expect(cLiteral, "").value
+	}
+	return s
+}
+
+// identifier reads an identifier or keyword used as name.
+func (p *compactParser) identifier() string {
+	t := p.next()
+	if t.kind != cIdentifier && t.kind != cKeyword {
+		p.errorf(t, "expected identifier, found %s", t)
+	}
+	return t.value
+}
+
+func (p *compactParser) declarations(inherited string) {
+	for p.err == nil {
+		t := p.peek()
+		if t.kind != cKeyword {
+			return
+		}
+		switch t.value {
+		case "namespace", "default":
+			p.next()
+			isDefault := t.value == "default"
+			if isDefault {
+				p.expect(cKeyword, "namespace")
+			}
+			prefix := ""
+			if !p.is(cOp, "=") {
+				prefix = p.identifier()
+			}
+			p.expect(cOp, "=")
+			uri := inherited
+			if p.is(cKeyword, "inherit") {
+				p.next()
+			} else {
+				uri = p.literal()
+			}
+			if prefix != "" {
+				p.namespaces[prefix] = uri
+			}
+			if isDefault {
+				p.namespaces[""] = uri
+			}
+		case "datatypes":
+			p.next()
+			prefix := p.identifier()
+			p.expect(cOp, "=")
+			p.datatypes[prefix] = p.literal()
+		default:
+			return
+		}
+	}
+}
+
+func (p *compactParser) isGrammar() bool {
+	t, u := p.peek(), p.tokens[p.pos]
+	if p.pos+1 < len(p.tokens) {
+		u = p.tokens[p.pos+1]
+	}
+	switch {
+	case t.kind == cEOF:
+		return true
+	case u.kind == cOp && (u.value == "=" || u.value == "|=" || u.value == "&="):
+		return t.kind == cIdentifier || (t.kind == cKeyword && t.value == "start")
+	case t.kind == cKeyword && t.value == "div":
+		return u.kind == cOp && u.value == "{"
+	case t.kind == cKeyword && t.value == "include":
+		return u.kind == cLiteral
+	}
+	return false
+}
+
+// grammarContent reads definitions up to the closing brace or the end of the
+// schema, skipping the overridden ones.
+func (p *compactParser) grammarContent(overrides map[string]bool) {
+	for p.err == nil {
+		t := p.peek()
+		switch {
+		case t.kind == cEOF || (t.kind == cOp && t.value == "}"):
+			return
+		case t.kind == cKeyword && t.value == "div":
+			p.next()
+			p.expect(cOp, "{")
+			p.grammarContent(overrides)
+			p.expect(cOp, "}")
+		case t.kind == cKeyword && t.value == "include":
+			p.include(overrides)
+		case t.kind == cIdentifier || (t.kind == cKeyword && t.value == "start"):
+			p.next()
+			name := t.value
+			if t.kind == cKeyword {
+				name = ""
+			}
+			combine := ""
+			switch op := p.next(); {
+			case op.kind == cOp && op.value == "|=":
+				combine = "choice"
+			case op.kind == cOp && op.value == "&=":
+				combine = "interleave"
+			case op.kind != cOp || op.value != "=":
+				p.errorf(op, "expected '=', found %s", op)
+				return
+			}
+			pattern := p.pattern()
+			if p.defined != nil {
+				p.defined[name] = true
+			}
+			if overrides[name] {
+				continue
+			}
+			if msg := p.b.define(p.grammar, name, combine, pattern); msg != "" {
+				p.errorf(t, "%s", msg)
+			}
+		default:
+			p.errorf(t, "unexpected %s in grammar", t)
+		}
+	}
+}
+
+func (p *compactParser) include(overrides map[string]bool) {
+	t := p.next()
+	href := p.literal()
+	ns := p.namespaces[""]
+	if p.is(cKeyword, "inherit") {
+		p.next()
+		p.expect(cOp, "=")
+		ns = p.namespaces[p.identifier()]
+	}
+
+	// the definitions of the include replace those of the included schema
+	names := map[string]bool{}
+	for name := range overrides {
+		names[name] = true
+	}
+	if p.is(cOp, "{") {
+		p.next()
+		outer := p.defined
+		p.defined = names
+		p.grammarContent(overrides)
+		p.defined = outer
+		p.expect(cOp, "}")
+	}
+	if p.err != nil {
+		return
+	}
+
+	text, location, err := p.b.load(p.src, href)
+	if err != nil {
+		p.errorf(t, "%s", err)
+		return
+	}
+	if _, err := p.b.parse(text, location, ns, p.grammar, names); err != nil {
+		p.err = err
+	}
+}
+
+func (p *compactParser) pattern() *pattern {
+	first := p.particle()
+	t := p.peek()
+	if t.kind != cOp || (t.value != "," && t.value != "|" && t.value != "&") {
+		return first
+	}
+
+	kind := map[string]patternKind{",": groupPattern, "|": choicePattern, "&": interleavePattern}[t.value]
+	patterns := []*pattern{first}
+	for p.err == nil {
+		op := p.peek()
+		if op.kind != cOp || (op.value != "," && op.value != "|" && op.value != "&") {
+			break
+		}
+		if op.value != t.value {
+			return p.errorf(op, "mixed operators %s and %s, use parentheses", t, op)
+		}
+		p.next()
+		patterns = append(patterns, p.particle())
+	}
+	return fold(kind, patterns)
+}
+
+func (p *compactParser) particle() *pattern {
+	r := p.primary()
+	t := p.peek()
+	if t.kind != cOp {
+		return r
+	}
+	switch t.value {
+	case "?":
+		p.next()
+		return newPattern(choicePattern, r, empty)
+	case "*":
+		p.next()
+		return newPattern(choicePattern, newPattern(oneOrMorePattern, r, nil), empty)
+	case "+":
+		p.next()
+		return newPattern(oneOrMorePattern, r, nil)
+	}
+	return r
+}
+
+// block reads a pattern in braces.
+func (p *compactParser) block() *pattern {
+	p.expect(cOp, "{")
+	r := p.pattern()
+	p.expect(cOp, "}")
+	return r
+}
+
+func (p *compactParser) primary() *pattern {
+	t := p.peek()
+	if p.err != nil {
+		return notAllowed
+	}
+
+	switch t.kind {
+	case cKeyword:
+		switch t.value {
+		case "element", "attribute":
+			p.next()
+			r := &pattern{kind: elementPattern}
+			if t.value == "attribute" {
+				r.kind = attributePattern
+			}
+			r.name = p.nameClass(t.value == "attribute")
+			r.p1 = p.block()
+			return r
+		case "list":
+			p.next()
+			return newPattern(listPattern, p.block(), nil)
+		case "mixed":
+			p.next()
+			return newPattern(interleavePattern, p.block(), text)
+		case "parent":
+			p.next()
+			if p.grammar == nil || p.grammar.parent == nil {
+				return p.errorf(t, "parent reference outside of nested grammar")
+			}
+			return p.b.ref(p.grammar.parent, p.identifier(), p.src, t.offset)
+		case "empty":
+			p.next()
+			return empty
+		case "text":
+			p.next()
+			return text
+		case "notAllowed":
+			p.next()
+			return notAllowed
+		case "external":
+			p.next()
+			href := p.literal()
+			ns := p.namespaces[""]
+			if p.is(cKeyword, "inherit") {
+				p.next()
+				p.expect(cOp, "=")
+				ns = p.namespaces[p.identifier()]
+			}
+			s, location, err := p.b.load(p.src, href)
+			if err != nil {
+				return p.errorf(t, "%s", err)
+			}
+			r, err := p.b.parse(s, location, ns, nil, nil)
+			if err != nil {
+				if p.err == nil {
+					p.err = err
+				}
+				return notAllowed
+			}
+			return r
+		case "grammar":
+			p.next()
+			outer := p.grammar
+			p.grammar = newGrammar(outer)
+			defer func() { p.grammar = outer }()
+			p.expect(cOp, "{")
+			p.grammarContent(nil)
+			p.expect(cOp, "}")
+			return p.b.ref(p.grammar, "", p.src, t.offset)
+		case "string", "token":
+			return p.data("", t.value)
+		}
+	case cCName:
+		prefix := t.value[:strings.IndexByte(t.value, ':')]
+		library, ok := p.datatypes[prefix]
+		if !ok {
+			return p.errorf(t, "undeclared datatypes prefix %s", prefix)
+		}
+		return p.data(library, t.value[len(prefix)+1:])
+	case cLiteral:
+		dt, _ := p.b.datatype("", "token", nil)
+		return &pattern{kind: valuePattern, datatype: dt, value: p.literal()}
+	case cIdentifier:
+		p.next()
+		if p.grammar == nil {
+			return p.errorf(t, "reference to %s outside of grammar", t.value)
+		}
+		return p.b.ref(p.grammar, t.value, p.src, t.offset)
+	case cOp:
+		if t.value == "(" {
+			p.next()
+			r := p.pattern()
+			p.expect(cOp, ")")
+			return r
+		}
+	}
+
+	return p.errorf(t, "unexpected %s", t)
+}
+
+// data reads a value or data pattern following the datatype name.
+func (p *compactParser) data(library, name string) *pattern {
+	t := p.next()
+
+	if p.peek().kind == cLiteral {
+		dt, err := p.b.datatype(library, name, nil)
+		if err != nil {
+			return p.errorf(t, "%s", err)
+		}
+		return &pattern{kind: valuePattern, datatype: dt, value: p.literal()}
+	}
+
+	params := []xsd.Param{}
+	if p.is(cOp, "{") {
+		p.next()
+		for p.err == nil && !p.is(cOp, "}") {
+			param := xsd.Param{Name: p.identifier()}
+			p.expect(cOp, "=")
+			param.Value = p.literal()
+			params = append(params, param)
+		}
+		p.expect(cOp, "}")
+	}
+	dt, err := p.b.datatype(library, name, params)
+	if err != nil {
+		return p.errorf(t, "%s", err)
+	}
+
+	r := &pattern{kind: dataPattern, datatype: dt}
+	if p.is(cOp, "-") {
+		p.next()
+		r.except = p.primary()
+	}
+	return r
+}
+
+func (p *compactParser) nameClass(attribute bool) *nameClass {
+	nc := p.simpleNameClass(attribute)
+	for p.err == nil && p.is(cOp, "|") {
+		p.next()
+		nc = &nameClass{kind: choiceNameClass, c1: nc, c2: p.simpleNameClass(attribute)}
+	}
+	return nc
+}
+
+func (p *compactParser) simpleNameClass(attribute bool) *nameClass {
+	t := p.next()
+	except := func() *nameClass {
+		if p.is(cOp, "-") {
+			p.next()
+			return p.simpleNameClass(attribute)
+		}
+		return nil
+	}
+
+	switch {
+	case t.kind == cIdentifier || t.kind == cKeyword:
+		nc := &nameClass{kind: nameNameClass, local: t.value}
+		if !attribute {
+			nc.ns = p.namespaces[""]
+		}
+		return nc
+	case t.kind == cCName:
+		idx := strings.IndexByte(t.value, ':')
+		ns, ok := p.namespaces[t.value[:idx]]
+		if !ok {
+			p.errorf(t, "undeclared namespace prefix %s", t.value[:idx])
+		}
+		return &nameClass{kind: nameNameClass, ns: ns, local: t.value[idx+1:]}
+	case t.kind == cNsName:
+		ns, ok := p.namespaces[t.value]
+		if !ok {
+			p.errorf(t, "undeclared namespace prefix %s", t.value)
+		}
+		return &nameClass{kind: nsNameClass, ns: ns, except: except()}
+	case t.kind == cOp && t.value == "*":
+		return &nameClass{kind: anyNameClass, except: except()}
+	case t.kind == cOp && t.value == "(":
+		nc := p.nameClass(attribute)
+		p.expect(cOp, ")")
+		return nc
+	}
+
+	p.errorf(t, "expected name class, found %s", t)
+	return &nameClass{kind: anyNameClass}
+}
@@ -0,0 +1,473 @@
+package rng
+
+import (
+	"sort"
+	"strings"
+)
+
+type patternKind uint8
+
+const (
+	notAllowedPattern patternKind = iota
+	emptyPattern
+	textPattern
+	choicePattern
+	interleavePattern
+	groupPattern
+	oneOrMorePattern
+	listPattern
+	dataPattern
+	valuePattern
+	attributePattern
+	elementPattern
+	afterPattern
+	refPattern
+)
+
+// pattern is a node of a simplified schema. Patterns of the schema are
+// shared between validations and never modified after parsing, the patterns
+// created while validating are interned per validation.
+type pattern struct {
+	kind     patternKind
+	id       int
+	nullable bool
+	p1, p2   *pattern
+	name     *nameClass
+	datatype datatype
+	value    string
+	// except is the excluded pattern of data patterns
+	except *pattern
+	// ref is the definition referred to by ref patterns, which are removed
+	// once the schema is complete
+	ref *define
+}
+
+var (
+	notAllowed = &pattern{kind: notAllowedPattern, id: 0}
+	empty      = &pattern{kind: emptyPattern, id: 1, nullable: true}
+	text       = &pattern{kind: textPattern, id: 2, nullable: true}
+)
+
+// firstID is the first id available for other patterns.
+const firstID = 3
+
+func newPattern(kind patternKind, p1, p2 *pattern) *pattern {
+	return &pattern{kind: kind, p1: p1, p2: p2}
+}
+
+type nameClassKind uint8
+
+const (
+	anyNameClass nameClassKind = iota
+	nsNameClass
+	nameNameClass
+	choiceNameClass
+)
+
+type nameClass struct {
+	kind   nameClassKind
+	ns     string
+	local  string
+	except *nameClass
+	c1, c2 *nameClass
+}
+
+type qname struct {
+	ns    string
+	local string
+}
+
+func (nc *nameClass) contains(q qname) bool {
+	switch nc.kind {
+	case anyNameClass:
+		return nc.except == nil || !nc.except.contains(q)
+	case nsNameClass:
+		return nc.ns == q.ns && (nc.except == nil || !nc.except.contains(q))
+	case nameNameClass:
+		return nc.ns == q.ns && nc.local == q.local
+	}
+	return nc.c1.contains(q) || nc.c2.contains(q)
+}
+
+// describe appends human-readable descriptions of the names in nc.
+func (nc *nameClass) describe(r []string, format string) []string {
+	switch nc.kind {
+	case anyNameClass:
+		return append(r, strings.Replace(format, "%s", "*", 1))
+	case nsNameClass:
+		return append(r, strings.Replace(format, "%s", "{"+nc.ns+"}*", 1))
+	case nameNameClass:
+		return append(r, strings.Replace(format, "%s", nc.local, 1))
+	}
+	return nc.c2.describe(nc.c1.describe(r, format), format)
+}
+
+// deriver computes the derivatives of patterns. It interns all patterns it
+// creates, so that equal patterns are identical and choices can be
+// normalized.
+type deriver struct {
+	intern map[key]*pattern
+	nextID int
+	open   map[openKey]*pattern
+}
+
+type key struct {
+	kind   patternKind
+	p1, p2 *pattern
+}
+
+type openKey struct {
+	p *pattern
+	q qname
+}
+
+func newDeriver(s *Schema) *deriver {
+	return &deriver{intern: map[key]*pattern{}, nextID: s.patterns, open: map[openKey]*pattern{}}
+}
+
+func (d *deriver) make(kind patternKind, p1, p2 *pattern) *pattern {
+	k := key{kind, p1, p2}
+	if p, ok := d.intern[k]; ok {
+		return p
+	}
+	p := &pattern{kind: kind, id: d.nextID, p1: p1, p2: p2}
+	d.nextID++
+	switch kind {
+	case choicePattern:
+		p.nullable = p1.nullable || p2.nullable
+	case groupPattern, interleavePattern:
+		p.nullable = p1.nullable && p2.nullable
+	case oneOrMorePattern:
+		p.nullable = p1.nullable
+	}
+	d.intern[k] = p
+	return p
+}
+
+// alternatives appends the patterns of nested choices.
+func alternatives(r []*pattern, p *pattern) []*pattern {
+	if p.kind == choicePattern {
+		return alternatives(alternatives(r, p.p1), p.p2)
+	}
+	return append(r, p)
+}
+
+func (d *deriver) choice(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p1 == p2:
+		return p2
+	case p2 == notAllowed:
+		return p1
+	}
+
+	// normalize to a sorted list without duplicates
+	all := alternatives(alternatives(nil, p1), p2)
+	sort.Slice(all, func(i, j int) bool { return all[i].id < all[j].id })
+	r := all[len(all)-1]
+	for i := len(all) - 2; i >= 0; i-- {
+		if all[i] != all[i+1] {
+			r = d.make(choicePattern, all[i], r)
+		}
+	}
+	return r
+}
+
+func (d *deriver) group(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p2 == notAllowed:
+		return notAllowed
+	case p1 == empty:
+		return p2
+	case p2 == empty:
+		return p1
+	}
+	return d.make(groupPattern, p1, p2)
+}
+
+func (d *deriver) interleave(p1, p2 *pattern) *pattern {
+	switch {
+	case p1 == notAllowed || p2 == notAllowed:
+		return notAllowed
+	case p1 == empty:
+		return p2
+	case p2 == empty:
+		return p1
+	}
+	return d.make(interleavePattern, p1, p2)
+}
+
+func (d *deriver) after(p1, p2 *pattern) *pattern {
+	if p1 == notAllowed || p2 == notAllowed {
+		return notAllowed
+	}
+	return d.make(afterPattern, p1, p2)
+}
+
+func (d *deriver) oneOrMore(p *pattern) *pattern {
+	if p == notAllowed {
+		return notAllowed
+	}
+	return d.make(oneOrMorePattern, p, nil)
+}
+
+// applyAfter applies f to the second pattern of all after patterns in p.
+func (d *deriver) applyAfter(p *pattern, f func(*pattern) *pattern) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return d.after(p.p1, f(p.p2))
+	case choicePattern:
+		return d.choice(d.applyAfter(p.p1, f), d.applyAfter(p.p2, f))
+	}
+	return notAllowed
+}
+
+func (d *deriver) startTagOpen(p *pattern, q qname) *pattern {
+	k := openKey{p, q}
+	if r, ok := d.open[k]; ok {
+		return r
+	}
+	r := d.startTagOpenDeriv(p, q)
+	d.open[k] = r
+	return r
+}
+
+func (d *deriver) startTagOpenDeriv(p *pattern, q qname) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return d.choice(d.startTagOpen(p.p1, q), d.startTagOpen(p.p2, q))
+	case elementPattern:
+		if p.name.contains(q) {
+			return d.after(p.p1, empty)
+		}
+	case interleavePattern:
+		return d.choice(
+			d.applyAfter(d.startTagOpen(p.p1, q), func(x *pattern) *pattern { return d.interleave(x, p.p2) }),
+			d.applyAfter(d.startTagOpen(p.p2, q), func(x *pattern) *pattern { return d.interleave(p.p1, x) }))
+	case oneOrMorePattern:
+		return d.applyAfter(d.startTagOpen(p.p1, q), func(x *pattern) *pattern {
+			return d.group(x, d.choice(p, empty))
+		})
+	case groupPattern:
+		r := d.applyAfter(d.startTagOpen(p.p1, q), func(x *pattern) *pattern { return d.group(x, p.p2) })
+		if p.p1.nullable {
+			r = d.choice(r, d.startTagOpen(p.p2, q))
+		}
+		return r
+	case afterPattern:
+		return d.applyAfter(d.startTagOpen(p.p1, q), func(x *pattern) *pattern { return d.after(x, p.p2) })
+	}
+	return notAllowed
+}
+
+// attribute derives p for an attribute. If lenient is set, the value is not
+// checked.
+func (d *deriver) attribute(p *pattern, q qname, value string, lenient bool) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return d.after(d.attribute(p.p1, q, value, lenient), p.p2)
+	case choicePattern:
+		return d.choice(d.attribute(p.p1, q, value, lenient), d.attribute(p.p2, q, value, lenient))
+	case groupPattern:
+		return d.choice(d.group(d.attribute(p.p1, q, value, lenient), p.p2), d.group(p.p1, d.attribute(p.p2, q, value, lenient)))
+	case interleavePattern:
+		return d.choice(d.interleave(d.attribute(p.p1, q, value, lenient), p.p2), d.interleave(p.p1, d.attribute(p.p2, q, value, lenient)))
+	case oneOrMorePattern:
+		return d.group(d.attribute(p.p1, q, value, lenient), d.choice(p, empty))
+	case attributePattern:
+		if p.name.contains(q) && (lenient || d.valueMatches(p.p1, value)) {
+			return empty
+		}
+	}
+	return notAllowed
+}
+
+func (d *deriver) valueMatches(p *pattern, s string) bool {
+	return (p.nullable && isWhitespace(s)) || d.text(p, s).nullable
+}
+
+// startTagClose derives p after all attributes have been seen. If lenient
+// is set, missing attributes are ignored.
+func (d *deriver) startTagClose(p *pattern, lenient bool) *pattern {
+	switch p.kind {
+	case afterPattern:
+		return d.after(d.startTagClose(p.p1, lenient), p.p2)
+	case choicePattern:
+		return d.choice(d.startTagClose(p.p1, lenient), d.startTagClose(p.p2, lenient))
+	case groupPattern:
+		return d.group(d.startTagClose(p.p1, lenient), d.startTagClose(p.p2, lenient))
+	case interleavePattern:
+		return d.interleave(d.startTagClose(p.p1, lenient), d.startTagClose(p.p2, lenient))
+	case oneOrMorePattern:
+		return d.oneOrMore(d.startTagClose(p.p1, lenient))
+	case attributePattern:
+		if lenient {
+			return empty
+		}
+		return notAllowed
+	}
+	return p
+}
+
+func (d *deriver) text(p *pattern, s string) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return d.choice(d.text(p.p1, s), d.text(p.p2, s))
+	case interleavePattern:
+		return d.choice(d.interleave(d.text(p.p1, s), p.p2), d.interleave(p.p1, d.text(p.p2, s)))
+	case groupPattern:
+		r := d.group(d.text(p.p1, s), p.p2)
+		if p.p1.nullable {
+			r = d.choice(r, d.text(p.p2, s))
+		}
+		return r
+	case afterPattern:
+		return d.after(d.text(p.p1, s), p.p2)
+	case oneOrMorePattern:
+		return d.group(d.text(p.p1, s), d.choice(p, empty))
+	case textPattern:
+		return p
+	case valuePattern:
+		if p.datatype.Equal(p.value, s) {
+			return empty
+		}
+	case dataPattern:
+		if p.datatype.Validate(s) == nil && (p.except == nil || !d.text(p.except, s).nullable) {
+			return empty
+		}
+	case listPattern:
+		r := p.p1
+		for _, token := range strings.Fields(s) {
+			r = d.text(r, token)
+		}
+		if r.nullable {
+			return empty
+		}
+	}
+	return notAllowed
+}
+
+// endTag derives p for an end tag. If lenient is set, incomplete content is
+// accepted.
+func (d *deriver) endTag(p *pattern, lenient bool) *pattern {
+	switch p.kind {
+	case choicePattern:
+		return d.choice(d.endTag(p.p1, lenient), d.endTag(p.p2, lenient))
+	case afterPattern:
+		if lenient || p.p1.nullable {
+			return p.p2
+		}
+	}
+	return notAllowed
+}
+
+func isWhitespace(s string) bool {
+	return strings.Trim(s, " \t\r\n") == ""
+}
+
+// first calls f for the patterns that may match next in the content of the
+// after patterns in p.
+func first(p *pattern, f func(*pattern)) {
+	seen := map[*pattern]bool{}
+	var visit func(p *pattern)
+	visit = func(p *pattern) {
+		if seen[p] {
+			return
+		}
+		seen[p] = true
+		switch p.kind {
+		case choicePattern, interleavePattern:
+			visit(p.p1)
+			visit(p.p2)
+		case groupPattern:
+			visit(p.p1)
+			if p.p1.nullable {
+				visit(p.p2)
+			}
+		case oneOrMorePattern:
+			visit(p.p1)
+		case elementPattern, textPattern, dataPattern, valuePattern, listPattern:
+			f(p)
+		}
+	}
+	for _, a := range alternatives(nil, p) {
+		if a.kind == afterPattern {
+			visit(a.p1)
+		}
+	}
+}
+
+// expected describes the elements allowed next in the current content of p.
+func expected(p *pattern, end string) string {
+	names := []string{}
+	first(p, func(p *pattern) {
+		if p.kind == elementPattern {
+			names = p.name.describe(names, "<%s>")
+		} else {
+			names = append(names, "text")
+		}
+	})
+	for _, a := range alternatives(nil, p) {
+		if a.kind == afterPattern && a.p1.nullable && end != "" {
+			names = append(names, end)
+		}
+	}
+	return describe(names, " or ")
+}
+
+// attributesOf calls f for the attribute patterns in the current start tag
+// of p.
+func attributesOf(p *pattern, f func(*pattern)) {
+	switch p.kind {
+	case afterPattern, oneOrMorePattern:
+		attributesOf(p.p1, f)
+	case choicePattern, groupPattern, interleavePattern:
+		attributesOf(p.p1, f)
+		attributesOf(p.p2, f)
+	case attributePattern:
+		f(p)
+	}
+}
+
+// required describes the attributes missing in the current start tag of p.
+func required(p *pattern) string {
+	var visit func(p *pattern) []string
+	visit = func(p *pattern) []string {
+		switch p.kind {
+		case afterPattern, oneOrMorePattern:
+			return visit(p.p1)
+		case groupPattern, interleavePattern:
+			return append(visit(p.p1), visit(p.p2)...)
+		case choicePattern:
+			// only attributes required in all alternatives
+			r := []string{}
+			b := visit(p.p2)
+			for _, a := range visit(p.p1) {
+				for _, x := range b {
+					if a == x {
+						r = append(r, a)
+						break
+					}
+				}
+			}
+			return r
+		case attributePattern:
+			return p.name.describe(nil, "%s")
+		}
+		return nil
+	}
+	return describe(visit(p), ", ")
+}
+
+func describe(names []string, sep string) string {
+	sort.Strings(names)
+	r := []string{}
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			r = append(r, n)
+		}
+	}
+	if len(r) == 0 {
+		return "nothing"
+	}
+	return strings.Join(r, sep)
+}
@@ -0,0 +1,252 @@
+package rng
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/roblillack/gockl/dtd"
+)
+
+const addressBook = `<?xml version="1.0"?>
+<grammar xmlns="http://relaxng.org/ns/structure/1.0"
+         datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+  <start>
+    <element name="addressBook">
+      <zeroOrMore>
+        <ref name="card"/>
+      </zeroOrMore>
+    </element>
+  </start>
+
+  <define name="card">
+    <element name="card">
+      <attribute name="id"><data type="NCName"/></attribute>
+      <optional>
+        <attribute name="kind">
+          <choice><value>person</value><value>company</value></choice>
+        </attribute>
+      </optional>
+      <interleave>
+        <element name="name"><text/></element>
+        <element name="email"><text/></element>
+        <zeroOrMore>
+          <element name="phone">
+            <data type="string"><param name="pattern">\+?[0-9 ]+</param></data>
+          </element>
+        </zeroOrMore>
+      </interleave>
+      <optional>
+        <element name="age"><data type="nonNegativeInteger"><param name="maxInclusive">150</param></data></element>
+      </optional>
+      <optional>
+        <element name="note"><mixed><zeroOrMore><element name="b"><text/></element></zeroOrMore></mixed></element>
+      </optional>
+      <optional>
+        <element name="tags"><list><oneOrMore><data type="token"/></oneOrMore></list></element>
+      </optional>
+    </element>
+  </define>
+</grammar>
+`
+
+const addressBookCompact = `# the same schema in the compact syntax
+datatypes xs = "http://www.w3.org/2001/XMLSchema-datatypes"
+
+start = element addressBook { card* }
+
+[ a:documentation [ "A single entry." ] ]
+card = element card {
+  attribute id { xs:NCName },
+  attribute kind { "person" | "company" }?,
+  (element name { text } & element email { text } & element phone { xs:string { pattern = "\+?[0-9 ]+" } }*),
+  element age { xs:nonNegativeInteger { maxInclusive = "150" } }?,
+  element note { mixed { element b { text }* } }?,
+  element tags { list { xs:token+ } }?
+}
+`
+
+func TestValidate(t *testing.T) {
+	xml, err := Parse(addressBook, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, err := ParseCompact(addressBookCompact, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for input, expected := range map[string][]string{
+		`<addressBook/>`: nil,
+		`<addressBook>
+  <card id="a1" kind="person"><email>a@example.com</email><phone>+49 30 1234</phone><name>A</name><phone>110</phone></card>
+  <card id="b"><name>B</name><email/><age> 42 </age><note>Some <b>bold</b> text</note><tags>x  y z</tags></card>
+</addressBook>`: nil,
+		`<addressBook><card/></addressBook>`: {
+			"1:14: required attribute id missing on <card>",
+			"1:21: content of <card> is incomplete, expected <email> or <name> or <phone>",
+		},
+		`<addressBook><card id="1a" kind="other" foo="x"><name>A</name></card></addressBook>`: {
+			"1:24: invalid value of attribute id: \"1a\" is not a valid NCName",
+			"1:34: invalid value of attribute kind: \"other\" is not one of person, company",
+			"1:41: attribute foo not allowed on <card>",
+			"1:63: content of <card> is incomplete, expected <email> or <phone>",
+		},
+		`<addressBook><card id="a"><name>A</name><email>a</email><age>151</age><phone>1</phone></card></addressBook>`: {
+			"1:62: invalid content of <age>: \"151\" is greater than 150",
+			"1:71: element <phone> not allowed in <card> here, expected </card> or <note> or <tags>",
+		},
+		`<addressBook>text<card id="a"><name>A</name><email>a</email><phone>call me</phone><age/><note><i/></note></card></addressBook>`: {
+			"1:14: character data not allowed in <addressBook>",
+			"1:68: invalid content of <phone>: \"call me\" does not match the required pattern",
+			"1:83: invalid content of <age>: \"\" is not a valid integer",
+			"1:95: element <i> not allowed in <note> here, expected </note> or <b> or text",
+		},
+		`<card id="a"/>`: {
+			"1:1: document element <card> not allowed, expected <addressBook>",
+			"1:15: content of <card> is incomplete, expected <email> or <name> or <phone>",
+		},
+		`<x:addressBook xmlns:x="urn:x"/>`: {
+			"1:1: document element <x:addressBook> in namespace urn:x not allowed, expected <addressBook>",
+		},
+	} {
+		for _, s := range []*Schema{xml, compact} {
+			actual := []string{}
+			for _, e := range s.ValidateString(input) {
+				actual = append(actual, e.Error())
+			}
+			if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+				t.Errorf("%s: unexpected errors:\n%s", input, strings.Join(actual, "\n"))
+			}
+		}
+	}
+
+	if errs := xml.ValidateString("<!-- nothing -->"); len(errs) != 1 || errs[0].Msg != "no document element" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	if errs := xml.ValidateString(strings.Repeat("<addressBook><x/></addressBook>", 20)); len(errs) != 1 {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+	input := "<addressBook>" + strings.Repeat("<x/>", 20) + "</addressBook>"
+	if errs := xml.ValidateString(input); len(errs) != MaxErrors {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	s, err := ParseCompact(`default namespace = "urn:doc"
+namespace x = "urn:ext"
+
+start = element doc { attribute x:id { text }?, attribute lang { text }?, (element item { empty } | element x:* { text })+, element * - (item | x:*) { text }* }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for input, expected := range map[string]string{
+		`<doc xmlns="urn:doc" lang="en"><item/><e:other xmlns:e="urn:ext">x</e:other><foo xmlns="urn:whatever">x</foo></doc>`: "",
+		`<d:doc xmlns:d="urn:doc" xmlns:x="urn:ext" x:id="1"><d:item/></d:doc>`:                                               "",
+		`<doc xmlns="urn:doc" xmlns:x="urn:ext" x:lang="en"><item/></doc>`:                                                    "1:40: attribute x:lang not allowed on <doc>",
+		`<doc xmlns="urn:doc"><foo/></doc>`:                                                                                   "1:22: element <foo> in namespace urn:doc not allowed in <doc> here, expected <item> or <{urn:ext}*>\n1:28: content of <doc> is incomplete, expected <item> or <{urn:ext}*>",
+		`<doc xmlns="urn:doc"><item/><item>x</item></doc>`:                                                                    "1:35: character data not allowed in <item>",
+		`<doc xmlns="urn:doc"><p:item/></doc>`:                                                                                "1:22: undeclared namespace prefix in <p:item>\n1:31: content of <doc> is incomplete, expected <item> or <{urn:ext}*>",
+	} {
+		actual := []string{}
+		for _, e := range s.ValidateString(input) {
+			actual = append(actual, e.Error())
+		}
+		if strings.Join(actual, "\n") != expected {
+			t.Errorf("%s: unexpected errors:\n%s", input, strings.Join(actual, "\n"))
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for input, expected := range map[string]string{
+		`<element xmlns="http://relaxng.org/ns/structure/1.0"/>`: "rng: 1:1: missing name of <element>",
+		`<foo/>`: "rng: 1:1: missing RELAX NG pattern",
+		`<element name="a" xmlns="http://relaxng.org/ns/structure/1.0"><data type="int"/></element>`:                                             "rng: 1:63: unknown datatype int",
+		`<grammar xmlns="http://relaxng.org/ns/structure/1.0"><start><ref name="b"/></start></grammar>`:                                          "rng: 1:61: reference to undefined pattern b",
+		`<grammar xmlns="http://relaxng.org/ns/structure/1.0"><define name="a"><empty/></define></grammar>`:                                      "rng: 1:1: missing start pattern",
+		`<grammar xmlns="http://relaxng.org/ns/structure/1.0"><start><empty/></start><start><text/></start></grammar>`:                           "rng: 1:77: start defined more than once",
+		`<grammar xmlns="http://relaxng.org/ns/structure/1.0"><start><ref name="a"/></start><define name="a"><ref name="a"/></define></grammar>`: "rng: 1:61: recursive reference to pattern a",
+		`start = a
+a = b, empty
+b = text | a`: "rng: 1:9: recursive reference to pattern a outside of an element",
+		`start = element a { b }`:                      "rng: 1:21: reference to undefined pattern b",
+		`element a { text, empty | text }`:             "rng: 1:25: mixed operators ',' and '|', use parentheses",
+		`element a { xsd:int { minInclusive = "x" } }`: "rng: 1:13: invalid value of minInclusive facet: \"x\" is not a valid integer",
+		`element a { foo:int }`:                        "rng: 1:13: undeclared datatypes prefix foo",
+		`element a { text`:                             "rng: 1:17: expected '}', found end of schema",
+		`element a { "x }`:                             "rng: 1:13: unterminated literal",
+		`start = element a { empty }
+start |= element b { empty }
+start &= text`: "rng: 3:1: conflicting combine methods for start",
+		`element a { external "other.rnc" }`: "rng: 1:13: no resolver to load other.rnc",
+	} {
+		parse := ParseCompact
+		if strings.HasPrefix(input, "<") {
+			parse = Parse
+		}
+		_, err := parse(input, nil)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %s, got %v", input, expected, err)
+		}
+	}
+
+	s, err := ParseCompact(`start = a | b
+a = element a { text }
+a |= element c { text }
+b = grammar { start = element b { parent a } }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range []string{"<a/>", "<b><c/></b>", "<b><a>x</a></b>"} {
+		if errs := s.ValidateString(input); len(errs) != 0 {
+			t.Errorf("%s: unexpected errors: %v", input, errs)
+		}
+	}
+}
+
+func TestResolver(t *testing.T) {
+	files := map[string]string{
+		"main.rnc": `include "lib/base.rng" {
+  title = element title { xsd:string { maxLength = "5" } }
+}
+start = doc`,
+		"lib/base.rng": `<grammar xmlns="http://relaxng.org/ns/structure/1.0" datatypeLibrary="http://www.w3.org/2001/XMLSchema-datatypes">
+  <define name="doc"><element name="doc"><ref name="title"/><externalRef href="meta.rnc"/></element></define>
+  <define name="title"><element name="title"><empty/></element></define>
+</grammar>`,
+		"lib/meta.rnc": `element meta { attribute version { xsd:decimal } }`,
+	}
+	requested := []string{}
+	r := dtd.ResolverFunc(func(publicID, systemID string) (string, error) {
+		requested = append(requested, systemID)
+		if s, ok := files[systemID]; ok {
+			return s, nil
+		}
+		return "", fmt.Errorf("not found")
+	})
+
+	s, err := ParseCompact(files["main.rnc"], r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(requested, ",") != "lib/base.rng,lib/meta.rnc" {
+		t.Errorf("Unexpected requests: %v", requested)
+	}
+
+	input := `<doc><title>hello!</title><meta version="1.x"/></doc>`
+	actual := []string{}
+	for _, e := range s.ValidateString(input) {
+		actual = append(actual, e.Error())
+	}
+	if strings.Join(actual, "\n") != "1:13: invalid content of <title>: \"hello!\" is longer than the maximum length of 5\n1:42: invalid value of attribute version: \"1.x\" is not a valid decimal" {
+		t.Errorf("Unexpected errors: %v", actual)
+	}
+
+	files["lib/meta.rnc"] = `external "../main.rnc"`
+	if _, err := ParseCompact(files["main.rnc"], r); err == nil || err.Error() != "rng: main.rnc:1:1: recursive inclusion of lib/base.rng" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
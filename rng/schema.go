@@ -0,0 +1,322 @@
+// Package rng validates documents against RELAX NG schemas, written in
+// either the XML or the compact syntax.
+//
+// Documents are validated while streaming through their tokens using the
+// derivative algorithm, so that only the character data of the current
+// element is kept in memory. Besides the built-in string and token
+// datatypes, the XML Schema datatypes are supported. Restrictions of the
+// specification that only concern the schema itself, like the prohibition of
+// attributes inside of attributes, are not checked.
+package rng
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/dtd"
+	"github.com/roblillack/gockl/xsd"
+)
+
+const xsdDatatypes = "http://www.w3.org/2001/XMLSchema-datatypes"
+
+// Schema is a compiled schema.
+type Schema struct {
+	start *pattern
+	// elements lists all element patterns, to validate misplaced elements
+	elements []*pattern
+	// patterns is the number of patterns
+	patterns int
+}
+
+// Parse compiles a schema written in the XML syntax. Included and externally
+// referenced schemas are loaded using r, which may be nil if there are none.
+// They may be written in either syntax.
+func Parse(s string, r dtd.Resolver) (*Schema, error) {
+	b := &builder{r: r, loading: map[string]bool{}}
+	p, err := b.parseXML(s, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return b.finalize(p)
+}
+
+// ParseCompact compiles a schema written in the compact syntax. Included and
+// externally referenced schemas are loaded using r, which may be nil if there
+// are none. They may be written in either syntax.
+func ParseCompact(s string, r dtd.Resolver) (*Schema, error) {
+	b := &builder{r: r, loading: map[string]bool{}}
+	p, err := b.parseCompact(s, "", "")
+	if err != nil {
+		return nil, err
+	}
+	return b.finalize(p)
+}
+
+// source is a single schema document.
+type source struct {
+	input    string
+	location string
+}
+
+func (s *source) errorf(offset int, format string, args ...interface{}) error {
+	prefix := "rng: "
+	if s.location != "" {
+		prefix += s.location + ":"
+	}
+	return fmt.Errorf("%s%s: %s", prefix, gockl.Locate(s.input, offset), fmt.Sprintf(format, args...))
+}
+
+type grammar struct {
+	parent *grammar
+	// defines maps the names of definitions to them, with the start
+	// pattern using the empty name
+	defines map[string]*define
+}
+
+func newGrammar(parent *grammar) *grammar {
+	return &grammar{parent: parent, defines: map[string]*define{}}
+}
+
+func (g *grammar) lookup(name string) *define {
+	d := g.defines[name]
+	if d == nil {
+		d = &define{name: name}
+		g.defines[name] = d
+	}
+	return d
+}
+
+type define struct {
+	name    string
+	pattern *pattern
+	combine string
+	// plain is set if there was a definition without combine attribute
+	plain bool
+	// the first reference, to report undefined patterns
+	src    *source
+	offset int
+}
+
+func (d *define) String() string {
+	if d.name == "" {
+		return "start"
+	}
+	return "pattern " + d.name
+}
+
+type builder struct {
+	r       dtd.Resolver
+	loading map[string]bool
+}
+
+// define adds a definition to g and returns a description of the problem or
+// an empty string.
+func (b *builder) define(g *grammar, name, combine string, p *pattern) string {
+	d := g.lookup(name)
+	if combine != "" && combine != "choice" && combine != "interleave" {
+		return fmt.Sprintf("invalid combine method %s", combine)
+	}
+	if d.pattern == nil {
+		d.pattern, d.combine, d.plain = p, combine, combine == ""
+		return ""
+	}
+
+	switch {
+	case combine == "" && d.plain:
+		return fmt.Sprintf("%s defined more than once", d)
+	case combine != "" && d.combine != "" && combine != d.combine:
+		return fmt.Sprintf("conflicting combine methods for %s", d)
+	case combine == "":
+		d.plain = true
+	default:
+		d.combine = combine
+	}
+
+	kind := choicePattern
+	if d.combine == "interleave" {
+		kind = interleavePattern
+	}
+	d.pattern = newPattern(kind, d.pattern, p)
+	return ""
+}
+
+func (b *builder) ref(g *grammar, name string, src *source, offset int) *pattern {
+	d := g.lookup(name)
+	if d.src == nil {
+		d.src, d.offset = src, offset
+	}
+	return &pattern{kind: refPattern, ref: d}
+}
+
+// load returns the text and location of the schema referenced by href.
+func (b *builder) load(src *source, href string) (string, string, error) {
+	location := href
+	if src.location != "" && !strings.Contains(href, ":") && !path.IsAbs(href) {
+		location = path.Join(path.Dir(src.location), href)
+	}
+	if b.loading[location] {
+		return "", "", fmt.Errorf("recursive inclusion of %s", location)
+	}
+	if b.r == nil {
+		return "", "", fmt.Errorf("no resolver to load %s", location)
+	}
+	text, err := b.r.Resolve("", location)
+	if err != nil {
+		return "", "", fmt.Errorf("cannot load %s: %s", location, err)
+	}
+	return text, location, nil
+}
+
+// parse parses a loaded schema in either syntax.
+func (b *builder) parse(text, location, ns string, g *grammar, overrides map[string]bool) (*pattern, error) {
+	b.loading[location] = true
+	defer delete(b.loading, location)
+
+	if strings.HasPrefix(strings.TrimLeft(text, " \t\r\n\ufeff"), "<") {
+		if g != nil {
+			return nil, b.includeXML(text, location, ns, g, overrides)
+		}
+		return b.parseXML(text, location, ns)
+	}
+	if g != nil {
+		return nil, b.includeCompact(text, location, ns, g, overrides)
+	}
+	return b.parseCompact(text, location, ns)
+}
+
+type datatype interface {
+	Validate(value string) error
+	Equal(a, b string) bool
+}
+
+// builtinType is one of the datatypes string and token of the built-in
+// datatype library.
+type builtinType struct {
+	token bool
+}
+
+func (builtinType) Validate(value string) error {
+	return nil
+}
+
+func (t builtinType) Equal(a, b string) bool {
+	if t.token {
+		return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+	}
+	return a == b
+}
+
+func (b *builder) datatype(library, name string, params []xsd.Param) (datatype, error) {
+	switch library {
+	case "":
+		if len(params) > 0 {
+			return nil, fmt.Errorf("datatype %s does not have parameters", name)
+		}
+		switch name {
+		case "string":
+			return builtinType{}, nil
+		case "token":
+			return builtinType{token: true}, nil
+		}
+		return nil, fmt.Errorf("unknown datatype %s", name)
+	case xsdDatatypes:
+		dt, err := xsd.NewDatatype(name, params...)
+		if err != nil {
+			return nil, fmt.Errorf("%s", strings.TrimPrefix(err.Error(), "xsd: "))
+		}
+		return dt, nil
+	}
+	return nil, fmt.Errorf("unsupported datatype library %s", library)
+}
+
+// finalize replaces all references by the referenced patterns and checks
+// that recursion only happens inside of elements.
+func (b *builder) finalize(start *pattern) (*Schema, error) {
+	s := &Schema{patterns: firstID}
+	done := map[*pattern]bool{}
+	// patterns visited since the last element
+	active := map[*pattern]bool{}
+	names := map[*pattern]*define{}
+
+	deref := func(p *pattern) (*pattern, error) {
+		seen := map[*define]bool{}
+		for p.kind == refPattern {
+			d := p.ref
+			if d.pattern == nil && d.name == "" {
+				return nil, d.src.errorf(d.offset, "missing start pattern")
+			} else if d.pattern == nil {
+				return nil, d.src.errorf(d.offset, "reference to undefined %s", d)
+			}
+			if seen[d] {
+				return nil, d.src.errorf(d.offset, "recursive reference to %s", d)
+			}
+			seen[d] = true
+			p = d.pattern
+			if names[p] == nil {
+				names[p] = d
+			}
+		}
+		return p, nil
+	}
+
+	var walk func(p *pattern) error
+	walk = func(p *pattern) error {
+		if done[p] || p == notAllowed || p == empty || p == text {
+			return nil
+		}
+		if active[p] {
+			d := names[p]
+			return d.src.errorf(d.offset, "recursive reference to %s outside of an element", d)
+		}
+		if p.kind == elementPattern {
+			// recursion is fine from here on
+			done[p] = true
+			outer := active
+			active = map[*pattern]bool{}
+			defer func() { active = outer }()
+			s.elements = append(s.elements, p)
+		} else {
+			active[p] = true
+			defer delete(active, p)
+		}
+		p.id = s.patterns
+		s.patterns++
+
+		for _, field := range []**pattern{&p.p1, &p.p2, &p.except} {
+			if *field == nil {
+				continue
+			}
+			resolved, err := deref(*field)
+			if err != nil {
+				return err
+			}
+			*field = resolved
+			if err := walk(resolved); err != nil {
+				return err
+			}
+		}
+
+		switch p.kind {
+		case choicePattern:
+			p.nullable = p.p1.nullable || p.p2.nullable
+		case groupPattern, interleavePattern:
+			p.nullable = p.p1.nullable && p.p2.nullable
+		case oneOrMorePattern:
+			p.nullable = p.p1.nullable
+		}
+		done[p] = true
+		return nil
+	}
+
+	start, err := deref(start)
+	if err == nil {
+		err = walk(start)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.start = start
+	return s, nil
+}
@@ -0,0 +1,341 @@
+package rng
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Error is a single validity error.
+type Error struct {
+	gockl.Location
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Location.String() + ": " + e.Msg
+}
+
+// MaxErrors is the maximum number of errors reported for a single document.
+// It is lower than for other validators, as later errors are often caused by
+// earlier ones.
+const MaxErrors = 10
+
+// ValidateString validates the document in input.
+func (s *Schema) ValidateString(input string) []*Error {
+	return s.Validate(gockl.New(input))
+}
+
+// Validate reads all remaining tokens of z and returns the validity errors
+// found. Well-formedness is not checked, use the check package for that.
+func (s *Schema) Validate(z *gockl.Tokenizer) []*Error {
+	v := &validator{input: z.Input, s: s, d: newDeriver(s), p: s.start}
+
+	for len(v.errors) < MaxErrors {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		v.token(span)
+	}
+
+	if !v.root && len(v.errors) < MaxErrors {
+		v.errorf(0, "no document element")
+	}
+
+	return v.errors
+}
+
+type frame struct {
+	name   string
+	offset int
+	// namespaces declared on this element
+	namespaces map[string]string
+	// children is set if the element contains child elements
+	children bool
+}
+
+type validator struct {
+	input string
+	s     *Schema
+	d     *deriver
+	p     *pattern
+	stack []*frame
+	// text collects the character data since the last tag
+	text       []byte
+	textOffset int
+	// skip is the depth inside an element that is not validated
+	skip   int
+	root   bool
+	errors []*Error
+}
+
+func (v *validator) errorf(offset int, format string, args ...interface{}) {
+	if len(v.errors) >= MaxErrors {
+		return
+	}
+	v.errors = append(v.errors, &Error{gockl.Locate(v.input, offset), fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) top() *frame {
+	if len(v.stack) == 0 {
+		return nil
+	}
+	return v.stack[len(v.stack)-1]
+}
+
+func (v *validator) token(span gockl.Span) {
+	if v.skip > 0 {
+		switch span.Kind {
+		case gockl.StartElementKind:
+			v.skip++
+		case gockl.EndElementKind:
+			v.skip--
+		}
+		return
+	}
+
+	switch span.Kind {
+	case gockl.TextKind, gockl.CDATAKind:
+		if len(v.stack) == 0 {
+			return
+		}
+		if len(v.text) == 0 {
+			v.textOffset = span.Start
+		}
+		if span.Kind == gockl.TextKind {
+			v.text = append(v.text, gockl.Unescape(span.Raw(v.input))...)
+		} else {
+			content, _ := gockl.CDATAToken(span.Raw(v.input)).Content()
+			v.text = append(v.text, content...)
+		}
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		if !v.startElement(span.Token(v.input).(gockl.StartOrEmptyElementToken), span.Start) {
+			if span.Kind == gockl.StartElementKind {
+				v.skip = 1
+			}
+			return
+		}
+		if span.Kind == gockl.EmptyElementKind {
+			v.endElement(span.End)
+		}
+	case gockl.EndElementKind:
+		v.endElement(span.Start)
+	}
+}
+
+// flushText derives the pattern for the character data collected. It
+// reports whether the data was allowed.
+func (v *validator) flushText(end bool) bool {
+	s := string(v.text)
+	v.text = v.text[:0]
+	f := v.top()
+	if f == nil {
+		return true
+	}
+
+	offset := v.textOffset
+	var p *pattern
+	switch {
+	case end && !f.children && isWhitespace(s):
+		// the whitespace may be the value of the element or be ignored
+		p = v.d.text(v.p, s)
+		if p == notAllowed && invalidValue(v.p, s) == "" {
+			return true
+		}
+		if p != notAllowed {
+			p = v.d.choice(v.p, p)
+		}
+		offset = f.offset
+	case isWhitespace(s):
+		return true
+	default:
+		p = v.d.text(v.p, s)
+	}
+	if p != notAllowed {
+		v.p = p
+		return true
+	}
+	if msg := invalidValue(v.p, s); msg != "" {
+		v.errorf(offset, "invalid content of <%s>: %s", f.name, msg)
+	} else {
+		v.errorf(offset, "character data not allowed in <%s>", f.name)
+	}
+	return false
+}
+
+// invalidValue describes why the data patterns allowed next in p do not
+// match s. It returns an empty string if there are none.
+func invalidValue(p *pattern, s string) string {
+	values := []string{}
+	msg := ""
+	first(p, func(p *pattern) {
+		switch p.kind {
+		case valuePattern:
+			values = append(values, p.value)
+		case dataPattern, listPattern:
+			if msg != "" {
+				return
+			}
+			msg = fmt.Sprintf("%q is not allowed", s)
+			if p.kind == dataPattern {
+				if err := p.datatype.Validate(s); err != nil {
+					msg = err.Error()
+				}
+			}
+		}
+	})
+	if len(values) > 0 && msg == "" {
+		return fmt.Sprintf("%q is not one of %s", s, strings.Join(values, ", "))
+	}
+	return msg
+}
+
+// namespace looks up the namespace bound to prefix.
+func (v *validator) namespace(f *frame, prefix string) (string, bool) {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace", true
+	}
+	if ns, ok := f.namespaces[prefix]; ok {
+		return ns, true
+	}
+	for i := len(v.stack) - 1; i >= 0; i-- {
+		if ns, ok := v.stack[i].namespaces[prefix]; ok {
+			return ns, true
+		}
+	}
+	return "", prefix == ""
+}
+
+func (v *validator) qname(f *frame, name string, attribute bool) (qname, bool) {
+	prefix := ""
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		prefix, name = name[:idx], name[idx+1:]
+	}
+	if attribute && prefix == "" {
+		return qname{"", name}, true
+	}
+	ns, ok := v.namespace(f, prefix)
+	return qname{ns, name}, ok
+}
+
+// startElement derives the pattern for a start tag and reports whether the
+// content of the element is validated.
+func (v *validator) startElement(t gockl.StartOrEmptyElementToken, offset int) bool {
+	parent := v.top()
+	if parent == nil && v.root {
+		return false
+	}
+	v.root = true
+
+	f := &frame{name: t.Name(), offset: offset, namespaces: map[string]string{}}
+	attributes := t.AttributeSpans()
+	for _, a := range attributes {
+		if a.Name == "xmlns" {
+			f.namespaces[""] = gockl.Unescape(a.Content)
+		} else if strings.HasPrefix(a.Name, "xmlns:") {
+			f.namespaces[a.Name[len("xmlns:"):]] = gockl.Unescape(a.Content)
+		}
+	}
+
+	if parent != nil {
+		v.flushText(false)
+		parent.children = true
+	}
+
+	q, ok := v.qname(f, f.name, false)
+	if !ok {
+		v.errorf(offset, "undeclared namespace prefix in <%s>", f.name)
+		return false
+	}
+
+	p := v.d.startTagOpen(v.p, q)
+	if p == notAllowed {
+		if parent == nil {
+			v.errorf(offset, "document element <%s>%s not allowed, expected %s", f.name, inNamespace(q.ns), expected(v.d.after(v.p, empty), ""))
+		} else {
+			v.errorf(offset, "element <%s>%s not allowed in <%s> here, expected %s", f.name, inNamespace(q.ns), parent.name, expected(v.p, "</"+parent.name+">"))
+		}
+
+		// validate the element against all declarations of it
+		for _, e := range v.s.elements {
+			if e.name.contains(q) {
+				p = v.d.choice(p, v.d.after(e.p1, v.p))
+			}
+		}
+		if p == notAllowed {
+			return false
+		}
+	}
+
+	for _, a := range attributes {
+		if a.Name == "xmlns" || strings.HasPrefix(a.Name, "xmlns:") {
+			continue
+		}
+		aq, ok := v.qname(f, a.Name, true)
+		if !ok {
+			v.errorf(offset+a.Start, "undeclared namespace prefix in attribute %s", a.Name)
+			continue
+		}
+		value := gockl.Unescape(a.Content)
+		next := v.d.attribute(p, aq, value, false)
+		if next != notAllowed {
+			p = next
+			continue
+		}
+
+		var declared *pattern
+		attributesOf(p, func(ap *pattern) {
+			if declared == nil && ap.name.contains(aq) {
+				declared = ap
+			}
+		})
+		if declared != nil {
+			msg := invalidValue(v.d.after(declared.p1, empty), value)
+			if msg == "" {
+				msg = fmt.Sprintf("%q is not allowed", value)
+			}
+			v.errorf(offset+a.ValueStart, "invalid value of attribute %s: %s", a.Name, msg)
+			p = v.d.attribute(p, aq, value, true)
+		} else {
+			v.errorf(offset+a.Start, "attribute %s not allowed on <%s>", a.Name, f.name)
+		}
+	}
+
+	closed := v.d.startTagClose(p, false)
+	if closed == notAllowed {
+		v.errorf(offset, "required attribute %s missing on <%s>", required(p), f.name)
+		closed = v.d.startTagClose(p, true)
+	}
+
+	v.p = closed
+	v.stack = append(v.stack, f)
+	return true
+}
+
+func inNamespace(ns string) string {
+	if ns == "" {
+		return ""
+	}
+	return " in namespace " + ns
+}
+
+func (v *validator) endElement(offset int) {
+	f := v.top()
+	if f == nil {
+		return
+	}
+
+	ok := v.flushText(true)
+	p := v.d.endTag(v.p, false)
+	if p == notAllowed {
+		if ok {
+			v.errorf(offset, "content of <%s> is incomplete, expected %s", f.name, expected(v.p, ""))
+		}
+		p = v.d.endTag(v.p, true)
+	}
+
+	v.p = p
+	v.stack = v.stack[:len(v.stack)-1]
+}
@@ -0,0 +1,372 @@
+package rng
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl/tree"
+	"github.com/roblillack/gockl/xsd"
+)
+
+const rngNamespace = "http://relaxng.org/ns/structure/1.0"
+
+// xmlParser reads a single schema document in the XML syntax.
+type xmlParser struct {
+	b       *builder
+	src     *source
+	ns      string
+	grammar *grammar
+	err     error
+}
+
+func (b *builder) readXML(text, location, ns string) (*xmlParser, *tree.Node, error) {
+	x := &xmlParser{b: b, src: &source{text, location}, ns: ns}
+	doc, err := tree.ParseString(text)
+	if err != nil {
+		if location != "" {
+			return nil, nil, fmt.Errorf("rng: %s: %s", location, err)
+		}
+		return nil, nil, fmt.Errorf("rng: %s", err)
+	}
+	if doc.Root == nil || x.namespace(doc.Root, prefix(doc.Root.Name())) != rngNamespace {
+		return nil, nil, x.src.errorf(0, "missing RELAX NG pattern")
+	}
+	return x, doc.Root, nil
+}
+
+func (b *builder) parseXML(text, location, ns string) (*pattern, error) {
+	x, root, err := b.readXML(text, location, ns)
+	if err != nil {
+		return nil, err
+	}
+	p := x.pattern(root)
+	return p, x.err
+}
+
+func (b *builder) includeXML(text, location, ns string, g *grammar, overrides map[string]bool) error {
+	x, root, err := b.readXML(text, location, ns)
+	if err != nil {
+		return err
+	}
+	if local(root) != "grammar" {
+		return x.src.errorf(root.Offset(), "included schema must be a grammar")
+	}
+	x.grammar = g
+	x.grammarContent(root, overrides)
+	return x.err
+}
+
+func (x *xmlParser) errorf(n *tree.Node, format string, args ...interface{}) *pattern {
+	if x.err == nil {
+		x.err = x.src.errorf(n.Offset(), format, args...)
+	}
+	return notAllowed
+}
+
+func prefix(name string) string {
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[:idx]
+	}
+	return ""
+}
+
+func local(n *tree.Node) string {
+	name := n.Name()
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// namespace returns the namespace bound to prefix in the scope of n.
+func (x *xmlParser) namespace(n *tree.Node, prefix string) string {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace"
+	}
+	attr := "xmlns"
+	if prefix != "" {
+		attr += ":" + prefix
+	}
+	for ; n != nil; n = n.Parent {
+		if ns, ok := n.Attribute(attr); ok {
+			return ns
+		}
+	}
+	return ""
+}
+
+// inherited returns the value of the ns or datatypeLibrary attribute in
+// effect for n.
+func (x *xmlParser) inherited(n *tree.Node, attr string) string {
+	for ; n != nil; n = n.Parent {
+		if v, ok := n.Attribute(attr); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	if attr == "ns" {
+		return x.ns
+	}
+	return ""
+}
+
+// children returns the child elements in the RELAX NG namespace.
+func (x *xmlParser) children(n *tree.Node) []*tree.Node {
+	r := []*tree.Node{}
+	for _, c := range n.Elements() {
+		if x.namespace(c, prefix(c.Name())) == rngNamespace {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func (x *xmlParser) attribute(n *tree.Node, name string) string {
+	v, ok := n.Attribute(name)
+	if !ok {
+		x.errorf(n, "missing %s attribute on <%s>", name, local(n))
+	}
+	return strings.TrimSpace(v)
+}
+
+func (x *xmlParser) qname(n *tree.Node, name string) qname {
+	name = strings.TrimSpace(name)
+	if p := prefix(name); p != "" {
+		ns := x.namespace(n, p)
+		if ns == "" {
+			x.errorf(n, "undeclared namespace prefix %s", p)
+		}
+		return qname{ns, name[len(p)+1:]}
+	}
+	return qname{x.inherited(n, "ns"), name}
+}
+
+func fold(kind patternKind, patterns []*pattern) *pattern {
+	p := patterns[0]
+	for _, q := range patterns[1:] {
+		p = newPattern(kind, p, q)
+	}
+	return p
+}
+
+// patterns parses the child patterns of n.
+func (x *xmlParser) patterns(n *tree.Node, children []*tree.Node) []*pattern {
+	if len(children) == 0 {
+		x.errorf(n, "<%s> must contain a pattern", local(n))
+		return []*pattern{notAllowed}
+	}
+	r := []*pattern{}
+	for _, c := range children {
+		r = append(r, x.pattern(c))
+	}
+	return r
+}
+
+func (x *xmlParser) pattern(n *tree.Node) *pattern {
+	children := x.children(n)
+
+	switch kind := local(n); kind {
+	case "element", "attribute":
+		p := &pattern{kind: elementPattern}
+		if kind == "attribute" {
+			p.kind = attributePattern
+		}
+		if name, ok := n.Attribute("name"); ok {
+			q := x.qname(n, name)
+			if _, ok := n.Attribute("ns"); kind == "attribute" && !ok && prefix(name) == "" {
+				q.ns = ""
+			}
+			p.name = &nameClass{kind: nameNameClass, ns: q.ns, local: q.local}
+		} else if len(children) > 0 {
+			p.name = x.nameClass(children[0])
+			children = children[1:]
+		} else {
+			return x.errorf(n, "missing name of <%s>", kind)
+		}
+		if kind == "attribute" && len(children) == 0 {
+			p.p1 = text
+		} else {
+			p.p1 = fold(groupPattern, x.patterns(n, children))
+		}
+		return p
+	case "group":
+		return fold(groupPattern, x.patterns(n, children))
+	case "interleave":
+		return fold(interleavePattern, x.patterns(n, children))
+	case "choice":
+		return fold(choicePattern, x.patterns(n, children))
+	case "optional":
+		return newPattern(choicePattern, fold(groupPattern, x.patterns(n, children)), empty)
+	case "zeroOrMore":
+		return newPattern(choicePattern, newPattern(oneOrMorePattern, fold(groupPattern, x.patterns(n, children)), nil), empty)
+	case "oneOrMore":
+		return newPattern(oneOrMorePattern, fold(groupPattern, x.patterns(n, children)), nil)
+	case "list":
+		return newPattern(listPattern, fold(groupPattern, x.patterns(n, children)), nil)
+	case "mixed":
+		return newPattern(interleavePattern, fold(groupPattern, x.patterns(n, children)), text)
+	case "ref", "parentRef":
+		g := x.grammar
+		if kind == "parentRef" && g != nil {
+			g = g.parent
+		}
+		if g == nil {
+			return x.errorf(n, "<%s> outside of grammar", kind)
+		}
+		return x.b.ref(g, x.attribute(n, "name"), x.src, n.Offset())
+	case "empty":
+		return empty
+	case "text":
+		return text
+	case "notAllowed":
+		return notAllowed
+	case "value":
+		library, name := "", "token"
+		if t, ok := n.Attribute("type"); ok {
+			library, name = x.inherited(n, "datatypeLibrary"), strings.TrimSpace(t)
+		}
+		dt, err := x.b.datatype(library, name, nil)
+		if err != nil {
+			return x.errorf(n, "%s", err)
+		}
+		return &pattern{kind: valuePattern, datatype: dt, value: n.Text()}
+	case "data":
+		params := []xsd.Param{}
+		p := &pattern{kind: dataPattern}
+		for _, c := range children {
+			switch local(c) {
+			case "param":
+				params = append(params, xsd.Param{Name: x.attribute(c, "name"), Value: c.Text()})
+			case "except":
+				p.except = fold(choicePattern, x.patterns(c, x.children(c)))
+			default:
+				return x.errorf(c, "unexpected <%s> in <data>", local(c))
+			}
+		}
+		dt, err := x.b.datatype(x.inherited(n, "datatypeLibrary"), x.attribute(n, "type"), params)
+		if err != nil {
+			return x.errorf(n, "%s", err)
+		}
+		p.datatype = dt
+		return p
+	case "externalRef":
+		s, location, err := x.b.load(x.src, x.attribute(n, "href"))
+		if err != nil {
+			return x.errorf(n, "%s", err)
+		}
+		p, err := x.b.parse(s, location, x.inherited(n, "ns"), nil, nil)
+		if err != nil {
+			if x.err == nil {
+				x.err = err
+			}
+			return notAllowed
+		}
+		return p
+	case "grammar":
+		outer := x.grammar
+		x.grammar = newGrammar(outer)
+		defer func() { x.grammar = outer }()
+		x.grammarContent(n, nil)
+		return x.b.ref(x.grammar, "", x.src, n.Offset())
+	default:
+		return x.errorf(n, "unexpected <%s>", kind)
+	}
+}
+
+// definitions adds the names of the definitions in n to names.
+func (x *xmlParser) definitions(n *tree.Node, names map[string]bool) {
+	for _, c := range x.children(n) {
+		switch local(c) {
+		case "start":
+			names[""] = true
+		case "define":
+			v, _ := c.Attribute("name")
+			names[strings.TrimSpace(v)] = true
+		case "div":
+			x.definitions(c, names)
+		}
+	}
+}
+
+// grammarContent reads the definitions in n, skipping the overridden ones.
+func (x *xmlParser) grammarContent(n *tree.Node, overrides map[string]bool) {
+	for _, c := range x.children(n) {
+		if x.err != nil {
+			return
+		}
+		switch kind := local(c); kind {
+		case "start", "define":
+			name := ""
+			if kind == "define" {
+				name = x.attribute(c, "name")
+			}
+			if overrides[name] {
+				continue
+			}
+			combine, _ := c.Attribute("combine")
+			p := fold(groupPattern, x.patterns(c, x.children(c)))
+			if msg := x.b.define(x.grammar, name, strings.TrimSpace(combine), p); msg != "" {
+				x.errorf(c, "%s", msg)
+			}
+		case "div":
+			x.grammarContent(c, overrides)
+		case "include":
+			s, location, err := x.b.load(x.src, x.attribute(c, "href"))
+			if err != nil {
+				x.errorf(c, "%s", err)
+				return
+			}
+			names := map[string]bool{}
+			for name := range overrides {
+				names[name] = true
+			}
+			x.definitions(c, names)
+			if _, err := x.b.parse(s, location, x.inherited(c, "ns"), x.grammar, names); err != nil {
+				x.err = err
+				return
+			}
+			x.grammarContent(c, overrides)
+		default:
+			x.errorf(c, "unexpected <%s> in grammar", kind)
+		}
+	}
+}
+
+func (x *xmlParser) nameClass(n *tree.Node) *nameClass {
+	except := func() *nameClass {
+		for _, c := range x.children(n) {
+			if local(c) != "except" {
+				x.errorf(c, "unexpected <%s> in <%s>", local(c), local(n))
+				continue
+			}
+			return x.nameClassChoice(c, x.children(c))
+		}
+		return nil
+	}
+
+	switch kind := local(n); kind {
+	case "name":
+		q := x.qname(n, n.Text())
+		return &nameClass{kind: nameNameClass, ns: q.ns, local: q.local}
+	case "anyName":
+		return &nameClass{kind: anyNameClass, except: except()}
+	case "nsName":
+		return &nameClass{kind: nsNameClass, ns: x.inherited(n, "ns"), except: except()}
+	case "choice":
+		return x.nameClassChoice(n, x.children(n))
+	default:
+		x.errorf(n, "unexpected <%s> in name class", kind)
+		return &nameClass{kind: anyNameClass}
+	}
+}
+
+func (x *xmlParser) nameClassChoice(n *tree.Node, children []*tree.Node) *nameClass {
+	if len(children) == 0 {
+		x.errorf(n, "<%s> must contain a name class", local(n))
+		return &nameClass{kind: anyNameClass}
+	}
+	nc := x.nameClass(children[0])
+	for _, c := range children[1:] {
+		nc = &nameClass{kind: choiceNameClass, c1: nc, c2: x.nameClass(c)}
+	}
+	return nc
+}
@@ -0,0 +1,185 @@
+package sanitize
+
+// SVG returns a policy for static SVG images. Scripts, foreign objects,
+// animations setting arbitrary attributes and event handlers are not allowed.
+// Links may use http, https and mailto URLs, images may additionally be PNG,
+// JPEG, GIF or WebP data URLs. All other references must be local.
+func SVG() *Policy {
+	return &Policy{
+		Elements: map[string][]string{
+			"svg":                 {"version", "baseProfile", "width", "height", "x", "y", "viewBox", "preserveAspectRatio"},
+			"g":                   nil,
+			"defs":                nil,
+			"symbol":              {"viewBox", "preserveAspectRatio", "refX", "refY"},
+			"use":                 nil,
+			"image":               {"preserveAspectRatio"},
+			"switch":              nil,
+			"desc":                nil,
+			"title":               nil,
+			"metadata":            nil,
+			"a":                   {"target"},
+			"view":                {"viewBox", "preserveAspectRatio"},
+			"circle":              {"pathLength"},
+			"ellipse":             {"pathLength"},
+			"line":                {"pathLength"},
+			"path":                {"pathLength"},
+			"polygon":             {"pathLength"},
+			"polyline":            {"pathLength"},
+			"rect":                {"pathLength"},
+			"text":                {"lengthAdjust", "textLength"},
+			"tspan":               {"lengthAdjust", "textLength"},
+			"textPath":            {"lengthAdjust", "textLength", "method", "spacing", "startOffset", "side", "path"},
+			"linearGradient":      {"gradientUnits", "gradientTransform", "spreadMethod", "x1", "y1", "x2", "y2"},
+			"radialGradient":      {"gradientUnits", "gradientTransform", "spreadMethod", "fr", "fx", "fy"},
+			"stop":                {"offset"},
+			"pattern":             {"patternUnits", "patternContentUnits", "patternTransform", "viewBox", "preserveAspectRatio"},
+			"clipPath":            {"clipPathUnits"},
+			"mask":                {"maskUnits", "maskContentUnits"},
+			"marker":              {"markerUnits", "markerWidth", "markerHeight", "orient", "refX", "refY", "viewBox", "preserveAspectRatio"},
+			"filter":              {"filterUnits", "primitiveUnits"},
+			"feBlend":             {"mode", "in2"},
+			"feColorMatrix":       {"type", "values"},
+			"feComponentTransfer": nil,
+			"feComposite":         {"operator", "in2", "k1", "k2", "k3", "k4"},
+			"feConvolveMatrix":    {"order", "kernelMatrix", "divisor", "bias", "targetX", "targetY", "edgeMode", "preserveAlpha"},
+			"feDiffuseLighting":   {"surfaceScale", "diffuseConstant", "kernelUnitLength"},
+			"feDisplacementMap":   {"scale", "xChannelSelector", "yChannelSelector", "in2"},
+			"feDistantLight":      {"azimuth", "elevation"},
+			"feDropShadow":        {"dx", "dy", "stdDeviation"},
+			"feFlood":             nil,
+			"feFuncA":             {"type", "tableValues", "slope", "intercept", "amplitude", "exponent", "offset"},
+			"feFuncB":             {"type", "tableValues", "slope", "intercept", "amplitude", "exponent", "offset"},
+			"feFuncG":             {"type", "tableValues", "slope", "intercept", "amplitude", "exponent", "offset"},
+			"feFuncR":             {"type", "tableValues", "slope", "intercept", "amplitude", "exponent", "offset"},
+			"feGaussianBlur":      {"stdDeviation", "edgeMode"},
+			"feImage":             {"preserveAspectRatio"},
+			"feMerge":             nil,
+			"feMergeNode":         nil,
+			"feMorphology":        {"operator", "radius"},
+			"feOffset":            {"dx", "dy"},
+			"fePointLight":        {"z"},
+			"feSpecularLighting":  {"surfaceScale", "specularConstant", "specularExponent", "kernelUnitLength"},
+			"feSpotLight":         {"z", "pointsAtX", "pointsAtY", "pointsAtZ", "specularExponent", "limitingConeAngle"},
+			"feTile":              nil,
+			"feTurbulence":        {"baseFrequency", "numOctaves", "seed", "stitchTiles", "type"},
+			"style":               {"type", "media"},
+			"animateTransform":    {"attributeName", "type", "from", "to", "by", "values", "begin", "dur", "end", "repeatCount", "repeatDur", "fill", "calcMode", "keyTimes", "keySplines", "additive", "accumulate"},
+			"animateMotion":       {"path", "keyPoints", "rotate", "from", "to", "by", "values", "begin", "dur", "end", "repeatCount", "repeatDur", "fill", "calcMode", "keyTimes", "keySplines", "additive", "accumulate"},
+			"mpath":               nil,
+		},
+		GlobalAttributes: []string{
+			"id", "class", "style", "lang", "tabindex", "xmlns", "xmlns:xlink", "xml:space", "xml:lang",
+			"href", "xlink:href", "xlink:title", "requiredExtensions", "systemLanguage",
+			"x", "y", "width", "height", "cx", "cy", "r", "rx", "ry", "x1", "y1", "x2", "y2",
+			"d", "points", "dx", "dy", "rotate", "transform", "transform-origin", "in", "result",
+			"alignment-baseline", "baseline-shift", "clip", "clip-path", "clip-rule", "color",
+			"color-interpolation", "color-interpolation-filters", "color-rendering", "direction",
+			"display", "dominant-baseline", "fill", "fill-opacity", "fill-rule", "filter",
+			"flood-color", "flood-opacity", "font-family", "font-size", "font-size-adjust",
+			"font-stretch", "font-style", "font-variant", "font-weight", "image-rendering",
+			"letter-spacing", "lighting-color", "marker-end", "marker-mid", "marker-start", "mask",
+			"opacity", "overflow", "paint-order", "pointer-events", "shape-rendering", "stop-color",
+			"stop-opacity", "stroke", "stroke-dasharray", "stroke-dashoffset", "stroke-linecap",
+			"stroke-linejoin", "stroke-miterlimit", "stroke-opacity", "stroke-width", "text-anchor",
+			"text-decoration", "text-rendering", "unicode-bidi", "vector-effect", "visibility",
+			"word-spacing", "writing-mode",
+		},
+		URLAttributes: []string{"href", "xlink:href"},
+		Schemes: map[string][]string{
+			"a":     {"http", "https", "mailto"},
+			"image": {"http", "https", "data:image/png;", "data:image/jpeg;", "data:image/gif;", "data:image/webp;"},
+		},
+		CDATA: true,
+	}
+}
+
+// XHTML returns a policy for formatted text in XHTML documents, like
+// comments written by users. Scripts, forms, embedded content other than
+// images and event handlers are not allowed.
+func XHTML() *Policy {
+	return &Policy{
+		Elements: map[string][]string{
+			"html":       nil,
+			"head":       nil,
+			"title":      nil,
+			"body":       nil,
+			"style":      {"type", "media"},
+			"div":        nil,
+			"span":       nil,
+			"p":          nil,
+			"br":         nil,
+			"hr":         nil,
+			"h1":         nil,
+			"h2":         nil,
+			"h3":         nil,
+			"h4":         nil,
+			"h5":         nil,
+			"h6":         nil,
+			"address":    nil,
+			"article":    nil,
+			"aside":      nil,
+			"footer":     nil,
+			"header":     nil,
+			"main":       nil,
+			"nav":        nil,
+			"section":    nil,
+			"figure":     nil,
+			"figcaption": nil,
+			"blockquote": {"cite"},
+			"pre":        nil,
+			"ul":         nil,
+			"ol":         {"start", "reversed", "type"},
+			"li":         {"value"},
+			"dl":         nil,
+			"dt":         nil,
+			"dd":         nil,
+			"a":          {"href", "name", "target", "rel", "hreflang", "type"},
+			"abbr":       nil,
+			"b":          nil,
+			"bdi":        nil,
+			"bdo":        nil,
+			"cite":       nil,
+			"code":       nil,
+			"data":       {"value"},
+			"del":        {"cite", "datetime"},
+			"dfn":        nil,
+			"em":         nil,
+			"i":          nil,
+			"ins":        {"cite", "datetime"},
+			"kbd":        nil,
+			"mark":       nil,
+			"q":          {"cite"},
+			"s":          nil,
+			"samp":       nil,
+			"small":      nil,
+			"strong":     nil,
+			"sub":        nil,
+			"sup":        nil,
+			"time":       {"datetime"},
+			"u":          nil,
+			"var":        nil,
+			"wbr":        nil,
+			"img":        {"src", "alt", "width", "height"},
+			"table":      {"summary"},
+			"caption":    nil,
+			"colgroup":   {"span"},
+			"col":        {"span"},
+			"thead":      nil,
+			"tbody":      nil,
+			"tfoot":      nil,
+			"tr":         nil,
+			"th":         {"colspan", "rowspan", "headers", "scope", "abbr"},
+			"td":         {"colspan", "rowspan", "headers"},
+		},
+		GlobalAttributes: []string{"id", "class", "style", "title", "lang", "xml:lang", "dir", "xmlns"},
+		URLAttributes:    []string{"href", "src", "cite"},
+		Schemes: map[string][]string{
+			"a":          {"http", "https", "mailto"},
+			"img":        {"http", "https", "data:image/png;", "data:image/jpeg;", "data:image/gif;", "data:image/webp;"},
+			"blockquote": {"http", "https"},
+			"q":          {"http", "https"},
+			"del":        {"http", "https"},
+			"ins":        {"http", "https"},
+		},
+	}
+}
@@ -0,0 +1,331 @@
+// Package sanitize removes everything not explicitly allowed by a policy from
+// untrusted documents, like SVG files uploaded by users. Allowed markup is
+// kept byte by byte, disallowed elements are removed together with their
+// content and disallowed attributes are cut out of their elements.
+//
+// Besides the allowed elements and attributes, policies restrict the URLs
+// used in attributes. After resolving character references, URLs may only
+// reference fragments of the document itself (#id), unless schemes are
+// allowed for the element. Styles in style attributes and elements, as well
+// as other attribute values using url(), may only reference fragments, CSS
+// escapes, expressions and imports are not allowed.
+//
+// Directives, like document type declarations, and processing instructions
+// other than the XML declaration at the start of the document are always
+// removed.
+package sanitize
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Policy lists what is allowed in a document.
+type Policy struct {
+	// Elements maps the names of allowed elements to the attributes
+	// allowed on them in addition to GlobalAttributes.
+	Elements         map[string][]string
+	GlobalAttributes []string
+	// URLAttributes lists attributes containing URLs.
+	URLAttributes []string
+	// Schemes maps elements to the URL schemes allowed for them. Entries
+	// containing a colon are matched as prefix of the URL, e.g.
+	// "data:image/png;". URLs of elements listed here may also be relative,
+	// elements not listed may only reference fragments.
+	Schemes map[string][]string
+	// Comments keeps comments, which do not contain `--`.
+	Comments bool
+	// CDATA keeps CDATA sections, otherwise their content is escaped. Use
+	// this only for documents not parsed as HTML.
+	CDATA bool
+}
+
+// String returns the sanitized document.
+func String(input string, p *Policy) string {
+	buf := strings.Builder{}
+	Write(&buf, gockl.New(input), p)
+	return buf.String()
+}
+
+// Write writes the remaining tokens of z to w, as far as they are allowed by
+// p. Unclosed elements are closed at the end.
+func Write(w io.Writer, z *gockl.Tokenizer, p *Policy) error {
+	s := &sanitizer{p: p, attributes: map[string]map[string]bool{}}
+	for name, attrs := range p.Elements {
+		s.attributes[name] = set(p.GlobalAttributes, attrs)
+	}
+	s.urls = set(p.URLAttributes)
+
+	buf := &strings.Builder{}
+	stack := []string{}
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		raw := span.Raw(z.Input)
+
+		switch span.Kind {
+		case gockl.TextKind:
+			// the tokenizer treats a few bytes at the end of the input as
+			// text even if they look like markup
+			buf.WriteString(strings.Replace(raw, "<", "&lt;", -1))
+		case gockl.CDATAKind:
+			if p.CDATA {
+				buf.WriteString(raw)
+			} else {
+				content, _ := gockl.CDATAToken(raw).Content()
+				buf.WriteString(gockl.EscapeText(content))
+			}
+		case gockl.CommentKind:
+			content, ok := gockl.CommentToken(raw).Content()
+			if p.Comments && ok && !strings.Contains(content, "--") && !strings.HasPrefix(content, ">") && !strings.HasPrefix(content, "->") {
+				buf.WriteString(raw)
+			}
+		case gockl.ProcInstKind:
+			if span.Start == 0 && declaration(raw) {
+				buf.WriteString(raw)
+			}
+		case gockl.StartElementKind, gockl.EmptyElementKind:
+			t := span.Token(z.Input).(gockl.StartOrEmptyElementToken)
+			start, ok := s.element(t, raw, span.Kind == gockl.EmptyElementKind)
+			if ok && span.Kind == gockl.StartElementKind && local(t.Name()) == "style" {
+				// styles are checked as a whole
+				rest, err := z.CaptureElement()
+				if err == nil && s.style(rest[len(raw):]) {
+					buf.WriteString(start + rest[len(raw):])
+				}
+				continue
+			}
+			if !ok {
+				if span.Kind == gockl.StartElementKind {
+					z.SkipElement()
+				}
+				continue
+			}
+			buf.WriteString(start)
+			if span.Kind == gockl.StartElementKind {
+				stack = append(stack, t.Name())
+			}
+		case gockl.EndElementKind:
+			name := gockl.EndElementToken(raw).Name()
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i] != name {
+					continue
+				}
+				// close elements left open
+				for j := len(stack) - 1; j > i; j-- {
+					buf.WriteString("</" + stack[j] + ">")
+				}
+				buf.WriteString(raw)
+				stack = stack[:i]
+				break
+			}
+		}
+	}
+
+	for i := len(stack) - 1; i >= 0; i-- {
+		buf.WriteString("</" + stack[i] + ">")
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+// xmlDeclaration matches the pseudo-attributes of XML declarations, without
+// allowing anything HTML parsers could end a bogus comment at.
+var xmlDeclaration = regexp.MustCompile(`^(\s+(version|encoding|standalone)\s*=\s*("[\w.:-]*"|'[\w.:-]*'))*\s*$`)
+
+// declaration reports whether raw is an XML declaration.
+func declaration(raw string) bool {
+	t := gockl.ProcInstToken(raw)
+	content, ok := t.Content()
+	return ok && t.Target() == "xml" && xmlDeclaration.MatchString(content[len("xml"):])
+}
+
+func set(lists ...[]string) map[string]bool {
+	r := map[string]bool{}
+	for _, l := range lists {
+		for _, s := range l {
+			r[s] = true
+		}
+	}
+	return r
+}
+
+func local(name string) string {
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+type sanitizer struct {
+	p          *Policy
+	attributes map[string]map[string]bool
+	urls       map[string]bool
+}
+
+// element returns the start or empty element t without the attributes, which
+// are not allowed, or false if the element is not allowed at all.
+func (s *sanitizer) element(t gockl.StartOrEmptyElementToken, raw string, empty bool) (string, bool) {
+	name := t.Name()
+	allowed, ok := s.attributes[name]
+	if !ok {
+		return "", false
+	}
+
+	keep := func(a gockl.AttributeSpan) bool {
+		if !allowed[a.Name] {
+			return false
+		}
+		if s.urls[a.Name] && !s.url(name, a.Content) {
+			return false
+		}
+		// presentation attributes like fill or mask may reference URLs, too
+		value := gockl.Unescape(a.Content)
+		return (a.Name != "style" && !strings.Contains(strings.ToLower(value), "url(")) || css(value)
+	}
+
+	// everything but the name and the attributes must be whitespace and
+	// values must be quoted without containing markup, so that nothing is
+	// hidden from the tokenizer
+	buf := strings.Builder{}
+	buf.WriteString("<" + name)
+	pos := 1 + len(name)
+	valid := strings.HasPrefix(raw, "<"+name)
+	for _, a := range t.AttributeSpans() {
+		valid = valid && a.Start >= pos && strings.Trim(raw[pos:a.Start], " \t\r\n") == ""
+		valid = valid && a.Quote != 0 && !strings.ContainsRune(a.Content, '<')
+		if keep(a) && valid {
+			buf.WriteString(raw[pos:a.End])
+		}
+		pos = a.End
+	}
+	end := ">"
+	if empty {
+		end = "/>"
+	}
+	if tail := raw[pos:]; valid && strings.TrimLeft(tail, " \t\r\n") == end {
+		buf.WriteString(tail)
+		return buf.String(), true
+	}
+
+	buf.Reset()
+	buf.WriteString("<" + name)
+	for _, a := range t.AttributeSpans() {
+		if keep(a) {
+			buf.WriteString(" " + a.Name + `="` + gockl.EscapeAttribute(gockl.Unescape(a.Content), '"') + `"`)
+		}
+	}
+	buf.WriteString(end)
+	return buf.String(), true
+}
+
+// url reports whether the URL in the raw attribute value is allowed for the
+// element.
+func (s *sanitizer) url(element, value string) bool {
+	// browsers ignore whitespace and control characters in URLs
+	u := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, gockl.Unescape(value))
+
+	if strings.HasPrefix(u, "#") {
+		return true
+	}
+	schemes, ok := s.p.Schemes[element]
+	if !ok {
+		return false
+	}
+
+	// references not resolved by Unescape could hide the scheme
+	scheme := u
+	if idx := strings.IndexAny(u, "/?#"); idx > -1 {
+		scheme = u[:idx]
+	}
+	if strings.ContainsRune(scheme, '&') {
+		return false
+	}
+	idx := strings.IndexByte(scheme, ':')
+	if idx == -1 {
+		return true
+	}
+	scheme = strings.ToLower(scheme[:idx])
+	for _, allowed := range schemes {
+		if scheme == allowed || (strings.ContainsRune(allowed, ':') && strings.HasPrefix(strings.ToLower(u), allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+// style reports whether the raw content of a style element only contains
+// allowed CSS.
+func (s *sanitizer) style(content string) bool {
+	end := strings.LastIndex(content, "</")
+	if end == -1 {
+		return false
+	}
+
+	buf := strings.Builder{}
+	z := gockl.New(content[:end])
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		switch span.Kind {
+		case gockl.TextKind:
+			buf.WriteString(gockl.Unescape(span.Raw(z.Input)))
+		case gockl.CDATAKind:
+			if !s.p.CDATA {
+				return false
+			}
+			content, _ := gockl.CDATAToken(span.Raw(z.Input)).Content()
+			buf.WriteString(content)
+		default:
+			return false
+		}
+	}
+	return css(buf.String())
+}
+
+var cssForbidden = []string{"\\", "&", "<", "expression", "javascript:", "@import", "behavior", "binding", "image-set"}
+
+// css reports whether s only contains allowed CSS.
+func css(s string) bool {
+	// comments could be used to hide function names
+	for {
+		start := strings.Index(s, "/*")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(s[start+2:], "*/")
+		if end == -1 {
+			return false
+		}
+		s = s[:start] + s[start+2+end+2:]
+	}
+
+	lower := strings.ToLower(s)
+	for _, f := range cssForbidden {
+		if strings.Contains(lower, f) {
+			return false
+		}
+	}
+	for {
+		idx := strings.Index(lower, "url(")
+		if idx == -1 {
+			return true
+		}
+		lower = strings.TrimLeft(lower[idx+4:], " \t\r\n\f\"'")
+		if !strings.HasPrefix(lower, "#") {
+			return false
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sanitize
+
+import (
+	"testing"
+)
+
+const clean = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg"   width='16' viewBox="0 0 16 16" >
+  <style><![CDATA[ .a { fill: url(#g); } ]]></style>
+  <defs>
+    <linearGradient id="g"><stop offset="0" stop-color="#fff"/></linearGradient>
+    <path id="p" d="M0 0h16v16z"/>
+  </defs>
+  <use href="#p" class="a" />
+  <a href="https://example.com/?a=1&amp;b=2"><text x="1" y="12">A &lt; B</text></a>
+  <image href="data:image/png;base64,AAAA" width="1" height="1"/>
+</svg>
+`
+
+func TestClean(t *testing.T) {
+	if actual := String(clean, SVG()); actual != clean {
+		t.Errorf("Clean document modified:\n%s", actual)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	for input, expected := range map[string]string{
+		`<svg><script>alert(1)</script><g/></svg>`:                                                                       `<svg><g/></svg>`,
+		`<svg><foreignObject><div><svg/></div></foreignObject></svg>`:                                                    `<svg></svg>`,
+		`<svg><SCRIPT>alert(1)</SCRIPT></svg>`:                                                                           `<svg></svg>`,
+		`<svg onload="alert(1)" width="1"><g  onclick='x()'/></svg>`:                                                     `<svg width="1"><g/></svg>`,
+		`<svg><a href="javascript:alert(1)">x</a></svg>`:                                                                 `<svg><a>x</a></svg>`,
+		`<svg><a href="&#106;avascript:alert(1)">x</a></svg>`:                                                            `<svg><a>x</a></svg>`,
+		`<svg><a href="&#106avascript:alert(1)">x</a></svg>`:                                                             `<svg><a>x</a></svg>`,
+		`<svg><a href="java&#x09;script:alert(1)">x</a></svg>`:                                                           `<svg><a>x</a></svg>`,
+		`<svg><a href=" JavaScript&colon;alert(1)">x</a></svg>`:                                                          `<svg><a>x</a></svg>`,
+		`<svg><a href="mailto:a@example.com">x</a></svg>`:                                                                `<svg><a href="mailto:a@example.com">x</a></svg>`,
+		`<svg><a href="page.html">x</a></svg>`:                                                                           `<svg><a href="page.html">x</a></svg>`,
+		`<svg><use href="https://example.com/a.svg#x"/><use xlink:href="#x"/></svg>`:                                     `<svg><use/><use xlink:href="#x"/></svg>`,
+		`<svg><use href="a.svg#x"/></svg>`:                                                                               `<svg><use/></svg>`,
+		`<svg><image href="data:image/svg+xml;base64,AAAA"/></svg>`:                                                      `<svg><image/></svg>`,
+		`<svg><animate attributeName="href" to="javascript:alert(1)"/></svg>`:                                            `<svg></svg>`,
+		`<svg><rect style="fill: url(https://example.com/)"/></svg>`:                                                     `<svg><rect/></svg>`,
+		`<svg><rect style="fill: url(#a)"/></svg>`:                                                                       `<svg><rect style="fill: url(#a)"/></svg>`,
+		`<svg><rect fill="url(https://evil.example/p.svg#a)" mask="url(http://x/m.svg#m)" filter="url(//x/f#f)"/></svg>`: `<svg><rect/></svg>`,
+		`<svg><path clip-path="URL(x.svg#c)" marker-start="url( 'x#m' )" marker-end="u&#114;l(x#m)"/></svg>`:             `<svg><path/></svg>`,
+		`<svg><rect fill="url(#g) red" stroke="blue" marker-mid="url('#m')"/></svg>`:                                     `<svg><rect fill="url(#g) red" stroke="blue" marker-mid="url('#m')"/></svg>`,
+		`<svg><style>@import "https://example.com/a.css";</style></svg>`:                                                 `<svg></svg>`,
+		`<svg><style>a { b: ex/**/pression(1) }</style></svg>`:                                                           `<svg></svg>`,
+		`<svg><style><g/></style></svg>`:                                                                                 `<svg></svg>`,
+		`<!DOCTYPE svg [<!ENTITY a "b">]><?php x ?><!-- x --><svg/>`:                                                     `<svg/>`,
+		`<svg><g><rect></svg>`:                                 `<svg><g><rect></rect></g></svg>`,
+		"<svg></g><g>\n":                                       "<svg><g>\n</g></svg>",
+		`<svg width="1"onload="x()">`:                          `<svg width="1"></svg>`,
+		`<svg><g id=a"b></g></svg>`:                            `<svg><g id="a&quot;b&gt;&lt;/g&gt;&lt;/svg"></g></svg>`,
+		`<svg><g id=a"b><script>alert(1)</script>"></g></svg>`: `<svg><g id="a&quot;b&gt;&lt;script&gt;alert(1)&lt;/script&gt;&quot;"></g></svg>`,
+	} {
+		if actual := String(input, SVG()); actual != expected {
+			t.Errorf("Unexpected result for %s:\n%s", input, actual)
+		}
+	}
+}
+
+func TestXHTML(t *testing.T) {
+	for input, expected := range map[string]string{
+		`<p>Hi <b>there</b>!</p>`: `<p>Hi <b>there</b>!</p>`,
+		`<p><iframe src="x"></iframe><img src="a.png" onerror="x()"/></p>`: `<p><img src="a.png"/></p>`,
+		`<p><img src="vbscript:x"/><img src="data:text/html,x"/></p>`:      `<p><img/><img/></p>`,
+		`<blockquote cite="ftp://example.com/">x</blockquote>`:             `<blockquote>x</blockquote>`,
+		`<p><![CDATA[<script>x</script>]]></p>`:                            `<p>&lt;script&gt;x&lt;/script&gt;</p>`,
+		`<p title="a">x</p><svg><g/></svg>`:                                `<p title="a">x</p>`,
+		`<div><?xml foo="><img src=x onerror=alert(1)>"?></div>`:           `<div></div>`,
+		`<?xml version="1.0"?><p>x</p><?xml version="1.0"?>`:               `<?xml version="1.0"?><p>x</p>`,
+		`<?xml version="1.0" foo="><img src=x onerror=alert(1)>"?><p/>`:    `<p/>`,
+		`<?xml version="1.0><img src=x onerror=alert(1)>"?><p/>`:           `<p/>`,
+	} {
+		if actual := String(input, XHTML()); actual != expected {
+			t.Errorf("Unexpected result for %s:\n%s", input, actual)
+		}
+	}
+}
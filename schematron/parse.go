@@ -0,0 +1,192 @@
+package schematron
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/tree"
+)
+
+var namespaces = map[string]bool{
+	"http://purl.oclc.org/dsdl/schematron": true,
+	"http://www.ascc.net/xml/schematron":   true,
+}
+
+// ignored lists the elements that do not change the checks.
+var ignored = map[string]bool{
+	"title":       true,
+	"p":           true,
+	"ns":          true,
+	"phase":       true,
+	"diagnostics": true,
+}
+
+type parser struct {
+	input  string
+	schema *Schema
+}
+
+func (p *parser) errorf(n *tree.Node, format string, args ...interface{}) error {
+	return fmt.Errorf("schematron: %s: %s", gockl.Locate(p.input, n.Offset()), fmt.Sprintf(format, args...))
+}
+
+// Parse compiles a schema written in ISO Schematron. Supported are patterns,
+// rules, asserts and reports, whose messages may use name and value-of.
+// Phases are ignored, all patterns are active. Abstract rules, variables
+// and diagnostics are not supported.
+func Parse(s string) (*Schema, error) {
+	doc, err := tree.ParseString(s)
+	if err != nil {
+		return nil, fmt.Errorf("schematron: %s", err)
+	}
+	p := &parser{input: s, schema: &Schema{}}
+	if doc.Root == nil || local(doc.Root) != "schema" || !namespaces[namespace(doc.Root)] {
+		return nil, fmt.Errorf("schematron: missing schema element")
+	}
+
+	for _, c := range p.children(doc.Root) {
+		switch local(c) {
+		case "pattern":
+			if err := p.pattern(c); err != nil {
+				return nil, err
+			}
+		default:
+			if !ignored[local(c)] {
+				return nil, p.errorf(c, "unsupported element <%s>", c.Name())
+			}
+		}
+	}
+	return p.schema, nil
+}
+
+func local(n *tree.Node) string {
+	name := n.Name()
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+func namespace(n *tree.Node) string {
+	attr := "xmlns"
+	if idx := strings.IndexByte(n.Name(), ':'); idx > -1 {
+		attr += ":" + n.Name()[:idx]
+	}
+	for ; n != nil; n = n.Parent {
+		if ns, ok := n.Attribute(attr); ok {
+			return ns
+		}
+	}
+	return ""
+}
+
+// children returns the child elements in the Schematron namespace.
+func (p *parser) children(n *tree.Node) []*tree.Node {
+	r := []*tree.Node{}
+	for _, c := range n.Elements() {
+		if namespaces[namespace(c)] {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func (p *parser) pattern(n *tree.Node) error {
+	if _, ok := n.Attribute("abstract"); ok {
+		return p.errorf(n, "abstract patterns are not supported")
+	}
+	rules := []*rule{}
+	for _, c := range p.children(n) {
+		switch local(c) {
+		case "rule":
+			r, err := p.rule(c)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, r)
+		default:
+			if !ignored[local(c)] {
+				return p.errorf(c, "unsupported element <%s>", c.Name())
+			}
+		}
+	}
+	p.schema.patterns = append(p.schema.patterns, rules)
+	return nil
+}
+
+func (p *parser) rule(n *tree.Node) (*rule, error) {
+	context, ok := n.Attribute("context")
+	if !ok {
+		return nil, p.errorf(n, "missing context attribute on <%s>", n.Name())
+	}
+	q, err := compileContext(context)
+	if err != nil {
+		return nil, p.errorf(n, "%s", err)
+	}
+	r := &rule{context: q}
+
+	for _, c := range p.children(n) {
+		switch local(c) {
+		case "assert", "report":
+			test, ok := c.Attribute("test")
+			if !ok {
+				return nil, p.errorf(c, "missing test attribute on <%s>", c.Name())
+			}
+			message, err := p.message(c)
+			if err != nil {
+				return nil, err
+			}
+			id, _ := c.Attribute("id")
+			cc, err := compileCheck(Check{ID: id, Test: test, Report: local(c) == "report", Message: message})
+			if err != nil {
+				return nil, p.errorf(c, "%s", err)
+			}
+			r.checks = append(r.checks, cc)
+		default:
+			if !ignored[local(c)] {
+				return nil, p.errorf(c, "unsupported element <%s>", c.Name())
+			}
+		}
+	}
+	return r, nil
+}
+
+// message converts the content of an assert or report to a message with
+// expressions in curly braces.
+func (p *parser) message(n *tree.Node) (string, error) {
+	buf := strings.Builder{}
+	var walk func(n *tree.Node) error
+	walk = func(n *tree.Node) error {
+		for _, c := range n.Children {
+			switch {
+			case c.Kind() == gockl.TextKind || c.Kind() == gockl.CDATAKind:
+				s := c.Text()
+				s = strings.Replace(s, "{", "{{", -1)
+				s = strings.Replace(s, "}", "}}", -1)
+				buf.WriteString(s)
+			case !c.IsElement():
+			case namespaces[namespace(c)] && local(c) == "name":
+				if _, ok := c.Attribute("path"); ok {
+					return p.errorf(c, "path attribute on <%s> is not supported", c.Name())
+				}
+				buf.WriteString("{name()}")
+			case namespaces[namespace(c)] && local(c) == "value-of":
+				sel, ok := c.Attribute("select")
+				if !ok {
+					return p.errorf(c, "missing select attribute on <%s>", c.Name())
+				}
+				buf.WriteString("{" + sel + "}")
+			default:
+				if err := walk(c); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk(n); err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(buf.String()), " "), nil
+}
@@ -0,0 +1,223 @@
+// Package schematron checks documents against rules in the style of
+// Schematron, using the expressions of the query package.
+//
+// Rules can either be written as Go values and compiled using Compile, or
+// be parsed from a subset of ISO Schematron using Parse:
+//
+//	s, err := schematron.Compile(schematron.Pattern{Rules: []schematron.Rule{{
+//		Context: "order[country != 'US']//price",
+//		Checks: []schematron.Check{{
+//			Test:    "@currency",
+//			Message: "price {.} is missing a currency",
+//		}},
+//	}}})
+//
+// Each rule selects its context nodes using a query and evaluates the tests
+// of its checks relative to them. Within a pattern, a node is only checked
+// by the first rule selecting it.
+package schematron
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/query"
+	"github.com/roblillack/gockl/tree"
+)
+
+// Pattern is a group of rules.
+type Pattern struct {
+	Rules []Rule
+}
+
+// Rule applies checks to all nodes selected by the query Context.
+type Rule struct {
+	Context string
+	Checks  []Check
+}
+
+// Check is a single assertion. By default, it fails if Test evaluates to
+// false. If Report is set, it fails if Test evaluates to true.
+//
+// The Message may contain expressions in curly braces, which are replaced by
+// their string value. Literal braces are written as {{ and }}. If there is
+// no message, the test is used to describe the failure.
+type Check struct {
+	ID      string
+	Test    string
+	Report  bool
+	Message string
+}
+
+// Error is a single failed check.
+type Error struct {
+	gockl.Location
+	// ID is the ID of the check.
+	ID string
+	// Report is set if the check is a report.
+	Report bool
+	// Node is the context node the check failed on.
+	Node *tree.Node
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Location.String() + ": " + e.Msg
+}
+
+// Schema is a compiled set of patterns.
+type Schema struct {
+	patterns [][]*rule
+}
+
+type rule struct {
+	context *query.Query
+	checks  []*check
+}
+
+type check struct {
+	Check
+	test    *query.Expr
+	message []messagePart
+}
+
+// messagePart is either literal text or an expression.
+type messagePart struct {
+	text string
+	expr *query.Expr
+}
+
+// Compile compiles patterns written as Go values.
+func Compile(patterns ...Pattern) (*Schema, error) {
+	s := &Schema{}
+	for _, p := range patterns {
+		rules := []*rule{}
+		for _, r := range p.Rules {
+			context, err := compileContext(r.Context)
+			if err != nil {
+				return nil, fmt.Errorf("schematron: %s", err)
+			}
+			compiled := &rule{context: context}
+			for _, c := range r.Checks {
+				cc, err := compileCheck(c)
+				if err != nil {
+					return nil, fmt.Errorf("schematron: %s", err)
+				}
+				compiled.checks = append(compiled.checks, cc)
+			}
+			rules = append(rules, compiled)
+		}
+		s.patterns = append(s.patterns, rules)
+	}
+	return s, nil
+}
+
+func compileContext(s string) (*query.Query, error) {
+	q, err := query.Compile(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid context %s: %s", s, strings.TrimPrefix(err.Error(), "query: "))
+	}
+	return q, nil
+}
+
+func compileCheck(c Check) (*check, error) {
+	test, err := query.CompileExpr(c.Test)
+	if err != nil {
+		return nil, fmt.Errorf("invalid test %s: %s", c.Test, strings.TrimPrefix(err.Error(), "query: "))
+	}
+	message, err := parseMessage(c.Message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message %q: %s", c.Message, strings.TrimPrefix(err.Error(), "query: "))
+	}
+	return &check{c, test, message}, nil
+}
+
+func parseMessage(s string) ([]messagePart, error) {
+	r := []messagePart{}
+	text := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{"), strings.HasPrefix(s[i:], "}}"):
+			text.WriteByte(s[i])
+			i++
+		case s[i] == '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated expression at position %d", i)
+			}
+			e, err := query.CompileExpr(s[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			if text.Len() > 0 {
+				r = append(r, messagePart{text: text.String()})
+				text.Reset()
+			}
+			r = append(r, messagePart{expr: e})
+			i += end
+		case s[i] == '}':
+			return nil, fmt.Errorf("unexpected } at position %d", i)
+		default:
+			text.WriteByte(s[i])
+		}
+	}
+	if text.Len() > 0 {
+		r = append(r, messagePart{text: text.String()})
+	}
+	return r, nil
+}
+
+func (c *check) describe(n *tree.Node) string {
+	if len(c.message) == 0 {
+		if c.Report {
+			return "report: " + c.Test
+		}
+		return "assertion failed: " + c.Test
+	}
+	buf := strings.Builder{}
+	for _, p := range c.message {
+		if p.expr != nil {
+			buf.WriteString(p.expr.Value(n))
+		} else {
+			buf.WriteString(p.text)
+		}
+	}
+	return buf.String()
+}
+
+// ValidateString parses the document in input and checks it.
+func (s *Schema) ValidateString(input string) ([]*Error, error) {
+	doc, err := tree.ParseString(input)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validate(doc), nil
+}
+
+// Validate checks doc and returns the failed checks in document order.
+func (s *Schema) Validate(doc *tree.Document) []*Error {
+	errors := []*Error{}
+	for _, rules := range s.patterns {
+		checked := map[*tree.Node]bool{}
+		for _, r := range rules {
+			for _, n := range r.context.Select(doc) {
+				if checked[n] {
+					continue
+				}
+				checked[n] = true
+				for _, c := range r.checks {
+					if c.test.Test(n) == c.Report {
+						errors = append(errors, &Error{gockl.Locate(doc.Input, n.Offset()), c.ID, c.Report, n, c.describe(n)})
+					}
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(errors, func(i, j int) bool {
+		return errors[i].Node.Offset() < errors[j].Node.Offset()
+	})
+	return errors
+}
@@ -0,0 +1,123 @@
+package schematron
+
+import (
+	"strings"
+	"testing"
+)
+
+const orders = `<orders>
+  <order id="1">
+    <country>US</country>
+    <item><price>-10</price></item>
+  </order>
+  <order id="2">
+    <country>DE</country>
+    <item><price currency="EUR">20</price></item>
+    <item><price>-5</price></item>
+  </order>
+  <order id="3"/>
+</orders>
+`
+
+const schema = `<?xml version="1.0"?>
+<sch:schema xmlns:sch="http://purl.oclc.org/dsdl/schematron">
+  <sch:title>Orders</sch:title>
+  <sch:pattern>
+    <sch:rule context="order[country != 'US']//price">
+      <sch:assert test="@currency" id="currency">
+        Price <sch:value-of select="."/> of order
+        <sch:value-of select="../../@id"/> has no {currency}.
+      </sch:assert>
+    </sch:rule>
+    <sch:rule context="price">
+      <sch:report test=". &lt; 0">Negative <sch:emph><sch:name/></sch:emph>.</sch:report>
+    </sch:rule>
+  </sch:pattern>
+  <sch:pattern>
+    <sch:rule context="order">
+      <sch:assert test="count(item) > 0"/>
+    </sch:rule>
+  </sch:pattern>
+</sch:schema>
+`
+
+func TestValidate(t *testing.T) {
+	parsed, err := Parse(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := Compile(Pattern{Rules: []Rule{
+		{
+			Context: "order[country != 'US']//price",
+			Checks:  []Check{{ID: "currency", Test: "@currency", Message: "Price {.} of order {../../@id} has no {{currency}}."}},
+		},
+		{
+			Context: "price",
+			Checks:  []Check{{Test: ". < 0", Report: true, Message: "Negative {name()}."}},
+		},
+	}}, Pattern{Rules: []Rule{
+		{Context: "order", Checks: []Check{{Test: "count(item) > 0"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"4:11: Negative price.",
+		"9:11: Price -5 of order 2 has no {currency}.",
+		"11:3: assertion failed: count(item) > 0",
+	}
+	for _, s := range []*Schema{parsed, compiled} {
+		errs, err := s.ValidateString(orders)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := []string{}
+		for _, e := range errs {
+			actual = append(actual, e.Error())
+		}
+		if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Unexpected errors:\n%s", strings.Join(actual, "\n"))
+		}
+		if len(errs) > 1 && (errs[1].ID != "currency" || errs[1].Report || errs[1].Node.Name() != "price") {
+			t.Errorf("Unexpected error: %+v", errs[1])
+		}
+	}
+
+	s, err := Compile(Pattern{Rules: []Rule{{Context: "price", Checks: []Check{{Test: ". < 0", Report: true}}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := s.ValidateString(orders)
+	if err != nil || len(errs) != 2 || errs[1].Error() != "9:11: report: . < 0" || !errs[0].Report {
+		t.Errorf("Unexpected errors: %v, %v", errs, err)
+	}
+
+	if _, err := s.ValidateString("<a>"); err == nil {
+		t.Error("Expected syntax error")
+	}
+}
+
+func TestParse(t *testing.T) {
+	const ns = ` xmlns="http://purl.oclc.org/dsdl/schematron"`
+	for input, expected := range map[string]string{
+		`<schema/>`: "schematron: missing schema element",
+		`<schema` + ns + `><pattern><rule/></pattern></schema>`:                                                        "schematron: 1:63: missing context attribute on <rule>",
+		`<schema` + ns + `><pattern><rule context="a["/></pattern></schema>`:                                           "schematron: 1:63: invalid context a[: expected step at position 2",
+		`<schema` + ns + `><pattern><rule context="a"><assert/></rule></pattern></schema>`:                             "schematron: 1:81: missing test attribute on <assert>",
+		`<schema` + ns + `><pattern><rule context="a"><assert test="foo()"/></rule></pattern></schema>`:                "schematron: 1:81: invalid test foo(): unknown function foo at position 0",
+		`<schema` + ns + `><pattern><rule context="a"><let name="x"/></rule></pattern></schema>`:                       "schematron: 1:81: unsupported element <let>",
+		`<schema` + ns + `><pattern abstract="true"/></schema>`:                                                        "schematron: 1:54: abstract patterns are not supported",
+		`<schema` + ns + `><pattern><rule context="a"><report test="1"><value-of/></report></rule></pattern></schema>`: "schematron: 1:98: missing select attribute on <value-of>",
+	} {
+		if _, err := Parse(input); err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %s, got %v", input, expected, err)
+		}
+	}
+
+	for _, message := range []string{"{", "}", "{count(}"} {
+		if _, err := Compile(Pattern{Rules: []Rule{{Context: "a", Checks: []Check{{Test: "1", Message: message}}}}}); err == nil {
+			t.Errorf("%s: expected error", message)
+		}
+	}
+}
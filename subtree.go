@@ -0,0 +1,67 @@
+package gockl
+
+import (
+	"errors"
+	"io"
+)
+
+var ErrNoElement = errors.New("gockl: last token is not a start or empty element")
+
+// SkipElement consumes all tokens up to and including the end element
+// matching the start element that was just returned by Next. If the last
+// token was an empty element, nothing is consumed.
+func (me *Tokenizer) SkipElement() error {
+	_, err := me.skipElement()
+	return err
+}
+
+// CaptureElement works like SkipElement, but returns the raw markup of the
+// complete element, starting with the start element that was just returned by
+// Next and ending with its matching end element.
+func (me *Tokenizer) CaptureElement() (string, error) {
+	start, err := me.skipElement()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+
+	return me.Input[start:me.Position], err
+}
+
+func (me *Tokenizer) skipElement() (int, error) {
+	if !me.hasPrev || me.Position != me.prev.End {
+		return 0, ErrNoElement
+	}
+
+	start := me.prev.Start
+	switch me.prev.Kind {
+	case EmptyElementKind:
+		return start, nil
+	case StartElementKind:
+	default:
+		return 0, ErrNoElement
+	}
+
+	name := StartElementToken(me.prev.Raw(me.Input)).Name()
+	depth := 1
+
+	for {
+		span, err := me.NextSpan()
+		if err != nil {
+			return start, io.ErrUnexpectedEOF
+		}
+
+		switch span.Kind {
+		case StartElementKind:
+			if StartElementToken(span.Raw(me.Input)).Name() == name {
+				depth++
+			}
+		case EndElementKind:
+			if EndElementToken(span.Raw(me.Input)).Name() == name {
+				depth--
+				if depth == 0 {
+					return start, nil
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// expr is a value, which may be compared to another one and negated.
+type expr struct {
+	not         bool
+	left, right *operand
+	op          string
+}
+
+// operand is a dotted path or a quoted string.
+type operand struct {
+	path    []string
+	literal string
+}
+
+func (e *expr) String() string {
+	s := e.left.String()
+	if e.right != nil {
+		s += " " + e.op + " " + e.right.String()
+	}
+	if e.not {
+		s = "not " + s
+	}
+	return s
+}
+
+func (o *operand) String() string {
+	if o.path == nil {
+		return strconv.Quote(o.literal)
+	}
+	return strings.Join(o.path, ".")
+}
+
+func parseExpr(s string) (*expr, error) {
+	tokens, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &expr{}
+	if len(tokens) > 0 && (tokens[0] == "not" || tokens[0] == "!") {
+		e.not = true
+		tokens = tokens[1:]
+	}
+	switch {
+	case len(tokens) == 1:
+	case len(tokens) == 3 && (tokens[1] == "==" || tokens[1] == "!="):
+		e.op = tokens[1]
+		if e.right, err = parseOperand(tokens[2]); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("invalid expression %q", strings.TrimSpace(s))
+	}
+	if e.left, err = parseOperand(tokens[0]); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func parseOperand(s string) (*operand, error) {
+	if s[0] == '"' || s[0] == '\'' {
+		return &operand{literal: s[1 : len(s)-1]}, nil
+	}
+	o := &operand{path: strings.Split(s, ".")}
+	for _, name := range o.path {
+		if name == "" || strings.ContainsAny(name, "=!") {
+			return nil, fmt.Errorf("invalid path %q", s)
+		}
+	}
+	return o, nil
+}
+
+func parseRepetition(s string, offset int) (*repetition, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 3 || fields[1] != "in" || strings.ContainsAny(fields[0], ".\"'=!") {
+		return nil, fmt.Errorf("invalid repetition %q, expected name in list", strings.TrimSpace(s))
+	}
+	list, err := parseExpr(fields[2])
+	if err != nil {
+		return nil, err
+	}
+	return &repetition{offset: offset, name: fields[0], list: list}, nil
+}
+
+// lex splits s into quoted strings, operators and everything in between.
+func lex(s string) ([]string, error) {
+	tokens := []string{}
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		switch {
+		case s == "":
+			return tokens, nil
+		case s[0] == '"' || s[0] == '\'':
+			end := strings.IndexByte(s[1:], s[0])
+			if end == -1 {
+				return nil, errors.New("unterminated string")
+			}
+			tokens = append(tokens, s[:end+2])
+			s = s[end+2:]
+		case strings.HasPrefix(s, "==") || strings.HasPrefix(s, "!="):
+			tokens = append(tokens, s[:2])
+			s = s[2:]
+		case s[0] == '!':
+			tokens = append(tokens, "!")
+			s = s[1:]
+		default:
+			end := strings.IndexAny(s, " \t\r\n\"'=!")
+			if end == -1 {
+				end = len(s)
+			}
+			tokens = append(tokens, s[:end])
+			s = s[end:]
+		}
+	}
+}
+
+// scope is the data or a variable of a repetition.
+type scope struct {
+	name   string
+	value  interface{}
+	parent *scope
+}
+
+func (e *expr) eval(s *scope) interface{} {
+	v := e.left.eval(s)
+	if e.right != nil {
+		equal := str(v) == str(e.right.eval(s))
+		v = equal == (e.op == "==")
+	}
+	if e.not {
+		return !truth(v)
+	}
+	return v
+}
+
+func (o *operand) eval(s *scope) interface{} {
+	if o.path == nil {
+		return o.literal
+	}
+
+	var v interface{}
+	for ; s != nil; s = s.parent {
+		if s.parent == nil {
+			v = lookup(s.value, o.path[0])
+		} else if s.name == o.path[0] {
+			v = s.value
+		} else {
+			continue
+		}
+		break
+	}
+	for _, name := range o.path[1:] {
+		v = lookup(v, name)
+	}
+	return v
+}
+
+func indirect(v interface{}) reflect.Value {
+	r := reflect.ValueOf(v)
+	for r.IsValid() && (r.Kind() == reflect.Ptr || r.Kind() == reflect.Interface) {
+		r = r.Elem()
+	}
+	return r
+}
+
+// lookup returns the value of a map key, struct field or list index.
+func lookup(v interface{}, name string) interface{} {
+	r := indirect(v)
+	switch r.Kind() {
+	case reflect.Map:
+		if r.Type().Key().Kind() != reflect.String {
+			return nil
+		}
+		if m := r.MapIndex(reflect.ValueOf(name).Convert(r.Type().Key())); m.IsValid() {
+			return m.Interface()
+		}
+	case reflect.Struct:
+		if f, ok := r.Type().FieldByName(name); ok && f.PkgPath == "" {
+			return r.FieldByIndex(f.Index).Interface()
+		}
+	case reflect.Slice, reflect.Array:
+		if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < r.Len() {
+			return r.Index(i).Interface()
+		}
+	}
+	return nil
+}
+
+// list returns the items of a slice, an array or the values of a map ordered
+// by their keys.
+func list(v interface{}) ([]interface{}, bool) {
+	r := indirect(v)
+	items := []interface{}{}
+	switch r.Kind() {
+	case reflect.Invalid:
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < r.Len(); i++ {
+			items = append(items, r.Index(i).Interface())
+		}
+	case reflect.Map:
+		keys := r.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			items = append(items, r.MapIndex(k).Interface())
+		}
+	default:
+		return nil, false
+	}
+	return items, true
+}
+
+func truth(v interface{}) bool {
+	r := indirect(v)
+	switch r.Kind() {
+	case reflect.Invalid:
+		return false
+	case reflect.Bool:
+		return r.Bool()
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return r.Len() > 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return r.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return r.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return r.Float() != 0
+	}
+	return true
+}
+
+func str(v interface{}) string {
+	if !indirect(v).IsValid() {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(indirect(v).Interface())
+}
@@ -0,0 +1,330 @@
+package template
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+type parser struct {
+	input string
+	z     *gockl.Tokenizer
+	// trim removes the rest of the line of a directive from the next text,
+	// trimBreak also removes the line break. trimmed is set if the line break
+	// in front of the next directive has been removed already.
+	trim, trimBreak, trimmed bool
+	// blocks is the number of directives currently parsed.
+	blocks int
+}
+
+func (p *parser) errorf(offset int, format string, args ...interface{}) error {
+	return fmt.Errorf("template: %s: %s", gockl.Locate(p.input, offset), fmt.Sprintf(format, args...))
+}
+
+// nodes parses the template up to its end, an end element closing the
+// enclosing element or an else or end directive, which is returned.
+func (p *parser) nodes(inElement bool) ([]node, gockl.Span, error) {
+	nodes := []node{}
+	depth := 0
+
+	for {
+		span, err := p.z.NextSpan()
+		if err != nil {
+			return nodes, gockl.Span{}, nil
+		}
+		raw := span.Raw(p.input)
+		trim, trimBreak, trimmed := p.trim, p.trimBreak, p.trimmed
+		p.trim, p.trimBreak, p.trimmed = false, false, false
+
+		switch span.Kind {
+		case gockl.TextKind:
+			start, end := p.trimText(span, trim, trimBreak)
+			if nodes, err = p.placeholders(nodes, p.input[start:end], start, gockl.EscapeText); err != nil {
+				return nil, span, err
+			}
+		case gockl.CDATAKind:
+			content, _ := gockl.CDATAToken(raw).Content()
+			nodes = append(nodes, literal("<![CDATA["))
+			if nodes, err = p.placeholders(nodes, content, span.Start+9, escapeCDATA); err != nil {
+				return nil, span, err
+			}
+			nodes = append(nodes, literal(raw[9+len(content):]))
+		case gockl.ProcInstKind:
+			t := gockl.ProcInstToken(raw)
+			if t.Target() != directiveTarget {
+				nodes = append(nodes, literal(raw))
+				continue
+			}
+			if _, last, ok := p.standalone(span.Start, span.End); ok && !last {
+				p.trim, p.trimBreak = true, !trimmed
+			}
+			if depth > 0 && (p.directive(t) == "else" || p.directive(t) == "end") {
+				return nil, span, p.errorf(span.Start, "unclosed element before %s", raw)
+			}
+			var n node
+			switch p.directive(t) {
+			case "else", "end":
+				return nodes, span, nil
+			case "if":
+				n, err = p.condition(span)
+			case "repeat":
+				n, err = p.repetition(span)
+			default:
+				err = p.errorf(span.Start, "unknown directive %s", raw)
+			}
+			if err != nil {
+				return nil, span, err
+			}
+			nodes = append(nodes, n)
+		case gockl.StartElementKind, gockl.EmptyElementKind:
+			t := span.Token(p.input).(gockl.StartOrEmptyElementToken)
+			start, el, err := p.start(t, span)
+			if err != nil {
+				return nil, span, err
+			}
+			if el == nil {
+				nodes = append(nodes, start...)
+				if span.Kind == gockl.StartElementKind {
+					depth++
+				}
+				continue
+			}
+
+			nodes, el.lead = lead(nodes)
+			el.body = start
+			if span.Kind == gockl.StartElementKind {
+				body, stop, err := p.nodes(true)
+				if err != nil {
+					return nil, span, err
+				}
+				if stop.Kind != gockl.EndElementKind || gockl.EndElementToken(stop.Raw(p.input)).Name() != t.Name() {
+					return nil, span, p.errorf(span.Start, "unclosed element %s", t.Name())
+				}
+				el.body = append(append(el.body, body...), literal(stop.Raw(p.input)))
+			}
+			nodes = append(nodes, el)
+		case gockl.EndElementKind:
+			if depth == 0 && inElement {
+				return nodes, span, nil
+			}
+			if depth == 0 && p.blocks > 0 {
+				return nil, span, p.errorf(span.Start, "unexpected %s in directive", raw)
+			}
+			depth--
+			nodes = append(nodes, literal(raw))
+		default:
+			nodes = append(nodes, literal(raw))
+		}
+	}
+}
+
+func (p *parser) directive(t gockl.ProcInstToken) string {
+	return strings.SplitN(strings.TrimSpace(t.Instruction()), " ", 2)[0]
+}
+
+// block parses the content of a directive up to its else or end directive.
+func (p *parser) block(span gockl.Span) ([]node, string, error) {
+	p.blocks++
+	nodes, stop, err := p.nodes(false)
+	p.blocks--
+	if err != nil {
+		return nil, "", err
+	}
+	if stop.Kind != gockl.ProcInstKind {
+		return nil, "", p.errorf(span.Start, "missing end of %s", span.Raw(p.input))
+	}
+	return nodes, p.directive(gockl.ProcInstToken(stop.Raw(p.input))), nil
+}
+
+func (p *parser) condition(span gockl.Span) (node, error) {
+	instruction := strings.TrimSpace(gockl.ProcInstToken(span.Raw(p.input)).Instruction())
+	e, err := parseExpr(strings.TrimPrefix(instruction, "if"))
+	if err != nil {
+		return nil, p.errorf(span.Start, "%s", err)
+	}
+
+	c := &condition{expr: e}
+	var stop string
+	if c.then, stop, err = p.block(span); err != nil {
+		return nil, err
+	}
+	if stop == "else" {
+		if c.els, stop, err = p.block(span); err != nil {
+			return nil, err
+		}
+	}
+	if stop != "end" {
+		return nil, p.errorf(span.Start, "missing end of %s", span.Raw(p.input))
+	}
+	return c, nil
+}
+
+func (p *parser) repetition(span gockl.Span) (node, error) {
+	instruction := strings.TrimSpace(gockl.ProcInstToken(span.Raw(p.input)).Instruction())
+	r, err := parseRepetition(strings.TrimPrefix(instruction, "repeat"), span.Start)
+	if err != nil {
+		return nil, p.errorf(span.Start, "%s", err)
+	}
+
+	var stop string
+	if r.body, stop, err = p.block(span); err != nil {
+		return nil, err
+	}
+	if stop != "end" {
+		return nil, p.errorf(span.Start, "unexpected else in %s", span.Raw(p.input))
+	}
+	return r, nil
+}
+
+// start returns the nodes of a start or empty element with placeholders in
+// its attribute values and the element directive, if it has any directive
+// attributes. These are removed together with the whitespace in front of them.
+func (p *parser) start(t gockl.StartOrEmptyElementToken, span gockl.Span) ([]node, *element, error) {
+	raw := span.Raw(p.input)
+	nodes := []node{}
+	var el *element
+	pos := 0
+	var err error
+
+	for _, a := range t.AttributeSpans() {
+		switch a.Name {
+		case ifAttribute, repeatAttribute:
+			if el == nil {
+				el = &element{}
+			}
+			if a.Name == ifAttribute {
+				el.cond, err = parseExpr(gockl.Unescape(a.Content))
+			} else {
+				el.repeat, err = parseRepetition(gockl.Unescape(a.Content), span.Start+a.Start)
+			}
+			if err != nil {
+				return nil, nil, p.errorf(span.Start+a.Start, "%s", err)
+			}
+			nodes = append(nodes, literal(strings.TrimRight(raw[pos:a.Start], " \t\r\n")))
+			pos = a.End
+			continue
+		}
+
+		if !strings.Contains(a.Content, "{{") {
+			continue
+		}
+		if a.Quote == 0 {
+			return nil, nil, p.errorf(span.Start+a.Start, "placeholder in unquoted value of %s", a.Name)
+		}
+		quote := a.Quote
+		nodes = append(nodes, literal(raw[pos:a.ValueStart]))
+		nodes, err = p.placeholders(nodes, raw[a.ValueStart:a.ValueEnd], span.Start+a.ValueStart, func(s string) string {
+			return gockl.EscapeAttribute(s, quote)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		pos = a.ValueEnd
+	}
+
+	nodes = append(nodes, literal(raw[pos:]))
+	return nodes, el, nil
+}
+
+// placeholders appends the literal parts and placeholders of raw to nodes.
+func (p *parser) placeholders(nodes []node, raw string, offset int, escape func(string) string) ([]node, error) {
+	for {
+		start := strings.Index(raw, "{{")
+		if start == -1 {
+			break
+		}
+		end := strings.Index(raw[start:], "}}")
+		if end == -1 {
+			return nil, p.errorf(offset+start, "unterminated placeholder")
+		}
+		e, err := parseExpr(raw[start+2 : start+end])
+		if err != nil {
+			return nil, p.errorf(offset+start, "%s", err)
+		}
+		if start > 0 {
+			nodes = append(nodes, literal(raw[:start]))
+		}
+		nodes = append(nodes, &placeholder{expr: e, escape: escape})
+		raw = raw[start+end+2:]
+		offset += start + end + 2
+	}
+
+	if raw != "" {
+		nodes = append(nodes, literal(raw))
+	}
+	return nodes, nil
+}
+
+// standalone reports whether the directive between start and end is the only
+// thing on its line and returns the whitespace in front of it. last is true
+// for the last line of the template.
+func (p *parser) standalone(start, end int) (before string, last bool, ok bool) {
+	before = p.input[strings.LastIndexByte(p.input[:start], '\n')+1 : start]
+	after := p.input[end:]
+	if idx := strings.IndexByte(after, '\n'); idx > -1 {
+		after = after[:idx]
+	} else {
+		last = true
+	}
+	return before, last, strings.Trim(before, " \t") == "" && strings.Trim(after, " \t\r") == ""
+}
+
+// trimText returns the start and end of the text without the parts of lines
+// containing nothing but a directive.
+func (p *parser) trimText(span gockl.Span, trim, trimBreak bool) (int, int) {
+	raw := span.Raw(p.input)
+	start, end := 0, len(raw)
+	if trim {
+		// \r belongs to the line break, which is only removed with trimBreak
+		start = len(raw) - len(strings.TrimLeft(raw, " \t"))
+	}
+	if trimBreak {
+		start += strings.IndexByte(raw[start:], '\n') + 1
+	}
+
+	next, err := p.z.Peek()
+	if err != nil || next.Kind() != gockl.ProcInstKind || gockl.ProcInstToken(next.Raw()).Target() != directiveTarget {
+		return span.Start + start, span.Start + end
+	}
+	before, last, ok := p.standalone(span.End, span.End+len(next.Raw()))
+	if ok && len(before) <= end-start {
+		end -= len(before)
+		if !last && end > start && raw[end-1] == '\n' {
+			// the line break at the end of the directive is kept instead
+			end--
+			if end > start && raw[end-1] == '\r' {
+				end--
+			}
+			p.trimmed = true
+		}
+	}
+	return span.Start + start, span.Start + end
+}
+
+// lead removes the whitespace at the end of nodes up to and including the
+// last line break.
+func lead(nodes []node) ([]node, string) {
+	l, ok := last(nodes)
+	if !ok {
+		return nodes, ""
+	}
+	s := strings.TrimRight(string(l), " \t")
+	if strings.HasSuffix(s, "\n") {
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+	}
+	nodes[len(nodes)-1] = literal(s)
+	return nodes, string(l[len(s):])
+}
+
+func last(nodes []node) (literal, bool) {
+	if len(nodes) == 0 {
+		return "", false
+	}
+	l, ok := nodes[len(nodes)-1].(literal)
+	return l, ok
+}
+
+func escapeCDATA(s string) string {
+	return strings.Replace(s, "]]>", "]]]]><![CDATA[>", -1)
+}
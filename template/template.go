@@ -0,0 +1,194 @@
+// Package template generates documents from XML templates. Values are
+// substituted into text, CDATA sections and quoted attribute values using
+// {{placeholders}} and escaped as needed. Directives repeat or remove parts of
+// the template, all other bytes of the template are kept as they are.
+//
+// Directives are either given as attributes of an element, which is repeated
+// or removed together with its content and the whitespace in front of it:
+//
+//	<li data-repeat="item in items" data-if="item.visible">{{item.name}}</li>
+//
+// Or as processing instructions surrounding any part of the template. Lines
+// containing nothing but such a processing instruction are removed:
+//
+//	<?gockl if user.admin?> … <?gockl else?> … <?gockl end?>
+//	<?gockl repeat item in items?> … <?gockl end?>
+//
+// Expressions are either dotted paths into the data, which are looked up in
+// maps and exported struct fields, or quoted strings. Two of them can be
+// compared using == and !=, the result may be negated using not. Values are
+// true, if they are not empty, zero or nil.
+package template
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Template is a parsed template.
+type Template struct {
+	input string
+	nodes []node
+}
+
+// Parse parses a template.
+func Parse(input string) (*Template, error) {
+	p := &parser{input: input, z: gockl.New(input)}
+	nodes, stop, err := p.nodes(false)
+	if err != nil {
+		return nil, err
+	}
+	if stop.Kind != gockl.InvalidKind {
+		return nil, p.errorf(stop.Start, "unexpected %s", stop.Raw(input))
+	}
+	return &Template{input: input, nodes: nodes}, nil
+}
+
+// MustParse is like Parse, but panics if the template cannot be parsed.
+func MustParse(input string) *Template {
+	t, err := Parse(input)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute writes the document generated from the template and data to w.
+func (t *Template) Execute(w io.Writer, data interface{}) error {
+	s, err := t.ExecuteString(data)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, s)
+	return err
+}
+
+// ExecuteString returns the document generated from the template and data.
+func (t *Template) ExecuteString(data interface{}) (string, error) {
+	e := &executor{input: t.input}
+	if err := e.run(t.nodes, &scope{value: data}); err != nil {
+		return "", err
+	}
+	return e.buf.String(), nil
+}
+
+const (
+	ifAttribute     = "data-if"
+	repeatAttribute = "data-repeat"
+	directiveTarget = "gockl"
+)
+
+type node interface {
+	execute(e *executor, s *scope) error
+}
+
+// literal is a part of the template written as it is.
+type literal string
+
+// placeholder is an expression, whose value is escaped and written.
+type placeholder struct {
+	expr   *expr
+	escape func(string) string
+}
+
+// condition is an if directive.
+type condition struct {
+	expr      *expr
+	then, els []node
+}
+
+// repetition is a repeat directive.
+type repetition struct {
+	offset int
+	name   string
+	list   *expr
+	body   []node
+}
+
+// element is an element with directive attributes. The whitespace in front of
+// the element is written before every repetition.
+type element struct {
+	lead   string
+	cond   *expr
+	repeat *repetition
+	body   []node
+}
+
+type executor struct {
+	input string
+	buf   strings.Builder
+}
+
+func (e *executor) run(nodes []node, s *scope) error {
+	for _, n := range nodes {
+		if err := n.execute(e, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l literal) execute(e *executor, s *scope) error {
+	e.buf.WriteString(string(l))
+	return nil
+}
+
+func (p *placeholder) execute(e *executor, s *scope) error {
+	e.buf.WriteString(p.escape(str(p.expr.eval(s))))
+	return nil
+}
+
+func (c *condition) execute(e *executor, s *scope) error {
+	if truth(c.expr.eval(s)) {
+		return e.run(c.then, s)
+	}
+	return e.run(c.els, s)
+}
+
+func (r *repetition) execute(e *executor, s *scope) error {
+	items, err := r.items(e, s)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := e.run(r.body, &scope{name: r.name, value: item, parent: s}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *repetition) items(e *executor, s *scope) ([]interface{}, error) {
+	items, ok := list(r.list.eval(s))
+	if !ok {
+		return nil, fmt.Errorf("template: %s: cannot repeat %s", gockl.Locate(e.input, r.offset), r.list)
+	}
+	return items, nil
+}
+
+func (el *element) execute(e *executor, s *scope) error {
+	write := func(s *scope) error {
+		if el.cond != nil && !truth(el.cond.eval(s)) {
+			return nil
+		}
+		e.buf.WriteString(el.lead)
+		return e.run(el.body, s)
+	}
+
+	if el.repeat == nil {
+		return write(s)
+	}
+	items, err := el.repeat.items(e, s)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := write(&scope{name: el.repeat.name, value: item, parent: s}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package template
+
+import (
+	"strings"
+	"testing"
+)
+
+const feed = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type='text'>{{ title }}</title>
+  <?gockl if author?>
+  <author><name>{{author.Name}}</name></author>
+  <?gockl end?>
+  <entry data-repeat="e in entries" data-if='not e.draft'>
+    <title>{{e.title}}</title>
+    <link  href="{{e.link}}"   rel="alternate"/>
+    <content type="html"><![CDATA[{{e.html}}]]></content>
+  </entry>
+  <!-- {{ not substituted }} -->
+</feed>
+`
+
+type author struct {
+	Name  string
+	email string
+}
+
+func TestExecute(t *testing.T) {
+	tmpl := MustParse(feed)
+	data := map[string]interface{}{
+		"title":  "Tom & Jerry",
+		"author": &author{Name: "<Tom>"},
+		"entries": []map[string]interface{}{
+			{"title": "One", "link": `/1?a="b"&c`, "html": "<p>]]></p>"},
+			{"title": "Two", "draft": true},
+			{"title": "Three", "link": "/3"},
+		},
+	}
+
+	expected := `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type='text'>Tom &amp; Jerry</title>
+  <author><name>&lt;Tom&gt;</name></author>
+  <entry>
+    <title>One</title>
+    <link  href="/1?a=&quot;b&quot;&amp;c"   rel="alternate"/>
+    <content type="html"><![CDATA[<p>]]]]><![CDATA[></p>]]></content>
+  </entry>
+  <entry>
+    <title>Three</title>
+    <link  href="/3"   rel="alternate"/>
+    <content type="html"><![CDATA[]]></content>
+  </entry>
+  <!-- {{ not substituted }} -->
+</feed>
+`
+	if actual, err := tmpl.ExecuteString(data); err != nil || actual != expected {
+		t.Errorf("Unexpected result (%v):\n%s", err, actual)
+	}
+
+	expected = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type='text'></title>
+  <!-- {{ not substituted }} -->
+</feed>
+`
+	if actual, err := tmpl.ExecuteString(nil); err != nil || actual != expected {
+		t.Errorf("Unexpected result (%v):\n%s", err, actual)
+	}
+
+	buf := strings.Builder{}
+	if err := MustParse(`<a/>`).Execute(&buf, nil); err != nil || buf.String() != `<a/>` {
+		t.Errorf("Unexpected result (%v): %s", err, buf.String())
+	}
+}
+
+func TestDirectives(t *testing.T) {
+	data := map[string]interface{}{
+		"a":     "x",
+		"b":     `'"`,
+		"n":     0,
+		"list":  []int{1, 2},
+		"map":   map[string]string{"b": "2", "a": "1"},
+		"users": []author{{Name: "a"}, {Name: "b"}},
+	}
+	for input, expected := range map[string]string{
+		`<p><?gockl if a == "x"?>yes<?gockl else?>no<?gockl end?></p>`:                                       `<p>yes</p>`,
+		`<p><?gockl if a != 'x'?>yes<?gockl else?>no<?gockl end?></p>`:                                       `<p>no</p>`,
+		`<p><?gockl if !n?>zero<?gockl end?><?gockl if n?>not zero<?gockl end?></p>`:                         `<p>zero</p>`,
+		`<p><?gockl repeat i in list?><b>{{i}}</b><?gockl end?></p>`:                                         `<p><b>1</b><b>2</b></p>`,
+		`<p><?gockl repeat v in map?>{{v}}<?gockl end?></p>`:                                                 `<p>12</p>`,
+		`<p>{{list.1}}{{users.0.Name}}{{users.0.email}}{{missing.x}}</p>`:                                    `<p>2a</p>`,
+		`<p><i data-repeat="u in users">{{u.Name}}</i></p>`:                                                  `<p><i>a</i><i>b</i></p>`,
+		`<p> <i data-repeat="u in users" data-if="u.Name == 'b'"/></p>`:                                      `<p> <i/></p>`,
+		`<p> <i data-if="missing"/></p>`:                                                                     `<p></p>`,
+		`<p data-repeat="i in list" data-if="i != a"><?gockl repeat j in list?>{{i}}{{j}} <?gockl end?></p>`: `<p>11 12 </p><p>21 22 </p>`,
+		"<ul>\n  <li data-repeat=\"i in list\">{{i}}</li>\n</ul>":                                            "<ul>\n  <li>1</li>\n  <li>2</li>\n</ul>",
+		"<ul>\n\t<?gockl repeat i in list?>\n\t<li>{{i}}</li>\n\t<?gockl end?>\n</ul>":                       "<ul>\n\t<li>1</li>\n\t<li>2</li>\n</ul>",
+		"<?gockl if a?>\n <?gockl if list?>\n x {{a}}\n <?gockl end?>\n<?gockl end?>\n<a/>":                  " x x\n<a/>",
+		"<a>\n<?gockl if a?>\n\n<?gockl end?>":                                                               "<a>\n\n",
+		"<r>\r\n  <?gockl if a?>\r\n  <x/>\r\n  <?gockl end?>\r\n</r>":                                       "<r>\r\n  <x/>\r\n</r>",
+		"<r>\r\n\t<?gockl repeat i in list?>  \r\n\t<i>{{i}}</i>\r\n\t<?gockl end?>\r\n</r>":                 "<r>\r\n\t<i>1</i>\r\n\t<i>2</i>\r\n</r>",
+		`<a x="{{a}}" y='{{b}}'><?other {{a}}?></a>`:                                                         `<a x="x" y='&apos;"'><?other {{a}}?></a>`,
+	} {
+		actual, err := MustParse(input).ExecuteString(data)
+		if err != nil || actual != expected {
+			t.Errorf("Unexpected result for %s (%v):\n%s", input, err, actual)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for input, expected := range map[string]string{
+		"<a>\n  <?gockl if a?>\n  {{a</a>":          "template: 3:3: unterminated placeholder",
+		`<a>{{a</a>`:                                "template: 1:4: unterminated placeholder",
+		`<a>{{a b}}</a>`:                            `template: 1:4: invalid expression "a b"`,
+		`<a x={{a}}/>`:                              "template: 1:4: placeholder in unquoted value of x",
+		`<a data-repeat="a">`:                       `template: 1:4: invalid repetition "a", expected name in list`,
+		`<a data-if="a">`:                           "template: 1:1: unclosed element a",
+		`<a><?gockl if a?></a><?gockl end?>`:        "template: 1:18: unexpected </a> in directive",
+		`<a><?gockl if a?><b><?gockl end?></b></a>`: "template: 1:21: unclosed element before <?gockl end?>",
+		`<a><?gockl if a?></a>`:                     "template: 1:18: unexpected </a> in directive",
+		`<?gockl if a?>`:                            "template: 1:1: missing end of <?gockl if a?>",
+		`<?gockl end?>`:                             "template: 1:1: unexpected <?gockl end?>",
+		`<?gockl repeat x in y?><?gockl else?>`:     "template: 1:1: unexpected else in <?gockl repeat x in y?>",
+		`<?gockl include x?>`:                       "template: 1:1: unknown directive <?gockl include x?>",
+		`<a data-if="a"><?gockl end?></a>`:          "template: 1:1: unclosed element a",
+		`<a><?gockl if "a?><?gockl end?></a>`:       "template: 1:4: unterminated string",
+	} {
+		if _, err := Parse(input); err == nil || err.Error() != expected {
+			t.Errorf("Unexpected error for %s: %v", input, err)
+		}
+	}
+
+	_, err := MustParse(`<a data-repeat="i in a"/>`).ExecuteString(map[string]int{"a": 1})
+	if err == nil || err.Error() != "template: 1:4: cannot repeat a" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
@@ -1,11 +1,18 @@
 package gockl
 
 import (
+	"errors"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// Token is implemented by all tokens of this package. Kind has been added to
+// the interface on purpose, so that tokens can be told apart without type
+// switches; types implementing Token outside of this package need to add it.
 type Token interface {
 	Raw() string
+	Kind() TokenKind
 }
 
 type ElementToken interface {
@@ -13,10 +20,14 @@ type ElementToken interface {
 	Name() string
 }
 
+// StartOrEmptyElementToken is implemented by start and empty element tokens.
+// AttributeSpans has been added to the interface on purpose, types
+// implementing it outside of this package need to add it.
 type StartOrEmptyElementToken interface {
 	ElementToken
 	Attributes() []Attribute
 	Attribute(name string) (string, bool)
+	AttributeSpans() []AttributeSpan
 }
 
 type TextToken string
@@ -27,6 +38,10 @@ func (t TextToken) Raw() string {
 	return string(t)
 }
 
+func (t TextToken) Kind() TokenKind {
+	return TextKind
+}
+
 type CDATAToken string
 
 var _ Token = CDATAToken("")
@@ -35,12 +50,20 @@ func (t CDATAToken) Raw() string {
 	return string(t)
 }
 
+func (t CDATAToken) Kind() TokenKind {
+	return CDATAKind
+}
+
 type CommentToken string
 
 func (t CommentToken) Raw() string {
 	return string(t)
 }
 
+func (t CommentToken) Kind() TokenKind {
+	return CommentKind
+}
+
 type DirectiveToken string
 
 var _ Token = DirectiveToken("")
@@ -49,6 +72,10 @@ func (t DirectiveToken) Raw() string {
 	return string(t)
 }
 
+func (t DirectiveToken) Kind() TokenKind {
+	return DirectiveKind
+}
+
 type ProcInstToken string
 
 var _ Token = ProcInstToken("")
@@ -57,6 +84,10 @@ func (t ProcInstToken) Raw() string {
 	return string(t)
 }
 
+func (t ProcInstToken) Kind() TokenKind {
+	return ProcInstKind
+}
+
 type StartElementToken string
 
 var _ StartOrEmptyElementToken = StartElementToken("")
@@ -65,6 +96,10 @@ func (t StartElementToken) Raw() string {
 	return string(t)
 }
 
+func (t StartElementToken) Kind() TokenKind {
+	return StartElementKind
+}
+
 func (t StartElementToken) Name() string {
 	if idx := strings.IndexAny(string(t)[1:], " \t\r\n>/"); idx > -1 {
 		return string(t)[1 : 1+idx]
@@ -84,6 +119,20 @@ func (t StartElementToken) Attribute(name string) (string, bool) {
 	return getAttribute(string(t)[1:len(t)-1], name)
 }
 
+// AttributeSpans returns the attributes of the element together with their
+// offsets inside of the raw token.
+func (t StartElementToken) AttributeSpans() []AttributeSpan {
+	return getAttributeSpans(string(t))
+}
+
+// SetAttribute returns a copy of the token with the value of the given
+// attribute replaced, or the attribute appended if it does not exist yet.
+// Unlike Attribute, names are compared case-sensitively. Everything else is
+// left untouched.
+func (t StartElementToken) SetAttribute(name, value string) StartElementToken {
+	return StartElementToken(setAttribute(string(t), name, value))
+}
+
 type EndElementToken string
 
 var _ EndElementToken = EndElementToken("")
@@ -92,12 +141,16 @@ func (t EndElementToken) Raw() string {
 	return string(t)
 }
 
+func (t EndElementToken) Kind() TokenKind {
+	return EndElementKind
+}
+
 func (t EndElementToken) Name() string {
 	if len(t) <= 2 {
 		return ""
 	}
 
-	return string(t)[2 : len(t)-1]
+	return strings.TrimRight(string(t)[2:len(t)-1], spaceChars)
 }
 
 type EmptyElementToken string
@@ -108,6 +161,10 @@ func (t EmptyElementToken) Raw() string {
 	return string(t)
 }
 
+func (t EmptyElementToken) Kind() TokenKind {
+	return EmptyElementKind
+}
+
 func (t EmptyElementToken) Name() string {
 	return StartElementToken(t).Name()
 }
@@ -119,3 +176,137 @@ func (t EmptyElementToken) Attributes() []Attribute {
 func (t EmptyElementToken) Attribute(name string) (string, bool) {
 	return getAttribute(string(t)[1:len(t)-2], name)
 }
+
+// AttributeSpans returns the attributes of the element together with their
+// offsets inside of the raw token.
+func (t EmptyElementToken) AttributeSpans() []AttributeSpan {
+	return getAttributeSpans(string(t))
+}
+
+// SetAttribute returns a copy of the token with the value of the given
+// attribute replaced, or the attribute appended if it does not exist yet.
+// Unlike Attribute, names are compared case-sensitively. Everything else is
+// left untouched.
+func (t EmptyElementToken) SetAttribute(name, value string) EmptyElementToken {
+	return EmptyElementToken(setAttribute(string(t), name, value))
+}
+
+func unwrap(raw, prefix, suffix string) (string, bool) {
+	if !strings.HasPrefix(raw, prefix) {
+		return raw, false
+	}
+
+	inner := raw[len(prefix):]
+	if strings.HasSuffix(inner, suffix) {
+		return inner[:len(inner)-len(suffix)], true
+	}
+
+	return inner, false
+}
+
+// Content returns the character data between `<![CDATA[` and `]]>` and
+// whether the section was properly terminated.
+func (t CDATAToken) Content() (string, bool) {
+	return unwrap(string(t), "<![CDATA[", "]]>")
+}
+
+// Content returns the text between `<!--` and `-->` and whether the comment
+// was properly terminated.
+func (t CommentToken) Content() (string, bool) {
+	return unwrap(string(t), "<!--", "-->")
+}
+
+// Content returns the text between `<?` and `?>` (target included) and
+// whether the processing instruction was properly terminated.
+func (t ProcInstToken) Content() (string, bool) {
+	return unwrap(string(t), "<?", "?>")
+}
+
+// Target returns the target name of the processing instruction, e.g. "xml"
+// for the XML declaration.
+func (t ProcInstToken) Target() string {
+	content, _ := t.Content()
+	if idx := strings.IndexAny(content, spaceChars); idx > -1 {
+		return content[:idx]
+	}
+	return content
+}
+
+// Instruction returns the content of the processing instruction following
+// the target and any whitespace.
+func (t ProcInstToken) Instruction() string {
+	content, _ := t.Content()
+	if idx := strings.IndexAny(content, spaceChars); idx > -1 {
+		return strings.TrimLeft(content[idx:], spaceChars)
+	}
+	return ""
+}
+
+// NewCDATA creates CDATA sections containing the given content. As `]]>`
+// cannot appear inside of a CDATA section, the content is split into multiple
+// sections where necessary.
+func NewCDATA(content string) []CDATAToken {
+	r := []CDATAToken{}
+
+	for {
+		idx := strings.Index(content, "]]>")
+		if idx == -1 {
+			break
+		}
+		r = append(r, CDATAToken("<![CDATA["+content[:idx+2]+"]]>"))
+		content = content[idx+2:]
+	}
+
+	return append(r, CDATAToken("<![CDATA["+content+"]]>"))
+}
+
+// NewComment creates a comment token with the given content. An error is
+// returned if the content contains `--` or ends with `-`, which is not
+// allowed in XML comments.
+func NewComment(content string) (CommentToken, error) {
+	if strings.Contains(content, "--") || strings.HasSuffix(content, "-") {
+		return "", errors.New("gockl: invalid comment content")
+	}
+
+	return CommentToken("<!--" + content + "-->"), nil
+}
+
+// NewProcInst creates a processing instruction token for the given target and
+// instruction. An error is returned if the target is not a valid name or the
+// instruction contains `?>`.
+func NewProcInst(target, inst string) (ProcInstToken, error) {
+	if !isName(target) {
+		return "", errors.New("gockl: invalid processing instruction target")
+	}
+	if strings.Contains(inst, "?>") {
+		return "", errors.New("gockl: invalid processing instruction content")
+	}
+
+	if inst == "" {
+		return ProcInstToken("<?" + target + "?>"), nil
+	}
+
+	return ProcInstToken("<?" + target + " " + inst + "?>"), nil
+}
+
+// isName reports whether s matches the Name production of XML.
+func isName(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for i, r := range s {
+		if r == utf8.RuneError {
+			return false
+		}
+		if r == ':' || r == '_' || unicode.IsLetter(r) {
+			continue
+		}
+		if i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r) || r == 0xB7 || unicode.Is(unicode.Mn, r)) {
+			continue
+		}
+		return false
+	}
+
+	return true
+}
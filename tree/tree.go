@@ -0,0 +1,310 @@
+// Package tree builds a lightweight element tree on top of gockl tokens. The
+// nodes only keep references into the original input, so that the raw markup
+// of every node can be recovered byte by byte.
+package tree
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Node is a single node of the tree. For elements, Start is the start or
+// empty element token and End is the matching end element token, if any. For
+// all other nodes, Start is the token itself.
+type Node struct {
+	Start    gockl.Span
+	End      gockl.Span
+	Parent   *Node
+	Children []*Node
+	input    string
+}
+
+// Document is the result of parsing a complete input.
+type Document struct {
+	Input string
+	// Nodes are the top-level nodes, including the document element.
+	Nodes []*Node
+	// Root is the document element.
+	Root *Node
+}
+
+// SyntaxError is returned if the input is not well-formed enough to be
+// turned into a tree.
+type SyntaxError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("tree: %s at offset %d", e.Msg, e.Offset)
+}
+
+// Parse builds a tree from the remaining tokens of z.
+func Parse(z *gockl.Tokenizer) (*Document, error) {
+	doc := &Document{Input: z.Input}
+	stack := []*Node{}
+
+	for {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+
+		n := &Node{Start: span, input: z.Input}
+		if span.Kind == gockl.EndElementKind {
+			name := gockl.EndElementToken(span.Raw(z.Input)).Name()
+			if len(stack) == 0 {
+				return nil, &SyntaxError{span.Start, "unexpected end element </" + name + ">"}
+			}
+			if top := stack[len(stack)-1]; top.Name() != name {
+				return nil, &SyntaxError{span.Start, "end element </" + name + "> does not match <" + top.Name() + ">"}
+			}
+			stack[len(stack)-1].End = span
+			stack = stack[:len(stack)-1]
+			continue
+		}
+
+		if len(stack) > 0 {
+			n.Parent = stack[len(stack)-1]
+			n.Parent.Children = append(n.Parent.Children, n)
+		} else {
+			if n.IsElement() {
+				if doc.Root != nil {
+					return nil, &SyntaxError{span.Start, "multiple document elements"}
+				}
+				doc.Root = n
+			}
+			doc.Nodes = append(doc.Nodes, n)
+		}
+
+		if span.Kind == gockl.StartElementKind {
+			stack = append(stack, n)
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, &SyntaxError{len(z.Input), "unclosed element <" + stack[len(stack)-1].Name() + ">"}
+	}
+	if doc.Root == nil {
+		return nil, &SyntaxError{len(z.Input), "no document element"}
+	}
+
+	return doc, nil
+}
+
+// ParseString builds a tree from the complete input.
+func ParseString(input string) (*Document, error) {
+	return Parse(gockl.New(input))
+}
+
+// Kind returns the kind of the node's (start) token.
+func (n *Node) Kind() gockl.TokenKind {
+	return n.Start.Kind
+}
+
+// IsElement reports whether the node is an element.
+func (n *Node) IsElement() bool {
+	return n.Start.Kind == gockl.StartElementKind || n.Start.Kind == gockl.EmptyElementKind
+}
+
+// Token returns the node's (start) token.
+func (n *Node) Token() gockl.Token {
+	return n.Start.Token(n.input)
+}
+
+// Element returns the start or empty element token of an element node or nil
+// for other nodes.
+func (n *Node) Element() gockl.StartOrEmptyElementToken {
+	if t, ok := n.Token().(gockl.StartOrEmptyElementToken); ok {
+		return t
+	}
+	return nil
+}
+
+// Name returns the name of an element node or an empty string for other
+// nodes.
+func (n *Node) Name() string {
+	if el := n.Element(); el != nil {
+		return el.Name()
+	}
+	return ""
+}
+
+// Attribute returns the unescaped value of the given attribute.
+func (n *Node) Attribute(name string) (string, bool) {
+	if el := n.Element(); el != nil {
+		for _, a := range el.AttributeSpans() {
+			if a.Name == name {
+				return gockl.Unescape(a.Content), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Offset returns the offset of the first byte of the node in the input.
+func (n *Node) Offset() int {
+	return n.Start.Start
+}
+
+// EndOffset returns the offset following the last byte of the node, including
+// the end element.
+func (n *Node) EndOffset() int {
+	if n.End.Kind == gockl.EndElementKind {
+		return n.End.End
+	}
+	return n.Start.End
+}
+
+// ContentOffset returns the offset of the first byte of the element's
+// content. For empty elements, this is the end offset.
+func (n *Node) ContentOffset() int {
+	return n.Start.End
+}
+
+// ContentEndOffset returns the offset following the element's content, which
+// is the offset of the end element, if there is one.
+func (n *Node) ContentEndOffset() int {
+	if n.End.Kind == gockl.EndElementKind {
+		return n.End.Start
+	}
+	return n.Start.End
+}
+
+// Raw returns the raw markup of the node, including all descendants.
+func (n *Node) Raw() string {
+	return n.input[n.Offset():n.EndOffset()]
+}
+
+// Text returns the concatenated, unescaped character data of the node and
+// all its descendants.
+func (n *Node) Text() string {
+	buf := strings.Builder{}
+	n.writeText(&buf)
+	return buf.String()
+}
+
+func (n *Node) writeText(buf *strings.Builder) {
+	switch n.Start.Kind {
+	case gockl.TextKind:
+		buf.WriteString(gockl.Unescape(n.Start.Raw(n.input)))
+	case gockl.CDATAKind:
+		content, _ := gockl.CDATAToken(n.Start.Raw(n.input)).Content()
+		buf.WriteString(content)
+	case gockl.StartElementKind:
+		for _, c := range n.Children {
+			c.writeText(buf)
+		}
+	}
+}
+
+// Elements returns the child elements of the node.
+func (n *Node) Elements() []*Node {
+	r := []*Node{}
+	for _, c := range n.Children {
+		if c.IsElement() {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+// Index returns the position of the node among the siblings of the same name
+// (for elements) or the same node type (for other nodes), starting at 1.
+func (n *Node) Index() int {
+	if n.Parent == nil {
+		return 1
+	}
+
+	idx := 0
+	step := n.step()
+	for _, c := range n.Parent.Children {
+		if c.step() == step {
+			idx++
+		}
+		if c == n {
+			break
+		}
+	}
+	return idx
+}
+
+func (n *Node) step() string {
+	switch n.Start.Kind {
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		return n.Name()
+	case gockl.TextKind, gockl.CDATAKind:
+		return "text()"
+	case gockl.CommentKind:
+		return "comment()"
+	case gockl.ProcInstKind:
+		return "processing-instruction()"
+	}
+	return "node()"
+}
+
+// Path returns an XPath-like location path of the node, e.g.
+// `/doc/item[2]/text()[1]`. Position predicates are only added if there are
+// multiple siblings of the same name.
+func (n *Node) Path() string {
+	step := n.step()
+	if n.Parent == nil {
+		return "/" + step
+	}
+
+	count := 0
+	for _, c := range n.Parent.Children {
+		if c.step() == step {
+			count++
+		}
+	}
+	if count > 1 {
+		step += "[" + strconv.Itoa(n.Index()) + "]"
+	}
+
+	return n.Parent.Path() + "/" + step
+}
+
+// Lookup returns the node addressed by a path as returned by Node.Path or nil,
+// if there is no such node. Missing position predicates select the first
+// matching node.
+func (d *Document) Lookup(path string) *Node {
+	if !strings.HasPrefix(path, "/") {
+		return nil
+	}
+
+	var current *Node
+	nodes := d.Nodes
+	for _, step := range strings.Split(path[1:], "/") {
+		name, idx := step, 1
+		if open := strings.IndexByte(step, '['); open > -1 && strings.HasSuffix(step, "]") {
+			i, err := strconv.Atoi(step[open+1 : len(step)-1])
+			if err != nil || i < 1 {
+				return nil
+			}
+			name, idx = step[:open], i
+		}
+
+		var found *Node
+		for _, n := range nodes {
+			if n.step() == name {
+				idx--
+				if idx == 0 {
+					found = n
+					break
+				}
+			}
+		}
+		if found == nil {
+			return nil
+		}
+
+		current = found
+		nodes = found.Children
+	}
+
+	return current
+}
@@ -0,0 +1,123 @@
+package tree
+
+import (
+	"testing"
+)
+
+const document = `<?xml version="1.0"?>
+<!-- top -->
+<doc a="1 &amp; 2">
+  <item>one</item>
+  <item>two<![CDATA[ & three]]></item>
+  <empty/>
+  text
+</doc>
+`
+
+func TestParse(t *testing.T) {
+	doc, err := ParseString(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(doc.Nodes) != 6 {
+		t.Errorf("Wrong number of top-level nodes: %d", len(doc.Nodes))
+	}
+	if doc.Root == nil || doc.Root.Name() != "doc" {
+		t.Fatalf("Wrong document element: %v", doc.Root)
+	}
+	if a, ok := doc.Root.Attribute("a"); !ok || a != "1 & 2" {
+		t.Errorf("Wrong attribute: %s", a)
+	}
+	if raw := doc.Root.Raw(); raw != document[doc.Root.Offset():len(document)-1] {
+		t.Errorf("Wrong raw content: %s", raw)
+	}
+
+	elements := doc.Root.Elements()
+	if len(elements) != 3 {
+		t.Fatalf("Wrong number of elements: %d", len(elements))
+	}
+
+	for i, expected := range []struct {
+		Path string
+		Text string
+		Raw  string
+	}{
+		{"/doc/item[1]", "one", "<item>one</item>"},
+		{"/doc/item[2]", "two & three", "<item>two<![CDATA[ & three]]></item>"},
+		{"/doc/empty", "", "<empty/>"},
+	} {
+		el := elements[i]
+		if p := el.Path(); p != expected.Path {
+			t.Errorf("Wrong path: %s (actual) != %s (expected)", p, expected.Path)
+		}
+		if text := el.Text(); text != expected.Text {
+			t.Errorf("Wrong text: %s (actual) != %s (expected)", text, expected.Text)
+		}
+		if raw := el.Raw(); raw != expected.Raw {
+			t.Errorf("Wrong raw content: %s (actual) != %s (expected)", raw, expected.Raw)
+		}
+	}
+
+	if p := elements[1].Children[1].Path(); p != "/doc/item[2]/text()[2]" {
+		t.Errorf("Wrong text path: %s", p)
+	}
+	if content := document[elements[1].ContentOffset():elements[1].ContentEndOffset()]; content != "two<![CDATA[ & three]]>" {
+		t.Errorf("Wrong content: %s", content)
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	for input, offset := range map[string]int{
+		``:                    0,
+		`<!-- x -->`:          10,
+		`<a>`:                 3,
+		`<a></b>`:             3,
+		`</a>`:                0,
+		`<a/><b/>`:            4,
+		`<a><b></a>`:          6,
+		`<a></a><b></b>`:      7,
+		`text<a><b/></a><c>x`: 15,
+	} {
+		_, err := ParseString(input)
+		if e, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Expected syntax error for %s, got %v", input, err)
+		} else if e.Offset != offset {
+			t.Errorf("Wrong offset for %s: %d (actual) != %d (expected)", input, e.Offset, offset)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	doc, err := ParseString(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var walk func(nodes []*Node)
+	walk = func(nodes []*Node) {
+		for _, n := range nodes {
+			if n.Parent == nil && !n.IsElement() {
+				continue
+			}
+			if found := doc.Lookup(n.Path()); found != n {
+				t.Errorf("Lookup of %s returned wrong node: %v", n.Path(), found)
+			}
+			walk(n.Children)
+		}
+	}
+	walk(doc.Nodes)
+
+	for path, expected := range map[string]*Node{
+		"/doc/item":         doc.Root.Elements()[0],
+		"/doc/item[3]":      nil,
+		"/doc/item[0]":      nil,
+		"/doc/item[x]":      nil,
+		"doc":               nil,
+		"/doc/empty/text()": nil,
+	} {
+		if found := doc.Lookup(path); found != expected {
+			t.Errorf("Lookup of %s returned wrong node: %v", path, found)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package gockl
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// TokenReader implements encoding/xml's TokenReader interface on top of a
+// Tokenizer, so that xml.NewTokenDecoder can be used to decode parts of a
+// document into structs. Tokens are read from the Tokenizer one at a time,
+// so it can be used to continue tokenizing after decoding an element.
+type TokenReader struct {
+	Tokenizer *Tokenizer
+	end       *xml.EndElement
+}
+
+var _ xml.TokenReader = &TokenReader{}
+
+func NewTokenReader(z *Tokenizer) *TokenReader {
+	return &TokenReader{Tokenizer: z}
+}
+
+func (me *TokenReader) Token() (xml.Token, error) {
+	if me.end != nil {
+		t := *me.end
+		me.end = nil
+		return t, nil
+	}
+
+	t, err := me.Tokenizer.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	return me.convert(t), nil
+}
+
+func (me *TokenReader) convert(t Token) xml.Token {
+	switch t := t.(type) {
+	case TextToken:
+		return xml.CharData(Unescape(string(t)))
+	case CDATAToken:
+		content, _ := t.Content()
+		return xml.CharData(content)
+	case CommentToken:
+		content, _ := t.Content()
+		return xml.Comment(content)
+	case DirectiveToken:
+		return xml.Directive(strings.TrimSuffix(strings.TrimPrefix(string(t), "<!"), ">"))
+	case ProcInstToken:
+		return xml.ProcInst{Target: t.Target(), Inst: []byte(t.Instruction())}
+	case StartElementToken:
+		return startElement(t)
+	case EmptyElementToken:
+		start := startElement(t)
+		me.end = &xml.EndElement{Name: start.Name}
+		return start
+	case EndElementToken:
+		return xml.EndElement{Name: xmlName(t.Name())}
+	}
+
+	return nil
+}
+
+func startElement(t StartOrEmptyElementToken) xml.StartElement {
+	attrs := t.Attributes()
+	r := xml.StartElement{Name: xmlName(t.Name()), Attr: make([]xml.Attr, len(attrs))}
+
+	for i, a := range attrs {
+		r.Attr[i] = xml.Attr{Name: xmlName(a.Name), Value: Unescape(a.Content)}
+	}
+
+	return r
+}
+
+func xmlName(name string) xml.Name {
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return xml.Name{Space: name[:idx], Local: name[idx+1:]}
+	}
+
+	return xml.Name{Local: name}
+}
@@ -0,0 +1,55 @@
+package xsd
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Param is a facet restricting a Datatype.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Datatype is a built-in datatype, optionally restricted by facets. It makes
+// the datatypes available to other schema languages.
+type Datatype struct {
+	t *simpleType
+}
+
+// NewDatatype returns the built-in datatype with the given local name,
+// restricted by params. Each param is applied as a separate restriction, so
+// multiple patterns all have to match.
+func NewDatatype(name string, params ...Param) (*Datatype, error) {
+	t, ok := builtins[name]
+	if !ok {
+		return nil, fmt.Errorf("xsd: unknown datatype %s", name)
+	}
+	for _, p := range params {
+		base := t
+		t = newSimpleType(name, base)
+		if err := t.facet(p.Name, p.Value); err != nil {
+			return nil, fmt.Errorf("xsd: %s", err)
+		}
+		switch p.Name {
+		case "minInclusive", "maxInclusive", "minExclusive", "maxExclusive":
+			if msg := base.validate(p.Value); msg != "" {
+				return nil, fmt.Errorf("xsd: invalid value of %s facet: %s", p.Name, msg)
+			}
+		}
+	}
+	return &Datatype{t}, nil
+}
+
+// Validate returns an error describing why value is not valid.
+func (d *Datatype) Validate(value string) error {
+	if msg := d.t.validate(value); msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// Equal reports whether a and b denote the same value.
+func (d *Datatype) Equal(a, b string) bool {
+	return d.t.equal(a, b)
+}
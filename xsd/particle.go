@@ -0,0 +1,306 @@
+package xsd
+
+import (
+	"sort"
+	"strings"
+)
+
+type particleKind uint8
+
+const (
+	elementParticle particleKind = iota + 1
+	wildcardParticle
+	sequenceParticle
+	choiceParticle
+	allParticle
+)
+
+// unbounded is used as maximum number of occurrences for
+// maxOccurs="unbounded".
+const unbounded = -1
+
+// maxUnroll limits the number of copies made for particles with a minimum or
+// maximum number of occurrences. Larger numbers are treated like this limit
+// or, for maxOccurs, like unbounded.
+const maxUnroll = 1000
+
+type particle struct {
+	kind     particleKind
+	min      int
+	max      int
+	element  *element
+	wildcard *wildcard
+	children []*particle
+}
+
+// wildcard is an xs:any or xs:anyAttribute.
+type wildcard struct {
+	// namespaces lists the allowed namespaces, with "##local" for no
+	// namespace, or is nil if any namespace is allowed
+	namespaces []string
+	// not excludes a namespace and no namespace, for "##other"
+	not             string
+	other           bool
+	processContents string
+}
+
+func (w *wildcard) allows(ns string) bool {
+	if w.other {
+		return ns != "" && ns != w.not
+	}
+	if w.namespaces == nil {
+		return true
+	}
+	for _, n := range w.namespaces {
+		if n == ns || (n == "##local" && ns == "") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *particle) matches(name qname) bool {
+	switch p.kind {
+	case elementParticle:
+		return p.element.name == name
+	case wildcardParticle:
+		return p.wildcard.allows(name.ns)
+	}
+	return false
+}
+
+func (p *particle) describe() string {
+	if p.kind == wildcardParticle {
+		return "any element"
+	}
+	return "<" + p.element.name.local + ">"
+}
+
+// contentMatcher checks the sequence of child elements against a content
+// model.
+type contentMatcher interface {
+	// step returns the particle matching the next child element or nil.
+	step(name qname) *particle
+	accepts() bool
+	expected() []string
+}
+
+// automaton is a nondeterministic finite automaton built from a content
+// model. State 0 is the start state.
+type automaton struct {
+	states []state
+	accept int
+}
+
+type state struct {
+	// either a transition for the particle to next
+	particle *particle
+	next     int
+	// or epsilon transitions
+	epsilon []int
+}
+
+func (a *automaton) add() int {
+	a.states = append(a.states, state{next: -1})
+	return len(a.states) - 1
+}
+
+func (a *automaton) epsilon(from, to int) {
+	a.states[from].epsilon = append(a.states[from].epsilon, to)
+}
+
+func compileParticle(p *particle) *automaton {
+	a := &automaton{}
+	start := a.add()
+	a.accept = a.add()
+	if p != nil {
+		a.build(p, start, a.accept)
+	} else {
+		a.epsilon(start, a.accept)
+	}
+	return a
+}
+
+// build adds the states for p between from and to.
+func (a *automaton) build(p *particle, from, to int) {
+	min, max := p.min, p.max
+	if min > maxUnroll {
+		min = maxUnroll
+	}
+	if max > maxUnroll {
+		max = unbounded
+	}
+
+	current := from
+	for i := 0; i < min; i++ {
+		next := a.add()
+		a.once(p, current, next)
+		current = next
+	}
+
+	if max == unbounded {
+		loop := a.add()
+		a.epsilon(current, loop)
+		a.epsilon(loop, to)
+		next := a.add()
+		a.once(p, loop, next)
+		a.epsilon(next, loop)
+		return
+	}
+
+	for i := min; i < max; i++ {
+		a.epsilon(current, to)
+		next := a.add()
+		a.once(p, current, next)
+		current = next
+	}
+	a.epsilon(current, to)
+}
+
+// once adds the states for a single occurrence of p.
+func (a *automaton) once(p *particle, from, to int) {
+	switch p.kind {
+	case elementParticle, wildcardParticle:
+		s := a.add()
+		a.epsilon(from, s)
+		a.states[s].particle, a.states[s].next = p, to
+	case choiceParticle:
+		for _, c := range p.children {
+			a.build(c, from, to)
+		}
+		if len(p.children) == 0 {
+			// an empty choice cannot be matched
+			return
+		}
+	default:
+		current := from
+		for _, c := range p.children {
+			next := a.add()
+			a.build(c, current, next)
+			current = next
+		}
+		a.epsilon(current, to)
+	}
+}
+
+type nfaMatcher struct {
+	a       *automaton
+	current []int
+}
+
+func (a *automaton) matcher() *nfaMatcher {
+	return &nfaMatcher{a, a.closure([]int{0})}
+}
+
+func (a *automaton) closure(states []int) []int {
+	seen := map[int]bool{}
+	r := []int{}
+	var visit func(int)
+	visit = func(s int) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		r = append(r, s)
+		for _, e := range a.states[s].epsilon {
+			visit(e)
+		}
+	}
+	for _, s := range states {
+		visit(s)
+	}
+	return r
+}
+
+func (m *nfaMatcher) step(name qname) *particle {
+	var matched *particle
+	next := []int{}
+	for _, s := range m.current {
+		st := m.a.states[s]
+		if st.particle != nil && st.particle.matches(name) {
+			// prefer element declarations over wildcards
+			if matched == nil || (matched.kind == wildcardParticle && st.particle.kind == elementParticle) {
+				matched = st.particle
+			}
+			next = append(next, st.next)
+		}
+	}
+	if matched == nil {
+		return nil
+	}
+	m.current = m.a.closure(next)
+	return matched
+}
+
+func (m *nfaMatcher) accepts() bool {
+	for _, s := range m.current {
+		if s == m.a.accept {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *nfaMatcher) expected() []string {
+	seen := map[string]bool{}
+	r := []string{}
+	for _, s := range m.current {
+		if p := m.a.states[s].particle; p != nil && !seen[p.describe()] {
+			seen[p.describe()] = true
+			r = append(r, p.describe())
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+// allMatcher checks the content of an xs:all group, in which every element
+// may occur at most once in any order.
+type allMatcher struct {
+	p    *particle
+	seen map[*particle]bool
+}
+
+func (m *allMatcher) step(name qname) *particle {
+	for _, c := range m.p.children {
+		if !m.seen[c] && c.matches(name) {
+			m.seen[c] = true
+			return c
+		}
+	}
+	return nil
+}
+
+func (m *allMatcher) accepts() bool {
+	if len(m.seen) == 0 && m.p.min == 0 {
+		return true
+	}
+	for _, c := range m.p.children {
+		if c.min > 0 && !m.seen[c] {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *allMatcher) expected() []string {
+	r := []string{}
+	for _, c := range m.p.children {
+		if !m.seen[c] {
+			r = append(r, c.describe())
+		}
+	}
+	sort.Strings(r)
+	return r
+}
+
+func describeExpected(m contentMatcher, end string) string {
+	expected := m.expected()
+	if m.accepts() {
+		expected = append(expected, end)
+	}
+	if len(expected) == 0 {
+		return "nothing"
+	}
+	return strings.Join(expected, " or ")
+}
@@ -0,0 +1,809 @@
+// Package xsd validates documents against a subset of XML Schema 1.0.
+//
+// Supported are global and local element and attribute declarations, named
+// and anonymous complex and simple types, sequences, choices and all groups
+// with occurrence constraints, wildcards, model and attribute groups, simple
+// and complex content derived by extension or restriction, as well as simple
+// types derived by restriction (using the enumeration, pattern, length,
+// minLength, maxLength, minInclusive, maxInclusive, minExclusive,
+// maxExclusive, totalDigits, fractionDigits and whiteSpace facets), list and
+// union. Schemas can be split using xs:include and xs:import.
+//
+// Not supported are identity constraints, substitution groups, xsi:type,
+// xs:redefine and the checking of ID/IDREF integrity. Documents are validated
+// while streaming through their tokens.
+package xsd
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/roblillack/gockl"
+	"github.com/roblillack/gockl/dtd"
+	"github.com/roblillack/gockl/tree"
+)
+
+const (
+	xsNamespace  = "http://www.w3.org/2001/XMLSchema"
+	xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+)
+
+type qname struct {
+	ns    string
+	local string
+}
+
+func (q qname) String() string {
+	if q.ns == "" {
+		return q.local
+	}
+	return "{" + q.ns + "}" + q.local
+}
+
+type typeDef interface {
+	isType()
+}
+
+type element struct {
+	name     qname
+	typ      typeDef
+	nillable bool
+	fixed    *string
+}
+
+type complexType struct {
+	name         string
+	mixed        bool
+	simple       *simpleType
+	content      *particle
+	attributes   map[qname]*attribute
+	anyAttribute *wildcard
+
+	automaton *automaton
+	done      bool
+}
+
+func (*complexType) isType() {}
+
+func (t *complexType) matcher() contentMatcher {
+	if t.content != nil && t.content.kind == allParticle {
+		return &allMatcher{t.content, map[*particle]bool{}}
+	}
+	return t.automaton.matcher()
+}
+
+type attribute struct {
+	name       qname
+	typ        *simpleType
+	required   bool
+	prohibited bool
+	fixed      *string
+}
+
+var anyType = &complexType{
+	name:         "anyType",
+	mixed:        true,
+	content:      &particle{kind: wildcardParticle, min: 0, max: unbounded, wildcard: &wildcard{processContents: "lax"}},
+	attributes:   map[qname]*attribute{},
+	anyAttribute: &wildcard{processContents: "lax"},
+	done:         true,
+}
+
+func init() {
+	anyType.automaton = compileParticle(anyType.content)
+}
+
+// Schema is a compiled schema.
+type Schema struct {
+	elements map[qname]*element
+}
+
+// Parse compiles the schema document in s. Included and imported schema
+// documents are loaded using r, which may be nil if there are none. The
+// namespace of imported schemas is passed to r as public identifier.
+func Parse(s string, r dtd.Resolver) (*Schema, error) {
+	c := &compiler{
+		r:          r,
+		loaded:     map[string]bool{},
+		defs:       map[string]map[qname]*definition{},
+		types:      map[qname]typeDef{},
+		elements:   map[qname]*element{},
+		attributes: map[qname]*attribute{},
+		groups:     map[qname]*particle{},
+		inProgress: map[*tree.Node]bool{},
+	}
+
+	if err := c.load(s, ""); err != nil {
+		return nil, err
+	}
+
+	schema := &Schema{elements: map[qname]*element{}}
+	for q, d := range c.defs["element"] {
+		schema.elements[q] = c.globalElement(d)
+	}
+	// compile all named types to report their errors as well
+	for q := range c.defs["complexType"] {
+		c.typ(nil, nil, q)
+	}
+	for q := range c.defs["simpleType"] {
+		c.typ(nil, nil, q)
+	}
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	for _, t := range c.complex {
+		t.automaton = compileParticle(t.content)
+	}
+
+	return schema, nil
+}
+
+// document is a single schema document.
+type document struct {
+	input    string
+	location string
+	target   string
+	// qualified local elements and attributes
+	elements   bool
+	attributes bool
+}
+
+type definition struct {
+	node *tree.Node
+	doc  *document
+}
+
+type compiler struct {
+	r          dtd.Resolver
+	loaded     map[string]bool
+	defs       map[string]map[qname]*definition
+	types      map[qname]typeDef
+	elements   map[qname]*element
+	attributes map[qname]*attribute
+	groups     map[qname]*particle
+	inProgress map[*tree.Node]bool
+	complex    []*complexType
+	err        error
+}
+
+func (c *compiler) errorf(doc *document, n *tree.Node, format string, args ...interface{}) {
+	if c.err != nil {
+		return
+	}
+	prefix := "xsd: "
+	if doc.location != "" {
+		prefix += doc.location + ":"
+	}
+	if n != nil {
+		prefix += gockl.Locate(doc.input, n.Offset()).String() + ": "
+	}
+	c.err = fmt.Errorf("%s%s", prefix, fmt.Sprintf(format, args...))
+}
+
+func local(n *tree.Node) string {
+	name := n.Name()
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		return name[idx+1:]
+	}
+	return name
+}
+
+// children returns the child elements, skipping annotations.
+func children(n *tree.Node) []*tree.Node {
+	r := []*tree.Node{}
+	for _, c := range n.Elements() {
+		if local(c) != "annotation" {
+			r = append(r, c)
+		}
+	}
+	return r
+}
+
+func (c *compiler) load(input, location string) error {
+	doc := &document{input: input, location: location}
+	t, err := tree.ParseString(input)
+	if err != nil {
+		return fmt.Errorf("xsd: %s: %s", location, err)
+	}
+	if t.Root == nil || local(t.Root) != "schema" {
+		c.errorf(doc, t.Root, "missing schema element")
+		return c.err
+	}
+
+	doc.target, _ = t.Root.Attribute("targetNamespace")
+	if v, _ := t.Root.Attribute("elementFormDefault"); v == "qualified" {
+		doc.elements = true
+	}
+	if v, _ := t.Root.Attribute("attributeFormDefault"); v == "qualified" {
+		doc.attributes = true
+	}
+
+	for _, n := range children(t.Root) {
+		switch kind := local(n); kind {
+		case "include", "import":
+			schemaLocation, ok := n.Attribute("schemaLocation")
+			if !ok {
+				continue
+			}
+			if location != "" && !strings.Contains(schemaLocation, ":") && !path.IsAbs(schemaLocation) {
+				schemaLocation = path.Join(path.Dir(location), schemaLocation)
+			}
+			if c.loaded[schemaLocation] {
+				continue
+			}
+			c.loaded[schemaLocation] = true
+			if c.r == nil {
+				c.errorf(doc, n, "no resolver to load %s", schemaLocation)
+				return c.err
+			}
+			namespace, _ := n.Attribute("namespace")
+			text, err := c.r.Resolve(namespace, schemaLocation)
+			if err != nil {
+				c.errorf(doc, n, "cannot load %s: %s", schemaLocation, err)
+				return c.err
+			}
+			if err := c.load(text, schemaLocation); err != nil {
+				return err
+			}
+		case "element", "complexType", "simpleType", "attribute", "group", "attributeGroup":
+			name, ok := n.Attribute("name")
+			if !ok {
+				c.errorf(doc, n, "missing name of global %s", kind)
+				return c.err
+			}
+			if c.defs[kind] == nil {
+				c.defs[kind] = map[qname]*definition{}
+			}
+			q := qname{doc.target, name}
+			if _, exists := c.defs[kind][q]; exists || (kind == "simpleType" && c.defs["complexType"][q] != nil) || (kind == "complexType" && c.defs["simpleType"][q] != nil) {
+				c.errorf(doc, n, "%s %s defined more than once", kind, name)
+				return c.err
+			}
+			c.defs[kind][q] = &definition{n, doc}
+		case "notation":
+		default:
+			c.errorf(doc, n, "unsupported schema component %s", kind)
+			return c.err
+		}
+	}
+
+	return nil
+}
+
+// resolve resolves a qualified name used as attribute value of n.
+func (c *compiler) resolve(doc *document, n *tree.Node, value string) qname {
+	value = strings.TrimSpace(value)
+	prefix, name := "", value
+	if idx := strings.IndexByte(value, ':'); idx > -1 {
+		prefix, name = value[:idx], value[idx+1:]
+	}
+
+	attr := "xmlns"
+	if prefix != "" {
+		attr += ":" + prefix
+	}
+	if prefix == "xml" {
+		return qname{"http://www.w3.org/XML/1998/namespace", name}
+	}
+	for a := n; a != nil; a = a.Parent {
+		if ns, ok := a.Attribute(attr); ok {
+			return qname{ns, name}
+		}
+	}
+	if prefix != "" {
+		c.errorf(doc, n, "undeclared namespace prefix %s", prefix)
+	}
+	return qname{"", name}
+}
+
+func (c *compiler) lookup(kind string, doc *document, n *tree.Node, q qname) *definition {
+	if d := c.defs[kind][q]; d != nil {
+		return d
+	}
+	c.errorf(doc, n, "unknown %s %s", kind, q)
+	return nil
+}
+
+func (c *compiler) globalElement(d *definition) *element {
+	q := qname{d.doc.target, ""}
+	q.local, _ = d.node.Attribute("name")
+	if el := c.elements[q]; el != nil {
+		return el
+	}
+	el := &element{name: q}
+	c.elements[q] = el
+	c.elementType(d.doc, d.node, el)
+	return el
+}
+
+// elementType compiles the type, nillable and fixed properties of an element
+// declaration.
+func (c *compiler) elementType(doc *document, n *tree.Node, el *element) {
+	if v, _ := n.Attribute("nillable"); v == "true" || v == "1" {
+		el.nillable = true
+	}
+	if v, ok := n.Attribute("fixed"); ok {
+		el.fixed = &v
+	}
+
+	if t, ok := n.Attribute("type"); ok {
+		el.typ = c.typ(doc, n, c.resolve(doc, n, t))
+		return
+	}
+	for _, child := range children(n) {
+		switch local(child) {
+		case "complexType":
+			el.typ = c.complexType(doc, child, "")
+			return
+		case "simpleType":
+			el.typ = c.simpleType(doc, child, "")
+			return
+		}
+	}
+	el.typ = anyType
+}
+
+func (c *compiler) typ(doc *document, n *tree.Node, q qname) typeDef {
+	if q.ns == xsNamespace {
+		if q.local == "anyType" {
+			return anyType
+		}
+		if t, ok := builtins[q.local]; ok {
+			return t
+		}
+	}
+	if t, ok := c.types[q]; ok {
+		return t
+	}
+
+	if d := c.defs["complexType"][q]; d != nil {
+		return c.complexType(d.doc, d.node, q.local)
+	}
+	if d := c.defs["simpleType"][q]; d != nil {
+		t := c.simpleType(d.doc, d.node, q.local)
+		c.types[q] = t
+		return t
+	}
+
+	if doc != nil {
+		c.errorf(doc, n, "unknown type %s", q)
+	}
+	return anyType
+}
+
+func (c *compiler) simpleTypeRef(doc *document, n *tree.Node, value string) *simpleType {
+	t, ok := c.typ(doc, n, c.resolve(doc, n, value)).(*simpleType)
+	if !ok {
+		c.errorf(doc, n, "%s is not a simple type", value)
+		return builtins["anySimpleType"]
+	}
+	return t
+}
+
+func (c *compiler) simpleType(doc *document, n *tree.Node, name string) *simpleType {
+	if c.inProgress[n] {
+		c.errorf(doc, n, "circular definition of simple type %s", name)
+		return builtins["anySimpleType"]
+	}
+	c.inProgress[n] = true
+	defer delete(c.inProgress, n)
+
+	for _, child := range children(n) {
+		switch local(child) {
+		case "restriction":
+			var base *simpleType
+			if b, ok := child.Attribute("base"); ok {
+				base = c.simpleTypeRef(doc, child, b)
+			} else {
+				for _, st := range children(child) {
+					if local(st) == "simpleType" {
+						base = c.simpleType(doc, st, "")
+					}
+				}
+			}
+			if base == nil {
+				c.errorf(doc, child, "missing base type")
+				return builtins["anySimpleType"]
+			}
+			t := newSimpleType(name, base)
+			c.facets(doc, child, t)
+			return t
+		case "list":
+			t := newSimpleType(name, nil)
+			if item, ok := child.Attribute("itemType"); ok {
+				t.list = c.simpleTypeRef(doc, child, item)
+			}
+			for _, st := range children(child) {
+				if local(st) == "simpleType" {
+					t.list = c.simpleType(doc, st, "")
+				}
+			}
+			if t.list == nil {
+				c.errorf(doc, child, "missing item type")
+			}
+			return t
+		case "union":
+			t := newSimpleType(name, nil)
+			t.members = []*simpleType{}
+			if members, ok := child.Attribute("memberTypes"); ok {
+				for _, m := range strings.Fields(members) {
+					t.members = append(t.members, c.simpleTypeRef(doc, child, m))
+				}
+			}
+			for _, st := range children(child) {
+				if local(st) == "simpleType" {
+					t.members = append(t.members, c.simpleType(doc, st, ""))
+				}
+			}
+			return t
+		}
+	}
+
+	c.errorf(doc, n, "simple type must contain restriction, list or union")
+	return builtins["anySimpleType"]
+}
+
+// facets adds the facets found in the restriction element n to t.
+func (c *compiler) facets(doc *document, n *tree.Node, t *simpleType) {
+	patterns := []string{}
+
+	for _, f := range children(n) {
+		value, _ := f.Attribute("value")
+		switch local(f) {
+		case "simpleType", "attribute", "attributeGroup", "anyAttribute":
+			continue
+		case "pattern":
+			patterns = append(patterns, value)
+		}
+		if err := t.facet(local(f), value); err != nil {
+			c.errorf(doc, f, "%s", err)
+		}
+	}
+
+	if len(patterns) > 1 {
+		// multiple patterns in the same step are alternatives
+		re, err := translatePattern("(" + strings.Join(patterns, ")|(") + ")")
+		if err == nil {
+			t.patterns = append(t.patterns[:0], re)
+		}
+	}
+	for _, bound := range []string{t.minInclusive, t.maxInclusive, t.minExclusive, t.maxExclusive} {
+		if bound != "" && t.base != nil && t.base.validate(bound) != "" {
+			c.errorf(doc, n, "invalid bound %q for base type %s", bound, t.base)
+		}
+	}
+}
+
+func (c *compiler) complexType(doc *document, n *tree.Node, name string) *complexType {
+	t := &complexType{name: name, attributes: map[qname]*attribute{}}
+	if name != "" {
+		c.types[qname{doc.target, name}] = t
+	}
+	c.complex = append(c.complex, t)
+	defer func() { t.done = true }()
+
+	if v, _ := n.Attribute("mixed"); v == "true" || v == "1" {
+		t.mixed = true
+	}
+
+	for _, child := range children(n) {
+		switch local(child) {
+		case "simpleContent":
+			c.simpleContent(doc, child, t)
+			return t
+		case "complexContent":
+			if v, ok := child.Attribute("mixed"); ok {
+				t.mixed = v == "true" || v == "1"
+			}
+			c.complexContent(doc, child, t)
+			return t
+		}
+	}
+
+	c.content(doc, n, t)
+	return t
+}
+
+// content compiles the particle and attributes found in n.
+func (c *compiler) content(doc *document, n *tree.Node, t *complexType) {
+	for _, child := range children(n) {
+		switch local(child) {
+		case "sequence", "choice", "all", "group":
+			if t.content != nil {
+				c.errorf(doc, child, "more than one content model")
+				return
+			}
+			t.content = c.particle(doc, child)
+			if t.content.kind == allParticle && t.content.max != 1 {
+				c.errorf(doc, child, "maxOccurs of all must be 1")
+			}
+		case "attribute", "attributeGroup", "anyAttribute":
+			c.attribute(doc, child, t)
+		}
+	}
+}
+
+func (c *compiler) baseComplexType(doc *document, n *tree.Node) (*complexType, *simpleType) {
+	b, ok := n.Attribute("base")
+	if !ok {
+		c.errorf(doc, n, "missing base type")
+		return nil, nil
+	}
+	switch base := c.typ(doc, n, c.resolve(doc, n, b)).(type) {
+	case *complexType:
+		if !base.done {
+			c.errorf(doc, n, "circular derivation of %s", b)
+			return nil, nil
+		}
+		return base, nil
+	case *simpleType:
+		return nil, base
+	}
+	return nil, nil
+}
+
+func (c *compiler) inherit(t, base *complexType) {
+	for q, a := range base.attributes {
+		t.attributes[q] = a
+	}
+	t.anyAttribute = base.anyAttribute
+}
+
+func (c *compiler) simpleContent(doc *document, n *tree.Node, t *complexType) {
+	for _, d := range children(n) {
+		base, simple := c.baseComplexType(doc, d)
+		if base != nil {
+			if base.simple == nil && !(local(d) == "restriction" && base.mixed) {
+				c.errorf(doc, d, "base type of simple content must have simple content")
+				return
+			}
+			c.inherit(t, base)
+			simple = base.simple
+		}
+		if simple == nil {
+			simple = builtins["anySimpleType"]
+		}
+
+		t.simple = simple
+		if local(d) == "restriction" {
+			t.simple = newSimpleType("", simple)
+			c.facets(doc, d, t.simple)
+		}
+		c.content(doc, d, t)
+		if t.content != nil {
+			c.errorf(doc, d, "simple content must not contain elements")
+		}
+		return
+	}
+}
+
+func (c *compiler) complexContent(doc *document, n *tree.Node, t *complexType) {
+	for _, d := range children(n) {
+		base, simple := c.baseComplexType(doc, d)
+		if simple != nil {
+			c.errorf(doc, d, "base type of complex content must be a complex type")
+			return
+		}
+		if base == nil {
+			return
+		}
+		c.inherit(t, base)
+
+		c.content(doc, d, t)
+		if local(d) == "extension" && base.content != nil {
+			if t.content == nil {
+				t.content = base.content
+			} else {
+				t.content = &particle{kind: sequenceParticle, min: 1, max: 1, children: []*particle{base.content, t.content}}
+			}
+		}
+		for q, a := range t.attributes {
+			if a.prohibited {
+				delete(t.attributes, q)
+			}
+		}
+		return
+	}
+}
+
+func (c *compiler) occurs(doc *document, n *tree.Node) (int, int) {
+	min, max := 1, 1
+	if v, ok := n.Attribute("minOccurs"); ok {
+		i, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || i < 0 {
+			c.errorf(doc, n, "invalid minOccurs %q", v)
+		}
+		min = i
+	}
+	if v, ok := n.Attribute("maxOccurs"); ok {
+		if strings.TrimSpace(v) == "unbounded" {
+			max = unbounded
+		} else {
+			i, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || i < 0 {
+				c.errorf(doc, n, "invalid maxOccurs %q", v)
+			}
+			max = i
+		}
+	}
+	if max != unbounded && max < min {
+		c.errorf(doc, n, "maxOccurs must not be less than minOccurs")
+	}
+	return min, max
+}
+
+func (c *compiler) particle(doc *document, n *tree.Node) *particle {
+	p := &particle{}
+	p.min, p.max = c.occurs(doc, n)
+
+	switch kind := local(n); kind {
+	case "element":
+		p.kind = elementParticle
+		if ref, ok := n.Attribute("ref"); ok {
+			if d := c.lookup("element", doc, n, c.resolve(doc, n, ref)); d != nil {
+				p.element = c.globalElement(d)
+			} else {
+				p.element = &element{typ: anyType}
+			}
+			return p
+		}
+		name, _ := n.Attribute("name")
+		p.element = &element{name: qname{"", name}}
+		form, ok := n.Attribute("form")
+		if (ok && form == "qualified") || (!ok && doc.elements) {
+			p.element.name.ns = doc.target
+		}
+		c.elementType(doc, n, p.element)
+	case "any":
+		p.kind = wildcardParticle
+		p.wildcard = c.wildcard(doc, n)
+	case "sequence", "choice", "all":
+		p.kind = map[string]particleKind{"sequence": sequenceParticle, "choice": choiceParticle, "all": allParticle}[kind]
+		for _, child := range children(n) {
+			cp := c.particle(doc, child)
+			if kind == "all" && (cp.kind != elementParticle || cp.max > 1 || cp.max == unbounded) {
+				c.errorf(doc, child, "all may only contain elements occurring at most once")
+			}
+			if cp.kind == allParticle {
+				c.errorf(doc, child, "all must be the only content model")
+			}
+			p.children = append(p.children, cp)
+		}
+	case "group":
+		ref, _ := n.Attribute("ref")
+		q := c.resolve(doc, n, ref)
+		group := c.groups[q]
+		if group == nil {
+			d := c.lookup("group", doc, n, q)
+			if d == nil {
+				return &particle{kind: sequenceParticle}
+			}
+			if c.inProgress[d.node] {
+				c.errorf(doc, n, "circular group %s", ref)
+				return &particle{kind: sequenceParticle}
+			}
+			c.inProgress[d.node] = true
+			for _, child := range children(d.node) {
+				group = c.particle(d.doc, child)
+			}
+			delete(c.inProgress, d.node)
+			if group == nil {
+				group = &particle{kind: sequenceParticle, min: 1, max: 1}
+			}
+			c.groups[q] = group
+		}
+		copy := *group
+		copy.min, copy.max = p.min, p.max
+		return &copy
+	default:
+		c.errorf(doc, n, "unexpected %s in content model", kind)
+	}
+
+	return p
+}
+
+func (c *compiler) wildcard(doc *document, n *tree.Node) *wildcard {
+	w := &wildcard{processContents: "strict"}
+	if v, ok := n.Attribute("processContents"); ok {
+		w.processContents = v
+	}
+
+	namespace, ok := n.Attribute("namespace")
+	namespace = strings.TrimSpace(namespace)
+	switch {
+	case !ok || namespace == "##any":
+	case namespace == "##other":
+		w.other = true
+		w.not = doc.target
+	default:
+		w.namespaces = []string{}
+		for _, ns := range strings.Fields(namespace) {
+			switch ns {
+			case "##targetNamespace":
+				ns = doc.target
+			case "##local":
+				ns = ""
+			}
+			w.namespaces = append(w.namespaces, ns)
+		}
+	}
+
+	return w
+}
+
+// attribute compiles an attribute, attributeGroup or anyAttribute element.
+func (c *compiler) attribute(doc *document, n *tree.Node, t *complexType) {
+	switch local(n) {
+	case "anyAttribute":
+		t.anyAttribute = c.wildcard(doc, n)
+		return
+	case "attributeGroup":
+		ref, _ := n.Attribute("ref")
+		d := c.lookup("attributeGroup", doc, n, c.resolve(doc, n, ref))
+		if d == nil {
+			return
+		}
+		if c.inProgress[d.node] {
+			c.errorf(doc, n, "circular attribute group %s", ref)
+			return
+		}
+		c.inProgress[d.node] = true
+		for _, child := range children(d.node) {
+			c.attribute(d.doc, child, t)
+		}
+		delete(c.inProgress, d.node)
+		return
+	}
+
+	a := &attribute{}
+	decl := n
+	declDoc := doc
+	if ref, ok := n.Attribute("ref"); ok {
+		q := c.resolve(doc, n, ref)
+		d := c.lookup("attribute", doc, n, q)
+		if d == nil {
+			return
+		}
+		a.name = q
+		decl, declDoc = d.node, d.doc
+	} else {
+		name, _ := n.Attribute("name")
+		a.name = qname{"", name}
+		form, ok := n.Attribute("form")
+		if (ok && form == "qualified") || (!ok && doc.attributes) || n.Parent == nil || local(n.Parent) == "schema" {
+			a.name.ns = doc.target
+		}
+	}
+
+	a.typ = builtins["anySimpleType"]
+	if typ, ok := decl.Attribute("type"); ok {
+		a.typ = c.simpleTypeRef(declDoc, decl, typ)
+	}
+	for _, child := range children(decl) {
+		if local(child) == "simpleType" {
+			a.typ = c.simpleType(declDoc, child, "")
+		}
+	}
+
+	for _, node := range []*tree.Node{decl, n} {
+		if v, ok := node.Attribute("fixed"); ok {
+			a.fixed = &v
+		}
+	}
+	switch use, _ := n.Attribute("use"); use {
+	case "required":
+		a.required = true
+	case "prohibited":
+		a.prohibited = true
+	}
+	if a.fixed != nil {
+		if msg := a.typ.validate(*a.fixed); msg != "" {
+			c.errorf(doc, n, "invalid fixed value of attribute %s: %s", a.name.local, msg)
+		}
+	}
+
+	t.attributes[a.name] = a
+}
@@ -0,0 +1,465 @@
+package xsd
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// simpleType is a built-in or user-defined simple type. Its value space
+// restrictions are stored per derivation step, a value has to pass the
+// checks of the type itself and of all its base types.
+type simpleType struct {
+	name string
+	base *simpleType
+	// primitive is the name of the built-in primitive type the type is
+	// derived from or empty for list and union types
+	primitive string
+	// check validates the lexical form of built-in types
+	check func(string) bool
+
+	list    *simpleType
+	members []*simpleType
+
+	whiteSpace     string
+	enumeration    []string
+	patterns       []*regexp.Regexp
+	length         int
+	minLength      int
+	maxLength      int
+	totalDigits    int
+	fractionDigits int
+	minInclusive   string
+	maxInclusive   string
+	minExclusive   string
+	maxExclusive   string
+}
+
+func (*simpleType) isType() {}
+
+func newSimpleType(name string, base *simpleType) *simpleType {
+	t := &simpleType{name: name, base: base, length: -1, minLength: -1, maxLength: -1, totalDigits: -1, fractionDigits: -1}
+	if base != nil {
+		t.primitive = base.primitive
+		t.list = base.list
+		t.members = base.members
+	}
+	return t
+}
+
+// whitespace returns the whiteSpace facet in effect.
+func (t *simpleType) whitespace() string {
+	for s := t; s != nil; s = s.base {
+		if s.whiteSpace != "" {
+			return s.whiteSpace
+		}
+	}
+	if t.primitive == "string" || t.members != nil {
+		// union members normalize the value themselves
+		return "preserve"
+	}
+	return "collapse"
+}
+
+// equal reports whether two values are equal in the value space of t.
+func (t *simpleType) equal(a, b string) bool {
+	ws := t.whitespace()
+	a, b = normalizeSpace(a, ws), normalizeSpace(b, ws)
+	if t.list == nil && t.members == nil {
+		if c, ok := compare(t.primitive, a, b); ok {
+			return c == 0
+		}
+	}
+	return a == b
+}
+
+func normalizeSpace(value, mode string) string {
+	switch mode {
+	case "replace":
+		return strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, value)
+	case "collapse":
+		return strings.Join(strings.Fields(value), " ")
+	}
+	return value
+}
+
+// validate checks a value and returns a description of the problem or an
+// empty string.
+func (t *simpleType) validate(value string) string {
+	value = normalizeSpace(value, t.whitespace())
+
+	if t.members != nil {
+		ok := false
+		for _, m := range t.members {
+			if m.validate(value) == "" {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Sprintf("%q does not match any member type of %s", value, t)
+		}
+	} else if t.list != nil {
+		for _, item := range strings.Fields(value) {
+			if msg := t.list.validate(item); msg != "" {
+				return msg
+			}
+		}
+	}
+
+	for s := t; s != nil; s = s.base {
+		if msg := s.facets(value, t); msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+func (t *simpleType) String() string {
+	if t.name != "" {
+		return t.name
+	}
+	return "anonymous type"
+}
+
+// length returns the length of a value as used by the length facets.
+func (t *simpleType) valueLength(value string) int {
+	if t.list != nil {
+		return len(strings.Fields(value))
+	}
+	switch t.primitive {
+	case "hexBinary":
+		return len(value) / 2
+	case "base64Binary":
+		s := strings.Replace(value, " ", "", -1)
+		return len(s)*3/4 - strings.Count(s, "=")
+	}
+	return utf8.RuneCountInString(value)
+}
+
+// facets checks the value against the facets of a single derivation step.
+func (s *simpleType) facets(value string, t *simpleType) string {
+	if s.check != nil && !s.check(value) {
+		return fmt.Sprintf("%q is not a valid %s", value, s.name)
+	}
+
+	if len(s.enumeration) > 0 {
+		found := false
+		for _, e := range s.enumeration {
+			if e == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%q is not one of %s", value, strings.Join(s.enumeration, ", "))
+		}
+	}
+
+	if len(s.patterns) > 0 {
+		found := false
+		for _, p := range s.patterns {
+			if p.MatchString(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("%q does not match the required pattern", value)
+		}
+	}
+
+	if s.length > -1 || s.minLength > -1 || s.maxLength > -1 {
+		l := t.valueLength(value)
+		if s.length > -1 && l != s.length {
+			return fmt.Sprintf("%q does not have the required length of %d", value, s.length)
+		}
+		if s.minLength > -1 && l < s.minLength {
+			return fmt.Sprintf("%q is shorter than the minimum length of %d", value, s.minLength)
+		}
+		if s.maxLength > -1 && l > s.maxLength {
+			return fmt.Sprintf("%q is longer than the maximum length of %d", value, s.maxLength)
+		}
+	}
+
+	if s.totalDigits > -1 || s.fractionDigits > -1 {
+		total, fraction := digits(value)
+		if s.totalDigits > -1 && total > s.totalDigits {
+			return fmt.Sprintf("%q has more than %d digits", value, s.totalDigits)
+		}
+		if s.fractionDigits > -1 && fraction > s.fractionDigits {
+			return fmt.Sprintf("%q has more than %d fraction digits", value, s.fractionDigits)
+		}
+	}
+
+	for _, bound := range []struct {
+		limit string
+		ok    func(int) bool
+		msg   string
+	}{
+		{s.minInclusive, func(c int) bool { return c >= 0 }, "less than"},
+		{s.maxInclusive, func(c int) bool { return c <= 0 }, "greater than"},
+		{s.minExclusive, func(c int) bool { return c > 0 }, "less than or equal to"},
+		{s.maxExclusive, func(c int) bool { return c < 0 }, "greater than or equal to"},
+	} {
+		if bound.limit == "" {
+			continue
+		}
+		if c, ok := compare(t.primitive, value, bound.limit); ok && !bound.ok(c) {
+			return fmt.Sprintf("%q is %s %s", value, bound.msg, bound.limit)
+		}
+	}
+
+	return ""
+}
+
+// facet sets the facet with the given name.
+func (t *simpleType) facet(name, value string) error {
+	number := func(facet *int) error {
+		i, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || i < 0 {
+			return fmt.Errorf("invalid value %q of %s facet", value, name)
+		}
+		*facet = i
+		return nil
+	}
+
+	switch name {
+	case "enumeration":
+		t.enumeration = append(t.enumeration, normalizeSpace(value, t.whitespace()))
+	case "pattern":
+		re, err := translatePattern(value)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %s", value, err)
+		}
+		t.patterns = append(t.patterns, re)
+	case "length":
+		return number(&t.length)
+	case "minLength":
+		return number(&t.minLength)
+	case "maxLength":
+		return number(&t.maxLength)
+	case "totalDigits":
+		return number(&t.totalDigits)
+	case "fractionDigits":
+		return number(&t.fractionDigits)
+	case "minInclusive":
+		t.minInclusive = value
+	case "maxInclusive":
+		t.maxInclusive = value
+	case "minExclusive":
+		t.minExclusive = value
+	case "maxExclusive":
+		t.maxExclusive = value
+	case "whiteSpace":
+		if value != "preserve" && value != "replace" && value != "collapse" {
+			return fmt.Errorf("invalid value %q of whiteSpace facet", value)
+		}
+		t.whiteSpace = value
+	default:
+		return fmt.Errorf("unsupported facet %s", name)
+	}
+	return nil
+}
+
+// digits returns the total and fraction digits of a decimal number.
+func digits(value string) (int, int) {
+	value = strings.TrimLeft(value, "+-")
+	integer, fraction := value, ""
+	if idx := strings.IndexByte(value, '.'); idx > -1 {
+		integer, fraction = value[:idx], value[idx+1:]
+	}
+	integer = strings.TrimLeft(integer, "0")
+	fraction = strings.TrimRight(fraction, "0")
+	return len(integer) + len(fraction), len(fraction)
+}
+
+// compare compares two values of the given primitive type. Numbers are
+// compared by value, dates and times lexically.
+func compare(primitive, a, b string) (int, bool) {
+	switch primitive {
+	case "decimal":
+		x, ok1 := new(big.Rat).SetString(a)
+		y, ok2 := new(big.Rat).SetString(b)
+		if !ok1 || !ok2 {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case "float", "double":
+		x, err1 := strconv.ParseFloat(a, 64)
+		y, err2 := strconv.ParseFloat(b, 64)
+		if err1 != nil || err2 != nil {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case "date", "dateTime", "time", "gYear", "gYearMonth":
+		return strings.Compare(a, b), true
+	}
+	return 0, false
+}
+
+// translatePattern converts an XML Schema regular expression into the
+// syntax of the regexp package.
+func translatePattern(p string) (*regexp.Regexp, error) {
+	classes := map[byte][2]string{
+		'i': {`\p{L}_:`, `^\p{L}_:`},
+		'I': {`^\p{L}_:`, ``},
+		'c': {`\p{L}\p{N}\p{Mn}._:\-\x{B7}`, ``},
+		'C': {`^\p{L}\p{N}\p{Mn}._:\-\x{B7}`, ``},
+		'd': {`\p{Nd}`, ``},
+		'D': {`^\p{Nd}`, ``},
+	}
+
+	buf := strings.Builder{}
+	inClass := false
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '\\' && i+1 < len(p):
+			next := p[i+1]
+			i++
+			if cl, ok := classes[next]; ok {
+				if inClass {
+					if strings.HasPrefix(cl[0], "^") {
+						return nil, fmt.Errorf("negated class escape \\%c inside of character class", next)
+					}
+					buf.WriteString(cl[0])
+				} else {
+					buf.WriteString("[" + cl[0] + "]")
+				}
+				continue
+			}
+			buf.WriteByte(c)
+			buf.WriteByte(next)
+		case c == '[':
+			if inClass {
+				return nil, fmt.Errorf("character class subtraction is not supported")
+			}
+			inClass = true
+			buf.WriteByte(c)
+		case c == ']':
+			inClass = false
+			buf.WriteByte(c)
+		case c == '-' && inClass && i+1 < len(p) && p[i+1] == '[':
+			return nil, fmt.Errorf("character class subtraction is not supported")
+		case (c == '^' || c == '$') && !inClass:
+			// anchors are literal characters in XML Schema
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return regexp.Compile(`^(?:` + buf.String() + `)$`)
+}
+
+func matcher(pattern string) func(string) bool {
+	re := regexp.MustCompile(`^(?:` + pattern + `)$`)
+	return re.MatchString
+}
+
+const (
+	datePattern     = `-?[0-9]{4,}-(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])`
+	timePattern     = `([01][0-9]|2[0-3]):[0-5][0-9]:[0-5][0-9](\.[0-9]+)?|24:00:00(\.0+)?`
+	timezonePattern = `(Z|[+-]((0[0-9]|1[0-3]):[0-5][0-9]|14:00))?`
+	namePattern     = `[\p{L}_:][\p{L}\p{N}\p{Mn}._:\-\x{B7}]*`
+	ncNamePattern   = `[\p{L}_][\p{L}\p{N}\p{Mn}._\-\x{B7}]*`
+)
+
+var builtins = map[string]*simpleType{}
+
+func builtin(name, base string, check func(string) bool, configure func(t *simpleType)) {
+	t := newSimpleType(name, builtins[base])
+	if base == "" {
+		t.primitive = name
+	}
+	t.check = check
+	if configure != nil {
+		configure(t)
+	}
+	builtins[name] = t
+}
+
+func init() {
+	builtin("anySimpleType", "", nil, func(t *simpleType) { t.primitive = "string" })
+	builtin("string", "", nil, nil)
+	builtin("boolean", "", matcher(`true|false|1|0`), nil)
+	builtin("decimal", "", matcher(`[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)`), nil)
+	builtin("float", "", matcher(`[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?|-?INF|NaN`), nil)
+	builtin("double", "", matcher(`[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)([eE][+-]?[0-9]+)?|-?INF|NaN`), nil)
+	builtin("duration", "", matcher(`-?P(([0-9]+Y)?([0-9]+M)?([0-9]+D)?(T([0-9]+H)?([0-9]+M)?([0-9]+(\.[0-9]+)?S)?)?)`), func(t *simpleType) {
+		check := t.check
+		t.check = func(s string) bool {
+			return check(s) && !strings.HasSuffix(s, "P") && !strings.HasSuffix(s, "T")
+		}
+	})
+	builtin("dateTime", "", matcher(datePattern+`T(`+timePattern+`)`+timezonePattern), nil)
+	builtin("date", "", matcher(datePattern+timezonePattern), nil)
+	builtin("time", "", matcher(`(`+timePattern+`)`+timezonePattern), nil)
+	builtin("gYearMonth", "", matcher(`-?[0-9]{4,}-(0[1-9]|1[0-2])`+timezonePattern), nil)
+	builtin("gYear", "", matcher(`-?[0-9]{4,}`+timezonePattern), nil)
+	builtin("gMonthDay", "", matcher(`--(0[1-9]|1[0-2])-(0[1-9]|[12][0-9]|3[01])`+timezonePattern), nil)
+	builtin("gDay", "", matcher(`---(0[1-9]|[12][0-9]|3[01])`+timezonePattern), nil)
+	builtin("gMonth", "", matcher(`--(0[1-9]|1[0-2])`+timezonePattern), nil)
+	builtin("hexBinary", "", matcher(`([0-9a-fA-F]{2})*`), nil)
+	builtin("base64Binary", "", matcher(`(([A-Za-z0-9+/] ?){4})*(([A-Za-z0-9+/] ?){3}[A-Za-z0-9+/]|([A-Za-z0-9+/] ?){2}[AEIMQUYcgkosw048] ?=|[A-Za-z0-9+/] ?[AQgw] ?= ?=)?`), nil)
+	builtin("anyURI", "", nil, nil)
+	builtin("QName", "", matcher(`(`+ncNamePattern+`:)?`+ncNamePattern), nil)
+	builtin("NOTATION", "", matcher(`(`+ncNamePattern+`:)?`+ncNamePattern), nil)
+
+	builtin("normalizedString", "string", nil, func(t *simpleType) { t.whiteSpace = "replace" })
+	builtin("token", "normalizedString", nil, func(t *simpleType) { t.whiteSpace = "collapse" })
+	builtin("language", "token", matcher(`[a-zA-Z]{1,8}(-[a-zA-Z0-9]{1,8})*`), nil)
+	builtin("NMTOKEN", "token", matcher(`[\p{L}\p{N}\p{Mn}._:\-\x{B7}]+`), nil)
+	builtin("Name", "token", matcher(namePattern), nil)
+	builtin("NCName", "Name", matcher(ncNamePattern), nil)
+	builtin("ID", "NCName", nil, nil)
+	builtin("IDREF", "NCName", nil, nil)
+	builtin("ENTITY", "NCName", nil, nil)
+
+	builtin("integer", "decimal", matcher(`[+-]?[0-9]+`), nil)
+	for _, r := range []struct {
+		name, base, min, max string
+	}{
+		{"nonPositiveInteger", "integer", "", "0"},
+		{"negativeInteger", "nonPositiveInteger", "", "-1"},
+		{"long", "integer", "-9223372036854775808", "9223372036854775807"},
+		{"int", "long", "-2147483648", "2147483647"},
+		{"short", "int", "-32768", "32767"},
+		{"byte", "short", "-128", "127"},
+		{"nonNegativeInteger", "integer", "0", ""},
+		{"unsignedLong", "nonNegativeInteger", "", "18446744073709551615"},
+		{"unsignedInt", "unsignedLong", "", "4294967295"},
+		{"unsignedShort", "unsignedInt", "", "65535"},
+		{"unsignedByte", "unsignedShort", "", "255"},
+		{"positiveInteger", "nonNegativeInteger", "1", ""},
+	} {
+		min, max := r.min, r.max
+		builtin(r.name, r.base, nil, func(t *simpleType) {
+			t.minInclusive, t.maxInclusive = min, max
+		})
+	}
+
+	for _, list := range []struct{ name, item string }{{"NMTOKENS", "NMTOKEN"}, {"IDREFS", "IDREF"}, {"ENTITIES", "ENTITY"}} {
+		t := newSimpleType(list.name, nil)
+		t.list = builtins[list.item]
+		t.minLength = 1
+		builtins[list.name] = t
+	}
+}
@@ -0,0 +1,353 @@
+package xsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/roblillack/gockl"
+)
+
+// Error is a single validity error.
+type Error struct {
+	gockl.Location
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Location.String() + ": " + e.Msg
+}
+
+// MaxErrors is the maximum number of errors reported for a single document.
+const MaxErrors = 100
+
+// ValidateString validates the document in input.
+func (s *Schema) ValidateString(input string) []*Error {
+	return s.Validate(gockl.New(input))
+}
+
+// Validate reads all remaining tokens of z and returns the validity errors
+// found. Well-formedness is not checked, use the check package for that.
+func (s *Schema) Validate(z *gockl.Tokenizer) []*Error {
+	v := &validator{input: z.Input, s: s}
+
+	for len(v.errors) < MaxErrors {
+		span, err := z.NextSpan()
+		if err != nil {
+			break
+		}
+		v.token(span)
+	}
+
+	if !v.root && len(v.errors) < MaxErrors {
+		v.errorf(0, "no document element")
+	}
+
+	return v.errors
+}
+
+type frame struct {
+	name string
+	// namespaces declared on this element
+	namespaces map[string]string
+	element    *element
+	complex    *complexType
+	simple     *simpleType
+	matcher    contentMatcher
+	// skip is set if the content is not validated
+	skip bool
+	// lax is set if undeclared child elements are skipped
+	lax    bool
+	nilled bool
+	text   []byte
+	offset int
+}
+
+type validator struct {
+	input  string
+	s      *Schema
+	stack  []*frame
+	root   bool
+	errors []*Error
+}
+
+func (v *validator) errorf(offset int, format string, args ...interface{}) {
+	if len(v.errors) >= MaxErrors {
+		return
+	}
+	v.errors = append(v.errors, &Error{gockl.Locate(v.input, offset), fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) top() *frame {
+	if len(v.stack) == 0 {
+		return nil
+	}
+	return v.stack[len(v.stack)-1]
+}
+
+func (v *validator) token(span gockl.Span) {
+	top := v.top()
+
+	switch span.Kind {
+	case gockl.TextKind, gockl.CDATAKind:
+		if top == nil || top.skip {
+			return
+		}
+		raw := span.Raw(v.input)
+		var text string
+		if span.Kind == gockl.TextKind {
+			text = gockl.Unescape(raw)
+		} else {
+			text = raw[len("<![CDATA[") : len(raw)-len("]]>")]
+		}
+		switch {
+		case top.nilled:
+			if text != "" {
+				v.errorf(span.Start, "nil element <%s> must be empty", top.name)
+				top.skip = true
+			}
+		case top.simple != nil:
+			top.text = append(top.text, text...)
+		case top.complex != nil && !top.complex.mixed && strings.Trim(text, " \t\r\n") != "":
+			v.errorf(span.Start, "character data not allowed in <%s>", top.name)
+		}
+	case gockl.StartElementKind, gockl.EmptyElementKind:
+		v.startElement(span.Token(v.input).(gockl.StartOrEmptyElementToken), span)
+		if span.Kind == gockl.EmptyElementKind {
+			v.endElement(span.End)
+		}
+	case gockl.EndElementKind:
+		v.endElement(span.Start)
+	}
+}
+
+// namespace looks up the namespace bound to prefix.
+func (v *validator) namespace(f *frame, prefix string) (string, bool) {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace", true
+	}
+	if ns, ok := f.namespaces[prefix]; ok {
+		return ns, true
+	}
+	for i := len(v.stack) - 1; i >= 0; i-- {
+		if ns, ok := v.stack[i].namespaces[prefix]; ok {
+			return ns, true
+		}
+	}
+	return "", prefix == ""
+}
+
+func (v *validator) qname(f *frame, name string, attribute bool) (qname, bool) {
+	prefix := ""
+	if idx := strings.IndexByte(name, ':'); idx > -1 {
+		prefix, name = name[:idx], name[idx+1:]
+	}
+	if attribute && prefix == "" {
+		return qname{"", name}, true
+	}
+	ns, ok := v.namespace(f, prefix)
+	return qname{ns, name}, ok
+}
+
+func (v *validator) startElement(t gockl.StartOrEmptyElementToken, span gockl.Span) {
+	parent := v.top()
+	f := &frame{name: t.Name(), offset: span.Start, namespaces: map[string]string{}}
+	attributes := t.AttributeSpans()
+	for _, a := range attributes {
+		if a.Name == "xmlns" {
+			f.namespaces[""] = gockl.Unescape(a.Content)
+		} else if strings.HasPrefix(a.Name, "xmlns:") {
+			f.namespaces[a.Name[len("xmlns:"):]] = gockl.Unescape(a.Content)
+		}
+	}
+	defer func() { v.stack = append(v.stack, f) }()
+
+	if parent != nil && parent.skip {
+		f.skip = true
+		return
+	}
+
+	name, ok := v.qname(f, f.name, false)
+	if !ok {
+		v.errorf(span.Start, "undeclared namespace prefix in <%s>", f.name)
+		f.skip = true
+		return
+	}
+
+	var decl *element
+	switch {
+	case parent == nil:
+		if v.root {
+			f.skip = true
+			return
+		}
+		v.root = true
+		if decl = v.s.elements[name]; decl == nil {
+			v.errorf(span.Start, "no declaration for document element <%s>%s", f.name, inNamespace(name.ns))
+			f.skip = true
+			return
+		}
+	case parent.nilled:
+		v.errorf(span.Start, "nil element <%s> must be empty", parent.name)
+		parent.skip, f.skip = true, true
+		return
+	case parent.simple != nil:
+		v.errorf(span.Start, "element <%s> not allowed in <%s>, which has simple content", f.name, parent.name)
+		f.skip = true
+		return
+	case parent.matcher == nil:
+		// the content of the parent is already invalid or lax
+		if decl = v.s.elements[name]; decl == nil {
+			if !parent.lax {
+				v.errorf(span.Start, "element <%s> not allowed in <%s>", f.name, parent.name)
+			}
+			f.skip = true
+			return
+		}
+	default:
+		p := parent.matcher.step(name)
+		if p == nil {
+			v.errorf(span.Start, "element <%s>%s not allowed in <%s> here, expected %s", f.name, inNamespace(name.ns), parent.name, describeExpected(parent.matcher, "</"+parent.name+">"))
+			// stop checking the content of the parent
+			parent.matcher = nil
+			parent.lax = true
+			f.skip = true
+			return
+		}
+		if p.kind == elementParticle {
+			decl = p.element
+			break
+		}
+		switch p.wildcard.processContents {
+		case "skip":
+			f.skip = true
+			return
+		case "lax":
+			if decl = v.s.elements[name]; decl == nil {
+				f.lax = true
+				f.skip = true
+				return
+			}
+		default:
+			if decl = v.s.elements[name]; decl == nil {
+				v.errorf(span.Start, "no declaration for element <%s>%s", f.name, inNamespace(name.ns))
+				f.skip = true
+				return
+			}
+		}
+	}
+
+	f.element = decl
+	switch typ := decl.typ.(type) {
+	case *simpleType:
+		f.simple = typ
+	case *complexType:
+		f.complex = typ
+		if typ.simple != nil {
+			f.simple = typ.simple
+		} else {
+			f.matcher = typ.matcher()
+		}
+		if typ == anyType {
+			f.lax = true
+		}
+	}
+
+	v.attributes(f, attributes, span.Start)
+}
+
+func inNamespace(ns string) string {
+	if ns == "" {
+		return ""
+	}
+	return " in namespace " + ns
+}
+
+func (v *validator) attributes(f *frame, attributes []gockl.AttributeSpan, offset int) {
+	seen := map[qname]bool{}
+
+	for _, a := range attributes {
+		if a.Name == "xmlns" || strings.HasPrefix(a.Name, "xmlns:") {
+			continue
+		}
+		q, ok := v.qname(f, a.Name, true)
+		if !ok {
+			v.errorf(offset+a.Start, "undeclared namespace prefix in attribute %s", a.Name)
+			continue
+		}
+		value := gockl.Unescape(a.Content)
+
+		if q.ns == xsiNamespace {
+			if q.local == "nil" && (value == "true" || value == "1") {
+				if !f.element.nillable {
+					v.errorf(offset+a.Start, "element <%s> is not nillable", f.name)
+					continue
+				}
+				f.nilled = true
+				f.matcher = nil
+			}
+			continue
+		}
+		seen[q] = true
+
+		var decl *attribute
+		if f.complex != nil {
+			decl = f.complex.attributes[q]
+		}
+		if decl == nil || decl.prohibited {
+			if f.complex == nil || f.complex.anyAttribute == nil || !f.complex.anyAttribute.allows(q.ns) {
+				v.errorf(offset+a.Start, "attribute %s not allowed on <%s>", a.Name, f.name)
+			}
+			continue
+		}
+
+		if msg := decl.typ.validate(value); msg != "" {
+			v.errorf(offset+a.ValueStart, "invalid value of attribute %s: %s", a.Name, msg)
+			continue
+		}
+		if decl.fixed != nil && !decl.typ.equal(value, *decl.fixed) {
+			v.errorf(offset+a.ValueStart, "attribute %s must have the fixed value %q", a.Name, *decl.fixed)
+		}
+	}
+
+	if f.complex == nil {
+		return
+	}
+	missing := []string{}
+	for q, decl := range f.complex.attributes {
+		if decl.required && !seen[q] {
+			missing = append(missing, q.local)
+		}
+	}
+	sort.Strings(missing)
+	for _, n := range missing {
+		v.errorf(offset, "required attribute %s missing on <%s>", n, f.name)
+	}
+}
+
+func (v *validator) endElement(offset int) {
+	f := v.top()
+	if f == nil {
+		return
+	}
+	v.stack = v.stack[:len(v.stack)-1]
+	if f.skip || f.nilled {
+		return
+	}
+
+	if f.simple != nil {
+		value := string(f.text)
+		if f.element.fixed != nil && !f.simple.equal(value, *f.element.fixed) {
+			v.errorf(f.offset, "element <%s> must have the fixed value %q", f.name, *f.element.fixed)
+			return
+		}
+		if msg := f.simple.validate(value); msg != "" {
+			v.errorf(f.offset, "invalid content of <%s>: %s", f.name, msg)
+		}
+		return
+	}
+
+	if f.matcher != nil && !f.matcher.accepts() {
+		v.errorf(offset, "content of <%s> is incomplete, expected %s", f.name, strings.Join(f.matcher.expected(), " or "))
+	}
+}
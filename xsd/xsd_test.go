@@ -0,0 +1,344 @@
+package xsd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/roblillack/gockl/dtd"
+)
+
+const orders = `<?xml version="1.0"?>
+<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"
+           xmlns:o="urn:orders" targetNamespace="urn:orders"
+           elementFormDefault="qualified">
+  <xs:element name="orders">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="order" type="o:order" maxOccurs="unbounded"/>
+        <xs:element ref="o:note" minOccurs="0"/>
+      </xs:sequence>
+      <xs:attribute name="version" type="xs:decimal" fixed="1.0"/>
+    </xs:complexType>
+  </xs:element>
+
+  <xs:element name="note" type="xs:string" nillable="true"/>
+
+  <xs:complexType name="order">
+    <xs:sequence>
+      <xs:choice>
+        <xs:element name="customer" type="xs:string"/>
+        <xs:element name="account" type="o:account"/>
+      </xs:choice>
+      <xs:element name="line" type="o:line" minOccurs="1" maxOccurs="3"/>
+      <xs:element name="extra" minOccurs="0">
+        <xs:complexType mixed="true">
+          <xs:sequence>
+            <xs:any namespace="##other" processContents="skip" minOccurs="0" maxOccurs="unbounded"/>
+          </xs:sequence>
+        </xs:complexType>
+      </xs:element>
+    </xs:sequence>
+    <xs:attribute name="id" type="o:id" use="required"/>
+    <xs:attribute name="status" default="new">
+      <xs:simpleType>
+        <xs:restriction base="xs:token">
+          <xs:enumeration value="new"/>
+          <xs:enumeration value="shipped"/>
+        </xs:restriction>
+      </xs:simpleType>
+    </xs:attribute>
+    <xs:anyAttribute namespace="urn:extensions" processContents="skip"/>
+  </xs:complexType>
+
+  <xs:complexType name="line">
+    <xs:all>
+      <xs:element name="sku" type="o:sku"/>
+      <xs:element name="quantity" type="xs:positiveInteger"/>
+      <xs:element name="price" type="o:price" minOccurs="0"/>
+    </xs:all>
+  </xs:complexType>
+
+  <xs:complexType name="price">
+    <xs:simpleContent>
+      <xs:extension base="o:amount">
+        <xs:attribute name="currency" type="o:currency" default="EUR"/>
+      </xs:extension>
+    </xs:simpleContent>
+  </xs:complexType>
+
+  <xs:simpleType name="amount">
+    <xs:restriction base="xs:decimal">
+      <xs:minExclusive value="0"/>
+      <xs:maxInclusive value="10000"/>
+      <xs:fractionDigits value="2"/>
+    </xs:restriction>
+  </xs:simpleType>
+
+  <xs:simpleType name="currency">
+    <xs:restriction base="xs:string">
+      <xs:length value="3"/>
+      <xs:pattern value="[A-Z]+"/>
+    </xs:restriction>
+  </xs:simpleType>
+
+  <xs:simpleType name="id">
+    <xs:restriction base="xs:string">
+      <xs:pattern value="\d{3}-\d{2}"/>
+      <xs:pattern value="X\d+"/>
+    </xs:restriction>
+  </xs:simpleType>
+
+  <xs:simpleType name="sku">
+    <xs:restriction base="xs:NMTOKEN">
+      <xs:minLength value="2"/>
+      <xs:maxLength value="8"/>
+    </xs:restriction>
+  </xs:simpleType>
+
+  <xs:complexType name="account">
+    <xs:complexContent>
+      <xs:extension base="o:base">
+        <xs:sequence>
+          <xs:element name="number" type="o:numbers"/>
+        </xs:sequence>
+      </xs:extension>
+    </xs:complexContent>
+  </xs:complexType>
+
+  <xs:complexType name="base">
+    <xs:sequence>
+      <xs:element name="name" type="xs:string"/>
+    </xs:sequence>
+    <xs:attribute name="vip" type="xs:boolean"/>
+  </xs:complexType>
+
+  <xs:simpleType name="numbers">
+    <xs:list itemType="xs:int"/>
+  </xs:simpleType>
+</xs:schema>
+`
+
+func TestParse(t *testing.T) {
+	if _, err := Parse(orders, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := func(body string) string {
+		return `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">` + "\n" + body + "\n</xs:schema>"
+	}
+	for input, expected := range map[string]string{
+		`<foo/>`: "xsd: 1:1: missing schema element",
+		schema(`<xs:element name="a" type="xs:foo"/>`):                                                                                          "xsd: 2:1: unknown type {http://www.w3.org/2001/XMLSchema}foo",
+		schema(`<xs:element name="a" type="b:foo"/>`):                                                                                           "xsd: 2:1: undeclared namespace prefix b",
+		schema(`<xs:element name="a"/><xs:element name="a"/>`):                                                                                  "xsd: 2:23: element a defined more than once",
+		schema(`<xs:element name="a"><xs:complexType><xs:sequence maxOccurs="x"/></xs:complexType></xs:element>`):                               "xsd: 2:38: invalid maxOccurs \"x\"",
+		schema(`<xs:simpleType name="a"><xs:restriction base="xs:string"><xs:pattern value="[a-z-[aeiou]]"/></xs:restriction></xs:simpleType>`): "xsd: 2:58: invalid pattern \"[a-z-[aeiou]]\": character class subtraction is not supported",
+		schema(`<xs:simpleType name="a"><xs:restriction base="a"/></xs:simpleType>`):                                                            "xsd: 2:1: circular definition of simple type a",
+		schema(`<xs:redefine schemaLocation="x.xsd"/>`):                                                                                         "xsd: 2:1: unsupported schema component redefine",
+		schema(`<xs:element name="a"><xs:complexType><xs:all maxOccurs="2"/></xs:complexType></xs:element>`):                                    "xsd: 2:38: maxOccurs of all must be 1",
+		schema(`<xs:include schemaLocation="other.xsd"/>`):                                                                                      "xsd: 2:1: no resolver to load other.xsd",
+	} {
+		_, err := Parse(input, nil)
+		if err == nil || err.Error() != expected {
+			t.Errorf("%s: expected error %s, got %v", input, expected, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse(orders, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for input, expected := range map[string][]string{
+		`<orders xmlns="urn:orders"><order id="123-45"><customer>ACME</customer><line><quantity>2</quantity><sku>ab-1</sku></line></order></orders>`: nil,
+		`<o:orders xmlns:o="urn:orders" version="1.00"><o:order id="X1" status=" shipped " xmlns:e="urn:extensions" e:flag="1">
+  <o:account vip="true"><o:name>ACME</o:name><o:number> 1 2  3 </o:number></o:account>
+  <o:line><o:sku>a1</o:sku><o:quantity>1</o:quantity><o:price currency="USD">9.99</o:price></o:line>
+  <o:extra>text <x:anything xmlns:x="urn:x"><unchecked/></x:anything></o:extra>
+</o:order><o:note xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:nil="true"/></o:orders>`: nil,
+		`<orders><order/></orders>`: {
+			"1:1: no declaration for document element <orders>",
+		},
+		`<orders xmlns="urn:orders" version="2"><note/></orders>`: {
+			"1:37: attribute version must have the fixed value \"1.0\"",
+			"1:40: element <note> in namespace urn:orders not allowed in <orders> here, expected <order>",
+		},
+		`<orders xmlns="urn:orders"><order id="12345" status="lost" foo="x"><line><sku>a</sku></line><customer/></order></orders>`: {
+			"1:39: invalid value of attribute id: \"12345\" does not match the required pattern",
+			"1:54: invalid value of attribute status: \"lost\" is not one of new, shipped",
+			"1:60: attribute foo not allowed on <order>",
+			"1:68: element <line> in namespace urn:orders not allowed in <order> here, expected <account> or <customer>",
+		},
+		`<orders xmlns="urn:orders"><order><customer>x</customer>text<line><sku>a</sku><sku>b</sku></line><line><quantity>0</quantity></line></order></orders>`: {
+			"1:28: required attribute id missing on <order>",
+			"1:57: character data not allowed in <order>",
+			"1:67: invalid content of <sku>: \"a\" is shorter than the minimum length of 2",
+			"1:79: element <sku> in namespace urn:orders not allowed in <line> here, expected <price> or <quantity>",
+			"1:104: invalid content of <quantity>: \"0\" is less than 1",
+			"1:126: content of <line> is incomplete, expected <price> or <sku>",
+		},
+		`<orders xmlns="urn:orders"><order id="X1"><customer>x</customer><line><sku>ab</sku><quantity>1</quantity><price currency="usd">0</price></line><line><sku>ab</sku><quantity>1</quantity><price>1.234</price></line></order></orders>`: {
+			"1:123: invalid value of attribute currency: \"usd\" does not match the required pattern",
+			"1:106: invalid content of <price>: \"0\" is less than or equal to 0",
+			"1:185: invalid content of <price>: \"1.234\" has more than 2 fraction digits",
+		},
+		`<orders xmlns="urn:orders"><order id="X1"><account><number>1 x</number><name/></account><line><sku>ab</sku><quantity>1</quantity></line><line><sku>ab</sku><quantity>1</quantity></line><line><sku>ab</sku><quantity>1</quantity></line><line/></order><note>x<b/></note></orders>`: {
+			"1:52: element <number> in namespace urn:orders not allowed in <account> here, expected <name>",
+			"1:233: element <line> in namespace urn:orders not allowed in <order> here, expected <extra> or </order>",
+			"1:255: element <b> not allowed in <note>, which has simple content",
+		},
+		`<orders xmlns="urn:orders" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><order id="X1" xsi:nil="true"><customer>x</customer></order><note xsi:nil="true">x</note></orders>`: {
+			"1:97: element <order> is not nillable",
+			"1:134: content of <order> is incomplete, expected <line>",
+			"1:163: nil element <note> must be empty",
+		},
+		`<orders xmlns="urn:orders"><order id="X1"><customer>x</customer><line><sku>ab</sku><quantity>1</quantity></line><extra><plain/></extra></order></orders>`: {
+			"1:120: element <plain> in namespace urn:orders not allowed in <extra> here, expected any element or </extra>",
+		},
+	} {
+		actual := []string{}
+		for _, e := range s.ValidateString(input) {
+			actual = append(actual, e.Error())
+		}
+		if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("%s: unexpected errors:\n%s", input, strings.Join(actual, "\n"))
+		}
+	}
+
+	if errs := s.ValidateString("<!-- nothing -->"); len(errs) != 1 || errs[0].Msg != "no document element" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+}
+
+func TestSimpleTypes(t *testing.T) {
+	for typ, values := range map[string]map[string]bool{
+		"boolean":            {"true": true, "0": true, "yes": false},
+		"int":                {"-2147483648": true, "2147483648": false, "+1": true, "1.0": false},
+		"unsignedByte":       {"255": true, "256": false, "-1": false},
+		"decimal":            {"-1.5": true, ".5": true, "1e3": false, "": false},
+		"double":             {"1e3": true, "INF": true, "NaN": true, "inf": false},
+		"date":               {"2024-02-29": true, "2024-13-01": false, "2024-01-01Z": true},
+		"dateTime":           {"2024-01-01T12:00:00+01:00": true, "2024-01-01 12:00:00": false},
+		"duration":           {"P1Y2M3DT4H": true, "P": false, "PT": false},
+		"hexBinary":          {"0aFF": true, "0": false},
+		"base64Binary":       {"aGVsbG8=": true, "a": false},
+		"anyURI":             {"http://example.com/ a": true},
+		"language":           {"en-US": true, "toolongsubtag": false},
+		"NCName":             {"a-b": true, "a:b": false, "1a": false},
+		"QName":              {"a:b": true, "a:b:c": false},
+		"NMTOKENS":           {"a b c": true, "": false},
+		"normalizedString":   {"a\tb": true},
+		"nonPositiveInteger": {"0": true, "1": false, "-0": true},
+	} {
+		st := builtins[typ]
+		for value, valid := range values {
+			if msg := st.validate(value); (msg == "") != valid {
+				t.Errorf("%s %q: expected valid=%v, got %q", typ, value, valid, msg)
+			}
+		}
+	}
+
+	s, err := Parse(`<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:element name="v">
+    <xs:simpleType>
+      <xs:union memberTypes="xs:int">
+        <xs:simpleType>
+          <xs:restriction base="xs:string">
+            <xs:enumeration value="none"/>
+          </xs:restriction>
+        </xs:simpleType>
+      </xs:union>
+    </xs:simpleType>
+  </xs:element>
+</xs:schema>`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for input, valid := range map[string]bool{"<v>1</v>": true, "<v> none </v>": false, "<v>none</v>": true, "<v>x</v>": false} {
+		if errs := s.ValidateString(input); (len(errs) == 0) != valid {
+			t.Errorf("%s: unexpected errors: %v", input, errs)
+		}
+	}
+}
+
+func TestDatatype(t *testing.T) {
+	d, err := NewDatatype("decimal", Param{"maxInclusive", "10"}, Param{"fractionDigits", "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for value, valid := range map[string]bool{"10": true, "10.0": true, "10.5": false, "1.25": false, " 2 ": true} {
+		if err := d.Validate(value); (err == nil) != valid {
+			t.Errorf("%q: expected valid=%v, got %v", value, valid, err)
+		}
+	}
+	if !d.Equal("1.50", "01.5") || d.Equal("1", "2") {
+		t.Error("Unexpected equality")
+	}
+
+	for _, params := range [][]Param{{{"maxInclusive", "x"}}, {{"foo", "1"}}} {
+		if _, err := NewDatatype("decimal", params...); err == nil {
+			t.Errorf("%v: expected error", params)
+		}
+	}
+	if _, err := NewDatatype("foo"); err == nil || err.Error() != "xsd: unknown datatype foo" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestResolver(t *testing.T) {
+	files := map[string]string{
+		"main.xsd": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:c="urn:common">
+  <xs:include schemaLocation="types/local.xsd"/>
+  <xs:import namespace="urn:common" schemaLocation="types/common.xsd"/>
+  <xs:element name="doc">
+    <xs:complexType>
+      <xs:sequence>
+        <xs:element name="title" type="short"/>
+        <xs:element ref="c:meta"/>
+      </xs:sequence>
+      <xs:attributeGroup ref="c:attrs"/>
+    </xs:complexType>
+  </xs:element>
+</xs:schema>`,
+		"types/local.xsd": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema">
+  <xs:simpleType name="short">
+    <xs:restriction base="xs:string"><xs:maxLength value="5"/></xs:restriction>
+  </xs:simpleType>
+</xs:schema>`,
+		"types/common.xsd": `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:common" attributeFormDefault="qualified">
+  <xs:element name="meta" type="xs:string"/>
+  <xs:attributeGroup name="attrs">
+    <xs:attribute name="lang" type="xs:language"/>
+  </xs:attributeGroup>
+</xs:schema>`,
+	}
+	requested := []string{}
+	r := dtd.ResolverFunc(func(publicID, systemID string) (string, error) {
+		requested = append(requested, publicID+" "+systemID)
+		if s, ok := files[systemID]; ok {
+			return s, nil
+		}
+		return "", fmt.Errorf("not found")
+	})
+
+	s, err := Parse(files["main.xsd"], r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(requested, ",") != " types/local.xsd,urn:common types/common.xsd" {
+		t.Errorf("Unexpected requests: %v", requested)
+	}
+
+	input := `<doc xmlns:c="urn:common" c:lang="en"><title>hello!</title><c:meta/></doc>`
+	if errs := s.ValidateString(input); len(errs) != 1 || errs[0].Error() != "1:39: invalid content of <title>: \"hello!\" is longer than the maximum length of 5" {
+		t.Errorf("Unexpected errors: %v", errs)
+	}
+
+	files["types/local.xsd"] = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema"><xs:include schemaLocation="missing.xsd"/></xs:schema>`
+	if _, err := Parse(files["main.xsd"], r); err == nil || err.Error() != "xsd: types/local.xsd:1:56: cannot load types/missing.xsd: not found" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}